@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"encoding/base64"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -125,6 +126,22 @@ func reload(s *server.Server) {
 		return
 	}
 
+	pwd, err := fetchPassword(globalConfig, s.Options.Environment)
+	if err != nil {
+		util.Warnf("Unable to reload config: %v", err)
+		return
+	}
+
+	next := *s.Options
+	next.Password = pwd
+	next.TLSCertFile = stringConfig(globalConfig, "faktory", "tls_cert", "")
+	next.TLSKeyFile = stringConfig(globalConfig, "faktory", "tls_key", "")
+	next.TLSCAFile = stringConfig(globalConfig, "faktory", "tls_ca", "")
+	if err := s.ApplyOptions(&next); err != nil {
+		util.Warnf("Unable to reload config: %v", err)
+		return
+	}
+
 	s.Options.GlobalConfig = globalConfig
 	s.Reload()
 }
@@ -150,6 +167,11 @@ func BuildServer(opts *CliOptions) (*server.Server, func(), error) {
 		return nil, nil, err
 	}
 
+	key, err := fetchEncryptionKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
 	sock := fmt.Sprintf("%s/redis.sock", opts.StorageDirectory)
 	stopper, err := storage.Boot(opts.StorageDirectory, sock)
 	if err != nil {
@@ -172,6 +194,18 @@ func BuildServer(opts *CliOptions) (*server.Server, func(), error) {
 		GlobalConfig:     globalConfig,
 		Password:         pwd,
 		PoolSize:         1000,
+		MaxConnsPerIP:    100,
+		TLSCertFile:      stringConfig(globalConfig, "faktory", "tls_cert", ""),
+		TLSKeyFile:       stringConfig(globalConfig, "faktory", "tls_key", ""),
+		TLSCAFile:        stringConfig(globalConfig, "faktory", "tls_ca", ""),
+		BackupDirectory:  stringConfig(globalConfig, "faktory", "backup_directory", ""),
+		MetricsBinding:   stringConfig(globalConfig, "faktory", "metrics_binding", ""),
+		HTTPBinding:      stringConfig(globalConfig, "faktory", "http_binding", ""),
+		WebSocketOrigins: stringsConfig(globalConfig, "faktory", "websocket_origins"),
+		AuthMode:         stringConfig(globalConfig, "faktory", "auth_mode", server.AuthPlain),
+		ClusterNodeID:    stringConfig(globalConfig, "faktory", "cluster_node_id", ""),
+		ClusterBindings:  stringsConfig(globalConfig, "faktory", "cluster_bindings"),
+		EncryptionKey:    key,
 	}
 
 	// don't log config hash until fetchPassword has had a chance to scrub the password value
@@ -199,6 +233,24 @@ func stringConfig(cfg map[string]interface{}, subsys string, elm string, defval
 	return defval
 }
 
+func stringsConfig(cfg map[string]interface{}, subsys string, elm string) []string {
+	var result []string
+	if mapp, ok := cfg[subsys]; ok {
+		if mappp, ok := mapp.(map[string]interface{}); ok {
+			if val, ok := mappp[elm]; ok {
+				if vals, ok := val.([]interface{}); ok {
+					for idx := range vals {
+						if sval, ok := vals[idx].(string); ok {
+							result = append(result, sval)
+						}
+					}
+				}
+			}
+		}
+	}
+	return result
+}
+
 // Read all config files in:
 //   /etc/faktory/conf.d/*.toml (in production)
 //   ~/.faktory/conf.d/*.toml (in development)
@@ -293,6 +345,20 @@ func fetchPassword(cfg map[string]interface{}, env string) (string, error) {
 	return password, nil
 }
 
+// The key is only read from ENV, base64-encoded, so it is never
+// committed to the config directory.
+func fetchEncryptionKey() ([]byte, error) {
+	val, ok := os.LookupEnv("FAKTORY_ENCRYPTION_KEY")
+	if !ok || val == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(val)
+	if err != nil {
+		return nil, fmt.Errorf("FAKTORY_ENCRYPTION_KEY must be base64-encoded: %w", err)
+	}
+	return key, nil
+}
+
 func skip() bool {
 	val, ok := os.LookupEnv("FAKTORY_SKIP_PASSWORD")
 	return ok && (val == "1" || val == "true" || val == "yes")
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/contribsys/faktory/internal/pool"
+	"github.com/contribsys/faktory/internal/scram"
 )
 
 const (
@@ -64,6 +65,9 @@ type ClientData struct {
 	Labels   []string `json:"labels"`
 	// Hash is hex(sha256(password + nonce))
 	PasswordHash string `json:"pwdhash"`
+	// Sent instead of PasswordHash if the server requires SCRAM.
+	ScramNonce string `json:"scram_nonce,omitempty"`
+	ScramProof string `json:"scram_proof,omitempty"`
 	// The protocol version used by this client.
 	// The server can reject this connection if the version will not work
 	// The server advertises its protocol version in the HI.
@@ -76,6 +80,8 @@ type Server struct {
 	Password string
 	Timeout  time.Duration
 	TLS      *tls.Config
+	// Sent in HELLO and BEAT, RandomProcessWid if empty.
+	Wid string
 }
 
 // OpenWithDialer creates a *Client with the dialer.
@@ -132,7 +138,7 @@ FOO_URL=tcp://:mypassword@faktory.example.com:7419`)
 }
 
 func DefaultServer() *Server {
-	return &Server{"tcp", "localhost:7419", "", 1 * time.Second, &tls.Config{}}
+	return &Server{"tcp", "localhost:7419", "", 1 * time.Second, &tls.Config{}, ""}
 }
 
 // Open connects to a Faktory server based on
@@ -192,9 +198,13 @@ func DialWithDialer(srv *Server, password string, dialer Dialer) (*Client, error
 // dial connects to the remote faktory server.
 func dial(srv *Server, password string, dialer Dialer) (*Client, error) {
 	client := emptyClientData()
+	if srv.Wid != "" {
+		client.Wid = srv.Wid
+	}
 
 	var err error
 	var conn net.Conn
+	var exchange *scramExchange
 
 	conn, err = dialer.Dial("tcp", srv.Address)
 	if err != nil {
@@ -241,7 +251,20 @@ func dial(srv *Server, password string, dialer Dialer) (*Client, error) {
 				iter = int(iterVal.(float64))
 			}
 
-			client.PasswordHash = hash(password, salt, iter)
+			if hi["a"] == "scram" {
+				serverNonce, _ := hi["r"].(string)
+				client.ScramNonce, err = scram.Nonce()
+				if err == nil {
+					exchange, err = newScramExchange(password, salt, iter, client.ScramNonce, serverNonce)
+				}
+				if err != nil {
+					conn.Close()
+					return nil, err
+				}
+				client.ScramProof = exchange.proof
+			} else {
+				client.PasswordHash = hash(password, salt, iter)
+			}
 		}
 	} else {
 		conn.Close()
@@ -258,10 +281,23 @@ func dial(srv *Server, password string, dialer Dialer) (*Client, error) {
 		return nil, err
 	}
 
-	err = ok(r)
-	if err != nil {
-		conn.Close()
-		return nil, err
+	if exchange != nil {
+		// the server proves it knows the password too
+		line, err := readString(r)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if !exchange.verify(line) {
+			conn.Close()
+			return nil, fmt.Errorf("Server failed SCRAM verification")
+		}
+	} else {
+		err = ok(r)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
 	}
 
 	return &Client{Options: client, Location: srv.Address, conn: conn, rdr: r, wtr: w}, nil
@@ -290,7 +326,23 @@ func (c *Client) Push(job *Job) error {
 	if err != nil {
 		return err
 	}
-	return c.ok(c.rdr)
+
+	// Newer servers respond with the job's JID, "OK <jid>"
+	val, err := c.readString(c.rdr)
+	if err != nil {
+		return err
+	}
+	if val == "OK" {
+		return nil
+	}
+	if !strings.HasPrefix(val, "OK ") {
+		c.markUnusable()
+		return fmt.Errorf("Invalid response: %s", val)
+	}
+	if job.Jid == "" {
+		job.Jid = val[3:]
+	}
+	return nil
 }
 
 func (c *Client) Fetch(q ...string) (*Job, error) {
@@ -427,8 +479,13 @@ func (c *Client) Beat(args ...string) (string, error) {
 	if len(args) > 0 {
 		state = args[0]
 	}
+	// the wid this connection sent in HELLO
+	wid := RandomProcessWid
+	if c.Options != nil {
+		wid = c.Options.Wid
+	}
 	hash := map[string]interface{}{}
-	hash["wid"] = RandomProcessWid
+	hash["wid"] = wid
 	hash["rss_kb"] = RssKb()
 
 	if state != "" {
@@ -562,6 +619,16 @@ func (pe *ProtocolError) Error() string {
 	return pe.msg
 }
 
+// Code returns the error code from an "ERR <code> <message>" response,
+// e.g. "ERR_JOB_NOT_FOUND", or "" if the response didn't include one.
+func (pe *ProtocolError) Code() string {
+	parts := strings.SplitN(pe.msg, " ", 3)
+	if len(parts) == 3 && parts[0] == "ERR" && strings.HasPrefix(parts[1], "ERR_") {
+		return parts[1]
+	}
+	return ""
+}
+
 func readResponse(rdr *bufio.Reader) ([]byte, error) {
 	chr, err := rdr.ReadByte()
 	if err != nil {
@@ -9,6 +9,7 @@ import (
 	"os/signal"
 	"runtime"
 	"runtime/debug"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -92,6 +93,14 @@ func TestClientOperations(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Contains(t, <-req, "PUSH")
 
+		pushed := NewJob("foo", 1, 2)
+		pushed.Jid = ""
+		resp <- "+OK abc123\r\n"
+		err = cl.Push(pushed)
+		assert.NoError(t, err)
+		assert.Contains(t, <-req, "PUSH")
+		assert.Equal(t, "abc123", pushed.Jid)
+
 		resp <- "+OK\r\n"
 		err = cl.Ack("123456")
 		assert.NoError(t, err)
@@ -169,3 +178,14 @@ func TestPasswordHashing(t *testing.T) {
 	result := hash(pwd, salt, iterations)
 	assert.Equal(t, "6d877f8e5544b1f2598768f817413ab8a357afffa924dedae99eb91472d4ec30", result)
 }
+
+func TestProtocolErrorCode(t *testing.T) {
+	rdr := bufio.NewReader(strings.NewReader("-ERR ERR_JOB_NOT_FOUND Job not found 123456789\r\n"))
+	_, err := readResponse(rdr)
+	perr, ok := err.(*ProtocolError)
+	assert.True(t, ok)
+	assert.Equal(t, "ERR_JOB_NOT_FOUND", perr.Code())
+
+	assert.Equal(t, "", (&ProtocolError{msg: "ERR something broke"}).Code())
+	assert.Equal(t, "", (&ProtocolError{msg: "DENIED push denied"}).Code())
+}
@@ -35,10 +35,22 @@ type Job struct {
 	EnqueuedAt string                 `json:"enqueued_at,omitempty"`
 	At         string                 `json:"at,omitempty"`
 	ReserveFor int                    `json:"reserve_for,omitempty"`
+	Priority   int                    `json:"priority,omitempty"`
+	UniqueFor  int                    `json:"unique_for,omitempty"`
+	ExpiresAt  string                 `json:"expires_at,omitempty"`
+	Labels     []string               `json:"labels,omitempty"`
+	Tags       []string               `json:"tags,omitempty"`
+	DependsOn  []string               `json:"depends_on,omitempty"`
+	HashKey    string                 `json:"hash_key,omitempty"`
+	ArgsUrl    string                 `json:"args_url,omitempty"`
+	BaseJid    string                 `json:"base_jid,omitempty"`
 	Retry      int                    `json:"retry"`
+	Jitter     *int                   `json:"jitter,omitempty"`
 	Backtrace  int                    `json:"backtrace,omitempty"`
 	Failure    *Failure               `json:"failure,omitempty"`
 	Custom     map[string]interface{} `json:"custom,omitempty"`
+	// set by ANNOTATE while the job is being worked
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 // Clients should use this constructor to build a Job, not allocate
@@ -86,6 +98,13 @@ func (j *Job) SetCustom(name string, value interface{}) *Job {
 	return j
 }
 
+// Delay this job's retries by up to +secs+ extra seconds instead of
+// the server's jitter_seconds, 0 retries it without jitter.
+func (j *Job) SetJitter(secs int) *Job {
+	j.Jitter = &secs
+	return j
+}
+
 ////////////////////////////////////////////
 // Faktory Pro helpers
 //
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+
+	"github.com/contribsys/faktory/internal/scram"
+)
+
+// SCRAM-SHA-256 (RFC 5802) authentication, used when the server's HI
+// advertises "a":"scram".  The client proves it knows the password and
+// verifies the server's signature in the response to HELLO.
+type scramExchange struct {
+	proof     string
+	signature string
+}
+
+func newScramExchange(password, salt string, iterations int, clientNonce, serverNonce string) (*scramExchange, error) {
+	rawSalt, err := base64.StdEncoding.DecodeString(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	clientKey, storedKey, serverKey := scram.Keys(password, rawSalt, iterations)
+	authMessage := scram.AuthMessage(clientNonce, serverNonce, salt, iterations)
+
+	proof := scram.HMAC(storedKey, authMessage)
+	for idx := range proof {
+		proof[idx] ^= clientKey[idx]
+	}
+
+	return &scramExchange{
+		proof:     base64.StdEncoding.EncodeToString(proof),
+		signature: base64.StdEncoding.EncodeToString(scram.HMAC(serverKey, authMessage)),
+	}, nil
+}
+
+// The server responds "OK v=<signature>" if it accepted our proof.
+func (se *scramExchange) verify(response string) bool {
+	return hmac.Equal([]byte(response), []byte("OK v="+se.signature))
+}
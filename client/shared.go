@@ -0,0 +1,183 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	reconnectAttempts = 8
+	reconnectMinDelay = 100 * time.Millisecond
+	reconnectMaxDelay = 10 * time.Second
+)
+
+var ErrClientClosed = errors.New("client is closed")
+
+// SharedClient is a Client which may be used from several goroutines
+// at once.  Calls are serialized over a single connection so a Pop
+// blocks the other goroutines until it returns; use a Pool if that's
+// a problem.
+//
+// If the connection fails, SharedClient reconnects with exponential
+// backoff and sends the command again, so a Push may enqueue the job
+// twice if the connection failed after the server received it.
+type SharedClient struct {
+	mu     sync.Mutex
+	dial   func() (*Client, error)
+	client *Client
+	closed bool
+}
+
+// DialShared connects to the server at +addr+, e.g. "localhost:7419".
+func DialShared(addr, password string) (*SharedClient, error) {
+	srv := DefaultServer()
+	srv.Address = addr
+	return newSharedClient(func() (*Client, error) { return Dial(srv, password) })
+}
+
+// OpenShared connects following the same conventions as Open.
+func OpenShared() (*SharedClient, error) {
+	return newSharedClient(Open)
+}
+
+// OpenShared connects to the server, e.g. with its Wid set.
+func (s *Server) OpenShared() (*SharedClient, error) {
+	return newSharedClient(s.Open)
+}
+
+func newSharedClient(dial func() (*Client, error)) (*SharedClient, error) {
+	cl, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	return &SharedClient{dial: dial, client: cl}, nil
+}
+
+func (sc *SharedClient) Push(job *Job) error {
+	return sc.do(func(cl *Client) error {
+		return cl.Push(job)
+	})
+}
+
+// Pop fetches a job from the first of the queues which has one,
+// nil if there are none.
+func (sc *SharedClient) Pop(queues ...string) (*Job, error) {
+	var job *Job
+	err := sc.do(func(cl *Client) error {
+		var err error
+		job, err = cl.Fetch(queues...)
+		return err
+	})
+	return job, err
+}
+
+func (sc *SharedClient) Ack(jid string) error {
+	return sc.do(func(cl *Client) error {
+		return cl.Ack(jid)
+	})
+}
+
+// Fail notifies Faktory that a job failed with the given error, see
+// Client.Fail.
+func (sc *SharedClient) Fail(jid string, err error, backtrace []byte) error {
+	return sc.do(func(cl *Client) error {
+		return cl.Fail(jid, err, backtrace)
+	})
+}
+
+// Heartbeat sends BEAT for this process, see Client.Beat.  Returns
+// "quiet" or "terminate" if the worker should stop fetching jobs.
+func (sc *SharedClient) Heartbeat() (string, error) {
+	var reply string
+	err := sc.do(func(cl *Client) error {
+		var err error
+		reply, err = cl.Beat()
+		return err
+	})
+	if err != nil || reply == "" {
+		return "", err
+	}
+
+	var hash map[string]string
+	if err := json.Unmarshal([]byte(reply), &hash); err != nil {
+		return "", fmt.Errorf("Invalid BEAT response: %s", reply)
+	}
+	return hash["state"], nil
+}
+
+func (sc *SharedClient) Close() error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.closed {
+		return nil
+	}
+	sc.closed = true
+	if sc.client == nil {
+		return nil
+	}
+	return sc.client.Close()
+}
+
+// Call fn with the connected client.  If the connection fails, reconnect
+// and call it once more.
+func (sc *SharedClient) do(fn func(*Client) error) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.closed {
+		return ErrClientClosed
+	}
+
+	if sc.client == nil {
+		if err := sc.reconnect(); err != nil {
+			return err
+		}
+	}
+	err := fn(sc.client)
+	if !connectionFailed(err) {
+		return err
+	}
+
+	sc.client.conn.Close()
+	sc.client = nil
+	if err := sc.reconnect(); err != nil {
+		return err
+	}
+	return fn(sc.client)
+}
+
+func (sc *SharedClient) reconnect() error {
+	delay := reconnectMinDelay
+	var err error
+	for attempt := 0; attempt < reconnectAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+			if delay > reconnectMaxDelay {
+				delay = reconnectMaxDelay
+			}
+		}
+		var cl *Client
+		cl, err = sc.dial()
+		if err == nil {
+			sc.client = cl
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot reconnect after %d attempts: %w", reconnectAttempts, err)
+}
+
+// Errors from the server, e.g. an unknown JID, leave the connection
+// usable.
+func connectionFailed(err error) bool {
+	if err == nil {
+		return false
+	}
+	var ne net.Error
+	return errors.As(err, &ne) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.ErrClosedPipe)
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A client connected to a goroutine which answers each command with
+// +OK, or hangs up after +replies+ commands.
+func pipeClient(replies int) *Client {
+	cli, srv := net.Pipe()
+	go func() {
+		defer srv.Close()
+		rdr := bufio.NewReader(srv)
+		for count := 0; replies < 0 || count < replies; count++ {
+			if _, err := rdr.ReadString('\n'); err != nil {
+				return
+			}
+			_, _ = srv.Write([]byte("+OK\r\n"))
+		}
+	}()
+	return &Client{conn: cli, rdr: bufio.NewReader(cli), wtr: bufio.NewWriter(cli)}
+}
+
+func TestSharedClientReconnects(t *testing.T) {
+	t.Parallel()
+
+	dials := 0
+	sc, err := newSharedClient(func() (*Client, error) {
+		dials++
+		switch dials {
+		case 1:
+			return pipeClient(1), nil
+		case 2:
+			return nil, fmt.Errorf("connection refused")
+		}
+		return pipeClient(-1), nil
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, sc.Ack("123456789"))
+	// the first connection hangs up, the second dial fails
+	assert.NoError(t, sc.Ack("123456789"))
+	assert.Equal(t, 3, dials)
+
+	var wg sync.WaitGroup
+	for idx := 0; idx < 10; idx++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, sc.Push(NewJob("SomeJob", 1)))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 3, dials)
+
+	assert.NoError(t, sc.Close())
+	assert.True(t, errors.Is(sc.Ack("123456789"), ErrClientClosed))
+}
+
+func TestSharedClientHeartbeat(t *testing.T) {
+	t.Parallel()
+
+	replies := []string{"+OK\r\n", "$17\r\n{\"state\":\"quiet\"}\r\n"}
+	cli, srv := net.Pipe()
+	go func() {
+		defer srv.Close()
+		rdr := bufio.NewReader(srv)
+		for _, reply := range replies {
+			if _, err := rdr.ReadString('\n'); err != nil {
+				return
+			}
+			_, _ = srv.Write([]byte(reply))
+		}
+	}()
+	sc, err := newSharedClient(func() (*Client, error) {
+		return &Client{conn: cli, rdr: bufio.NewReader(cli), wtr: bufio.NewWriter(cli)}, nil
+	})
+	assert.NoError(t, err)
+
+	state, err := sc.Heartbeat()
+	assert.NoError(t, err)
+	assert.Equal(t, "", state)
+	state, err = sc.Heartbeat()
+	assert.NoError(t, err)
+	assert.Equal(t, "quiet", state)
+}
+
+func TestConnectionFailed(t *testing.T) {
+	t.Parallel()
+
+	assert.False(t, connectionFailed(nil))
+	assert.False(t, connectionFailed(&ProtocolError{msg: "ERR_JOB_NOT_FOUND Job not found"}))
+	assert.True(t, connectionFailed(&net.OpError{Op: "write", Err: errors.New("broken pipe")}))
+}
@@ -0,0 +1,515 @@
+// Package cluster spreads queues across several Faktory servers.
+//
+// Every member has a node id, ServerOptions.ClusterNodeID, and lists
+// some of the others, its seeds, as "<node id>=<host:port>" in
+// ServerOptions.ClusterBindings.  A member's own entry gives the address
+// the others should dial it at, ServerOptions.Binding if it's missing.
+// Queue names are assigned to node ids with consistent hashing and the
+// jobs a member receives, from PUSH or MPUSH, are forwarded to their
+// queue's owner with FORWARD, so producers may connect to any member.
+// FETCH only reads the local queues: workers must connect to the members
+// which own their queues.
+//
+// A batch belongs to the owner of its bid, which the member receiving
+// BATCH NEW picks, and BATCH commands and the batch's jobs are sent
+// there whatever their queue, so the workers for those queues must
+// connect to every member.
+//
+// Members discover each other by gossip: every gossipInterval a member
+// sends the members it knows of, with a heartbeat counter for each, to
+// a random member or seed with GOSSIP and merges the list in the
+// response.  Each member increments its own heartbeat every round, so
+// a member is alive while its heartbeat keeps increasing.  A member
+// joins the hash ring when another hears of it and leaves when its
+// heartbeat hasn't increased for memberTimeout, its queues move to the
+// remaining members.  Before that a job whose owner can't be reached is
+// rejected with ERR_UNAVAILABLE rather than pushed to another member,
+// where no worker may fetch it, and the member isn't dialed again for
+// peerRetryInterval.  All members must use the same password and queue
+// routes.
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/internal/hashring"
+	"github.com/contribsys/faktory/manager"
+	"github.com/contribsys/faktory/server"
+	"github.com/contribsys/faktory/util"
+)
+
+const (
+	peerDialTimeout   = 5 * time.Second
+	peerRetryInterval = 10 * time.Second
+	gossipInterval    = 1 * time.Second
+	memberTimeout     = 30 * time.Second
+	// how long a member which left is remembered, so the stale
+	// heartbeats other members still gossip don't bring it back
+	tombstoneTTL = 10 * memberTimeout
+)
+
+type ClusterNode struct {
+	Server *server.Server
+
+	self string
+	// the bindings, gossiped to even when they've left
+	seeds map[string]string
+
+	mu      sync.Mutex
+	members map[string]*member
+	ring    *hashring.Ring
+	peers   map[string]*peer
+	// when each unreachable peer last failed
+	down map[string]time.Time
+}
+
+// A member as gossiped, a higher Heartbeat is newer.
+type member struct {
+	Address   string `json:"address"`
+	Heartbeat uint64 `json:"heartbeat"`
+
+	// when Heartbeat last increased
+	updated time.Time
+	left    bool
+}
+
+// A connection to another member, the commands forwarded to it are
+// serialized through it.  Forwarded commands are never forwarded
+// again, so a member never waits on a peer which is waiting on it.
+type peer struct {
+	id      string
+	address string
+	mu      sync.Mutex
+	conn    *client.Client
+	closed  bool
+}
+
+func Subsystem() *ClusterNode {
+	return &ClusterNode{}
+}
+
+func (cn *ClusterNode) Name() string {
+	return "Cluster"
+}
+
+func (cn *ClusterNode) Start(s *server.Server) error {
+	if len(s.Options.ClusterBindings) == 0 {
+		return nil
+	}
+	if s.Options.ClusterNodeID == "" {
+		return fmt.Errorf("cluster_node_id is required with cluster_bindings")
+	}
+	seeds, err := parseBindings(s.Options.ClusterBindings)
+	if err != nil {
+		return err
+	}
+
+	cn.Server = s
+	cn.init(s.Options.ClusterNodeID, s.Options.Binding, seeds)
+	s.SetForwarder(cn.forwardJobs)
+	s.SetGossiper(cn.merge)
+	s.Use(cn.routeBatch)
+
+	go cn.gossipLoop(s.Stopper())
+	return nil
+}
+
+// The seeds start as members, so jobs are routed as they will be once
+// the cluster has gossiped, and leave if they don't answer.
+func (cn *ClusterNode) init(self string, address string, seeds map[string]string) {
+	if addr, ok := seeds[self]; ok {
+		address = addr
+		delete(seeds, self)
+	}
+	cn.self = self
+	cn.seeds = seeds
+	cn.down = map[string]time.Time{}
+	cn.peers = map[string]*peer{}
+	now := time.Now()
+	// a restarted member's heartbeats must be newer than the ones
+	// gossiped before it stopped
+	cn.members = map[string]*member{
+		self: {Address: address, Heartbeat: uint64(now.UnixNano()), updated: now},
+	}
+	for id, addr := range seeds {
+		cn.members[id] = &member{Address: addr, updated: now}
+		cn.peers[id] = &peer{id: id, address: addr}
+	}
+	cn.rebuild()
+}
+
+// "<node id>=<host:port>" for each seed.
+func parseBindings(bindings []string) (map[string]string, error) {
+	seeds := map[string]string{}
+	for _, binding := range bindings {
+		parts := strings.SplitN(binding, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("Invalid cluster binding %q, expected <node id>=<host:port>", binding)
+		}
+		if existing, ok := seeds[parts[0]]; ok && existing != parts[1] {
+			return nil, fmt.Errorf("Cluster node %s is listed with two addresses", parts[0])
+		}
+		seeds[parts[0]] = parts[1]
+	}
+	return seeds, nil
+}
+
+// The seeds are only read at startup, the members gossip.
+func (cn *ClusterNode) Reload(s *server.Server) error {
+	return nil
+}
+
+// The node id of the member which owns the queue or bid.
+func (cn *ClusterNode) Owner(key string) string {
+	if key == "" {
+		key = "default"
+	}
+	cn.mu.Lock()
+	ring := cn.ring
+	cn.mu.Unlock()
+	return ring.Owner(key, func(string) bool { return true })
+}
+
+// Members returns the node ids in the hash ring, this member's
+// included.
+func (cn *ClusterNode) Members() []string {
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+	return cn.ring.Members()
+}
+
+// Call with cn.mu held.
+func (cn *ClusterNode) rebuild() {
+	ids := []string{cn.self}
+	for id, m := range cn.members {
+		if id != cn.self && !m.left {
+			ids = append(ids, id)
+		}
+	}
+	cn.ring = hashring.New(ids)
+}
+
+func (cn *ClusterNode) gossipLoop(stopper chan bool) {
+	ticker := time.NewTicker(gossipInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopper:
+			cn.close()
+			return
+		case <-ticker.C:
+			cn.gossip(time.Now())
+		}
+	}
+}
+
+// One round: expire the silent members and exchange member lists with
+// a random member or seed.
+func (cn *ClusterNode) gossip(now time.Time) {
+	cn.mu.Lock()
+	cn.members[cn.self].Heartbeat++
+	cn.members[cn.self].updated = now
+	stale := cn.expire(now)
+	var targets []*peer
+	for id, p := range cn.peers {
+		if _, seed := cn.seeds[id]; seed || !cn.members[id].left {
+			targets = append(targets, p)
+		}
+	}
+	cn.mu.Unlock()
+	closePeers(stale)
+	if len(targets) == 0 {
+		return
+	}
+
+	p := targets[rand.Intn(len(targets))]
+	reply, err := p.send(cn.Server, "GOSSIP "+cn.memberList())
+	if err != nil {
+		util.Debugf("Unable to gossip with cluster node %s: %v", p.id, err)
+		return
+	}
+	if _, err := cn.merge(reply); err != nil {
+		util.Warnf("Invalid gossip from cluster node %s: %v", p.id, err)
+	}
+}
+
+// Mark the members whose heartbeat hasn't increased for memberTimeout
+// as left and forget the ones which left long ago.  Returns the peers
+// to close, call with cn.mu held.
+func (cn *ClusterNode) expire(now time.Time) []*peer {
+	var stale []*peer
+	changed := false
+	for id, m := range cn.members {
+		if id == cn.self {
+			continue
+		}
+		if !m.left && now.Sub(m.updated) > memberTimeout {
+			util.Infof("Cluster node %s left", id)
+			m.left = true
+			changed = true
+			if _, seed := cn.seeds[id]; !seed {
+				stale = append(stale, cn.peers[id])
+				delete(cn.peers, id)
+			}
+		}
+		if _, seed := cn.seeds[id]; m.left && !seed && now.Sub(m.updated) > tombstoneTTL {
+			delete(cn.members, id)
+		}
+	}
+	if changed {
+		cn.rebuild()
+	}
+	return stale
+}
+
+// The members which haven't left as JSON.
+func (cn *ClusterNode) memberList() string {
+	cn.mu.Lock()
+	list := map[string]*member{}
+	for id, m := range cn.members {
+		if !m.left {
+			list[id] = m
+		}
+	}
+	// addresses and counters always marshal
+	data, _ := json.Marshal(list)
+	cn.mu.Unlock()
+	return string(data)
+}
+
+// Merge another member's list into this member's and return this
+// member's, the Gossiper for GOSSIP.
+func (cn *ClusterNode) merge(data string) (string, error) {
+	var list map[string]*member
+	if err := json.Unmarshal([]byte(data), &list); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	var stale []*peer
+	changed := false
+	cn.mu.Lock()
+	for id, m := range list {
+		if id == cn.self || m == nil || m.Address == "" {
+			continue
+		}
+		known, ok := cn.members[id]
+		if ok && m.Heartbeat <= known.Heartbeat {
+			continue
+		}
+		if !ok || known.left {
+			util.Infof("Cluster node %s joined at %s", id, m.Address)
+			changed = true
+		}
+		cn.members[id] = &member{Address: m.Address, Heartbeat: m.Heartbeat, updated: now}
+		if p, ok := cn.peers[id]; !ok || p.address != m.Address {
+			if ok {
+				stale = append(stale, p)
+			}
+			cn.peers[id] = &peer{id: id, address: m.Address}
+		}
+	}
+	if changed {
+		cn.rebuild()
+	}
+	cn.mu.Unlock()
+
+	// a peer may be busy forwarding, don't wait for it with cn.mu held
+	closePeers(stale)
+	return cn.memberList(), nil
+}
+
+// A batch's jobs go with the batch.
+func (cn *ClusterNode) jobOwner(job *client.Job) string {
+	if val, ok := job.GetCustom("bid"); ok {
+		if bid, _ := val.(string); bid != "" {
+			return cn.Owner(bid)
+		}
+	}
+	return cn.Owner(job.Queue)
+}
+
+func (cn *ClusterNode) forwardJobs(jobs []*client.Job) ([]*client.Job, error) {
+	var local []*client.Job
+	remote := map[string][]*client.Job{}
+	for _, job := range jobs {
+		owner := cn.jobOwner(job)
+		if owner == cn.self {
+			local = append(local, job)
+		} else {
+			remote[owner] = append(remote[owner], job)
+		}
+	}
+
+	// a member which fails leaves the groups already sent pushed, as
+	// MPUSH does with a job it rejects
+	for owner, group := range remote {
+		data, err := json.Marshal(group)
+		if err != nil {
+			return nil, err
+		}
+		_, err = cn.send(owner, "MPUSH "+string(data))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return local, nil
+}
+
+// BATCH NEW picks the batch's bid and creates it on the bid's owner,
+// the other BATCH commands go to the owner of their bid.
+func (cn *ClusterNode) routeBatch(c *server.Connection, s *server.Server, cmd string, next func()) {
+	if !strings.HasPrefix(cmd, "BATCH ") || c.Forwarded() {
+		next()
+		return
+	}
+	parts := strings.SplitN(cmd, " ", 3)
+	if len(parts) != 3 {
+		next()
+		return
+	}
+
+	if parts[1] == "NEW" {
+		var def client.Batch
+		if err := json.Unmarshal([]byte(parts[2]), &def); err != nil || def.Bid != "" {
+			// let BATCH report the error
+			next()
+			return
+		}
+		def.Bid = "b-" + util.RandomJid()
+		data, err := json.Marshal(&def)
+		if err != nil {
+			_ = c.Error(cmd, server.ErrCodeInternal, err)
+			return
+		}
+		cmd = "BATCH NEW " + string(data)
+		if cn.Owner(def.Bid) == cn.self {
+			s.Forward(c, cmd)
+			return
+		}
+		cn.relay(c, cmd, cn.Owner(def.Bid))
+		return
+	}
+
+	owner := cn.Owner(parts[2])
+	if owner == cn.self {
+		next()
+		return
+	}
+	cn.relay(c, cmd, owner)
+}
+
+// Forward the command and pass the owner's response to the client.
+func (cn *ClusterNode) relay(c *server.Connection, cmd string, owner string) {
+	reply, err := cn.send(owner, cmd)
+	if err != nil {
+		_ = c.Error(cmd, server.ErrCodeUnavailable, err)
+		return
+	}
+	if reply == "OK" {
+		_ = c.Ok()
+		return
+	}
+	_ = c.Result([]byte(reply))
+}
+
+// Send "FORWARD <cmd>" to the member and return its response.  A
+// rejected command returns the member's error as a
+// manager.KnownError, an unreachable member server.ErrUnavailable.
+func (cn *ClusterNode) send(owner string, cmd string) (string, error) {
+	cn.mu.Lock()
+	downAt, down := cn.down[owner]
+	p := cn.peers[owner]
+	cn.mu.Unlock()
+	if down && time.Since(downAt) < peerRetryInterval {
+		return "", fmt.Errorf("%w: node %s failed %s ago", server.ErrUnavailable, owner, time.Since(downAt).Round(time.Second))
+	}
+	if p == nil {
+		return "", fmt.Errorf("%w: node %s left", server.ErrUnavailable, owner)
+	}
+
+	reply, err := p.send(cn.Server, "FORWARD "+cmd)
+	if pe, ok := err.(*client.ProtocolError); ok {
+		// relay the owner's error as-is
+		parts := strings.SplitN(pe.Error(), " ", 2)
+		if len(parts) == 1 {
+			parts = append(parts, "")
+		}
+		return "", manager.ExpectedError(parts[0], parts[1])
+	}
+
+	cn.mu.Lock()
+	if err != nil {
+		cn.down[owner] = time.Now()
+	} else {
+		delete(cn.down, owner)
+	}
+	cn.mu.Unlock()
+	if err != nil {
+		util.Warnf("Unable to forward to cluster node %s: %v", owner, err)
+		return "", fmt.Errorf("%w: node %s: %v", server.ErrUnavailable, owner, err)
+	}
+	return reply, nil
+}
+
+// The error is a *client.ProtocolError if the peer rejected the
+// command, any other error means the peer is unreachable.
+func (p *peer) send(s *server.Server, cmd string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return "", fmt.Errorf("%s: connection closed", p.address)
+	}
+	if p.conn == nil {
+		srv := &client.Server{Network: "tcp", Address: p.address, Timeout: peerDialTimeout}
+		conn, err := client.Dial(srv, s.Options.Password)
+		if err != nil {
+			return "", err
+		}
+		p.conn = conn
+	}
+
+	reply, err := p.conn.Generic(cmd)
+	if err != nil {
+		if _, ok := err.(*client.ProtocolError); ok {
+			return "", err
+		}
+		_ = p.conn.Close()
+		p.conn = nil
+		return "", fmt.Errorf("%s: %w", p.address, err)
+	}
+	return reply, nil
+}
+
+func (p *peer) close() {
+	p.mu.Lock()
+	if p.conn != nil {
+		_ = p.conn.Close()
+		p.conn = nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+}
+
+func closePeers(peers []*peer) {
+	for _, p := range peers {
+		p.close()
+	}
+}
+
+func (cn *ClusterNode) close() {
+	cn.mu.Lock()
+	var peers []*peer
+	for _, p := range cn.peers {
+		peers = append(peers, p)
+	}
+	cn.mu.Unlock()
+	closePeers(peers)
+}
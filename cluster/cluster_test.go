@@ -0,0 +1,109 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOwner(t *testing.T) {
+	t.Parallel()
+
+	cn := &ClusterNode{}
+	cn.init("a", "localhost:7419", map[string]string{"b": "localhost:7420"})
+
+	var remote string
+	for idx := 0; remote == ""; idx++ {
+		queue := fmt.Sprintf("queue-%d", idx)
+		if cn.Owner(queue) == "b" {
+			remote = queue
+		}
+	}
+
+	// an unreachable owner keeps its queues
+	cn.down["b"] = time.Now()
+	assert.Equal(t, "b", cn.Owner(remote))
+	_, err := cn.send("b", "PUSH {}")
+	assert.True(t, errors.Is(err, server.ErrUnavailable))
+
+	assert.Equal(t, cn.Owner("default"), cn.Owner(""))
+
+	job := client.NewJob("Report", 1)
+	job.Queue = remote
+	assert.Equal(t, "b", cn.jobOwner(job))
+	job.SetCustom("bid", "b-xyz")
+	assert.Equal(t, cn.Owner("b-xyz"), cn.jobOwner(job))
+}
+
+func TestParseBindings(t *testing.T) {
+	t.Parallel()
+
+	seeds, err := parseBindings([]string{"a=:7419", "b=10.0.0.2:7419", "c=10.0.0.3:7419"})
+	assert.NoError(t, err)
+	assert.Len(t, seeds, 3)
+	assert.Equal(t, "10.0.0.2:7419", seeds["b"])
+
+	cn := &ClusterNode{}
+	cn.init("a", "localhost:7419", seeds)
+	assert.Equal(t, ":7419", cn.members["a"].Address)
+	assert.Len(t, cn.seeds, 2)
+
+	_, err = parseBindings([]string{"10.0.0.2:7419"})
+	assert.Error(t, err)
+	_, err = parseBindings([]string{"b=10.0.0.2:7419", "b=10.0.0.3:7419"})
+	assert.Error(t, err)
+}
+
+func TestGossip(t *testing.T) {
+	t.Parallel()
+
+	a := &ClusterNode{}
+	a.init("a", "10.0.0.1:7419", map[string]string{})
+	b := &ClusterNode{}
+	b.init("b", "10.0.0.2:7419", map[string]string{"a": "10.0.0.1:7419"})
+	c := &ClusterNode{}
+	c.init("c", "10.0.0.3:7419", map[string]string{"a": "10.0.0.1:7419"})
+
+	// a hears of b and c, c learns of b from a
+	_, err := a.merge(b.memberList())
+	assert.NoError(t, err)
+	reply, err := a.merge(c.memberList())
+	assert.NoError(t, err)
+	_, err = c.merge(reply)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, a.Members())
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, c.Members())
+	assert.Equal(t, "10.0.0.2:7419", c.peers["b"].address)
+
+	_, err = a.merge("{")
+	assert.Error(t, err)
+
+	// b stops gossiping
+	stale := a.memberList()
+	c.mu.Lock()
+	c.members["a"].updated = time.Now().Add(memberTimeout)
+	left := c.expire(time.Now().Add(memberTimeout + time.Second))
+	c.mu.Unlock()
+	assert.Len(t, left, 1)
+	assert.Equal(t, "b", left[0].id)
+	closePeers(left)
+	assert.ElementsMatch(t, []string{"a", "c"}, c.Members())
+	_, err = c.send("b", "PUSH {}")
+	assert.True(t, errors.Is(err, server.ErrUnavailable))
+
+	// its old heartbeat doesn't bring it back, a new one does
+	_, err = c.merge(stale)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a", "c"}, c.Members())
+	b.mu.Lock()
+	b.members["b"].Heartbeat++
+	b.mu.Unlock()
+	_, err = c.merge(b.memberList())
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, c.Members())
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/contribsys/faktory/cli"
 	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/cluster"
 	"github.com/contribsys/faktory/util"
 	"github.com/contribsys/faktory/webui"
 )
@@ -42,6 +43,7 @@ func main() {
 	}
 
 	s.Register(webui.Subsystem(opts.WebBinding))
+	s.Register(cluster.Subsystem())
 
 	go cli.HandleSignals(s)
 	go func() {
@@ -0,0 +1,85 @@
+// Package hashring assigns keys to members with consistent hashing,
+// so only ~1/N of the keys move when a member joins or leaves.
+package hashring
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+	"strconv"
+)
+
+// Each member is placed on the ring this many times so keys are
+// spread evenly.
+const virtualNodes = 100
+
+type Ring struct {
+	hashes  []uint32
+	members map[uint32]string
+	names   []string
+}
+
+func New(members []string) *Ring {
+	r := &Ring{members: map[uint32]string{}}
+	for _, member := range members {
+		if contains(r.names, member) {
+			continue
+		}
+		r.names = append(r.names, member)
+		for idx := 0; idx < virtualNodes; idx++ {
+			h := hash(member + "#" + strconv.Itoa(idx))
+			if _, ok := r.members[h]; ok {
+				continue
+			}
+			r.members[h] = member
+			r.hashes = append(r.hashes, h)
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+	return r
+}
+
+// Members returns each member once, in the order given to New.
+func (r *Ring) Members() []string {
+	result := make([]string, len(r.names))
+	copy(result, r.names)
+	return result
+}
+
+func contains(names []string, name string) bool {
+	for idx := range names {
+		if names[idx] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Owner returns the first member clockwise from the key's hash for
+// which alive returns true, "" if there are none.
+func (r *Ring) Owner(key string, alive func(string) bool) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	h := hash(key)
+	start := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	tried := map[string]bool{}
+	for idx := 0; idx < len(r.hashes); idx++ {
+		member := r.members[r.hashes[(start+idx)%len(r.hashes)]]
+		if tried[member] {
+			continue
+		}
+		if alive(member) {
+			return member
+		}
+		tried[member] = true
+	}
+	return ""
+}
+
+// Similar keys like "member#1" and "member#2" must land far apart,
+// which rules out cheaper hashes like CRC32 and FNV.
+func hash(key string) uint32 {
+	sum := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint32(sum[:4])
+}
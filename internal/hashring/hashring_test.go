@@ -0,0 +1,52 @@
+package hashring
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRing(t *testing.T) {
+	t.Parallel()
+
+	all := func(string) bool { return true }
+	assert.Equal(t, "", New(nil).Owner("default", all))
+
+	members := []string{"10.0.0.1:7419", "10.0.0.2:7419", "10.0.0.3:7419"}
+	r := New(members)
+
+	counts := map[string]int{}
+	owners := map[string]string{}
+	for idx := 0; idx < 3000; idx++ {
+		queue := fmt.Sprintf("queue-%d", idx)
+		owners[queue] = r.Owner(queue, all)
+		counts[owners[queue]]++
+	}
+	for _, member := range members {
+		assert.InDelta(t, 1000, counts[member], 300, member)
+	}
+
+	// adding a member only moves queues onto the new member
+	grown := New(append(members, "10.0.0.4:7419"))
+	for queue, owner := range owners {
+		moved := grown.Owner(queue, all)
+		if moved != owner {
+			assert.Equal(t, "10.0.0.4:7419", moved)
+		}
+	}
+
+	// a dead member's queues move, the rest stay put
+	dead := "10.0.0.2:7419"
+	alive := func(member string) bool { return member != dead }
+	for queue, owner := range owners {
+		if owner == dead {
+			assert.NotEqual(t, dead, r.Owner(queue, alive))
+		} else {
+			assert.Equal(t, owner, r.Owner(queue, alive))
+		}
+	}
+	assert.Equal(t, "", r.Owner("default", func(string) bool { return false }))
+
+	assert.Equal(t, members, New(append(members, members[0])).Members())
+}
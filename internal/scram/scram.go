@@ -0,0 +1,66 @@
+// Package scram holds the SCRAM-SHA-256 (RFC 5802) primitives shared
+// by the server and the client.  The exchange is folded into the
+// HI/HELLO handshake with an empty username and no channel binding.
+package scram
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+)
+
+// Keys derives the ClientKey, StoredKey and ServerKey from the
+// password.
+func Keys(password string, salt []byte, iterations int) (clientKey, storedKey, serverKey []byte) {
+	salted := Hi([]byte(password), salt, iterations)
+	clientKey = HMAC(salted, "Client Key")
+	stored := sha256.Sum256(clientKey)
+	return clientKey, stored[:], HMAC(salted, "Server Key")
+}
+
+// AuthMessage is built exactly as RFC 5802 describes, salt is base64
+// encoded as the server sends it.
+func AuthMessage(clientNonce, serverNonce, salt string, iterations int) string {
+	nonce := clientNonce + serverNonce
+	return "n=,r=" + clientNonce +
+		",r=" + nonce + ",s=" + salt + ",i=" + strconv.Itoa(iterations) +
+		",c=biws,r=" + nonce
+}
+
+func Nonce() (string, error) {
+	nonce := make([]byte, 18)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(nonce), nil
+}
+
+// Hi() from RFC 5802, which is PBKDF2 with HMAC-SHA-256 and a
+// single block of output.
+func Hi(password, salt []byte, iterations int) []byte {
+	mac := hmac.New(sha256.New, password)
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1})
+	u := mac.Sum(nil)
+
+	result := make([]byte, len(u))
+	copy(result, u)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for idx := range result {
+			result[idx] ^= u[idx]
+		}
+	}
+	return result
+}
+
+func HMAC(key []byte, msg string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(msg))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,18 @@
+package scram
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHi(t *testing.T) {
+	t.Parallel()
+
+	// PBKDF2-HMAC-SHA256 test vectors
+	assert.Equal(t, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b",
+		hex.EncodeToString(Hi([]byte("password"), []byte("salt"), 1)))
+	assert.Equal(t, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a",
+		hex.EncodeToString(Hi([]byte("password"), []byte("salt"), 4096)))
+}
@@ -0,0 +1,293 @@
+package manager
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/storage"
+	"github.com/contribsys/faktory/util"
+	"github.com/go-redis/redis"
+)
+
+// A batch groups jobs so a callback can run once all of them are done.
+// Each batch is a Redis hash, "batch-<bid>", holding its definition and
+// counters plus a set, "batch-<bid>-failed", of the JIDs which have
+// failed and not yet succeeded on retry.  Jobs join a batch by setting
+// the "bid" custom attribute, as client.Batch.Push does.
+//
+// Callbacks only fire once the batch is committed:
+//
+//   - complete fires when every job has either succeeded or failed
+//   - success fires when every job has succeeded, possibly after retries
+//
+// Callback jobs get a "_bid" custom attribute so they can look up
+// the batch's status.
+const (
+	BatchTTL = 30 * 24 * time.Hour
+)
+
+func batchKey(bid string) string {
+	return "batch-" + bid
+}
+
+func batchFailedKey(bid string) string {
+	return "batch-" + bid + "-failed"
+}
+
+func batchID(job *client.Job) string {
+	val, ok := job.GetCustom("bid")
+	if !ok {
+		return ""
+	}
+	bid, _ := val.(string)
+	return bid
+}
+
+func (m *manager) NewBatch(def *client.Batch) (string, error) {
+	if def.Success == nil && def.Complete == nil {
+		return "", invalid("Batch must have a success or complete callback")
+	}
+
+	fields := map[string]interface{}{
+		"created_at":  util.Nows(),
+		"description": def.Description,
+		"parent_bid":  def.ParentBid,
+		"total":       0,
+		"pending":     0,
+	}
+	for name, job := range map[string]*client.Job{"success": def.Success, "complete": def.Complete} {
+		if job == nil {
+			continue
+		}
+		if job.Jid == "" {
+			job.Jid = util.RandomJid()
+		}
+		_, err := m.validate(job)
+		if err != nil {
+			return "", invalid("Invalid %s callback: %v", name, err)
+		}
+		data, err := json.Marshal(job)
+		if err != nil {
+			return "", err
+		}
+		if m.cipher != nil {
+			data, err = m.cipher.Seal(data)
+			if err != nil {
+				return "", err
+			}
+		}
+		fields[name] = data
+	}
+
+	// a cluster member picks the bid of a batch it forwards
+	bid := def.Bid
+	if bid == "" {
+		bid = "b-" + util.RandomJid()
+	}
+	key := batchKey(bid)
+	exists, err := m.Redis().Exists(key).Result()
+	if err != nil {
+		return "", err
+	}
+	if exists > 0 {
+		return "", invalid("Batch %s already exists", bid)
+	}
+	_, err = m.Redis().TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HMSet(key, fields)
+		pipe.Expire(key, BatchTTL)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return bid, nil
+}
+
+// OpenBatch reopens a committed batch so more jobs can be added.
+// A batch whose callbacks have fired cannot be reopened.
+func (m *manager) OpenBatch(bid string) error {
+	vals, err := m.batchFields(bid)
+	if err != nil {
+		return err
+	}
+	if vals["complete_st"] != "" || vals["success_st"] != "" {
+		return invalid("Batch %s has already finished", bid)
+	}
+	return m.Redis().HDel(batchKey(bid), "committed").Err()
+}
+
+// CommitBatch marks the batch as fully defined, its callbacks may fire
+// immediately if all of its jobs have already finished.
+func (m *manager) CommitBatch(bid string) error {
+	_, err := m.batchFields(bid)
+	if err != nil {
+		return err
+	}
+	err = m.Redis().HSet(batchKey(bid), "committed", "1").Err()
+	if err != nil {
+		return err
+	}
+	return m.checkBatch(bid)
+}
+
+func (m *manager) BatchStatus(bid string) (*client.BatchStatus, error) {
+	vals, err := m.batchFields(bid)
+	if err != nil {
+		return nil, err
+	}
+	failed, err := m.Redis().SCard(batchFailedKey(bid)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	total, _ := strconv.ParseInt(vals["total"], 10, 64)
+	pending, _ := strconv.ParseInt(vals["pending"], 10, 64)
+	return &client.BatchStatus{
+		Bid:           bid,
+		ParentBid:     vals["parent_bid"],
+		Description:   vals["description"],
+		CreatedAt:     vals["created_at"],
+		Total:         total,
+		Pending:       pending,
+		Failed:        failed,
+		CompleteState: vals["complete_st"],
+		SuccessState:  vals["success_st"],
+	}, nil
+}
+
+func (m *manager) batchFields(bid string) (map[string]string, error) {
+	vals, err := m.Redis().HGetAll(batchKey(bid)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) == 0 {
+		return nil, invalid("Unknown batch %s", bid)
+	}
+	return vals, nil
+}
+
+func (m *manager) checkBatchExists(job *client.Job) error {
+	bid := batchID(job)
+	if bid == "" {
+		return nil
+	}
+	count, err := m.Redis().Exists(batchKey(bid)).Result()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return invalid("Unknown batch %s", bid)
+	}
+	return nil
+}
+
+func (m *manager) batchJobPushed(job *client.Job) error {
+	bid := batchID(job)
+	if bid == "" {
+		return nil
+	}
+	key := batchKey(bid)
+	_, err := m.Redis().TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(key, "total", 1)
+		pipe.HIncrBy(key, "pending", 1)
+		pipe.Expire(key, BatchTTL)
+		return nil
+	})
+	return err
+}
+
+func (m *manager) batchJobSucceeded(job *client.Job) error {
+	bid := batchID(job)
+	if bid == "" {
+		return nil
+	}
+	_, err := m.Redis().TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.SRem(batchFailedKey(bid), job.Jid)
+		pipe.HIncrBy(batchKey(bid), "pending", -1)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return m.checkBatch(bid)
+}
+
+func (m *manager) batchJobFailed(job *client.Job) error {
+	bid := batchID(job)
+	if bid == "" {
+		return nil
+	}
+	key := batchFailedKey(bid)
+	_, err := m.Redis().TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.SAdd(key, job.Jid)
+		pipe.Expire(key, BatchTTL)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return m.checkBatch(bid)
+}
+
+// Fire any callbacks whose conditions are now met.  HSETNX on the
+// state field guarantees each callback is pushed at most once even
+// if several jobs finish concurrently.
+func (m *manager) checkBatch(bid string) error {
+	vals, err := m.batchFields(bid)
+	if err != nil {
+		return err
+	}
+	if vals["committed"] != "1" {
+		return nil
+	}
+	failed, err := m.Redis().SCard(batchFailedKey(bid)).Result()
+	if err != nil {
+		return err
+	}
+	pending, _ := strconv.ParseInt(vals["pending"], 10, 64)
+
+	if pending == failed {
+		err = m.fireCallback(bid, "complete", vals["complete"])
+		if err != nil {
+			return err
+		}
+	}
+	if pending == 0 {
+		err = m.fireCallback(bid, "success", vals["success"])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *manager) fireCallback(bid string, name string, data string) error {
+	if data == "" {
+		return nil
+	}
+	ok, err := m.Redis().HSetNX(batchKey(bid), name+"_st", "1").Result()
+	if err != nil || !ok {
+		return err
+	}
+
+	payload := []byte(data)
+	if m.cipher != nil {
+		opened, err := m.cipher.Open(payload)
+		if err == nil {
+			payload = opened
+		} else if err != storage.ErrUnencrypted {
+			return err
+		}
+	}
+	var job client.Job
+	err = json.Unmarshal(payload, &job)
+	if err != nil {
+		return err
+	}
+	job.Jid = util.RandomJid()
+	job.CreatedAt = util.Nows()
+	job.SetCustom("_bid", bid)
+	return m.Push(&job)
+}
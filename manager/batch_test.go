@@ -0,0 +1,129 @@
+package manager
+
+import (
+	"context"
+	"testing"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchID(t *testing.T) {
+	t.Parallel()
+
+	job := client.NewJob("SomeJob", 1)
+	assert.Equal(t, "", batchID(job))
+	job.SetCustom("bid", "b-123")
+	assert.Equal(t, "b-123", batchID(job))
+}
+
+func TestBatch(t *testing.T) {
+	withRedis(t, "batch", func(t *testing.T, store storage.Store) {
+
+		t.Run("Success", func(t *testing.T) {
+			store.Flush()
+			m := newManager(store)
+
+			_, err := m.NewBatch(&client.Batch{})
+			assert.Error(t, err)
+
+			bid, err := m.NewBatch(&client.Batch{
+				Description: "Import users",
+				Success:     client.NewJob("ImportDone", 1),
+			})
+			assert.NoError(t, err)
+
+			orphan := client.NewJob("ImportUser", 1)
+			orphan.SetCustom("bid", "b-missing")
+			assert.Error(t, m.Push(orphan))
+
+			for i := 0; i < 2; i++ {
+				job := client.NewJob("ImportUser", i)
+				job.SetCustom("bid", bid)
+				assert.NoError(t, m.Push(job))
+			}
+			assert.NoError(t, m.CommitBatch(bid))
+
+			status, err := m.BatchStatus(bid)
+			assert.NoError(t, err)
+			assert.EqualValues(t, 2, status.Total)
+			assert.EqualValues(t, 2, status.Pending)
+			assert.Equal(t, "Import users", status.Description)
+
+			q, err := store.GetQueue("default")
+			assert.NoError(t, err)
+
+			first, err := m.Fetch(context.Background(), "workerId", "default")
+			assert.NoError(t, err)
+			assert.NoError(t, m.Fail(&FailPayload{Jid: first.Jid, ErrorType: "Boom"}))
+
+			second, err := m.Fetch(context.Background(), "workerId", "default")
+			assert.NoError(t, err)
+			_, err = m.Acknowledge(second.Jid)
+			assert.NoError(t, err)
+
+			status, err = m.BatchStatus(bid)
+			assert.NoError(t, err)
+			assert.EqualValues(t, 1, status.Pending)
+			assert.EqualValues(t, 1, status.Failed)
+			assert.Equal(t, "", status.SuccessState)
+			assert.EqualValues(t, 0, q.Size())
+
+			// the retry succeeds
+			count, err := store.Retries().RemoveBefore("9999-12-31T00:00:00Z", 10, func(data []byte) error {
+				return q.Push(data)
+			})
+			assert.NoError(t, err)
+			assert.EqualValues(t, 1, count)
+			retried, err := m.Fetch(context.Background(), "workerId", "default")
+			assert.NoError(t, err)
+			_, err = m.Acknowledge(retried.Jid)
+			assert.NoError(t, err)
+
+			status, err = m.BatchStatus(bid)
+			assert.NoError(t, err)
+			assert.EqualValues(t, 0, status.Pending)
+			assert.EqualValues(t, 0, status.Failed)
+			assert.Equal(t, "1", status.SuccessState)
+			assert.EqualValues(t, 1, q.Size())
+
+			callback, err := m.Fetch(context.Background(), "workerId", "default")
+			assert.NoError(t, err)
+			assert.Equal(t, "ImportDone", callback.Type)
+			val, _ := callback.GetCustom("_bid")
+			assert.Equal(t, bid, val)
+
+			assert.Error(t, m.OpenBatch(bid))
+		})
+
+		t.Run("CompleteBeforeCommit", func(t *testing.T) {
+			store.Flush()
+			m := newManager(store)
+
+			bid, err := m.NewBatch(&client.Batch{Complete: client.NewJob("AllDone", 1)})
+			assert.NoError(t, err)
+
+			job := client.NewJob("Work", 1)
+			job.Retry = 0
+			job.SetCustom("bid", bid)
+			assert.NoError(t, m.Push(job))
+
+			fetched, err := m.Fetch(context.Background(), "workerId", "default")
+			assert.NoError(t, err)
+			assert.NoError(t, m.Fail(&FailPayload{Jid: fetched.Jid}))
+
+			q, err := store.GetQueue("default")
+			assert.NoError(t, err)
+			assert.EqualValues(t, 0, q.Size())
+
+			assert.NoError(t, m.CommitBatch(bid))
+			assert.EqualValues(t, 1, q.Size())
+
+			status, err := m.BatchStatus(bid)
+			assert.NoError(t, err)
+			assert.Equal(t, "1", status.CompleteState)
+			assert.EqualValues(t, 1, status.Failed)
+		})
+	})
+}
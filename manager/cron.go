@@ -0,0 +1,152 @@
+package manager
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A parsed five field cron expression:
+//
+//   minute hour day-of-month month day-of-week
+//
+// Each field may be "*", a number, a range "1-5", a list "1,3,5"
+// or any of those with a step, e.g. "*/15" or "0-30/10".  Day-of-week
+// runs from 0 (Sunday) to 6, 7 is also accepted for Sunday.  Times are
+// evaluated in UTC.
+type cronSchedule struct {
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+
+	// Like Vixie cron, if both day fields are restricted a day
+	// matches if either field matches.
+	domStar bool
+	dowStar bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, invalid("Invalid cron expression '%s', expected 5 fields", expr)
+	}
+
+	bits := make([]uint64, len(fields))
+	for idx := range fields {
+		val, err := parseCronField(fields[idx], cronFields[idx])
+		if err != nil {
+			return nil, err
+		}
+		bits[idx] = val
+	}
+
+	// fold 7 into 0, both mean Sunday
+	if bits[4]&(1<<7) != 0 {
+		bits[4] = (bits[4] | 1) &^ (1 << 7)
+	}
+
+	return &cronSchedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+func parseCronField(field string, spec cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng := part
+		step := 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			rng = part[:idx]
+			val, err := strconv.Atoi(part[idx+1:])
+			if err != nil || val < 1 {
+				return 0, invalid("Invalid step in %s field '%s'", spec.name, field)
+			}
+			step = val
+		}
+
+		low, high := spec.min, spec.max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			val, err := strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, invalid("Invalid %s field '%s'", spec.name, field)
+			}
+			low, high = val, val
+			if len(bounds) == 2 {
+				high, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return 0, invalid("Invalid %s field '%s'", spec.name, field)
+				}
+			} else if step > 1 {
+				// "5/15" means starting at 5, every 15
+				high = spec.max
+			}
+		}
+		if low < spec.min || high > spec.max || low > high {
+			return 0, invalid("Out of range %s field '%s', must be %d-%d", spec.name, field, spec.min, spec.max)
+		}
+
+		for val := low; val <= high; val += step {
+			bits |= 1 << uint(val)
+		}
+	}
+	return bits, nil
+}
+
+func (cs *cronSchedule) dayMatches(t time.Time) bool {
+	dom := cs.dom&(1<<uint(t.Day())) != 0
+	dow := cs.dow&(1<<uint(t.Weekday())) != 0
+	if cs.domStar || cs.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first matching minute strictly after +t+, or the zero
+// time if nothing matches in the next five years, e.g. "0 0 30 2 *".
+func (cs *cronSchedule) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if cs.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !cs.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if cs.hour&(1<<uint(t.Hour())) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if cs.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,70 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCronParsing(t *testing.T) {
+	t.Parallel()
+
+	valid := []string{
+		"* * * * *",
+		"*/15 * * * *",
+		"0 9-17 * * 1-5",
+		"5,35 0 1 1,6 *",
+		"5/20 * * * 7",
+	}
+	for _, expr := range valid {
+		_, err := parseCron(expr)
+		assert.NoError(t, err, expr)
+	}
+
+	invalid := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+	}
+	for _, expr := range invalid {
+		_, err := parseCron(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	t.Parallel()
+
+	// a Wednesday
+	base := time.Date(2021, 3, 17, 10, 7, 30, 0, time.UTC)
+
+	next := func(expr string) time.Time {
+		cs, err := parseCron(expr)
+		assert.NoError(t, err)
+		return cs.Next(base)
+	}
+
+	assert.Equal(t, time.Date(2021, 3, 17, 10, 8, 0, 0, time.UTC), next("* * * * *"))
+	assert.Equal(t, time.Date(2021, 3, 17, 10, 15, 0, 0, time.UTC), next("*/15 * * * *"))
+	assert.Equal(t, time.Date(2021, 3, 18, 9, 0, 0, 0, time.UTC), next("0 9 * * *"))
+	assert.Equal(t, time.Date(2021, 3, 21, 0, 0, 0, 0, time.UTC), next("0 0 * * 0"))
+	assert.Equal(t, time.Date(2021, 3, 21, 0, 0, 0, 0, time.UTC), next("0 0 * * 7"))
+	assert.Equal(t, time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC), next("0 0 1 * *"))
+	assert.Equal(t, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), next("0 0 1 1 *"))
+	assert.Equal(t, time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC), next("0 12 29 2 *"))
+
+	// both day fields restricted, either may match: the 1st or a Friday
+	assert.Equal(t, time.Date(2021, 3, 19, 0, 0, 0, 0, time.UTC), next("0 0 1 * 5"))
+
+	// never matches
+	assert.True(t, next("0 0 30 2 *").IsZero())
+}
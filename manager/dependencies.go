@@ -0,0 +1,308 @@
+package manager
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/util"
+	"github.com/go-redis/redis"
+)
+
+// A job which sets depends_on waits until every JID it lists has been
+// acknowledged.  Until then it sits in the waiting set, out of reach of
+// the scheduler and the operator commands which move scheduled jobs,
+// scored by when it gives up.  Redis holds four indexes:
+//
+//   - "depends:<jid>", the dependencies a waiting job still needs
+//   - "dependents:<jid>", the waiting jobs which depend on a job
+//   - "waiting-at", the waiting set score of each waiting job
+//   - "done:<jid>" and "failed:<jid>", set for markerTTL when a job is
+//     acknowledged or fails for good so a job pushed afterwards
+//     doesn't wait for it
+//
+// Pushing registers a job in the indexes before checking which of its
+// dependencies are done, and ACK marks a job done before reading its
+// dependents, so one of them always sees the other.  Whichever finds
+// the last dependency fulfilled promotes the job, claiming it by
+// removing it from the waiting set so it's only enqueued once.
+//
+// A dependency which dies, expires, is deleted or cancelled sends its
+// dependents to the dead set, and theirs in turn.  A job which is
+// still waiting after DependencyTimeout, e.g. because a dependency
+// never existed, is sent to the dead set too.
+
+// How long a job waits for its dependencies.
+const DependencyTimeout = 7 * 24 * time.Hour
+
+// A job pushed within markerTTL of its dependency finishing still sees
+// it, a later one waits for DependencyTimeout.
+const markerTTL = DependencyTimeout
+
+const waitingAtKey = "waiting-at"
+
+func dependsKey(jid string) string {
+	return "depends:" + jid
+}
+
+func dependentsKey(jid string) string {
+	return "dependents:" + jid
+}
+
+func doneKey(jid string) string {
+	return "done:" + jid
+}
+
+func failedKey(jid string) string {
+	return "failed:" + jid
+}
+
+// Called within the push middleware instead of enqueuing the job.
+func (m *manager) waitForDependencies(job *client.Job) error {
+	at := util.Thens(time.Now().Add(DependencyTimeout))
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	rclient := m.Redis()
+	deps := make([]interface{}, len(job.DependsOn))
+	for idx := range job.DependsOn {
+		deps[idx] = job.DependsOn[idx]
+	}
+	_, err = rclient.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.SAdd(dependsKey(job.Jid), deps...)
+		pipe.HSet(waitingAtKey, job.Jid, at)
+		for _, dep := range job.DependsOn {
+			pipe.SAdd(dependentsKey(dep), job.Jid)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = m.store.Waiting().AddElement(at, job.Jid, data)
+	if err != nil {
+		m.forgetDependencies(job)
+		return err
+	}
+
+	// the job is pushed, if the rest fails its dependencies or the
+	// timeout still resolve it
+	err = m.checkDependencies(job)
+	if err != nil {
+		util.Error("Unable to check the dependencies of "+job.Jid, err)
+	}
+	return nil
+}
+
+// Resolve the dependencies which finished before the job was pushed.
+func (m *manager) checkDependencies(job *client.Job) error {
+	rclient := m.Redis()
+	done := make([]*redis.IntCmd, len(job.DependsOn))
+	failed := make([]*redis.IntCmd, len(job.DependsOn))
+	_, err := rclient.Pipelined(func(pipe redis.Pipeliner) error {
+		for idx, dep := range job.DependsOn {
+			done[idx] = pipe.Exists(doneKey(dep))
+			failed[idx] = pipe.Exists(failedKey(dep))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for idx, dep := range job.DependsOn {
+		if failed[idx].Val() > 0 {
+			return m.abandon(job.Jid, dep)
+		}
+	}
+	for idx, dep := range job.DependsOn {
+		if done[idx].Val() > 0 {
+			if err := rclient.SRem(dependsKey(job.Jid), dep).Err(); err != nil {
+				return err
+			}
+		}
+	}
+	// an ACK may have fulfilled the last dependency before the job
+	// was in the waiting set
+	return m.settle(job.Jid)
+}
+
+// Called after a job is acknowledged.
+func (m *manager) dependencyDone(jid string) error {
+	rclient := m.Redis()
+	var dependents *redis.StringSliceCmd
+	_, err := rclient.Pipelined(func(pipe redis.Pipeliner) error {
+		pipe.Set(doneKey(jid), "1", markerTTL)
+		dependents = pipe.SMembers(dependentsKey(jid))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, dependent := range dependents.Val() {
+		err = rclient.SRem(dependsKey(dependent), jid).Err()
+		if err != nil {
+			return err
+		}
+		err = m.settle(dependent)
+		if err != nil {
+			return err
+		}
+	}
+	return rclient.Del(dependentsKey(jid)).Err()
+}
+
+// Removed drops a job which an operator deleted, killed or cancelled
+// from the tag index and sends the jobs waiting for it to the dead set.
+func (m *manager) Removed(job *client.Job) {
+	if err := m.untagJob(job); err != nil {
+		util.Error("Unable to remove tags for "+job.Jid, err)
+	}
+	if err := m.dependencyFailed(job.Jid); err != nil {
+		util.Error("Unable to remove the jobs depending on "+job.Jid, err)
+	}
+}
+
+// Called when a job won't be acknowledged: it died, expired, was
+// deleted or cancelled.
+func (m *manager) dependencyFailed(jid string) error {
+	rclient := m.Redis()
+	var dependents *redis.StringSliceCmd
+	_, err := rclient.Pipelined(func(pipe redis.Pipeliner) error {
+		pipe.Set(failedKey(jid), "1", markerTTL)
+		dependents = pipe.SMembers(dependentsKey(jid))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, dependent := range dependents.Val() {
+		err = m.abandon(dependent, jid)
+		if err != nil {
+			return err
+		}
+	}
+	return rclient.Del(dependentsKey(jid)).Err()
+}
+
+// Promote the job if it has no dependencies left.
+func (m *manager) settle(jid string) error {
+	remaining, err := m.Redis().SCard(dependsKey(jid)).Result()
+	if err != nil || remaining > 0 {
+		return err
+	}
+	job, err := m.claimWaiting(jid)
+	if err != nil || job == nil {
+		return err
+	}
+
+	util.Debugf("JID %s: dependencies done, enqueuing", jid)
+	job.At = ""
+	return m.enqueue(job)
+}
+
+// Send the job to the dead set since dep won't be acknowledged.
+func (m *manager) abandon(jid string, dep string) error {
+	job, err := m.claimWaiting(jid)
+	if err != nil || job == nil {
+		return err
+	}
+
+	util.Infof("JID %s: dependency %s failed", jid, dep)
+	job.SetCustom("reason", "dependency failed")
+	return m.discardWaiting(job)
+}
+
+// Remove the job from the waiting set and the indexes, nil if another
+// client removed it first.
+func (m *manager) claimWaiting(jid string) (*client.Job, error) {
+	at, err := m.Redis().HGet(waitingAtKey, jid).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	waiting := m.store.Waiting()
+	key := []byte(at + "|" + jid)
+	ent, err := waiting.Get(key)
+	if err != nil || ent == nil {
+		return nil, err
+	}
+	job, err := ent.Job()
+	if err != nil {
+		return nil, err
+	}
+	ok, err := waiting.Remove(key)
+	if err != nil || !ok {
+		// already claimed
+		return nil, err
+	}
+	m.forgetDependencies(job)
+	return job, nil
+}
+
+// The job left the waiting set.
+func (m *manager) forgetDependencies(job *client.Job) {
+	_, err := m.Redis().Pipelined(func(pipe redis.Pipeliner) error {
+		pipe.Del(dependsKey(job.Jid))
+		pipe.HDel(waitingAtKey, job.Jid)
+		for _, dep := range job.DependsOn {
+			pipe.SRem(dependentsKey(dep), job.Jid)
+		}
+		return nil
+	})
+	if err != nil {
+		util.Error("Unable to remove dependencies for "+job.Jid, err)
+	}
+}
+
+func (m *manager) discardWaiting(job *client.Job) error {
+	if err := m.releaseUnique(job); err != nil {
+		util.Error("Unable to release unique lock for "+job.Jid, err)
+	}
+	if err := m.untagJob(job); err != nil {
+		util.Error("Unable to remove tags for "+job.Jid, err)
+	}
+	err := sendToMorgue(m.store, job)
+	if err != nil {
+		return err
+	}
+	return m.dependencyFailed(job.Jid)
+}
+
+// Waiting reports whether the job is waiting for its depends_on.
+func (m *manager) Waiting(jid string) (bool, error) {
+	return m.Redis().HExists(waitingAtKey, jid).Result()
+}
+
+// ExpireWaitingJobs sends the jobs which have waited DependencyTimeout
+// for their dependencies to the dead set.
+func (m *manager) ExpireWaitingJobs(when time.Time) (int64, error) {
+	total := int64(0)
+	for {
+		count, err := m.store.Waiting().RemoveBefore(util.Thens(when), 100, func(data []byte) error {
+			var job client.Job
+			err := json.Unmarshal(data, &job)
+			if err != nil {
+				return err
+			}
+			util.Infof("JID %s: gave up waiting for its dependencies", job.Jid)
+			m.forgetDependencies(&job)
+			job.SetCustom("reason", "dependency timeout")
+			return m.discardWaiting(&job)
+		})
+		total += count
+		if err != nil {
+			return total, err
+		}
+		if count != 100 {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package manager
+
+import (
+	"time"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/util"
+)
+
+// A job with an expires_at which passes before it can be processed is
+// sent to the Dead set rather than being executed.  Jobs built with
+// client's SetExpiresAt carry the time in their custom attributes.
+func expired(job *client.Job, now time.Time) bool {
+	at := job.ExpiresAt
+	if at == "" {
+		if val, ok := job.GetCustom("expires_at"); ok {
+			at, _ = val.(string)
+		}
+	}
+	if at == "" {
+		return false
+	}
+	tm, err := util.ParseTime(at)
+	if err != nil {
+		util.Warnf("JID %s: invalid expires_at %q", job.Jid, at)
+		return false
+	}
+	return now.After(tm)
+}
+
+func (m *manager) expire(job *client.Job) error {
+	util.Infof("JID %s: expired before it could be processed", job.Jid)
+	job.SetCustom("reason", "expired")
+	if err := m.releaseUnique(job); err != nil {
+		util.Error("Unable to release unique lock for "+job.Jid, err)
+	}
+	if err := m.untagJob(job); err != nil {
+		util.Error("Unable to remove tags for "+job.Jid, err)
+	}
+	if err := m.dependencyFailed(job.Jid); err != nil {
+		util.Error("Unable to remove the jobs depending on "+job.Jid, err)
+	}
+	return sendToMorgue(m.store, job)
+}
@@ -3,10 +3,12 @@ package manager
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/storage"
 	"github.com/contribsys/faktory/util"
 	"github.com/go-redis/redis"
 )
@@ -27,7 +29,9 @@ func (m *manager) Pause(qName string) error {
 		return err
 	}
 
+	m.pausedMutex.Lock()
 	m.paused = append(filter([]string{qName}, m.paused), qName)
+	m.pausedMutex.Unlock()
 	return nil
 }
 
@@ -41,10 +45,98 @@ func (m *manager) Resume(qName string) error {
 		return err
 	}
 
+	m.pausedMutex.Lock()
 	m.paused = filter([]string{qName}, m.paused)
+	m.pausedMutex.Unlock()
 	return nil
 }
 
+func (m *manager) PausedQueues() []string {
+	m.pausedMutex.RLock()
+	defer m.pausedMutex.RUnlock()
+	paused := make([]string, len(m.paused))
+	copy(paused, m.paused)
+	return paused
+}
+
+func (m *manager) RenameQueue(from, to string) (uint64, error) {
+	rs, ok := m.store.(storage.Renamable)
+	if !ok {
+		return 0, fmt.Errorf("Renaming queues is not supported by this storage backend")
+	}
+
+	// jobs pushed to the old name while the jobs move go to the new queue
+	m.renamesMutex.Lock()
+	prev := copyRenames(m.renames)
+	recordRename(m.renames, from, to)
+	m.renamesMutex.Unlock()
+
+	count, err := rs.RenameQueue(from, to)
+	if err != nil && !errors.Is(err, storage.ErrRenameIncomplete) {
+		m.renamesMutex.Lock()
+		m.renames = prev
+		m.renamesMutex.Unlock()
+		return 0, err
+	}
+
+	m.pausedMutex.Lock()
+	if contains(from, m.paused) {
+		m.paused = append(filter([]string{from}, m.paused), to)
+	}
+	m.pausedMutex.Unlock()
+
+	m.ratesMutex.Lock()
+	if rl, ok := m.rates[from]; ok {
+		delete(m.rates, from)
+		m.rates[to] = rl
+	}
+	m.ratesMutex.Unlock()
+
+	m.ringsMutex.Lock()
+	if ring, ok := m.rings[from]; ok {
+		delete(m.rings, from)
+		m.rings[to] = ring
+	}
+	m.ringsMutex.Unlock()
+	return count, err
+}
+
+func (m *manager) RenamedQueue(name string) (string, bool) {
+	m.renamesMutex.RLock()
+	defer m.renamesMutex.RUnlock()
+	to, ok := m.renames[name]
+	return to, ok
+}
+
+// The queue's current name, jobs which name a renamed queue are sent
+// to its new name.
+func (m *manager) queueName(name string) string {
+	if to, ok := m.RenamedQueue(name); ok {
+		return to
+	}
+	return name
+}
+
+func recordRename(renames map[string]string, from, to string) {
+	// the new name is in use again
+	delete(renames, to)
+	for old, current := range renames {
+		// renamed more than once, point straight to the latest name
+		if current == from {
+			renames[old] = to
+		}
+	}
+	renames[from] = to
+}
+
+func copyRenames(renames map[string]string) map[string]string {
+	cp := make(map[string]string, len(renames))
+	for k, v := range renames {
+		cp[k] = v
+	}
+	return cp
+}
+
 // returns the subset of "queues" which are not in "paused"
 func filter(paused []string, queues []string) []string {
 	if len(paused) == 0 {
@@ -77,8 +169,12 @@ func (m *manager) Fetch(ctx context.Context, wid string, queues ...string) (*cli
 		return nil, fmt.Errorf("You must call fetch with at least one queue!")
 	}
 
+	// a queue whose next job wasn't for this worker, see takeMatching
+	scan := ""
 restart:
+	m.pausedMutex.RLock()
 	activeQueues := filter(m.paused, queues)
+	m.pausedMutex.RUnlock()
 	if len(activeQueues) == 0 {
 		// if we pause all queues, there is nothing to fetch
 		select {
@@ -88,16 +184,70 @@ restart:
 		return nil, nil
 	}
 
-	lease, err := m.fetcher.Fetch(ctx, wid, activeQueues...)
+	var lease Lease
+	var err error
+	if scan != "" {
+		lease, err = m.takeMatching(ctx, wid, scan)
+	} else {
+		lease, err = m.fetcher.Fetch(ctx, wid, activeQueues...)
+	}
 	if err != nil {
 		return nil, err
 	}
+	if lease == Nothing && scan != "" {
+		// nothing in that queue for this worker, try the others
+		remaining := without(queues, scan)
+		if len(remaining) == 0 || len(remaining) == len(queues) {
+			select {
+			case <-ctx.Done():
+			case <-time.After(2 * time.Second):
+			}
+			return nil, nil
+		}
+		queues = remaining
+		scan = ""
+		goto restart
+	}
 
 	if lease != Nothing {
+		if m.cipher != nil {
+			opened, err := m.openLease(lease)
+			if err != nil {
+				return nil, err
+			}
+			lease = opened
+		}
+
 		job, err := lease.Job()
 		if err != nil {
 			return nil, err
 		}
+		if expired(job, time.Now()) {
+			err = m.expire(job)
+			if err != nil {
+				return nil, err
+			}
+			goto restart
+		}
+		if !m.canTake(ctx, wid, job) {
+			// not for this worker, put it back where it was and look
+			// further down its queue
+			err = m.pushBack(job, lease.Payload())
+			if err != nil {
+				return nil, err
+			}
+			scan = job.Queue
+			goto restart
+		}
+		err = m.waitForRate(ctx, job.Queue)
+		if err != nil {
+			// over the queue's rate limit, leave it for a later fetch
+			err = m.pushBack(job, lease.Payload())
+			if err != nil {
+				return nil, err
+			}
+			return nil, nil
+		}
 		err = callMiddleware(m.fetchChain, Ctx{ctx, job, m, nil}, func() error {
 			return m.reserve(wid, lease)
 		})
@@ -109,6 +259,10 @@ restart:
 			return nil, err
 		}
 		if err != nil {
+			// the job wasn't reserved, put it back rather than lose it
+			if perr := m.pushBack(job, lease.Payload()); perr != nil {
+				util.Error("Unable to push back "+job.Jid, perr)
+			}
 			return nil, err
 		}
 		return job, nil
@@ -116,6 +270,92 @@ restart:
 	return nil, nil
 }
 
+type labelsKey struct{}
+
+// WithLabels restricts Fetch to jobs which don't have any labels or
+// which share at least one label with the worker.  A job's type also
+// counts as one of its labels.  Workers without labels may fetch any job.
+func WithLabels(ctx context.Context, labels []string) context.Context {
+	return context.WithValue(ctx, labelsKey{}, labels)
+}
+
+func labelsFrom(ctx context.Context) []string {
+	labels, _ := ctx.Value(labelsKey{}).([]string)
+	return labels
+}
+
+func labelsMatch(job *client.Job, labels []string) bool {
+	if len(job.Labels) == 0 || len(labels) == 0 {
+		return true
+	}
+	if contains(job.Type, labels) {
+		return true
+	}
+	for idx := range job.Labels {
+		if contains(job.Labels[idx], labels) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *manager) canTake(ctx context.Context, wid string, job *client.Job) bool {
+	return labelsMatch(job, labelsFrom(ctx)) && m.ownsHashKey(wid, job)
+}
+
+// How many jobs takeMatching looks through.
+const matchScanLimit = 100
+
+// The first job this worker can take among the next matchScanLimit
+// jobs in the queue, or Nothing.  The jobs it passes over keep their
+// place so they're fetched by the workers they're meant for.
+func (m *manager) takeMatching(ctx context.Context, wid string, qName string) (Lease, error) {
+	q, err := m.store.GetQueue(qName)
+	if err != nil {
+		return nil, err
+	}
+	pq, ok := q.(storage.PriorityQueue)
+	if !ok {
+		return Nothing, nil
+	}
+
+	data, err := pq.TakeMatching(matchScanLimit, func(data []byte) bool {
+		var job client.Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			return false
+		}
+		return m.canTake(ctx, wid, &job)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return Nothing, nil
+	}
+	return &simpleLease{payload: data}, nil
+}
+
+func without(queues []string, name string) []string {
+	result := make([]string, 0, len(queues))
+	for idx := range queues {
+		if queues[idx] != name {
+			result = append(result, queues[idx])
+		}
+	}
+	return result
+}
+
+func (m *manager) pushBack(job *client.Job, data []byte) error {
+	q, err := m.store.GetQueue(m.queueName(job.Queue))
+	if err != nil {
+		return err
+	}
+	if pq, ok := q.(storage.PriorityQueue); ok {
+		return pq.PushBack(job.Priority, data)
+	}
+	return q.Push(data)
+}
+
 type Fetcher interface {
 	Fetch(ctx context.Context, wid string, queues ...string) (Lease, error)
 }
@@ -158,12 +398,48 @@ func (el *simpleLease) Job() (*client.Job, error) {
 	return el.job, nil
 }
 
+// The fetcher pops raw payloads so encrypted jobs are opened here.
+// The opened payload, so a job pushed back onto its queue is sealed
+// once by the queue.
+type openedLease struct {
+	Lease
+	data []byte
+	job  *client.Job
+}
+
+func (ol *openedLease) Payload() []byte {
+	return ol.data
+}
+
+func (ol *openedLease) Job() (*client.Job, error) {
+	return ol.job, nil
+}
+
+// A job pushed before encryption was enabled is accepted as it is, the
+// working set and any queue it goes back to seal it.
+func (m *manager) openLease(lease Lease) (Lease, error) {
+	data, err := m.cipher.Open(lease.Payload())
+	if err == storage.ErrUnencrypted {
+		data, err = lease.Payload(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var job client.Job
+	err = json.Unmarshal(data, &job)
+	if err != nil {
+		return nil, err
+	}
+	return &openedLease{Lease: lease, data: data, job: &job}, nil
+}
+
 func BasicFetcher(r *redis.Client) Fetcher {
 	return &BasicFetch{r: r}
 }
 
 func (f *BasicFetch) Fetch(ctx context.Context, wid string, queues ...string) (Lease, error) {
-	data, err := brpop(f.r, queues...)
+	data, err := brpop(ctx, f.r, queues...)
 	if err != nil {
 		return nil, err
 	}
@@ -173,8 +449,25 @@ func (f *BasicFetch) Fetch(ctx context.Context, wid string, queues ...string) (L
 	return Nothing, nil
 }
 
-func brpop(r *redis.Client, queues ...string) ([]byte, error) {
-	val, err := r.BRPop(2*time.Second, queues...).Result()
+// Block until a job is available in one of the queues or the context's
+// deadline passes, 2 seconds if the context has no deadline.
+func brpop(ctx context.Context, r *redis.Client, queues ...string) ([]byte, error) {
+	timeout := 2 * time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+		if timeout < time.Second {
+			// BRPOP's resolution is one second, zero would block forever
+			timeout = time.Second
+		}
+	}
+
+	// each queue is made up of several lists, one per priority
+	keys := make([]string, 0, len(queues)*storage.MaxPriority)
+	for idx := range queues {
+		keys = append(keys, storage.PriorityKeys(queues[idx])...)
+	}
+
+	val, err := r.BRPop(timeout, keys...).Result()
 	if err != nil {
 		if err == redis.Nil {
 			return nil, nil
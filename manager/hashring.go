@@ -0,0 +1,55 @@
+package manager
+
+import (
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/internal/hashring"
+)
+
+func (m *manager) SetHashRing(qName string, wids []string) {
+	m.ringsMutex.Lock()
+	defer m.ringsMutex.Unlock()
+	if len(wids) == 0 {
+		delete(m.rings, qName)
+		return
+	}
+	m.rings[qName] = hashring.New(wids)
+}
+
+func (m *manager) HashRings() map[string][]string {
+	m.ringsMutex.RLock()
+	defer m.ringsMutex.RUnlock()
+
+	result := make(map[string][]string, len(m.rings))
+	for name, ring := range m.rings {
+		result[name] = ring.Members()
+	}
+	return result
+}
+
+func (m *manager) SetLiveness(alive func(wid string) bool) {
+	m.ringsMutex.Lock()
+	defer m.ringsMutex.Unlock()
+	m.alive = alive
+}
+
+// Whether the worker may fetch the job: jobs without a HashKey, or in
+// a queue without a ring, go to any worker.  Workers outside the ring
+// only fetch those, unless none of the ring's workers are running so
+// the jobs aren't stranded.
+func (m *manager) ownsHashKey(wid string, job *client.Job) bool {
+	if job.HashKey == "" {
+		return true
+	}
+	m.ringsMutex.RLock()
+	ring, ok := m.rings[job.Queue]
+	alive := m.alive
+	m.ringsMutex.RUnlock()
+	if !ok {
+		return true
+	}
+	if alive == nil {
+		alive = func(string) bool { return true }
+	}
+	owner := ring.Owner(job.HashKey, alive)
+	return owner == "" || owner == wid
+}
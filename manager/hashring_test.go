@@ -0,0 +1,60 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/internal/hashring"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOwnsHashKey(t *testing.T) {
+	t.Parallel()
+
+	m := &manager{rings: map[string]*hashring.Ring{}}
+	job := client.NewJob("Checkout", 1)
+	job.Queue = "sessions"
+	job.HashKey = "user-42"
+	// no ring, any worker
+	assert.True(t, m.ownsHashKey("outsider", job))
+
+	wids := []string{"w1", "w2", "w3"}
+	m.SetHashRing("sessions", wids)
+	assert.Equal(t, map[string][]string{"sessions": wids}, m.HashRings())
+
+	owners := 0
+	for _, wid := range wids {
+		if m.ownsHashKey(wid, job) {
+			owners++
+		}
+	}
+	assert.Equal(t, 1, owners)
+	assert.False(t, m.ownsHashKey("outsider", job))
+
+	// the owner's keys move on to a running worker when it goes away
+	var owner string
+	for _, wid := range wids {
+		if m.ownsHashKey(wid, job) {
+			owner = wid
+		}
+	}
+	m.SetLiveness(func(wid string) bool { return wid != owner })
+	assert.False(t, m.ownsHashKey(owner, job))
+	owners = 0
+	for _, wid := range wids {
+		if m.ownsHashKey(wid, job) {
+			owners++
+		}
+	}
+	assert.Equal(t, 1, owners)
+
+	// and to anyone if the whole ring is gone
+	m.SetLiveness(func(string) bool { return false })
+	assert.True(t, m.ownsHashKey("outsider", job))
+
+	job.HashKey = ""
+	assert.True(t, m.ownsHashKey("outsider", job))
+
+	m.SetHashRing("sessions", nil)
+	assert.Empty(t, m.HashRings())
+}
@@ -3,11 +3,14 @@ package manager
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/internal/hashring"
 	"github.com/contribsys/faktory/storage"
 	"github.com/contribsys/faktory/util"
 	"github.com/go-redis/redis"
@@ -53,11 +56,66 @@ func ExpectedError(code string, msg string) error {
 	return &codedError{code: code, msg: msg}
 }
 
+// A ValidationError means the caller gave us bad input, e.g. a job
+// without a jobtype, rather than something going wrong server-side.
+type ValidationError struct {
+	msg string
+}
+
+func (ve *ValidationError) Error() string {
+	return ve.msg
+}
+
+func invalid(format string, args ...interface{}) error {
+	return &ValidationError{msg: fmt.Sprintf(format, args...)}
+}
+
 type Manager interface {
 	Push(job *client.Job) error
 
+	// PushBulk pushes a batch of jobs, rejecting all of them if any are
+	// invalid.  Returns the number of jobs pushed.
+	PushBulk(jobs []*client.Job) (int, error)
+
 	Pause(qName string) error
 	Resume(qName string) error
+	PausedQueues() []string
+
+	// RenameQueue moves a queue's jobs to a new, empty queue along with
+	// its paused state, rate limit and hash ring.  Returns the number
+	// of jobs moved.  Jobs pushed or enqueued to the old name afterwards
+	// go to the new one.
+	RenameQueue(from, to string) (uint64, error)
+	// RenamedQueue returns the new name of a renamed queue.
+	RenamedQueue(name string) (string, bool)
+
+	SetQueueLimits(limits func(queue string) (QueueLimit, bool))
+
+	// SetRate limits the jobs per second fetched from a queue,
+	// 0 removes the limit.
+	SetRate(qName string, perSec float64) error
+	Rates() map[string]float64
+
+	// SetHashRing sends jobs in the queue which have a HashKey only to
+	// the worker in +wids+ which the key hashes to, so the same key is
+	// always worked by the same worker.  No wids removes the ring.
+	SetHashRing(qName string, wids []string)
+	HashRings() map[string][]string
+	// SetLiveness tells the hash rings which workers are running, a
+	// key owned by a worker which isn't moves to the next one on the
+	// ring.  Every worker is assumed to be running until it's set.
+	SetLiveness(alive func(wid string) bool)
+
+	// SetRetryJitter adds up to +secs+ seconds, chosen at random, to
+	// the backoff of each retry so jobs which failed together don't
+	// all retry together.  Jobs may override it with their own jitter.
+	SetRetryJitter(secs int)
+
+	// SetSchedulerWorkers sets how many goroutines push the due jobs
+	// in the scheduled and retry sets, at least 1.  It takes effect
+	// immediately, even during a scan.
+	SetSchedulerWorkers(n int)
+	SchedulerWorkers() int
 
 	// Dispatch operations:
 	//
@@ -88,13 +146,54 @@ type Manager interface {
 
 	Fail(fail *FailPayload) error
 
+	// Remove a job from the working set without acknowledging
+	// or failing it.  Returns nil if the job is not being worked.
+	Unreserve(jid string) (*client.Job, error)
+
+	// Remove a job which is being worked or scheduled without
+	// acknowledging or failing it.  Returns nil if the job is in
+	// neither place.
+	Cancel(jid string) (*client.Job, error)
+
+	// Move a job being worked to the given queue if it fails or is
+	// requeued.  Returns false if the job is not being worked.
+	MoveWhenDone(jid string, queue string) (bool, error)
+
+	// Annotate sets a key in the annotations of a job being worked,
+	// persisted with its reservation.  They're kept if the job fails
+	// and discarded once it's acknowledged.
+	Annotate(jid string, key string, value string) error
+
 	// Allows arbitrary extension of a job's current reservation
 	// This is a no-op if you set the time before the current
 	// reservation expiry.
 	ExtendReservation(jid string, until time.Time) error
 
+	// The reservation for a job being worked, nil if the job
+	// is not being worked.
+	FindReservation(jid string) *Reservation
+
 	WorkingCount() int
 
+	// The number of jobs enqueued to the named queue since boot.
+	EnqueuedCount(qName string) int64
+
+	// The number of jobs processed and failed for each jobtype since boot.
+	JobtypeStats() map[string]JobtypeStats
+	// Zero the per-jobtype counters, returning their values beforehand.
+	ResetJobtypeStats() map[string]JobtypeStats
+
+	// Push every job in the working set back onto its queue,
+	// used when shutting down with jobs still in progress.
+	RequeueAll() (int, error)
+
+	// Push the jobs reserved by the given worker back onto their
+	// queues, e.g. when the worker process has crashed.
+	RequeueWorker(wid string) (int, error)
+
+	// The JIDs of the jobs bearing the tag which haven't finished yet.
+	TaggedJobs(tag string) ([]string, error)
+
 	ReapExpiredJobs(when time.Time) (int64, error)
 
 	// Purge deletes all dead jobs
@@ -106,6 +205,38 @@ type Manager interface {
 	// RetryJobs enqueues failed jobs
 	RetryJobs(when time.Time) (int64, error)
 
+	// Waiting reports whether the job is waiting for its depends_on.
+	Waiting(jid string) (bool, error)
+
+	// ExpireWaitingJobs sends the jobs which have waited too long for
+	// their depends_on to the dead set.
+	ExpireWaitingJobs(when time.Time) (int64, error)
+
+	// Removed tidies up after a job which was deleted or killed rather
+	// than acknowledged or failed: it's untagged and the jobs which
+	// depend on it are sent to the dead set.
+	Removed(job *client.Job)
+
+	// SetJobs and QueueJobs return the jobs an operator is about to
+	// clear from a set or queue, to pass to Removed once it's cleared.
+	SetJobs(set storage.SortedSet) ([]*client.Job, error)
+	QueueJobs(q storage.Queue) ([]*client.Job, error)
+
+	// Schedule registers a job to be pushed every time the given
+	// cron expression matches.
+	Schedule(expr string, job *client.Job) (*RecurringJob, error)
+	Schedules() ([]*RecurringJob, error)
+	Unschedule(id string) (bool, error)
+
+	// EnqueueRecurringJobs pushes recurring jobs which are due
+	EnqueueRecurringJobs(when time.Time) (int64, error)
+
+	// Batches group jobs and push a callback job once they finish.
+	NewBatch(def *client.Batch) (string, error)
+	OpenBatch(bid string) error
+	CommitBatch(bid string) error
+	BatchStatus(bid string) (*client.BatchStatus, error)
+
 	BusyCount(wid string) int
 
 	AddMiddleware(fntype string, fn MiddlewareFunc)
@@ -121,17 +252,38 @@ func NewManager(s storage.Store) Manager {
 
 func newManager(s storage.Store) *manager {
 	m := &manager{
-		store:      s,
-		workingMap: map[string]*Reservation{},
-		pushChain:  make(MiddlewareChain, 0),
-		failChain:  make(MiddlewareChain, 0),
-		ackChain:   make(MiddlewareChain, 0),
-		fetchChain: make(MiddlewareChain, 0),
+		store:        s,
+		workingMap:   map[string]*Reservation{},
+		workerCounts: map[string]int{},
+		pushChain:    make(MiddlewareChain, 0),
+		failChain:    make(MiddlewareChain, 0),
+		ackChain:     make(MiddlewareChain, 0),
+		fetchChain:   make(MiddlewareChain, 0),
+		rates:        map[string]*rateLimiter{},
+		rings:        map[string]*hashring.Ring{},
+
+		schedulerPool: newWorkerPool(1),
 	}
 	_ = m.loadWorkingSet()
-	p, _ := s.PausedQueues()
+	// paused queues are stored in Redis so they stay paused across restarts
+	p, err := s.PausedQueues()
+	if err != nil {
+		util.Error("Unable to load paused queues", err)
+	}
 	m.paused = p
+	m.renames = map[string]string{}
+	if rs, ok := s.(storage.Renamable); ok {
+		renames, err := rs.QueueRenames()
+		if err != nil {
+			util.Error("Unable to load renamed queues", err)
+		} else {
+			m.renames = renames
+		}
+	}
 	m.fetcher = BasicFetcher(m.Redis())
+	if es, ok := s.(storage.Encryptable); ok {
+		m.cipher = es.Cipher()
+	}
 	return m
 }
 
@@ -176,6 +328,7 @@ type manager struct {
 	// When client ack's JID, we can lookup reservation
 	// and remove stored entry quickly.
 	workingMap   map[string]*Reservation
+	workerCounts map[string]int
 	workingMutex sync.RWMutex
 	pushChain    MiddlewareChain
 	fetchChain   MiddlewareChain
@@ -183,20 +336,105 @@ type manager struct {
 	ackChain     MiddlewareChain
 	fetcher      Fetcher
 	paused       []string
+	pausedMutex  sync.RWMutex
+	// set if the store encrypts enqueued payloads
+	cipher *storage.PayloadCipher
+
+	// queue name -> *rateLimiter
+	rates      map[string]*rateLimiter
+	ratesMutex sync.RWMutex
+
+	// queue name -> worker ring, see SetHashRing
+	rings      map[string]*hashring.Ring
+	ringsMutex sync.RWMutex
+	// see SetLiveness
+	alive func(wid string) bool
+
+	// old queue name -> new, see RenameQueue
+	renames      map[string]string
+	renamesMutex sync.RWMutex
+
+	// see SetQueueLimits
+	limits      func(queue string) (QueueLimit, bool)
+	limitsMutex sync.RWMutex
+
+	// see Annotate
+	annotateMutex sync.Mutex
+
+	// seconds, see SetRetryJitter
+	retryJitter int64
+
+	// see SetSchedulerWorkers
+	schedulerPool *workerPool
+
+	// queue name -> *int64
+	enqueuedCounts sync.Map
+	// jobtype -> *JobtypeStats
+	jobtypeStats sync.Map
 }
 
 func (m *manager) Push(job *client.Job) error {
+	t, err := m.validate(job)
+	if err != nil {
+		return err
+	}
+	return m.push(job, t)
+}
+
+// PushBulk validates every job before pushing any of them so a
+// malformed job rejects the whole batch.  Jobs are then pushed in
+// order; if one fails to push, the jobs before it remain enqueued
+// and the returned count reflects how many were pushed.
+func (m *manager) PushBulk(jobs []*client.Job) (int, error) {
+	times := make([]time.Time, len(jobs))
+	for idx, job := range jobs {
+		t, err := m.validate(job)
+		if err != nil {
+			return 0, fmt.Errorf("Job %d: %w", idx, err)
+		}
+		times[idx] = t
+	}
+
+	for idx, job := range jobs {
+		err := m.push(job, times[idx])
+		if err != nil {
+			return idx, err
+		}
+	}
+	return len(jobs), nil
+}
+
+// Check the job for required attributes, fill in defaults and
+// parse the scheduled time if there is one.
+func (m *manager) validate(job *client.Job) (time.Time, error) {
+	var t time.Time
 	if job.Jid == "" || len(job.Jid) < 8 {
-		return fmt.Errorf("All jobs must have a reasonable jid parameter")
+		return t, invalid("All jobs must have a reasonable jid parameter")
 	}
 	if job.Type == "" {
-		return fmt.Errorf("All jobs must have a jobtype parameter")
+		return t, invalid("All jobs must have a jobtype parameter")
 	}
 	if job.Args == nil {
-		return fmt.Errorf("All jobs must have an args parameter")
+		return t, invalid("All jobs must have an args parameter")
 	}
 	if job.ReserveFor > 86400 {
-		return fmt.Errorf("Jobs cannot be reserved for more than one day")
+		return t, invalid("Jobs cannot be reserved for more than one day")
+	}
+	if job.Priority != 0 && (job.Priority < storage.MinPriority || job.Priority > storage.MaxPriority) {
+		return t, invalid("Job priority must be between %d and %d", storage.MinPriority, storage.MaxPriority)
+	}
+	if job.Jitter != nil && *job.Jitter < 0 {
+		return t, invalid("Job jitter must not be negative")
+	}
+
+	for _, dep := range job.DependsOn {
+		if dep == "" || dep == job.Jid {
+			return t, invalid("Invalid dependency %q, depends_on must list other jobs' JIDs", dep)
+		}
+	}
+
+	if err := m.checkBatchExists(job); err != nil {
+		return t, err
 	}
 
 	if job.CreatedAt == "" {
@@ -206,17 +444,31 @@ func (m *manager) Push(job *client.Job) error {
 	if job.Queue == "" {
 		job.Queue = "default"
 	}
+	job.Queue = m.queueName(job.Queue)
 
-	var err error
-	var t time.Time
 	if job.At != "" {
-		t, err = util.ParseTime(job.At)
+		parsed, err := util.ParseTime(job.At)
 		if err != nil {
-			return fmt.Errorf("Invalid timestamp for 'at': '%s'", job.At)
+			return t, invalid("Invalid timestamp for 'at': '%s'", job.At)
+		}
+		t = parsed
+	}
+	return t, nil
+}
+
+func (m *manager) push(job *client.Job, t time.Time) error {
+	var err error
+	if job.UniqueFor > 0 {
+		err = m.lockUnique(job)
+		if err != nil {
+			return err
 		}
 	}
 
 	err = callMiddleware(m.pushChain, Ctx{context.Background(), job, m, nil}, func() error {
+		if len(job.DependsOn) > 0 {
+			return m.waitForDependencies(job)
+		}
 		if job.At != "" {
 			if t.After(time.Now()) {
 				data, err := json.Marshal(job)
@@ -228,17 +480,40 @@ func (m *manager) Push(job *client.Job) error {
 				return m.store.Scheduled().AddElement(job.At, job.Jid, data)
 			}
 		}
-		return m.enqueue(job)
+		return m.enqueueWithin(job, true)
 	})
 	if err != nil {
 		if k, ok := err.(KnownError); ok {
 			util.Infof("JID %s: %s", job.Jid, k.Error())
 		}
+		if rerr := m.releaseUnique(job); rerr != nil {
+			util.Error("Unable to release unique lock for "+job.Jid, rerr)
+		}
+		if errors.Is(err, ErrJobDropped) {
+			util.Infof("JID %s: dropped, queue %s is full", job.Jid, job.Queue)
+			return nil
+		}
+		return err
+	}
+
+	if err := m.batchJobPushed(job); err != nil {
+		util.Error("Unable to add job to batch "+job.Jid, err)
+	}
+	if err := m.tagJob(job); err != nil {
+		util.Error("Unable to index tags for "+job.Jid, err)
 	}
-	return err
+	return nil
 }
 
 func (m *manager) enqueue(job *client.Job) error {
+	return m.enqueueWithin(job, false)
+}
+
+// Enqueue the job, within its queue's limit if +limited+ is set, see
+// SetQueueLimits.
+func (m *manager) enqueueWithin(job *client.Job, limited bool) error {
+	// e.g. a retry of a job from a queue since renamed
+	job.Queue = m.queueName(job.Queue)
 	q, err := m.store.GetQueue(job.Queue)
 	if err != nil {
 		return err
@@ -250,5 +525,43 @@ func (m *manager) enqueue(job *client.Job) error {
 		return err
 	}
 	//util.Debugf("pushed: %+v", job)
-	return q.Push(data)
+	pq, ok := q.(storage.PriorityQueue)
+	limit, bounded := m.queueLimit(job.Queue)
+	switch {
+	case ok && limited && bounded:
+		var dropped []byte
+		dropped, err = pq.PushBounded(job.Priority, data, limit.Size, limit.Policy == DropOldest)
+		if errors.Is(err, storage.ErrQueueFull) && limit.Policy == DropNewest {
+			return ErrJobDropped
+		}
+		if dropped != nil {
+			m.dropped(dropped)
+		}
+	case ok:
+		err = pq.PushPriority(job.Priority, data)
+	default:
+		err = q.Push(data)
+	}
+	if err != nil {
+		return err
+	}
+
+	m.countEnqueued(job.Queue)
+	return nil
+}
+
+func (m *manager) countEnqueued(qName string) {
+	val, ok := m.enqueuedCounts.Load(qName)
+	if !ok {
+		val, _ = m.enqueuedCounts.LoadOrStore(qName, new(int64))
+	}
+	atomic.AddInt64(val.(*int64), 1)
+}
+
+func (m *manager) EnqueuedCount(qName string) int64 {
+	val, ok := m.enqueuedCounts.Load(qName)
+	if !ok {
+		return 0
+	}
+	return atomic.LoadInt64(val.(*int64))
 }
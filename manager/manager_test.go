@@ -2,6 +2,7 @@ package manager
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"testing"
@@ -17,6 +18,83 @@ func TestManagerBasics(t *testing.T) {
 	t.Parallel()
 	assert.Equal(t, []string{"b", "c"}, filter([]string{"a"}, []string{"a", "b", "c"}))
 	assert.Equal(t, []string{"a"}, filter([]string{"c", "b"}, []string{"a", "b", "c"}))
+	assert.Equal(t, []string{"a", "c"}, without([]string{"a", "b", "c"}, "b"))
+}
+
+func TestLabelsMatch(t *testing.T) {
+	t.Parallel()
+
+	job := client.NewJob("ResizeImage", 1)
+	assert.True(t, labelsMatch(job, nil))
+	assert.True(t, labelsMatch(job, []string{"mailer"}))
+
+	job.Labels = []string{"image_processing"}
+	assert.True(t, labelsMatch(job, nil))
+	assert.True(t, labelsMatch(job, []string{"golang", "image_processing"}))
+	assert.True(t, labelsMatch(job, []string{"ResizeImage"}))
+	assert.False(t, labelsMatch(job, []string{"golang", "mailer"}))
+
+	ctx := WithLabels(context.Background(), []string{"mailer"})
+	assert.Equal(t, []string{"mailer"}, labelsFrom(ctx))
+	assert.Nil(t, labelsFrom(context.Background()))
+}
+
+func TestUniqueKey(t *testing.T) {
+	t.Parallel()
+
+	job := client.NewJob("SomeJob", 1, "two")
+	key, err := uniqueKey(job)
+	assert.NoError(t, err)
+	assert.Regexp(t, "^unique:[0-9a-f]{64}$", key)
+
+	same := client.NewJob("SomeJob", 1, "two")
+	skey, err := uniqueKey(same)
+	assert.NoError(t, err)
+	assert.Equal(t, key, skey)
+
+	other := client.NewJob("SomeJob", 1, "two")
+	other.Queue = "critical"
+	okey, err := uniqueKey(other)
+	assert.NoError(t, err)
+	assert.NotEqual(t, key, okey)
+
+	other = client.NewJob("SomeJob", 2, "two")
+	okey, err = uniqueKey(other)
+	assert.NoError(t, err)
+	assert.NotEqual(t, key, okey)
+}
+
+func TestJobtypeStats(t *testing.T) {
+	t.Parallel()
+
+	m := &manager{}
+	assert.Empty(t, m.JobtypeStats())
+
+	m.countProcessed("SendEmail", false)
+	m.countProcessed("SendEmail", true)
+	m.countProcessed("ResizeImage", false)
+
+	stats := m.JobtypeStats()
+	assert.Equal(t, JobtypeStats{Processed: 2, Failures: 1}, stats["SendEmail"])
+	assert.Equal(t, JobtypeStats{Processed: 1, Failures: 0}, stats["ResizeImage"])
+
+	assert.Equal(t, stats, m.ResetJobtypeStats())
+	assert.Equal(t, JobtypeStats{}, m.JobtypeStats()["SendEmail"])
+	m.countProcessed("SendEmail", true)
+	assert.Equal(t, JobtypeStats{Processed: 1, Failures: 1}, m.JobtypeStats()["SendEmail"])
+}
+
+func TestRecordRename(t *testing.T) {
+	t.Parallel()
+
+	renames := map[string]string{}
+	recordRename(renames, "images", "thumbnails")
+	recordRename(renames, "thumbnails", "previews")
+	assert.Equal(t, map[string]string{"images": "previews", "thumbnails": "previews"}, renames)
+
+	// the old name reused
+	recordRename(renames, "other", "images")
+	assert.Equal(t, map[string]string{"other": "images", "thumbnails": "previews"}, renames)
 }
 
 func TestManager(t *testing.T) {
@@ -98,6 +176,418 @@ func TestManager(t *testing.T) {
 			assert.Empty(t, job.EnqueuedAt)
 		})
 
+		t.Run("PushJobWithPriority", func(t *testing.T) {
+			store.Flush()
+			m := NewManager(store)
+
+			q, err := store.GetQueue("default")
+			assert.NoError(t, err)
+
+			low := client.NewJob("LowJob")
+			low.Args = []interface{}{}
+			low.Priority = 1
+			err = m.Push(low)
+			assert.NoError(t, err)
+
+			high := client.NewJob("HighJob")
+			high.Args = []interface{}{}
+			high.Priority = 9
+			err = m.Push(high)
+			assert.NoError(t, err)
+			assert.EqualValues(t, 2, q.Size())
+
+			invalid := client.NewJob("InvalidJob", 1)
+			invalid.Priority = 10
+			err = m.Push(invalid)
+			assert.Error(t, err)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+			job, err := m.Fetch(ctx, "workerId", "default")
+			assert.NoError(t, err)
+			assert.Equal(t, high.Jid, job.Jid)
+			job, err = m.Fetch(ctx, "workerId", "default")
+			assert.NoError(t, err)
+			assert.Equal(t, low.Jid, job.Jid)
+		})
+
+		t.Run("PushBulk", func(t *testing.T) {
+			store.Flush()
+			m := NewManager(store)
+
+			q, err := store.GetQueue("default")
+			assert.NoError(t, err)
+
+			jobs := []*client.Job{
+				client.NewJob("FirstJob", 1),
+				client.NewJob("SecondJob", 2),
+			}
+			count, err := m.PushBulk(jobs)
+			assert.NoError(t, err)
+			assert.Equal(t, 2, count)
+			assert.EqualValues(t, 2, q.Size())
+
+			invalid := client.NewJob("InvalidJob", 3)
+			invalid.Jid = ""
+			count, err = m.PushBulk([]*client.Job{client.NewJob("ThirdJob", 3), invalid})
+			assert.Error(t, err)
+			assert.Equal(t, 0, count)
+			assert.EqualValues(t, 2, q.Size())
+		})
+
+		t.Run("FetchWithLabels", func(t *testing.T) {
+			store.Flush()
+			m := NewManager(store)
+
+			labeled := client.NewJob("SendEmail", 1)
+			labeled.Labels = []string{"mailer"}
+			err := m.Push(labeled)
+			assert.NoError(t, err)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			job, err := m.Fetch(WithLabels(ctx, []string{"golang"}), "workerId", "default")
+			assert.NoError(t, err)
+			assert.Nil(t, job)
+
+			q, err := store.GetQueue("default")
+			assert.NoError(t, err)
+			assert.EqualValues(t, 1, q.Size())
+
+			ctx, cancel = context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+			job, err = m.Fetch(WithLabels(ctx, []string{"golang", "mailer"}), "workerId", "default")
+			assert.NoError(t, err)
+			assert.NotNil(t, job)
+			assert.Equal(t, labeled.Jid, job.Jid)
+		})
+
+		t.Run("FetchPastUnmatchedLabels", func(t *testing.T) {
+			store.Flush()
+			m := NewManager(store)
+
+			labeled := client.NewJob("SendEmail", 1)
+			labeled.Labels = []string{"mailer"}
+			assert.NoError(t, m.Push(labeled))
+			plain := client.NewJob("Report", 2)
+			assert.NoError(t, m.Push(plain))
+
+			// the head job isn't for this worker but doesn't block the next
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+			start := time.Now()
+			job, err := m.Fetch(WithLabels(ctx, []string{"golang"}), "workerId", "default")
+			assert.NoError(t, err)
+			assert.NotNil(t, job)
+			assert.Equal(t, plain.Jid, job.Jid)
+			assert.True(t, time.Since(start) < time.Second)
+
+			// and keeps its place for a worker it's meant for
+			job, err = m.Fetch(WithLabels(ctx, []string{"mailer"}), "workerId", "default")
+			assert.NoError(t, err)
+			assert.NotNil(t, job)
+			assert.Equal(t, labeled.Jid, job.Jid)
+		})
+
+		t.Run("PushToRenamedQueue", func(t *testing.T) {
+			store.Flush()
+			m := NewManager(store)
+
+			job := client.NewJob("Resize", 1)
+			job.Queue = "images"
+			assert.NoError(t, m.Push(job))
+			count, err := m.RenameQueue("images", "thumbnails")
+			assert.NoError(t, err)
+			assert.EqualValues(t, 1, count)
+
+			// pushed to the old name, or retried from it
+			job = client.NewJob("Resize", 2)
+			job.Queue = "images"
+			assert.NoError(t, m.Push(job))
+			assert.Equal(t, "thumbnails", job.Queue)
+			retried := client.NewJob("Resize", 3)
+			retried.Queue = "images"
+			assert.NoError(t, m.(*manager).enqueue(retried))
+
+			q, err := store.GetQueue("thumbnails")
+			assert.NoError(t, err)
+			assert.EqualValues(t, 3, q.Size())
+			names := []string{}
+			store.EachQueue(func(q storage.Queue) {
+				names = append(names, q.Name())
+			})
+			assert.Equal(t, []string{"thumbnails"}, names)
+
+			// remembered across restarts
+			to, ok := NewManager(store).RenamedQueue("images")
+			assert.True(t, ok)
+			assert.Equal(t, "thumbnails", to)
+		})
+
+		t.Run("FetchExpired", func(t *testing.T) {
+			store.Flush()
+			m := NewManager(store)
+
+			stale := client.NewJob("SendEmail", 1)
+			stale.ExpiresAt = util.Thens(time.Now().Add(-time.Minute))
+			err := m.Push(stale)
+			assert.NoError(t, err)
+			fresh := client.NewJob("SendEmail", 2)
+			err = m.Push(fresh)
+			assert.NoError(t, err)
+
+			job, err := m.Fetch(context.Background(), "workerId", "default")
+			assert.NoError(t, err)
+			assert.NotNil(t, job)
+			assert.Equal(t, fresh.Jid, job.Jid)
+			assert.EqualValues(t, 1, store.Dead().Size())
+		})
+
+		t.Run("PushWithinQueueLimit", func(t *testing.T) {
+			store.Flush()
+			m := NewManager(store)
+			limit := QueueLimit{Size: 1, Policy: RejectNew}
+			m.SetQueueLimits(func(queue string) (QueueLimit, bool) {
+				return limit, queue == "bulk"
+			})
+			q, err := store.GetQueue("bulk")
+			assert.NoError(t, err)
+
+			first := client.NewJob("Export", 1)
+			first.Queue = "bulk"
+			first.Tags = []string{"exports"}
+			assert.NoError(t, m.Push(first))
+
+			job := client.NewJob("Export", 2)
+			job.Queue = "bulk"
+			err = m.Push(job)
+			assert.True(t, errors.Is(err, storage.ErrQueueFull))
+
+			limit.Policy = DropNewest
+			job = client.NewJob("Export", 3)
+			job.Queue = "bulk"
+			job.Tags = []string{"exports"}
+			assert.NoError(t, m.Push(job))
+			assert.EqualValues(t, 1, q.Size())
+			jids, err := m.TaggedJobs("exports")
+			assert.NoError(t, err)
+			assert.Equal(t, []string{first.Jid}, jids)
+
+			// the first job makes room and is cleaned up
+			limit.Policy = DropOldest
+			job = client.NewJob("Export", 4)
+			job.Queue = "bulk"
+			assert.NoError(t, m.Push(job))
+			assert.EqualValues(t, 1, q.Size())
+			jids, err = m.TaggedJobs("exports")
+			assert.NoError(t, err)
+			assert.Empty(t, jids)
+		})
+
+		t.Run("TaggedJobs", func(t *testing.T) {
+			store.Flush()
+			m := NewManager(store)
+
+			acked := client.NewJob("Invoice", 1)
+			acked.Tags = []string{"customer-42", "billing"}
+			failed := client.NewJob("Invoice", 2)
+			failed.Tags = []string{"customer-42"}
+			failed.Retry = 0
+			assert.NoError(t, m.Push(acked))
+			assert.NoError(t, m.Push(failed))
+
+			jids, err := m.TaggedJobs("customer-42")
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, []string{acked.Jid, failed.Jid}, jids)
+			jids, err = m.TaggedJobs("billing")
+			assert.NoError(t, err)
+			assert.Equal(t, []string{acked.Jid}, jids)
+
+			for i := 0; i < 2; i++ {
+				job, err := m.Fetch(context.Background(), "workerId", "default")
+				assert.NoError(t, err)
+				if job.Jid == acked.Jid {
+					_, err = m.Acknowledge(job.Jid)
+				} else {
+					err = m.Fail(&FailPayload{Jid: job.Jid})
+				}
+				assert.NoError(t, err)
+			}
+
+			jids, err = m.TaggedJobs("customer-42")
+			assert.NoError(t, err)
+			assert.Empty(t, jids)
+		})
+
+		t.Run("DependsOn", func(t *testing.T) {
+			store.Flush()
+			m := NewManager(store)
+			q, err := store.GetQueue("default")
+			assert.NoError(t, err)
+
+			first := client.NewJob("Extract")
+			second := client.NewJob("Extract")
+			assert.NoError(t, m.Push(first))
+			assert.NoError(t, m.Push(second))
+
+			load := client.NewJob("Load")
+			load.DependsOn = []string{first.Jid, second.Jid}
+			assert.NoError(t, m.Push(load))
+			assert.EqualValues(t, 2, q.Size())
+			assert.EqualValues(t, 1, store.Waiting().Size())
+			// out of reach of the scheduler
+			assert.EqualValues(t, 0, store.Scheduled().Size())
+
+			for i := 0; i < 2; i++ {
+				job, err := m.Fetch(context.Background(), "workerId", "default")
+				assert.NoError(t, err)
+				_, err = m.Acknowledge(job.Jid)
+				assert.NoError(t, err)
+				// waits for both
+				assert.EqualValues(t, i, q.Size())
+			}
+			assert.EqualValues(t, 0, store.Waiting().Size())
+			job, err := m.Fetch(context.Background(), "workerId", "default")
+			assert.NoError(t, err)
+			assert.Equal(t, load.Jid, job.Jid)
+			assert.Empty(t, job.At)
+			_, err = m.Acknowledge(job.Jid)
+			assert.NoError(t, err)
+
+			// the dependency finished before this was pushed
+			later := client.NewJob("Load")
+			later.DependsOn = []string{first.Jid}
+			assert.NoError(t, m.Push(later))
+			assert.EqualValues(t, 1, q.Size())
+			assert.EqualValues(t, 0, store.Waiting().Size())
+			_, err = q.Clear()
+			assert.NoError(t, err)
+
+			// a dependency which dies takes its dependents, and
+			// theirs, to the dead set
+			doomed := client.NewJob("Extract")
+			doomed.Retry = -1
+			assert.NoError(t, m.Push(doomed))
+			child := client.NewJob("Load")
+			child.DependsOn = []string{doomed.Jid}
+			assert.NoError(t, m.Push(child))
+			grandchild := client.NewJob("Report")
+			grandchild.DependsOn = []string{child.Jid}
+			assert.NoError(t, m.Push(grandchild))
+			assert.EqualValues(t, 2, store.Waiting().Size())
+
+			job, err = m.Fetch(context.Background(), "workerId", "default")
+			assert.NoError(t, err)
+			assert.Equal(t, doomed.Jid, job.Jid)
+			assert.NoError(t, m.Fail(&FailPayload{Jid: job.Jid}))
+			assert.EqualValues(t, 0, store.Waiting().Size())
+			assert.EqualValues(t, 3, store.Dead().Size())
+
+			// as it does a job pushed after it died
+			orphan := client.NewJob("Load")
+			orphan.DependsOn = []string{doomed.Jid}
+			assert.NoError(t, m.Push(orphan))
+			assert.EqualValues(t, 0, store.Waiting().Size())
+			assert.EqualValues(t, 4, store.Dead().Size())
+
+			// a job waiting for a JID which never finishes gives up
+			unknown := client.NewJob("Load")
+			unknown.DependsOn = []string{"nosuchjob123"}
+			assert.NoError(t, m.Push(unknown))
+			count, err := m.ExpireWaitingJobs(time.Now())
+			assert.NoError(t, err)
+			assert.EqualValues(t, 0, count)
+			count, err = m.ExpireWaitingJobs(time.Now().Add(DependencyTimeout + time.Minute))
+			assert.NoError(t, err)
+			assert.EqualValues(t, 1, count)
+			assert.EqualValues(t, 0, store.Waiting().Size())
+			assert.EqualValues(t, 5, store.Dead().Size())
+			exists, err := store.(storage.Redis).Redis().Exists(dependsKey(unknown.Jid), dependentsKey("nosuchjob123")).Result()
+			assert.NoError(t, err)
+			assert.EqualValues(t, 0, exists)
+
+			self := client.NewJob("Load")
+			self.DependsOn = []string{self.Jid}
+			assert.Error(t, m.Push(self))
+		})
+
+		t.Run("RecurringJobs", func(t *testing.T) {
+			store.Flush()
+			m := NewManager(store)
+
+			q, err := store.GetQueue("default")
+			assert.NoError(t, err)
+
+			_, err = m.Schedule("not cron", client.NewJob("Cleanup"))
+			assert.Error(t, err)
+
+			job := client.NewJob("Cleanup")
+			job.Args = []interface{}{}
+			rj, err := m.Schedule("*/5 * * * *", job)
+			assert.NoError(t, err)
+			assert.NotEmpty(t, rj.ID)
+
+			schedules, err := m.Schedules()
+			assert.NoError(t, err)
+			assert.Len(t, schedules, 1)
+			assert.Equal(t, "*/5 * * * *", schedules[0].Cron)
+			assert.Equal(t, "Cleanup", schedules[0].Job.Type)
+
+			count, err := m.EnqueueRecurringJobs(time.Now())
+			assert.NoError(t, err)
+			assert.EqualValues(t, 0, count)
+			assert.EqualValues(t, 0, q.Size())
+
+			count, err = m.EnqueueRecurringJobs(time.Now().Add(6 * time.Minute))
+			assert.NoError(t, err)
+			assert.EqualValues(t, 1, count)
+			assert.EqualValues(t, 1, q.Size())
+
+			schedules, err = m.Schedules()
+			assert.NoError(t, err)
+			assert.NotEqual(t, rj.NextAt, schedules[0].NextAt)
+
+			ok, err := m.Unschedule(rj.ID)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			ok, err = m.Unschedule(rj.ID)
+			assert.NoError(t, err)
+			assert.False(t, ok)
+
+			schedules, err = m.Schedules()
+			assert.NoError(t, err)
+			assert.Len(t, schedules, 0)
+		})
+
+		t.Run("PushUniqueJob", func(t *testing.T) {
+			store.Flush()
+			m := NewManager(store)
+
+			job := client.NewJob("UniqueJob", 1, 2)
+			job.UniqueFor = 60
+			err := m.Push(job)
+			assert.NoError(t, err)
+
+			dupe := client.NewJob("UniqueJob", 1, 2)
+			dupe.UniqueFor = 60
+			err = m.Push(dupe)
+			assert.Equal(t, ErrDuplicate, err)
+
+			// not unique, always allowed
+			err = m.Push(client.NewJob("UniqueJob", 1, 2))
+			assert.NoError(t, err)
+
+			fetched, err := m.Fetch(context.Background(), "workerId", "default")
+			assert.NoError(t, err)
+			assert.Equal(t, job.Jid, fetched.Jid)
+			_, err = m.Acknowledge(job.Jid)
+			assert.NoError(t, err)
+
+			err = m.Push(dupe)
+			assert.NoError(t, err)
+		})
+
 		t.Run("PushScheduledJob", func(t *testing.T) {
 			store.Flush()
 			m := NewManager(store)
@@ -257,6 +747,10 @@ func TestManager(t *testing.T) {
 			pq, err = store.PausedQueues()
 			assert.NoError(t, err)
 			assert.Equal(t, []string{"default"}, pq)
+			assert.Equal(t, []string{"default"}, m.PausedQueues())
+
+			// a restarted server picks up the paused queues
+			assert.Equal(t, []string{"default"}, NewManager(store).PausedQueues())
 		})
 
 		t.Run("FetchFromMultipleQueues", func(t *testing.T) {
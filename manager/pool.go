@@ -0,0 +1,48 @@
+package manager
+
+import "sync"
+
+// A counting semaphore whose size can change while it's in use.
+// Shrinking it doesn't interrupt holders, later acquires wait until
+// fewer than the new size are busy.
+type workerPool struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	size int
+	busy int
+}
+
+func newWorkerPool(size int) *workerPool {
+	p := &workerPool{size: size}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+func (p *workerPool) acquire() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.busy >= p.size {
+		p.cond.Wait()
+	}
+	p.busy++
+}
+
+func (p *workerPool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.busy--
+	p.cond.Broadcast()
+}
+
+func (p *workerPool) resize(size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.size = size
+	p.cond.Broadcast()
+}
+
+func (p *workerPool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.size
+}
@@ -0,0 +1,75 @@
+package manager
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerPool(t *testing.T) {
+	t.Parallel()
+
+	p := newWorkerPool(2)
+	running, peak := int64(0), int64(0)
+	work := func(wg *sync.WaitGroup) {
+		p.acquire()
+		go func() {
+			defer wg.Done()
+			defer p.release()
+			n := atomic.AddInt64(&running, 1)
+			for {
+				old := atomic.LoadInt64(&peak)
+				if n <= old || atomic.CompareAndSwapInt64(&peak, old, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt64(&running, -1)
+		}()
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(10)
+	for i := 0; i < 10; i++ {
+		work(&wg)
+	}
+	wg.Wait()
+	assert.EqualValues(t, 2, peak)
+
+	// a waiting acquire is released by growing the pool
+	p.acquire()
+	p.acquire()
+	acquired := make(chan bool)
+	go func() {
+		p.acquire()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquired a full pool")
+	case <-time.After(10 * time.Millisecond):
+	}
+	p.resize(3)
+	<-acquired
+	assert.Equal(t, 3, p.Size())
+
+	// shrinking leaves the holders alone but blocks until enough release
+	p.resize(1)
+	acquired = make(chan bool)
+	go func() {
+		p.acquire()
+		close(acquired)
+	}()
+	p.release()
+	p.release()
+	select {
+	case <-acquired:
+		t.Fatal("acquired a shrunk pool")
+	case <-time.After(10 * time.Millisecond):
+	}
+	p.release()
+	<-acquired
+}
@@ -0,0 +1,68 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/util"
+)
+
+// What happens to a job pushed to a queue which already holds its
+// limit.
+const (
+	RejectNew  = "reject_new"
+	DropOldest = "drop_oldest"
+	DropNewest = "drop_newest"
+)
+
+// ErrJobDropped is returned from the push chain when a DropNewest limit
+// discards the job.  The push succeeds but the job isn't added to its
+// batch or tagged.
+var ErrJobDropped = errors.New("queue full, job dropped")
+
+type QueueLimit struct {
+	Size   uint64
+	Policy string
+}
+
+// SetQueueLimits sets the function which returns a queue's limit, false
+// if it has none.  Limits apply to jobs enqueued by a push, scheduled
+// jobs and jobs waiting on dependencies aren't counted until they're
+// enqueued and retries are never refused.
+func (m *manager) SetQueueLimits(limits func(queue string) (QueueLimit, bool)) {
+	m.limitsMutex.Lock()
+	defer m.limitsMutex.Unlock()
+	m.limits = limits
+}
+
+func (m *manager) queueLimit(queue string) (QueueLimit, bool) {
+	m.limitsMutex.RLock()
+	limits := m.limits
+	m.limitsMutex.RUnlock()
+	if limits == nil {
+		return QueueLimit{}, false
+	}
+	return limits(queue)
+}
+
+// The next job, removed by a DropOldest limit to make room, is cleaned
+// up as DEL would.  Its batch counts it as failed so the batch's
+// callbacks still fire.
+func (m *manager) dropped(data []byte) {
+	var job client.Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		util.Error("Unable to parse dropped job", err)
+		return
+	}
+	util.Infof("JID %s: dropped, queue %s is full", job.Jid, job.Queue)
+	if err := m.releaseUnique(&job); err != nil {
+		util.Error("Unable to release unique lock for "+job.Jid, err)
+	}
+	if err := m.untagJob(&job); err != nil {
+		util.Error("Unable to remove tags for "+job.Jid, err)
+	}
+	if err := m.batchJobFailed(&job); err != nil {
+		util.Error("Unable to update batch for "+job.Jid, err)
+	}
+}
@@ -0,0 +1,112 @@
+package manager
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Queue rate limits are kept in memory only and must be set again
+// after a restart.  A limit spaces out dequeues evenly with no burst:
+// at 2 jobs/sec, a job is handed out at most every 500ms.
+type rateLimiter struct {
+	mu       sync.Mutex
+	perSec   float64
+	interval time.Duration
+	// the earliest time the next job may be dequeued
+	next time.Time
+}
+
+func newRateLimiter(perSec float64) *rateLimiter {
+	return &rateLimiter{
+		perSec:   perSec,
+		interval: time.Duration(float64(time.Second) / perSec),
+	}
+}
+
+// Wait blocks until the next job may be dequeued.  If that would be
+// after the context's deadline, it returns immediately with an error
+// without using up the slot.
+func (rl *rateLimiter) Wait(ctx context.Context) error {
+	rl.mu.Lock()
+	now := time.Now()
+	at := rl.next
+	if at.Before(now) {
+		at = now
+	}
+	if deadline, ok := ctx.Deadline(); ok && at.After(deadline) {
+		rl.mu.Unlock()
+		return context.DeadlineExceeded
+	}
+	rl.next = at.Add(rl.interval)
+	rl.mu.Unlock()
+
+	delay := time.Until(at)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// The slowest rate, one job a day.  Slower rates would overflow the
+// interval between jobs.
+const MinRate = 1.0 / (24 * 60 * 60)
+
+// SetRate limits how many jobs per second can be fetched from
+// the queue.  A rate of 0 removes the limit.
+func (m *manager) SetRate(qName string, perSec float64) error {
+	if math.IsNaN(perSec) || math.IsInf(perSec, 0) {
+		return invalid("Rate must be a number")
+	}
+	if perSec < 0 {
+		return invalid("Rate must not be negative")
+	}
+	if perSec > 0 && perSec < MinRate {
+		return invalid("Rate must be at least %g jobs per second, one a day", MinRate)
+	}
+
+	m.ratesMutex.Lock()
+	defer m.ratesMutex.Unlock()
+	if perSec == 0 {
+		delete(m.rates, qName)
+		return nil
+	}
+	m.rates[qName] = newRateLimiter(perSec)
+	return nil
+}
+
+func (m *manager) Rates() map[string]float64 {
+	m.ratesMutex.RLock()
+	defer m.ratesMutex.RUnlock()
+
+	result := make(map[string]float64, len(m.rates))
+	for name, rl := range m.rates {
+		result[name] = rl.perSec
+	}
+	return result
+}
+
+// Fetch waits at most this long for a rate limited queue before
+// pushing the job back and returning nothing.
+const maxRateWait = 1 * time.Second
+
+func (m *manager) waitForRate(ctx context.Context, qName string) error {
+	m.ratesMutex.RLock()
+	rl, ok := m.rates[qName]
+	m.ratesMutex.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxRateWait)
+	defer cancel()
+	return rl.Wait(ctx)
+}
@@ -0,0 +1,52 @@
+package manager
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	t.Parallel()
+
+	rl := newRateLimiter(20)
+	assert.Equal(t, 50*time.Millisecond, rl.interval)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, rl.Wait(context.Background()))
+	}
+	elapsed := time.Since(start)
+	assert.True(t, elapsed >= 100*time.Millisecond, elapsed.String())
+
+	// the next slot is 50ms away, too late for this deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, rl.Wait(ctx))
+
+	// and the failed wait didn't use the slot up
+	next := rl.next
+	assert.NoError(t, rl.Wait(context.Background()))
+	assert.Equal(t, next.Add(rl.interval), rl.next)
+}
+
+func TestSetRate(t *testing.T) {
+	t.Parallel()
+
+	m := &manager{rates: map[string]*rateLimiter{}}
+	assert.Error(t, m.SetRate("stripe", -1))
+	assert.Error(t, m.SetRate("stripe", math.NaN()))
+	assert.Error(t, m.SetRate("stripe", math.Inf(1)))
+	assert.Error(t, m.SetRate("stripe", 1e-12))
+	assert.Empty(t, m.Rates())
+	assert.NoError(t, m.SetRate("stripe", 2.5))
+	assert.Equal(t, map[string]float64{"stripe": 2.5}, m.Rates())
+
+	assert.NoError(t, m.waitForRate(context.Background(), "default"))
+
+	assert.NoError(t, m.SetRate("stripe", 0))
+	assert.Empty(t, m.Rates())
+}
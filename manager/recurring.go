@@ -0,0 +1,166 @@
+package manager
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/util"
+	"github.com/go-redis/redis"
+)
+
+// Recurring jobs are stored in a Redis hash, keyed by ID, so they
+// survive restarts.  Each time a recurring job comes due, a copy of
+// its job is pushed with a fresh JID.
+const recurringKey = "recurring"
+
+type RecurringJob struct {
+	ID     string      `json:"id"`
+	Cron   string      `json:"cron"`
+	Job    *client.Job `json:"job"`
+	NextAt string      `json:"next_at"`
+}
+
+func (m *manager) Schedule(expr string, job *client.Job) (*RecurringJob, error) {
+	cs, err := parseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	if job.At != "" {
+		return nil, invalid("Recurring jobs cannot set 'at'")
+	}
+	if job.Jid == "" {
+		// each run gets its own JID, this only satisfies validation
+		job.Jid = util.RandomJid()
+	}
+	_, err = m.validate(job)
+	if err != nil {
+		return nil, err
+	}
+
+	next := cs.Next(time.Now())
+	if next.IsZero() {
+		return nil, invalid("Cron expression '%s' never matches", expr)
+	}
+
+	rj := &RecurringJob{
+		ID:     util.RandomJid(),
+		Cron:   expr,
+		Job:    job,
+		NextAt: util.Thens(next),
+	}
+	err = m.saveRecurring(rj)
+	if err != nil {
+		return nil, err
+	}
+	return rj, nil
+}
+
+// Schedules returns all recurring jobs, ordered by when they will next run.
+func (m *manager) Schedules() ([]*RecurringJob, error) {
+	vals, err := m.Redis().HGetAll(recurringKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*RecurringJob, 0, len(vals))
+	for id, data := range vals {
+		var rj RecurringJob
+		err := json.Unmarshal([]byte(data), &rj)
+		if err != nil {
+			util.Warnf("Unable to parse recurring job %s: %v", id, err)
+			continue
+		}
+		result = append(result, &rj)
+	}
+	// NextAt is always a whole minute so it sorts lexically
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].NextAt < result[j].NextAt
+	})
+	return result, nil
+}
+
+// EnqueueRecurringJobs pushes every recurring job which is due as of
+// +when+ and reschedules it for its next run.  A job which came due
+// several times while the server was down is only pushed once.
+func (m *manager) EnqueueRecurringJobs(when time.Time) (int64, error) {
+	schedules, err := m.Schedules()
+	if err != nil {
+		return 0, err
+	}
+
+	count := int64(0)
+	for _, rj := range schedules {
+		next, err := util.ParseTime(rj.NextAt)
+		if err != nil {
+			return count, err
+		}
+		if next.After(when) {
+			continue
+		}
+
+		cs, err := parseCron(rj.Cron)
+		if err != nil {
+			return count, err
+		}
+
+		job := *rj.Job
+		job.Jid = util.RandomJid()
+		job.CreatedAt = util.Nows()
+		err = m.Push(&job)
+		if err != nil && err != ErrDuplicate {
+			return count, err
+		}
+		if err == nil {
+			count++
+		}
+
+		rj.NextAt = util.Thens(cs.Next(when))
+		err = m.rescheduleRecurring(rj)
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// Unschedule removes the recurring job, returning false if there's no
+// recurring job with that ID.
+func (m *manager) Unschedule(id string) (bool, error) {
+	count, err := m.Redis().HDel(recurringKey, id).Result()
+	return count > 0, err
+}
+
+func (m *manager) saveRecurring(rj *RecurringJob) error {
+	data, err := json.Marshal(rj)
+	if err != nil {
+		return err
+	}
+	return m.Redis().HSet(recurringKey, rj.ID, data).Err()
+}
+
+// Save the recurring job's next run unless it was unscheduled while
+// it was being pushed.
+func (m *manager) rescheduleRecurring(rj *RecurringJob) error {
+	data, err := json.Marshal(rj)
+	if err != nil {
+		return err
+	}
+	err = m.Redis().Watch(func(tx *redis.Tx) error {
+		exists, err := tx.HExists(recurringKey, rj.ID).Result()
+		if err != nil || !exists {
+			return err
+		}
+		_, err = tx.TxPipelined(func(pipe redis.Pipeliner) error {
+			pipe.HSet(recurringKey, rj.ID, data)
+			return nil
+		})
+		return err
+	}, recurringKey)
+	if err == redis.TxFailedErr {
+		// unscheduled or rescheduled by another server in the meantime
+		return nil
+	}
+	return err
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math/rand"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/contribsys/faktory/client"
@@ -13,21 +14,50 @@ import (
 	"github.com/contribsys/faktory/util"
 )
 
+var (
+	// Returned by Fail when the job isn't in the working set, it may
+	// have already been acknowledged, failed or expired.
+	ErrJobNotFound = fmt.Errorf("Job not found")
+)
+
+// The furthest in the future a worker may ask for its job to be retried.
+const MaxRetryAt = 30 * 24 * time.Hour
+
 type FailPayload struct {
 	Jid          string   `json:"jid"`
 	ErrorMessage string   `json:"message"`
 	ErrorType    string   `json:"errtype"`
 	Backtrace    []string `json:"backtrace"`
+	// Optional RFC3339 time to retry the job rather than backing off,
+	// e.g. from an upstream API's Retry-After header.
+	RetryAt string `json:"retry_at,omitempty"`
+
+	retryAt time.Time
 }
 
 func (m *manager) Fail(failure *FailPayload) error {
 	if failure == nil {
-		return fmt.Errorf("No failure")
+		return invalid("No failure")
 	}
 
 	jid := failure.Jid
 	if jid == "" {
-		return fmt.Errorf("Missing JID")
+		return invalid("Missing JID")
+	}
+
+	if failure.RetryAt != "" {
+		at, err := time.Parse(time.RFC3339, failure.RetryAt)
+		if err != nil {
+			return invalid("Invalid retry_at %q, must be RFC3339", failure.RetryAt)
+		}
+		now := time.Now()
+		if at.Before(now) {
+			return invalid("Invalid retry_at %s, must not be in the past", failure.RetryAt)
+		}
+		if at.After(now.Add(MaxRetryAt)) {
+			return invalid("Invalid retry_at %s, must be within %v", failure.RetryAt, MaxRetryAt)
+		}
+		failure.retryAt = at
 	}
 
 	cleanse(failure)
@@ -71,7 +101,7 @@ func (m *manager) clearReservation(jid string) *Reservation {
 		return nil
 	}
 
-	delete(m.workingMap, jid)
+	m.removeReservation(res)
 	m.workingMutex.Unlock()
 	return res
 }
@@ -79,7 +109,7 @@ func (m *manager) clearReservation(jid string) *Reservation {
 func (m *manager) processFailure(jid string, failure *FailPayload) error {
 	res := m.clearReservation(jid)
 	if res == nil {
-		return fmt.Errorf("Job not found %s", jid)
+		return fmt.Errorf("%w %s", ErrJobNotFound, jid)
 	}
 
 	// Lease is in-memory only
@@ -106,6 +136,10 @@ func (m *manager) processFailure(jid string, failure *FailPayload) error {
 	_ = m.store.Failure()
 
 	job := res.Job
+	m.countProcessed(job.Type, true)
+	if res.moveTo != "" {
+		job.Queue = res.moveTo
+	}
 
 	if job.Failure != nil {
 		job.Failure.RetryCount++
@@ -122,20 +156,57 @@ func (m *manager) processFailure(jid string, failure *FailPayload) error {
 		}
 	}
 
+	if err := m.batchJobFailed(job); err != nil {
+		util.Error("Unable to update batch for "+jid, err)
+	}
+
 	return callMiddleware(m.failChain, Ctx{context.Background(), job, m, res}, func() error {
+		if job.Failure.RetryCount < job.Retry {
+			if !failure.retryAt.IsZero() {
+				return retryAt(m.store, job, failure.retryAt)
+			}
+			return retryLater(m.store, job, m.jitterFor(job))
+		}
+		if err := m.untagJob(job); err != nil {
+			util.Error("Unable to remove tags for "+jid, err)
+		}
+		if err := m.dependencyFailed(jid); err != nil {
+			util.Error("Unable to remove the jobs depending on "+jid, err)
+		}
 		if job.Retry == 0 {
 			// no retry, no death, completely ephemeral, goodbye
-			return nil
+			return m.releaseUnique(job)
 		}
-		if job.Failure.RetryCount < job.Retry {
-			return retryLater(m.store, job)
+		err := m.releaseUnique(job)
+		if err != nil {
+			return err
 		}
 		return sendToMorgue(m.store, job)
 	})
 }
 
-func retryLater(store storage.Store, job *client.Job) error {
-	when := util.Thens(nextRetry(job))
+func (m *manager) SetRetryJitter(secs int) {
+	atomic.StoreInt64(&m.retryJitter, int64(secs))
+}
+
+// The job's own jitter, even 0, overrides the server's.
+func (m *manager) jitterFor(job *client.Job) int {
+	if job.Jitter != nil {
+		return *job.Jitter
+	}
+	return int(atomic.LoadInt64(&m.retryJitter))
+}
+
+func retryLater(store storage.Store, job *client.Job, jitter int) error {
+	next := nextRetry(job)
+	if jitter > 0 {
+		next = next.Add(time.Duration(rand.Intn(jitter)) * time.Second)
+	}
+	return retryAt(store, job, next)
+}
+
+func retryAt(store storage.Store, job *client.Job, next time.Time) error {
+	when := util.Thens(next)
 	job.Failure.NextAt = when
 	bytes, err := json.Marshal(job)
 	if err != nil {
@@ -155,6 +226,8 @@ func sendToMorgue(store storage.Store, job *client.Job) error {
 	return store.Dead().AddElement(expiry, job.Jid, bytes)
 }
 
+// Exponential backoff with jitter, (count^4) + 15 + rand(30)*(count+1)
+// seconds: 15-44s for the first retry, roughly 20 days by the 25th.
 func nextRetry(job *client.Job) time.Time {
 	count := job.Failure.RetryCount
 	secs := (count * count * count * count) + 15 + (rand.Intn(30) * (count + 1))
@@ -1,13 +1,48 @@
 package manager
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/contribsys/faktory/client"
 	"github.com/contribsys/faktory/storage"
+	"github.com/contribsys/faktory/util"
 	"github.com/stretchr/testify/assert"
 )
 
+func TestNextRetry(t *testing.T) {
+	t.Parallel()
+
+	job := client.NewJob("ManagerPush", 1, 2, 3)
+	for _, count := range []int{0, 1, 5, 24} {
+		job.Failure = &client.Failure{RetryCount: count}
+		min := count*count*count*count + 15
+		max := min + 29*(count+1)
+
+		delay := time.Until(nextRetry(job))
+		assert.True(t, delay > time.Duration(min-1)*time.Second, "retry %d: %v", count, delay)
+		assert.True(t, delay <= time.Duration(max)*time.Second, "retry %d: %v", count, delay)
+	}
+}
+
+func TestJitterFor(t *testing.T) {
+	t.Parallel()
+
+	m := &manager{}
+	job := client.NewJob("ManagerPush", 1, 2, 3)
+	assert.Equal(t, 0, m.jitterFor(job))
+
+	m.SetRetryJitter(30)
+	assert.Equal(t, 30, m.jitterFor(job))
+
+	job.SetJitter(5)
+	assert.Equal(t, 5, m.jitterFor(job))
+
+	job.SetJitter(0)
+	assert.Equal(t, 0, m.jitterFor(job))
+}
+
 func TestRetry(t *testing.T) {
 	withRedis(t, "retry", func(t *testing.T, store storage.Store) {
 
@@ -110,9 +145,51 @@ func TestRetry(t *testing.T) {
 			assert.Error(t, err)
 			assert.Contains(t, err.Error(), "not found")
 		})
+
+		t.Run("FailWithRetryAt", func(t *testing.T) {
+			store.Flush()
+			m := newManager(store)
+
+			job := client.NewJob("ManagerPush", 1, 2, 3)
+			lease := &simpleLease{job: job}
+			err := m.reserve("workerId", lease)
+			assert.NoError(t, err)
+
+			at := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+			fail := failure(job.Jid, "rate limited", "TooManyRequests", nil)
+			fail.RetryAt = at.Format(time.RFC3339)
+			err = m.Fail(fail)
+			assert.NoError(t, err)
+			assert.EqualValues(t, 1, store.Retries().Size())
+
+			err = store.Retries().Each(func(idx int, entry storage.SortedEntry) error {
+				retried, err := entry.Job()
+				assert.NoError(t, err)
+				next, err := util.ParseTime(retried.Failure.NextAt)
+				assert.NoError(t, err)
+				assert.True(t, at.Equal(next), "%v != %v", at, next)
+				return nil
+			})
+			assert.NoError(t, err)
+		})
 	})
 }
 
+func TestFailRetryAtLimits(t *testing.T) {
+	t.Parallel()
+
+	m := &manager{}
+	for _, at := range []string{
+		"tomorrow",
+		time.Now().Add(-time.Minute).Format(time.RFC3339),
+		time.Now().Add(MaxRetryAt + time.Hour).Format(time.RFC3339),
+	} {
+		err := m.Fail(&FailPayload{Jid: "abc", RetryAt: at})
+		var ve *ValidationError
+		assert.True(t, errors.As(err, &ve), "%s: %v", at, err)
+	}
+}
+
 func failure(jid, msg, errtype string, bt []string) *FailPayload {
 	var f FailPayload
 	f.Jid = jid
@@ -3,6 +3,8 @@ package manager
 import (
 	"encoding/json"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/contribsys/faktory/client"
@@ -32,9 +34,25 @@ func (m *manager) RetryJobs(when time.Time) (int64, error) {
 	return m.schedule(when, m.store.Retries())
 }
 
+func (m *manager) SetSchedulerWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+	m.schedulerPool.resize(n)
+}
+
+func (m *manager) SchedulerWorkers() int {
+	return m.schedulerPool.Size()
+}
+
+// Each due job is pushed by a goroutine from schedulerPool, so up to
+// SchedulerWorkers jobs are pushed at once.  Every batch finishes
+// before the next is read so a job can't be removed twice.
 func (m *manager) schedule(when time.Time, set storage.SortedSet) (int64, error) {
 	total := int64(0)
 	for {
+		var wg sync.WaitGroup
+		failed := int64(0)
 		count, err := set.RemoveBefore(util.Thens(when), 100, func(data []byte) error {
 			var job client.Job
 			err := json.Unmarshal(data, &job)
@@ -42,13 +60,20 @@ func (m *manager) schedule(when time.Time, set storage.SortedSet) (int64, error)
 				return err
 			}
 
-			err = m.enqueue(&job)
-			if err != nil {
-				return fmt.Errorf("Error pushing job to '%s': %w", job.Queue, err)
-			}
+			m.schedulerPool.acquire()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer m.schedulerPool.release()
+				if err := m.due(&job, when); err != nil {
+					util.Warnf("Unable to process timed job: %v", err)
+					atomic.AddInt64(&failed, 1)
+				}
+			}()
 			return nil
 		})
-		total += count
+		wg.Wait()
+		total += count - atomic.LoadInt64(&failed)
 		if err != nil {
 			return total, err
 		}
@@ -58,3 +83,16 @@ func (m *manager) schedule(when time.Time, set storage.SortedSet) (int64, error)
 	}
 	return total, nil
 }
+
+// Push a job whose time has come, unless it has expired.
+func (m *manager) due(job *client.Job, when time.Time) error {
+	if expired(job, when) {
+		return m.expire(job)
+	}
+
+	err := m.enqueue(job)
+	if err != nil {
+		return fmt.Errorf("Error pushing job to '%s': %w", job.Queue, err)
+	}
+	return nil
+}
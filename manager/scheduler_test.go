@@ -102,6 +102,45 @@ func TestScheduler(t *testing.T) {
 			assert.EqualValues(t, 2, store.Scheduled().Size())
 		})
 
+		t.Run("EnqueueScheduledJobsInParallel", func(t *testing.T) {
+			store.Flush()
+			m := NewManager(store)
+			m.SetSchedulerWorkers(8)
+			assert.Equal(t, 8, m.SchedulerWorkers())
+
+			q, err := store.GetQueue("default")
+			assert.NoError(t, err)
+			// more than one batch
+			for i := 0; i < 250; i++ {
+				addJob(t, store.Scheduled(), util.Thens(time.Now()), client.NewJob("ScheduledJob", i))
+			}
+
+			count, err := m.EnqueueScheduledJobs(time.Now())
+			assert.NoError(t, err)
+			assert.EqualValues(t, 250, count)
+			assert.EqualValues(t, 250, q.Size())
+			assert.EqualValues(t, 0, store.Scheduled().Size())
+		})
+
+		t.Run("ExpireScheduledJobs", func(t *testing.T) {
+			store.Flush()
+			m := NewManager(store)
+
+			job := client.NewJob("ExpiredJob", 1, 2, 3)
+			job.ExpiresAt = util.Thens(time.Now().Add(-time.Minute))
+			q, err := store.GetQueue(job.Queue)
+			assert.NoError(t, err)
+
+			addJob(t, store.Scheduled(), util.Thens(time.Now()), job)
+
+			count, err := m.EnqueueScheduledJobs(time.Now())
+			assert.NoError(t, err)
+			assert.EqualValues(t, 1, count)
+			assert.EqualValues(t, 0, q.Size())
+			assert.EqualValues(t, 0, store.Scheduled().Size())
+			assert.EqualValues(t, 1, store.Dead().Size())
+		})
+
 		t.Run("RetryJobs", func(t *testing.T) {
 			store.Flush()
 			m := NewManager(store)
@@ -126,6 +165,24 @@ func TestScheduler(t *testing.T) {
 	})
 }
 
+func TestExpired(t *testing.T) {
+	now := time.Now()
+
+	job := client.NewJob("Report")
+	assert.False(t, expired(job, now))
+
+	job.ExpiresAt = util.Thens(now.Add(time.Minute))
+	assert.False(t, expired(job, now))
+	job.ExpiresAt = util.Thens(now.Add(-time.Minute))
+	assert.True(t, expired(job, now))
+
+	job = client.NewJob("Report").SetExpiresAt(now.Add(-time.Minute))
+	assert.True(t, expired(job, now))
+
+	job.ExpiresAt = "yesterday"
+	assert.False(t, expired(job, now))
+}
+
 func addJob(t *testing.T, set storage.SortedSet, timestamp string, job *client.Job) {
 	data, err := json.Marshal(job)
 	assert.NoError(t, err)
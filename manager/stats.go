@@ -0,0 +1,52 @@
+package manager
+
+import (
+	"sync/atomic"
+)
+
+// Per-jobtype counters are kept in memory only and reset when the
+// server restarts, the store keeps the persistent totals.
+type JobtypeStats struct {
+	Processed int64 `json:"processed"`
+	Failures  int64 `json:"failures"`
+}
+
+func (m *manager) countProcessed(jobtype string, failed bool) {
+	val, ok := m.jobtypeStats.Load(jobtype)
+	if !ok {
+		val, _ = m.jobtypeStats.LoadOrStore(jobtype, &JobtypeStats{})
+	}
+	stats := val.(*JobtypeStats)
+	// like the store's totals, a failure counts as processed too
+	atomic.AddInt64(&stats.Processed, 1)
+	if failed {
+		atomic.AddInt64(&stats.Failures, 1)
+	}
+}
+
+func (m *manager) JobtypeStats() map[string]JobtypeStats {
+	result := map[string]JobtypeStats{}
+	m.jobtypeStats.Range(func(key, val interface{}) bool {
+		stats := val.(*JobtypeStats)
+		result[key.(string)] = JobtypeStats{
+			Processed: atomic.LoadInt64(&stats.Processed),
+			Failures:  atomic.LoadInt64(&stats.Failures),
+		}
+		return true
+	})
+	return result
+}
+
+// Zero every jobtype's counters, returning their values beforehand.
+func (m *manager) ResetJobtypeStats() map[string]JobtypeStats {
+	result := map[string]JobtypeStats{}
+	m.jobtypeStats.Range(func(key, val interface{}) bool {
+		stats := val.(*JobtypeStats)
+		result[key.(string)] = JobtypeStats{
+			Processed: atomic.SwapInt64(&stats.Processed, 0),
+			Failures:  atomic.SwapInt64(&stats.Failures, 0),
+		}
+		return true
+	})
+	return result
+}
@@ -0,0 +1,90 @@
+package manager
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/storage"
+	"github.com/go-redis/redis"
+)
+
+// Each tag is indexed as a Redis set, "tag:<tag>", holding the JIDs of
+// the jobs bearing it.  A job is added when pushed and removed once it
+// is acknowledged, fails permanently, expires, is cancelled, deleted
+// or killed, or its queue or set is cleared, so the index only holds
+// jobs which may still run.
+
+func tagKey(tag string) string {
+	return "tag:" + tag
+}
+
+func (m *manager) tagJob(job *client.Job) error {
+	if len(job.Tags) == 0 {
+		return nil
+	}
+	_, err := m.Redis().Pipelined(func(pipe redis.Pipeliner) error {
+		for _, tag := range job.Tags {
+			if tag != "" {
+				pipe.SAdd(tagKey(tag), job.Jid)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func (m *manager) untagJob(job *client.Job) error {
+	if len(job.Tags) == 0 {
+		return nil
+	}
+	_, err := m.Redis().Pipelined(func(pipe redis.Pipeliner) error {
+		for _, tag := range job.Tags {
+			if tag != "" {
+				pipe.SRem(tagKey(tag), job.Jid)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func (m *manager) TaggedJobs(tag string) ([]string, error) {
+	jids, err := m.Redis().SMembers(tagKey(tag)).Result()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(jids)
+	return jids, nil
+}
+
+func (m *manager) SetJobs(set storage.SortedSet) ([]*client.Job, error) {
+	// dead jobs were tidied up when they died
+	if set.Name() == m.store.Dead().Name() {
+		return nil, nil
+	}
+	var jobs []*client.Job
+	err := set.Each(func(idx int, ent storage.SortedEntry) error {
+		job, err := ent.Job()
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, job)
+		return nil
+	})
+	return jobs, err
+}
+
+func (m *manager) QueueJobs(q storage.Queue) ([]*client.Job, error) {
+	var jobs []*client.Job
+	err := q.Each(func(idx int, data []byte) error {
+		var job client.Job
+		err := json.Unmarshal(data, &job)
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, &job)
+		return nil
+	})
+	return jobs, err
+}
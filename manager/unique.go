@@ -0,0 +1,75 @@
+package manager
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/go-redis/redis"
+)
+
+// Jobs which set unique_for are fingerprinted by (jobtype, queue, args).
+// While the fingerprint's lock exists, any other push of an identical
+// job is rejected.  The lock is released when the job is acknowledged
+// or fails permanently, otherwise it expires after unique_for seconds.
+
+var (
+	ErrDuplicate = fmt.Errorf("duplicate")
+)
+
+func uniqueKey(job *client.Job) (string, error) {
+	args, err := json.Marshal(job.Args)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	hash.Write([]byte(job.Type))
+	hash.Write([]byte{0})
+	hash.Write([]byte(job.Queue))
+	hash.Write([]byte{0})
+	hash.Write(args)
+	return fmt.Sprintf("unique:%x", hash.Sum(nil)), nil
+}
+
+func (m *manager) lockUnique(job *client.Job) error {
+	key, err := uniqueKey(job)
+	if err != nil {
+		return err
+	}
+
+	ok, err := m.Redis().SetNX(key, job.Jid, time.Duration(job.UniqueFor)*time.Second).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+func (m *manager) releaseUnique(job *client.Job) error {
+	if job.UniqueFor <= 0 {
+		return nil
+	}
+
+	key, err := uniqueKey(job)
+	if err != nil {
+		return err
+	}
+
+	// only release the lock if this job holds it, it may
+	// have expired and been taken by another job.
+	jid, err := m.Redis().Get(key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil
+		}
+		return err
+	}
+	if jid != job.Jid {
+		return nil
+	}
+	return m.Redis().Del(key).Err()
+}
@@ -27,6 +27,8 @@ type Reservation struct {
 	texpiry   time.Time
 	extension time.Time
 	lease     Lease
+	// the queue the job should move to when its reservation ends
+	moveTo string
 }
 
 func (res *Reservation) ReservedAt() time.Time {
@@ -48,6 +50,99 @@ func (m *manager) ExtendReservation(jid string, until time.Time) error {
 	return nil
 }
 
+// MoveWhenDone records that a job being worked should move to the given
+// queue.  The move is applied if the job fails or its reservation is
+// requeued; an acknowledged job is finished so there is nothing to move.
+// Returns false if the job isn't being worked.
+func (m *manager) MoveWhenDone(jid string, queue string) (bool, error) {
+	if !storage.ValidQueueName.MatchString(queue) {
+		return false, invalid("Invalid queue %q, queue names must match %v", queue, storage.ValidQueueName)
+	}
+	queue = m.queueName(queue)
+
+	m.workingMutex.Lock()
+	defer m.workingMutex.Unlock()
+	res, ok := m.workingMap[jid]
+	if !ok {
+		return false, nil
+	}
+	res.moveTo = queue
+	return true, nil
+}
+
+// The most annotations a job may have.
+const MaxAnnotations = 100
+
+// The most bytes an annotation's key and value may hold together.
+const MaxAnnotationBytes = 4096
+
+func (m *manager) Annotate(jid string, key string, value string) error {
+	if key == "" {
+		return invalid("annotation key must not be empty")
+	}
+	if len(key)+len(value) > MaxAnnotationBytes {
+		return invalid("annotation must not be larger than %d bytes", MaxAnnotationBytes)
+	}
+
+	// one annotation at a time so none are lost, without holding
+	// workingMutex while the working set is updated
+	m.annotateMutex.Lock()
+	defer m.annotateMutex.Unlock()
+
+	m.workingMutex.RLock()
+	res, ok := m.workingMap[jid]
+	var cp Reservation
+	var annotations map[string]string
+	if ok {
+		if _, exists := res.Job.Annotations[key]; !exists && len(res.Job.Annotations) >= MaxAnnotations {
+			m.workingMutex.RUnlock()
+			return invalid("job %s already has %d annotations", jid, MaxAnnotations)
+		}
+		// a new map so INSPECT can read the old one without the lock
+		annotations = make(map[string]string, len(res.Job.Annotations)+1)
+		for k, v := range res.Job.Annotations {
+			annotations[k] = v
+		}
+		annotations[key] = value
+
+		cp = *res
+		job := *res.Job
+		job.Annotations = annotations
+		cp.Job = &job
+	}
+	m.workingMutex.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w %s", ErrJobNotFound, jid)
+	}
+
+	data, err := json.Marshal(&cp)
+	if err != nil {
+		return err
+	}
+	// the payload is the member so the entry is replaced, not updated
+	replaced, err := m.store.Working().ReplaceElement(cp.Expiry, jid, data)
+	if err != nil {
+		return err
+	}
+	if !replaced {
+		// finished or reaped in the meantime
+		return fmt.Errorf("%w %s", ErrJobNotFound, jid)
+	}
+
+	m.workingMutex.Lock()
+	if m.workingMap[jid] == res {
+		res.Job.Annotations = annotations
+	}
+	m.workingMutex.Unlock()
+	return nil
+}
+
+func (m *manager) FindReservation(jid string) *Reservation {
+	m.workingMutex.RLock()
+	defer m.workingMutex.RUnlock()
+	return m.workingMap[jid]
+}
+
 func (m *manager) WorkingCount() int {
 	m.workingMutex.RLock()
 	defer m.workingMutex.RUnlock()
@@ -56,15 +151,31 @@ func (m *manager) WorkingCount() int {
 
 func (m *manager) BusyCount(wid string) int {
 	m.workingMutex.RLock()
+	defer m.workingMutex.RUnlock()
+	return m.workerCounts[wid]
+}
 
-	count := 0
-	for _, res := range m.workingMap {
-		if res.Wid == wid {
-			count++
-		}
+// Add or remove the reservation from the working set, keeping the
+// per-worker counts for BusyCount.  Must be called with workingMutex
+// held.
+func (m *manager) addReservation(res *Reservation) {
+	if old, ok := m.workingMap[res.Job.Jid]; ok {
+		m.removeReservation(old)
 	}
-	m.workingMutex.RUnlock()
-	return count
+	if m.workerCounts == nil {
+		m.workerCounts = map[string]int{}
+	}
+	m.workingMap[res.Job.Jid] = res
+	m.workerCounts[res.Wid]++
+}
+
+func (m *manager) removeReservation(res *Reservation) {
+	delete(m.workingMap, res.Job.Jid)
+	if m.workerCounts[res.Wid] <= 1 {
+		delete(m.workerCounts, res.Wid)
+		return
+	}
+	m.workerCounts[res.Wid]--
 }
 
 /*
@@ -90,7 +201,7 @@ func (m *manager) loadWorkingSet() error {
 			util.Error("Unable to restore working job", err)
 			return nil
 		}
-		m.workingMap[res.Job.Jid] = &res
+		m.addReservation(&res)
 		addedCount++
 		return nil
 	})
@@ -144,7 +255,7 @@ func (m *manager) reserve(wid string, lease Lease) error {
 	}
 
 	m.workingMutex.Lock()
-	m.workingMap[job.Jid] = res
+	m.addReservation(res)
 	m.workingMutex.Unlock()
 
 	return nil
@@ -174,6 +285,21 @@ func (m *manager) Acknowledge(jid string) (*client.Job, error) {
 
 	if res.Job != nil {
 		_ = m.store.Success()
+		m.countProcessed(res.Job.Type, false)
+		if err := m.releaseUnique(res.Job); err != nil {
+			util.Error("Unable to release unique lock for "+jid, err)
+		}
+		if err := m.batchJobSucceeded(res.Job); err != nil {
+			util.Error("Unable to update batch for "+jid, err)
+		}
+		if err := m.untagJob(res.Job); err != nil {
+			util.Error("Unable to remove tags for "+jid, err)
+		}
+		if err := m.dependencyDone(jid); err != nil {
+			util.Error("Unable to enqueue the jobs depending on "+jid, err)
+		}
+		// only meaningful while the job is being worked
+		res.Job.Annotations = nil
 		err = callMiddleware(m.ackChain, Ctx{context.Background(), res.Job, m, res}, func() error {
 			return nil
 		})
@@ -182,6 +308,120 @@ func (m *manager) Acknowledge(jid string) (*client.Job, error) {
 	return res.Job, err
 }
 
+func (m *manager) RequeueAll() (int, error) {
+	return m.requeueReservations(func(res *Reservation) bool {
+		return true
+	})
+}
+
+func (m *manager) RequeueWorker(wid string) (int, error) {
+	return m.requeueReservations(func(res *Reservation) bool {
+		return res.Wid == wid
+	})
+}
+
+// Remove any matching reservations from the working set and push
+// their jobs back onto their queues so another worker can pick them up.
+func (m *manager) requeueReservations(match func(res *Reservation) bool) (int, error) {
+	m.workingMutex.RLock()
+	jids := []string{}
+	for jid, res := range m.workingMap {
+		if match(res) {
+			jids = append(jids, jid)
+		}
+	}
+	m.workingMutex.RUnlock()
+
+	count := 0
+	for _, jid := range jids {
+		res := m.clearReservation(jid)
+		if res == nil {
+			// acknowledged or failed while we were iterating
+			continue
+		}
+
+		ok, err := m.store.Working().RemoveElement(res.Expiry, jid)
+		if err != nil {
+			return count, err
+		}
+		if !ok {
+			continue
+		}
+
+		if res.lease != nil {
+			err = res.lease.Release()
+			if err != nil {
+				util.Error("Error releasing lease for "+jid, err)
+			}
+		}
+
+		if res.moveTo != "" {
+			res.Job.Queue = res.moveTo
+		}
+		err = m.enqueue(res.Job)
+		if err != nil {
+			return count, fmt.Errorf("Unable to requeue %s: %w", jid, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (m *manager) Unreserve(jid string) (*client.Job, error) {
+	res := m.clearReservation(jid)
+	if res == nil {
+		return nil, nil
+	}
+
+	ok, err := m.store.Working().RemoveElement(res.Expiry, jid)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// reaped while we were looking
+		return nil, nil
+	}
+
+	if res.lease != nil {
+		err = res.lease.Release()
+		if err != nil {
+			util.Error("Error releasing lease for "+jid, err)
+		}
+	}
+	return res.Job, nil
+}
+
+// Cancel removes a job which is being worked or is scheduled without
+// counting it as processed or failed.  Returns nil if the job is in
+// neither place.
+func (m *manager) Cancel(jid string) (*client.Job, error) {
+	job, err := m.Unreserve(jid)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		scheduled := m.store.Scheduled()
+		ent, err := storage.FindByJid(scheduled, jid)
+		if err != nil || ent == nil {
+			return nil, err
+		}
+		job, err = ent.Job()
+		if err != nil {
+			return nil, err
+		}
+		err = scheduled.RemoveEntry(ent)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := m.releaseUnique(job); err != nil {
+		util.Error("Unable to release unique lock for "+jid, err)
+	}
+	m.Removed(job)
+	return job, nil
+}
+
 func (m *manager) ReapExpiredJobs(when time.Time) (int64, error) {
 	total := int64(0)
 	for {
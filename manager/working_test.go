@@ -1,6 +1,9 @@
 package manager
 
 import (
+	"errors"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -163,5 +166,202 @@ func TestLoadWorkingSet(t *testing.T) {
 			assert.EqualValues(t, 1, count)
 			assert.EqualValues(t, 1, store.Retries().Size())
 		})
+
+		t.Run("ManagerAnnotate", func(t *testing.T) {
+			store.Flush()
+			m := newManager(store)
+
+			err := m.Annotate("nosuch", "step", "1")
+			assert.True(t, errors.Is(err, ErrJobNotFound))
+
+			working := client.NewJob("WorkingJob", 1, 2, 3)
+			err = m.reserve("workerId", &simpleLease{job: working})
+			assert.NoError(t, err)
+
+			assert.NoError(t, m.Annotate(working.Jid, "step", "1"))
+			assert.NoError(t, m.Annotate(working.Jid, "note", "resized 3 images"))
+			assert.NoError(t, m.Annotate(working.Jid, "step", "2"))
+			assert.Equal(t, map[string]string{"step": "2", "note": "resized 3 images"}, m.FindReservation(working.Jid).Job.Annotations)
+			assert.EqualValues(t, 1, store.Working().Size())
+
+			// persisted with the reservation
+			m2 := newManager(store)
+			assert.Equal(t, "2", m2.FindReservation(working.Jid).Job.Annotations["step"])
+
+			job, err := m.Acknowledge(working.Jid)
+			assert.NoError(t, err)
+			assert.Nil(t, job.Annotations)
+			assert.EqualValues(t, 0, store.Working().Size())
+		})
+
+		t.Run("ManagerUnreserve", func(t *testing.T) {
+			store.Flush()
+			m := newManager(store)
+
+			job, err := m.Unreserve("nosuch")
+			assert.NoError(t, err)
+			assert.Nil(t, job)
+
+			working := client.NewJob("WorkingJob", 1, 2, 3)
+			lease := &simpleLease{job: working}
+			err = m.reserve("workerId", lease)
+			assert.NoError(t, err)
+
+			job, err = m.Unreserve(working.Jid)
+			assert.NoError(t, err)
+			assert.Equal(t, working.Jid, job.Jid)
+			assert.True(t, lease.released)
+			assert.EqualValues(t, 0, store.Working().Size())
+			assert.EqualValues(t, 0, m.WorkingCount())
+			assert.EqualValues(t, 0, store.TotalProcessed())
+			assert.EqualValues(t, 0, store.TotalFailures())
+		})
+
+		t.Run("ManagerCancel", func(t *testing.T) {
+			store.Flush()
+			m := newManager(store)
+
+			job, err := m.Cancel("nosuch")
+			assert.NoError(t, err)
+			assert.Nil(t, job)
+
+			working := client.NewJob("WorkingJob", 1, 2, 3)
+			err = m.reserve("workerId", &simpleLease{job: working})
+			assert.NoError(t, err)
+
+			scheduled := client.NewJob("ScheduledJob", 1, 2, 3)
+			scheduled.At = util.Thens(time.Now().Add(time.Hour))
+			err = m.Push(scheduled)
+			assert.NoError(t, err)
+			assert.EqualValues(t, 1, store.Scheduled().Size())
+
+			job, err = m.Cancel(working.Jid)
+			assert.NoError(t, err)
+			assert.Equal(t, working.Jid, job.Jid)
+			assert.EqualValues(t, 0, m.WorkingCount())
+
+			job, err = m.Cancel(scheduled.Jid)
+			assert.NoError(t, err)
+			assert.Equal(t, scheduled.Jid, job.Jid)
+			assert.EqualValues(t, 0, store.Scheduled().Size())
+
+			assert.EqualValues(t, 0, store.TotalProcessed())
+			assert.EqualValues(t, 0, store.TotalFailures())
+		})
+
+		t.Run("ManagerRequeueAll", func(t *testing.T) {
+			store.Flush()
+			m := newManager(store)
+
+			job := client.NewJob("WorkingJob", 1, 2, 3)
+			q, err := store.GetQueue(job.Queue)
+			assert.NoError(t, err)
+
+			lease := &simpleLease{job: job}
+			err = m.reserve("workerId", lease)
+			assert.NoError(t, err)
+			assert.EqualValues(t, 0, q.Size())
+			assert.EqualValues(t, 1, m.WorkingCount())
+
+			count, err := m.RequeueAll()
+			assert.NoError(t, err)
+			assert.EqualValues(t, 1, count)
+			assert.EqualValues(t, 1, q.Size())
+			assert.EqualValues(t, 0, store.Working().Size())
+			assert.EqualValues(t, 0, m.WorkingCount())
+			assert.True(t, lease.released)
+
+			count, err = m.RequeueAll()
+			assert.NoError(t, err)
+			assert.EqualValues(t, 0, count)
+		})
+
+		t.Run("ManagerRequeueWorker", func(t *testing.T) {
+			store.Flush()
+			m := newManager(store)
+
+			crashed := client.NewJob("WorkingJob", 1)
+			healthy := client.NewJob("WorkingJob", 2)
+			q, err := store.GetQueue(crashed.Queue)
+			assert.NoError(t, err)
+
+			err = m.reserve("crashed", &simpleLease{job: crashed})
+			assert.NoError(t, err)
+			err = m.reserve("healthy", &simpleLease{job: healthy})
+			assert.NoError(t, err)
+
+			count, err := m.RequeueWorker("crashed")
+			assert.NoError(t, err)
+			assert.EqualValues(t, 1, count)
+			assert.EqualValues(t, 1, q.Size())
+			assert.EqualValues(t, 1, m.WorkingCount())
+			assert.NotNil(t, m.FindReservation(healthy.Jid))
+		})
 	})
 }
+
+func TestMoveWhenDone(t *testing.T) {
+	t.Parallel()
+
+	m := &manager{workingMap: map[string]*Reservation{}}
+	moved, err := m.MoveWhenDone("12345abcde", "critical")
+	assert.NoError(t, err)
+	assert.False(t, moved)
+
+	job := client.NewJob("WorkingJob", 1, 2, 3)
+	m.workingMap[job.Jid] = &Reservation{Job: job}
+	moved, err = m.MoveWhenDone(job.Jid, "critical")
+	assert.NoError(t, err)
+	assert.True(t, moved)
+	assert.Equal(t, "critical", m.workingMap[job.Jid].moveTo)
+
+	moved, err = m.MoveWhenDone(job.Jid, "bad queue")
+	assert.Error(t, err)
+	assert.False(t, moved)
+	assert.Equal(t, "critical", m.workingMap[job.Jid].moveTo)
+	// the job keeps running on its current queue
+	assert.Equal(t, "default", job.Queue)
+}
+
+func TestAnnotateLimits(t *testing.T) {
+	t.Parallel()
+
+	m := &manager{workingMap: map[string]*Reservation{}}
+	job := client.NewJob("WorkingJob", 1, 2, 3)
+	job.Annotations = map[string]string{}
+	for i := 0; i < MaxAnnotations; i++ {
+		job.Annotations[strconv.Itoa(i)] = "x"
+	}
+	m.workingMap[job.Jid] = &Reservation{Job: job}
+
+	var ve *ValidationError
+	assert.True(t, errors.As(m.Annotate(job.Jid, "", "x"), &ve))
+	assert.True(t, errors.As(m.Annotate(job.Jid, "one_more", "x"), &ve))
+	assert.True(t, errors.As(m.Annotate(job.Jid, "0", strings.Repeat("x", MaxAnnotationBytes)), &ve))
+	assert.Len(t, job.Annotations, MaxAnnotations)
+}
+
+func TestBusyCount(t *testing.T) {
+	t.Parallel()
+
+	m := &manager{workingMap: map[string]*Reservation{}}
+	first := &Reservation{Job: client.NewJob("WorkingJob", 1), Wid: "worker1"}
+	second := &Reservation{Job: client.NewJob("WorkingJob", 2), Wid: "worker1"}
+	other := &Reservation{Job: client.NewJob("WorkingJob", 3), Wid: "worker2"}
+	m.addReservation(first)
+	m.addReservation(second)
+	m.addReservation(other)
+	assert.Equal(t, 2, m.BusyCount("worker1"))
+	assert.Equal(t, 1, m.BusyCount("worker2"))
+	assert.Equal(t, 0, m.BusyCount("worker3"))
+
+	// reloading a reservation doesn't count it twice
+	m.addReservation(&Reservation{Job: first.Job, Wid: "worker1"})
+	assert.Equal(t, 2, m.BusyCount("worker1"))
+
+	assert.NotNil(t, m.clearReservation(first.Job.Jid))
+	assert.Equal(t, 1, m.BusyCount("worker1"))
+	assert.NotNil(t, m.clearReservation(second.Job.Jid))
+	assert.Equal(t, 0, m.BusyCount("worker1"))
+	assert.NotContains(t, m.workerCounts, "worker1")
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/util"
+)
+
+// A DeadArchiver receives dead jobs as they are purged from the dead
+// set, by PURGE_DEAD or once they expire, so they can be kept in cold
+// storage rather than lost.  Jobs are passed in batches of up to 100.
+//
+// If Archive returns an error the batch is put back in the dead set
+// and purged again later.
+type DeadArchiver interface {
+	Archive(jobs []*client.Job) error
+}
+
+// NullArchiver discards purged jobs, the default.
+type NullArchiver struct{}
+
+func (NullArchiver) Archive(jobs []*client.Job) error {
+	return nil
+}
+
+// FileArchiver appends purged jobs to a file, one JSON object per line.
+type FileArchiver struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func NewFileArchiver(path string) *FileArchiver {
+	return &FileArchiver{Path: path}
+}
+
+func (fa *FileArchiver) Archive(jobs []*client.Job) error {
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+
+	file, err := os.OpenFile(fa.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(file)
+	enc := json.NewEncoder(out)
+	for idx := range jobs {
+		if err := enc.Encode(jobs[idx]); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := out.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (s *Server) deadArchiver() DeadArchiver {
+	if s.Options.DeadArchiver != nil {
+		return s.Options.DeadArchiver
+	}
+	if s.Options.DeadArchivePath != "" {
+		return NewFileArchiver(s.Options.DeadArchivePath)
+	}
+	return NullArchiver{}
+}
+
+// Remove the dead jobs which expire before +when+, DeadTTL after they
+// died, and pass them to the archiver.
+func (s *Server) purgeDead(when time.Time) (int64, error) {
+	// built once at Boot so PURGE_DEAD and the scheduler share the
+	// FileArchiver's lock
+	archiver := s.archiver
+	cutoff := util.Thens(when)
+	total := int64(0)
+	for {
+		var jobs []*client.Job
+		var payloads [][]byte
+		count, err := s.store.Dead().RemoveBefore(cutoff, 100, func(data []byte) error {
+			var job client.Job
+			if err := json.Unmarshal(data, &job); err != nil {
+				return err
+			}
+			jobs = append(jobs, &job)
+			payloads = append(payloads, data)
+			return nil
+		})
+		if len(jobs) > 0 {
+			if aerr := archiver.Archive(jobs); aerr != nil {
+				s.restoreDead(cutoff, jobs, payloads)
+				return total, aerr
+			}
+		}
+		total += count
+		if err != nil {
+			return total, err
+		}
+		if count != 100 {
+			break
+		}
+	}
+	return total, nil
+}
+
+// Put jobs the archiver refused back so the next purge retries them.
+func (s *Server) restoreDead(expiry string, jobs []*client.Job, payloads [][]byte) {
+	for idx := range jobs {
+		err := s.store.Dead().AddElement(expiry, jobs[idx].Jid, payloads[idx])
+		if err != nil {
+			s.logger().Error("Unable to restore dead job", err, map[string]interface{}{"jid": jobs[idx].Jid})
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileArchiver(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "dead.ndjson")
+	fa := NewFileArchiver(path)
+	assert.NoError(t, fa.Archive([]*client.Job{client.NewJob("First", 1)}))
+	assert.NoError(t, fa.Archive([]*client.Job{client.NewJob("Second", 2), client.NewJob("Third", 3)}))
+
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	var types []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var job client.Job
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &job))
+		types = append(types, job.Type)
+	}
+	assert.Equal(t, []string{"First", "Second", "Third"}, types)
+}
+
+func TestDeadArchiverDefault(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{Options: &ServerOptions{}}
+	assert.Equal(t, NullArchiver{}, s.deadArchiver())
+
+	s.Options.DeadArchivePath = "/tmp/dead.ndjson"
+	assert.Equal(t, "/tmp/dead.ndjson", s.deadArchiver().(*FileArchiver).Path)
+
+	s.Options.DeadArchiver = NullArchiver{}
+	assert.Equal(t, NullArchiver{}, s.deadArchiver())
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/contribsys/faktory/manager"
+)
+
+// Large args, e.g. image bytes, belong in an object store rather than
+// Redis: the producer uploads them and pushes a job with "args_url",
+// which Faktory delivers as-is for the worker to download.  Faktory
+// never fetches the URL itself.
+func (s *Server) limitInlineArgs(next func() error, ctx manager.Context) error {
+	limit := s.Options.MaxInlineArgBytes
+	job := ctx.Job()
+	if limit <= 0 || len(job.Args) == 0 {
+		return next()
+	}
+
+	data, err := json.Marshal(job.Args)
+	if err != nil {
+		return err
+	}
+	if len(data) > limit {
+		atomic.AddUint64(&s.Stats.LargePayloadRejected, 1)
+		return fmt.Errorf("%w: use args_url for payloads over %d bytes", errPayloadTooLarge, limit)
+	}
+	return next()
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitInlineArgs(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{Options: &ServerOptions{}, Stats: &RuntimeStats{}}
+	push := func(job *client.Job) error {
+		return s.limitInlineArgs(func() error { return nil }, jobContext{job: job})
+	}
+	big := strings.Repeat("x", 100)
+
+	// unlimited by default
+	assert.NoError(t, push(client.NewJob("Resize", big)))
+
+	s.Options.MaxInlineArgBytes = 64
+	assert.NoError(t, push(client.NewJob("Resize", "small")))
+
+	err := push(client.NewJob("Resize", big))
+	assert.EqualError(t, err, "payload too large: use args_url for payloads over 64 bytes")
+	assert.Equal(t, ErrCodePayloadTooLarge, errorCode(err))
+	assert.Equal(t, uint64(1), s.Stats.LargePayloadRejected)
+
+	job := client.NewJob("Resize")
+	job.ArgsUrl = "https://storage.example.com/args/123"
+	assert.NoError(t, push(job))
+}
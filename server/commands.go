@@ -3,8 +3,13 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/contribsys/faktory/client"
@@ -19,35 +24,173 @@ import (
 type command func(c *Connection, s *Server, cmd string)
 
 var CommandSet = map[string]command{
-	"END":    end,
-	"PUSH":   push,
-	"FETCH":  fetch,
-	"ACK":    ack,
-	"FAIL":   fail,
-	"BEAT":   heartbeat,
-	"INFO":   info,
-	"FLUSH":  flush,
-	"MUTATE": mutate,
-	"BATCH":  batch,
-	"TRACK":  track,
-	"QUEUE":  queue,
+	"END":            end,
+	"PUSH":           push,
+	"MPUSH":          mpush,
+	"FETCH":          fetch,
+	"ACK":            ack,
+	"FAIL":           fail,
+	"BEAT":           heartbeat,
+	"INFO":           info,
+	"FLUSH":          flush,
+	"MUTATE":         mutate,
+	"BATCH":          batch,
+	"TRACK":          track,
+	"QUEUE":          queue,
+	"METRICS":        metrics,
+	"PAUSE":          pause,
+	"RESUME":         resume,
+	"DELETE":         deleteJob,
+	"RESURRECT":      resurrect,
+	"PURGE_DEAD":     purgeDead,
+	"SIGNAL":         signal,
+	"SCHEDULE":       schedule,
+	"LIST_SCHEDULES": listSchedules,
+	"UNSCHEDULE":     unschedule,
+	"QUERY":          query,
+	"RATE":           rate,
+	"MOVE":           move,
+	"DRAIN":          drainQueue,
+	"INSPECT":        inspect,
+	"TRANSFER":       transfer,
+	"CANCEL":         cancel,
+	"PEEK":           peek,
+	"REQUEUE":        requeue,
+	"CLEAR":          clearJobs,
+	"QUERY_TAG":      queryTag,
+	"STORE":          storeCommand,
+	"ADDROUTE":       addRoute,
+	"LIST_ROUTES":    listRoutes,
+	"THROTTLE":       throttleCommand,
+	"STATS":          stats,
+	"HEALTH":         health,
+	"HASHRING":       hashRing,
+	"SUBSCRIBE":      subscribe,
+	"CREDIT":         credit,
+	"SETLIMIT":       setLimit,
+	"DECLARE_QUEUE":  declareQueue,
+	"LIST_QUEUES":    listQueues,
+	"RENAME_QUEUE":   renameQueue,
+	"TRACE":          trace,
+	"RESET_STATS":    resetStats,
+	"COPY":           copyJob,
+	"FANOUT":         fanout,
+	"PUSH_TEMPLATE":  pushTemplate,
+	"THROUGHPUT":     throughput,
+	"LOCK":           lock,
+	"UNLOCK":         unlock,
+	"PROMOTE":        promote,
+	"DRAIN_WORKER":   drainWorker,
+	"RESIZE_POOL":    resizePool,
+	"ANNOTATE":       annotate,
 }
 
 func track(c *Connection, s *Server, cmd string) {
-	_ = c.Error(cmd, fmt.Errorf("The Tracking subsystem is only available in Faktory Enterprise"))
+	_ = c.Error(cmd, ErrCodeNotSupported, fmt.Errorf("The Tracking subsystem is only available in Faktory Enterprise"))
 }
 
+// BATCH NEW {"success":{...},"complete":{...},"description":"..."}
+// BATCH OPEN <bid>
+// BATCH COMMIT <bid>
+// BATCH STATUS <bid>
 func batch(c *Connection, s *Server, cmd string) {
-	_ = c.Error(cmd, fmt.Errorf("The Batch subsystem is only available in Faktory Enterprise"))
+	parts := strings.SplitN(cmd, " ", 3)
+	if len(parts) != 3 {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+	m := s.Manager()
+	arg := parts[2]
+
+	switch parts[1] {
+	case "NEW":
+		var def client.Batch
+		err := json.Unmarshal([]byte(arg), &def)
+		if err != nil {
+			_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid JSON: %w", err))
+			return
+		}
+		// the cluster picks the bid so it knows the batch's owner
+		if def.Bid != "" && !c.forwarded {
+			_ = c.Error(cmd, ErrCodeInvalidArgument, fmt.Errorf("Batch must not specify a bid"))
+			return
+		}
+		bid, err := m.NewBatch(&def)
+		if err != nil {
+			_ = c.Error(cmd, errorCode(err), err)
+			return
+		}
+		_ = c.Result([]byte(bid))
+	case "OPEN":
+		err := m.OpenBatch(arg)
+		if err != nil {
+			_ = c.Error(cmd, errorCode(err), err)
+			return
+		}
+		_ = c.Result([]byte(arg))
+	case "COMMIT":
+		err := m.CommitBatch(arg)
+		if err != nil {
+			_ = c.Error(cmd, errorCode(err), err)
+			return
+		}
+		_ = c.Ok()
+	case "STATUS":
+		status, err := m.BatchStatus(arg)
+		if err != nil {
+			_ = c.Error(cmd, errorCode(err), err)
+			return
+		}
+		data, err := json.Marshal(status)
+		if err != nil {
+			_ = c.Error(cmd, errorCode(err), err)
+			return
+		}
+		_ = c.Result(data)
+	default:
+		_ = c.Error(cmd, ErrCodeInvalidArgument, fmt.Errorf("Unknown BATCH subcommand %s", parts[1]))
+	}
+}
+
+// SIGNAL <wid> quiet
+// SIGNAL <wid> terminate
+//
+// The worker receives the new state in the response to its next BEAT.
+func signal(c *Connection, s *Server, cmd string) {
+	args := strings.Split(cmd, " ")[1:]
+	if len(args) != 2 {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+
+	state := stateFromString(args[1])
+	if state == Running {
+		_ = c.Error(cmd, ErrCodeInvalidArgument, fmt.Errorf("Invalid signal %s, must be quiet or terminate", args[1]))
+		return
+	}
+
+	if !s.workers.signal(args[0], state) {
+		_ = c.Error(cmd, ErrCodeUnknownWorker, fmt.Errorf("Unknown worker %s", args[0]))
+		return
+	}
+	_ = c.Ok()
 }
 
 // QUEUE PAUSE foo bar baz
 // QUEUE RESUME *
 func queue(c *Connection, s *Server, cmd string) {
 	qs := strings.Split(cmd, " ")[1:]
+	if len(qs) < 2 {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
 	m := s.Manager()
+	ns := c.namespace()
 	if qs[1] == "*" {
 		s.Store().EachQueue(func(q storage.Queue) {
+			if _, ok := ns.local(q.Name()); !ok {
+				return
+			}
 			if qs[0] == "PAUSE" {
 				_ = m.Pause(q.Name())
 			} else if qs[0] == "RESUME" {
@@ -55,7 +198,7 @@ func queue(c *Connection, s *Server, cmd string) {
 			}
 		})
 	} else {
-		names := qs[1:]
+		names := ns.queues(qs[1:])
 		for idx := range names {
 			if qs[0] == "PAUSE" {
 				_ = m.Pause(names[idx])
@@ -67,6 +210,455 @@ func queue(c *Connection, s *Server, cmd string) {
 	_ = c.Ok()
 }
 
+// PAUSE foo bar baz
+// PAUSE *
+func pause(c *Connection, s *Server, cmd string) {
+	queue(c, s, "QUEUE "+cmd)
+}
+
+// RESUME foo bar baz
+// RESUME *
+func resume(c *Connection, s *Server, cmd string) {
+	queue(c, s, "QUEUE "+cmd)
+}
+
+// RATE critical 2.5
+// RATE critical 0
+func rate(c *Connection, s *Server, cmd string) {
+	args := strings.Split(cmd, " ")[1:]
+	if len(args) != 2 {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+	perSec, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		_ = c.Error(cmd, ErrCodeInvalidArgument, fmt.Errorf("Invalid rate %s", args[1]))
+		return
+	}
+	err = s.manager.SetRate(c.namespace().queue(args[0]), perSec)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	_ = c.Ok()
+}
+
+// HASHRING sessions wid1 wid2 wid3
+// HASHRING sessions
+func hashRing(c *Connection, s *Server, cmd string) {
+	args := strings.Split(cmd, " ")[1:]
+	if len(args) < 1 || args[0] == "" {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+	name := c.namespace().queue(args[0])
+	if !storage.ValidQueueName.MatchString(name) {
+		_ = c.Error(cmd, ErrCodeInvalidArgument, fmt.Errorf("Invalid queue %q, queue names must match %v", args[0], storage.ValidQueueName))
+		return
+	}
+	s.manager.SetHashRing(name, args[1:])
+	_ = c.Ok()
+}
+
+// SETLIMIT bulk 10000 drop_oldest
+func setLimit(c *Connection, s *Server, cmd string) {
+	args := strings.Split(cmd, " ")[1:]
+	if len(args) != 3 {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+	size, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		_ = c.Error(cmd, ErrCodeInvalidArgument, fmt.Errorf("Invalid size %s", args[1]))
+		return
+	}
+	err = s.setQueueLimit(c.namespace().queue(args[0]), size, args[2])
+	if err != nil {
+		_ = c.Error(cmd, ErrCodeInvalidArgument, err)
+		return
+	}
+	_ = c.Ok()
+}
+
+const (
+	defaultDrainTimeout = 60 * time.Second
+	drainPollInterval   = 100 * time.Millisecond
+)
+
+// DRAIN image-resize
+// DRAIN image-resize 300
+//
+// Block until the queue is empty or the timeout in seconds elapses.
+func drainQueue(c *Connection, s *Server, cmd string) {
+	args := strings.Split(cmd, " ")[1:]
+	if len(args) < 1 || len(args) > 2 || args[0] == "" {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+	timeout := defaultDrainTimeout
+	if len(args) == 2 {
+		secs, err := strconv.Atoi(args[1])
+		if err != nil || secs < 1 {
+			_ = c.Error(cmd, ErrCodeInvalidArgument, fmt.Errorf("Invalid timeout %s", args[1]))
+			return
+		}
+		timeout = time.Duration(secs) * time.Second
+	}
+
+	q, err := s.store.GetQueue(c.namespace().queue(args[0]))
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	if !waitUntilEmpty(q.Size, timeout, s.Stopper()) {
+		_ = c.Error(cmd, ErrCodeTimeout, fmt.Errorf("Timed out waiting for %s to drain", args[0]))
+		return
+	}
+	_ = c.Ok()
+}
+
+// Poll size until it returns 0.  Returns false if the timeout
+// elapses or the server stops first.
+func waitUntilEmpty(size func() uint64, timeout time.Duration, stopper <-chan bool) bool {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for size() > 0 {
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+			return false
+		case <-stopper:
+			return false
+		}
+	}
+	return true
+}
+
+// TRANSFER thumbnails thumbnails-retry
+//
+// Move the next job from one queue to another in a single transaction,
+// responding with the job or nil if the source queue is empty.
+func transfer(c *Connection, s *Server, cmd string) {
+	args := strings.Split(cmd, " ")[1:]
+	if len(args) != 2 || args[0] == "" || args[1] == "" {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+	ns := c.namespace()
+
+	src, err := s.store.GetQueue(ns.queue(args[0]))
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	tq, ok := src.(storage.Transferable)
+	if !ok {
+		_ = c.Error(cmd, ErrCodeNotSupported, fmt.Errorf("TRANSFER is not supported by this storage backend"))
+		return
+	}
+	dst, err := s.store.GetQueue(ns.queue(args[1]))
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+
+	job, err := tq.TransferTo(dst)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	if job == nil {
+		_ = c.Result(nil)
+		return
+	}
+	data, err := json.Marshal(ns.jobForClient(job))
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	_ = c.Result(data)
+}
+
+// REQUEUE 4a4e3b3c
+//
+// Push the jobs reserved by the given worker back onto their queues,
+// responding with the number of jobs requeued.
+func requeue(c *Connection, s *Server, cmd string) {
+	args := strings.Split(cmd, " ")[1:]
+	if len(args) != 1 || args[0] == "" {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+	count, err := s.manager.RequeueWorker(args[0])
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	_ = c.Number(count)
+}
+
+// DRAIN_WORKER 4a4e3b3c
+//
+// Clean up after a worker process which is going away without END.
+// A connected process gets no more jobs and is told to terminate in
+// the reply to its next BEAT, then it's forgotten and its reserved
+// jobs are requeued, or when the reaper expires it.  An unknown one's
+// jobs are requeued right away.  Responds with the number of jobs
+// requeued now.
+func drainWorker(c *Connection, s *Server, cmd string) {
+	args := strings.Split(cmd, " ")[1:]
+	if len(args) != 1 || args[0] == "" {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+	if s.workers.drain(args[0]) {
+		// its jobs are requeued once a BEAT tells it to terminate
+		_ = c.Number(0)
+		return
+	}
+	count, err := s.manager.RequeueWorker(args[0])
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	_ = c.Number(count)
+}
+
+const (
+	defaultPeekCount = 1
+	maxPeekCount     = 100
+)
+
+// PEEK default
+// PEEK default 10
+//
+// Respond with a JSON array of the next jobs to be fetched from the
+// queue, leaving them in place.
+func peek(c *Connection, s *Server, cmd string) {
+	args := strings.Split(cmd, " ")[1:]
+	if len(args) < 1 || len(args) > 2 || args[0] == "" {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+	count := defaultPeekCount
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 || n > maxPeekCount {
+			_ = c.Error(cmd, ErrCodeInvalidArgument, fmt.Errorf("Invalid count %s, must be between 1 and %d", args[1], maxPeekCount))
+			return
+		}
+		count = n
+	}
+	ns := c.namespace()
+
+	q, err := s.store.GetQueue(ns.queue(args[0]))
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	payloads, err := q.Peek(count)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+
+	jobs := make([]*client.Job, 0, len(payloads))
+	for idx := range payloads {
+		var job client.Job
+		err = json.Unmarshal(payloads[idx], &job)
+		if err != nil {
+			_ = c.Error(cmd, errorCode(err), err)
+			return
+		}
+		jobs = append(jobs, ns.jobForClient(&job))
+	}
+	data, err := json.Marshal(jobs)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	_ = c.Result(data)
+}
+
+// CLEAR default
+// CLEAR retry
+//
+// Remove every job from a queue or from the scheduled, retry or dead
+// set, responding with the number of jobs removed.  Those three names
+// refer to the sets rather than queues of the same name.
+func clearJobs(c *Connection, s *Server, cmd string) {
+	args := strings.Split(cmd, " ")[1:]
+	if len(args) != 1 || args[0] == "" {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+	ns := c.namespace()
+
+	var set storage.SortedSet
+	switch args[0] {
+	case "scheduled":
+		set = s.store.Scheduled()
+	case "retry":
+		set = s.store.Retries()
+	case "dead":
+		set = s.store.Dead()
+	}
+	var count uint64
+	var jobs []*client.Job
+	var err error
+	if set != nil {
+		// the sets are shared by every namespace
+		if ns != "" {
+			_ = c.Error(cmd, ErrCodeNotSupported, fmt.Errorf("Unable to clear %s from a namespace", args[0]))
+			return
+		}
+		jobs, err = s.manager.SetJobs(set)
+		if err == nil {
+			count, err = set.Flush()
+		}
+	} else {
+		var q storage.Queue
+		q, err = s.store.GetQueue(ns.queue(args[0]))
+		if err == nil {
+			jobs, err = s.manager.QueueJobs(q)
+		}
+		if err == nil {
+			count, err = q.Flush()
+		}
+	}
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	for _, job := range jobs {
+		s.manager.Removed(job)
+	}
+	_, _ = c.conn.Write([]byte("+OK " + strconv.FormatUint(count, 10) + "\r\n"))
+}
+
+// QUERY_TAG billing
+//
+// Respond with a JSON array of the JIDs of the jobs bearing the tag
+// which haven't finished yet.
+func queryTag(c *Connection, s *Server, cmd string) {
+	tag := strings.TrimPrefix(cmd, "QUERY_TAG ")
+	if tag == cmd || tag == "" {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+	jids, err := s.manager.TaggedJobs(tag)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	data, err := json.Marshal(jids)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	_ = c.Result(data)
+}
+
+// A BACKUP's subdirectory, it can't escape Options.BackupDirectory.
+var validBackupName = regexp.MustCompile(`\A[a-zA-Z0-9_-]+\z`)
+
+// STORE BACKUP [nightly]
+// STORE SNAPSHOTS
+// STORE RESTORE 1760520972000
+// STORE STATS
+//
+// Back up the whole dataset while jobs keep flowing, to
+// Options.BackupDirectory or a subdirectory of it, list the backups or
+// restore one when the server next restarts.  STATS returns the store's
+// key metrics as JSON.
+func storeCommand(c *Connection, s *Server, cmd string) {
+	args := strings.SplitN(cmd, " ", 3)[1:]
+	if len(args) == 0 {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+	// a namespace shouldn't see or replace the other namespaces' jobs
+	if c.namespace() != "" {
+		_ = c.Error(cmd, ErrCodeNotSupported, fmt.Errorf("Unable to use STORE from a namespace"))
+		return
+	}
+	if strings.EqualFold(args[0], "STATS") && len(args) == 1 {
+		stats, err := s.store.ParsedStats()
+		if err != nil {
+			_ = c.Error(cmd, errorCode(err), err)
+			return
+		}
+		data, err := json.Marshal(stats)
+		if err != nil {
+			_ = c.Error(cmd, errorCode(err), err)
+			return
+		}
+		_ = c.Result(data)
+		return
+	}
+	store, ok := s.store.(storage.Backupable)
+	if !ok {
+		_ = c.Error(cmd, ErrCodeNotSupported, fmt.Errorf("The store doesn't support backups"))
+		return
+	}
+
+	switch {
+	case strings.EqualFold(args[0], "BACKUP") && len(args) <= 2:
+		dest := s.Options.backupDirectory()
+		if dest == "" {
+			_ = c.Error(cmd, ErrCodeNotSupported, fmt.Errorf("Backups require backup_directory"))
+			return
+		}
+		if len(args) == 2 {
+			if !validBackupName.MatchString(args[1]) {
+				_ = c.Error(cmd, ErrCodeInvalidArgument, fmt.Errorf("Invalid backup name %q, must match %v", args[1], validBackupName))
+				return
+			}
+			dest = filepath.Join(dest, args[1])
+		}
+		backup, err := store.Backup(dest)
+		if err != nil {
+			_ = c.Error(cmd, errorCode(err), err)
+			return
+		}
+		_ = c.OkWith(strconv.FormatInt(backup.Id, 10))
+	case strings.EqualFold(args[0], "SNAPSHOTS") && len(args) == 1:
+		backups, err := store.Backups()
+		if err != nil {
+			_ = c.Error(cmd, errorCode(err), err)
+			return
+		}
+		data, err := json.Marshal(backups)
+		if err != nil {
+			_ = c.Error(cmd, errorCode(err), err)
+			return
+		}
+		_ = c.Result(data)
+	case strings.EqualFold(args[0], "RESTORE") && len(args) == 2:
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			_ = c.Error(cmd, ErrCodeInvalidArgument, fmt.Errorf("Invalid snapshot %s", args[1]))
+			return
+		}
+		err = store.Restore(id)
+		if errors.Is(err, storage.ErrBackupNotFound) {
+			_ = c.Error(cmd, ErrCodeInvalidArgument, err)
+			return
+		}
+		if err != nil {
+			_ = c.Error(cmd, errorCode(err), err)
+			return
+		}
+		// Redis can't load a snapshot while it's running
+		_ = c.Result([]byte(fmt.Sprintf("Snapshot %d will replace the dataset when Faktory restarts, jobs pushed until then will be lost", id)))
+	default:
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+	}
+}
+
 // FLUSH
 func flush(c *Connection, s *Server, cmd string) {
 	if s.Options.Environment == "development" {
@@ -76,7 +668,7 @@ func flush(c *Connection, s *Server, cmd string) {
 	}
 	err := s.store.Flush()
 	if err != nil {
-		_ = c.Error(cmd, err)
+		_ = c.Error(cmd, errorCode(err), err)
 		return
 	}
 
@@ -89,8 +681,14 @@ func end(c *Connection, s *Server, cmd string) {
 }
 
 // PUSH {json}
+//
+// Responds with the job's JID, "+OK <jid>".
 func push(c *Connection, s *Server, cmd string) {
 	data := cmd[5:]
+	if err := s.checkPayloadSize(len(data)); err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
 
 	var job client.Job
 	// If retry is not set, the `json` package won't touch the Retry attribute.
@@ -99,41 +697,303 @@ func push(c *Connection, s *Server, cmd string) {
 
 	err := json.Unmarshal([]byte(data), &job)
 	if err != nil {
-		_ = c.Error(cmd, fmt.Errorf("Invalid JSON: %w", err))
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid JSON: %w", err))
+		return
+	}
+	s.assignJid(&job)
+	if !c.forwarded {
+		s.routeJob(&job)
+	}
+	c.namespace().job(&job)
+
+	local, err := s.forwardJobs(c, []*client.Job{&job})
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	if len(local) == 0 {
+		_ = c.OkWith(job.Jid)
 		return
 	}
 
 	err = s.manager.Push(&job)
 	if err != nil {
-		_ = c.Error(cmd, err)
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+
+	_ = c.OkWith(job.Jid)
+}
+
+// Reject oversized jobs before parsing them, accidentally embedding
+// a binary blob in a job's args can quickly exhaust Redis's memory.
+func (s *Server) checkPayloadSize(size int) error {
+	limit := s.Options.maxJobPayloadBytes()
+	if size > limit {
+		atomic.AddUint64(&s.Stats.LargePayloadRejected, 1)
+		return fmt.Errorf("%w %d > %d", errPayloadTooLarge, size, limit)
+	}
+	return nil
+}
+
+// MPUSH [{"jid":"...","jobtype":"...","args":[]},...]
+func mpush(c *Connection, s *Server, cmd string) {
+	if len(cmd) < 7 {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+
+	jobs, err := parseJobs([]byte(cmd[6:]), s.checkPayloadSize)
+	if err != nil {
+		code := ErrCodeInvalidFormat
+		if errors.Is(err, errPayloadTooLarge) {
+			code = ErrCodePayloadTooLarge
+		}
+		_ = c.Error(cmd, code, err)
+		return
+	}
+	for idx := range jobs {
+		s.assignJid(jobs[idx])
+		if !c.forwarded {
+			s.routeJob(jobs[idx])
+		}
+		c.namespace().job(jobs[idx])
+	}
+
+	local, err := s.forwardJobs(c, jobs)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	count := len(jobs) - len(local)
+	if len(local) > 0 {
+		pushed, err := s.manager.PushBulk(local)
+		if err != nil {
+			_ = c.Error(cmd, errorCode(err), err)
+			return
+		}
+		count += pushed
+	}
+
+	_ = c.OkWith(strconv.Itoa(count))
+}
+
+func parseJobs(data []byte, checkSize func(int) error) ([]*client.Job, error) {
+	var elms []json.RawMessage
+	err := json.Unmarshal(data, &elms)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid JSON: %w", err)
+	}
+	if len(elms) == 0 {
+		return nil, fmt.Errorf("No jobs given")
+	}
+
+	jobs := make([]*client.Job, len(elms))
+	for idx := range elms {
+		err = checkSize(len(elms[idx]))
+		if err != nil {
+			return nil, fmt.Errorf("Job %d: %w", idx, err)
+		}
+
+		// default to 25 retries, same as PUSH
+		job := &client.Job{Retry: 25}
+		err = json.Unmarshal(elms[idx], job)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid JSON for job %d: %w", idx, err)
+		}
+		jobs[idx] = job
+	}
+	return jobs, nil
+}
+
+// SCHEDULE */15 * * * * {"jobtype":"Cleanup","args":[]}
+func schedule(c *Connection, s *Server, cmd string) {
+	idx := strings.Index(cmd, "{")
+	if idx < 0 {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+	expr := strings.TrimSpace(cmd[len("SCHEDULE"):idx])
+
+	job := client.Job{Retry: 25}
+	err := json.Unmarshal([]byte(cmd[idx:]), &job)
+	if err != nil {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid JSON: %w", err))
+		return
+	}
+
+	rj, err := s.manager.Schedule(expr, &job)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	_ = c.OkWith(rj.ID)
+}
+
+// UNSCHEDULE <id>
+func unschedule(c *Connection, s *Server, cmd string) {
+	id := strings.TrimSpace(cmd[len("UNSCHEDULE"):])
+	if id == "" || strings.Contains(id, " ") {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
 		return
 	}
 
+	ok, err := s.manager.Unschedule(id)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	if !ok {
+		_ = c.Error(cmd, ErrCodeJobNotFound, fmt.Errorf("not found"))
+		return
+	}
 	_ = c.Ok()
 }
 
+// LIST_SCHEDULES
+func listSchedules(c *Connection, s *Server, cmd string) {
+	schedules, err := s.manager.Schedules()
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+
+	data, err := json.Marshal(schedules)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	_ = c.Result(data)
+}
+
+// ADDROUTE *EmailJob email
+// ADDROUTE /^Report(Daily|Weekly)$/ reports
+//
+// Send pushed jobs whose jobtype matches the pattern to the queue.
+func addRoute(c *Connection, s *Server, cmd string) {
+	args := strings.Split(cmd, " ")[1:]
+	if len(args) != 2 {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+	// routes apply to every namespace
+	if c.namespace() != "" {
+		_ = c.Error(cmd, ErrCodeNotSupported, fmt.Errorf("Unable to add a route from a namespace"))
+		return
+	}
+	err := s.AddRoute(args[0], args[1])
+	if err != nil {
+		_ = c.Error(cmd, ErrCodeInvalidArgument, err)
+		return
+	}
+	_ = c.Ok()
+}
+
+// LIST_ROUTES
+func listRoutes(c *Connection, s *Server, cmd string) {
+	data, err := json.Marshal(s.Routes())
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	_ = c.Result(data)
+}
+
+// THROTTLE 10
+// THROTTLE 0
+//
+// Limit the jobs being worked across all workers, zero removes the
+// limit.  FETCH returns no job while the limit is reached.
+func throttleCommand(c *Connection, s *Server, cmd string) {
+	args := strings.Split(cmd, " ")[1:]
+	if len(args) != 1 {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+	// the limit applies to every namespace
+	if c.namespace() != "" {
+		_ = c.Error(cmd, ErrCodeNotSupported, fmt.Errorf("Unable to throttle from a namespace"))
+		return
+	}
+	limit, err := strconv.Atoi(args[0])
+	if err != nil || limit < 0 {
+		_ = c.Error(cmd, ErrCodeInvalidArgument, fmt.Errorf("Invalid limit %q", args[0]))
+		return
+	}
+	s.throttle.setLimit(limit)
+	_ = c.Ok()
+}
+
+// STATS
+// STATS 15
+func stats(c *Connection, s *Server, cmd string) {
+	args := strings.Split(cmd, " ")[1:]
+	if len(args) > 1 {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+	minutes := statsSamples
+	if len(args) == 1 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > statsSamples {
+			_ = c.Error(cmd, ErrCodeInvalidArgument, fmt.Errorf("Invalid minutes %s, must be between 1 and %d", args[0], statsSamples))
+			return
+		}
+		minutes = n
+	}
+
+	data, err := json.Marshal(c.namespace().samples(s.trends.recent(minutes)))
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	_ = c.Result(data)
+}
+
+// RESET_STATS
+//
+// Zero the processed and failure totals, the per-jobtype counters and
+// the samples kept for STATS, e.g. between load tests.  Responds with
+// the counters' values from before.
+func resetStats(c *Connection, s *Server, cmd string) {
+	processed, failures, err := s.store.ResetStats()
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	jobtypes := s.manager.ResetJobtypeStats()
+	s.trends.reset()
+
+	data, err := json.Marshal(map[string]interface{}{
+		"processed":     processed,
+		"failures":      failures,
+		"jobtype_stats": jobtypes,
+	})
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	_ = c.Result(data)
+}
+
 // FETCH critical default bulk
+// FETCH critical:2 default:1 bulk:0.5
 func fetch(c *Connection, s *Server, cmd string) {
-	if c.client.state != Running {
-		// quiet or terminated workers should not get new jobs
-		time.Sleep(2 * time.Second)
-		_ = c.Result(nil)
+	qs, weights, err := parseQueueWeights(strings.Split(cmd, " ")[1:])
+	if err != nil {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, err)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
-
-	qs := strings.Split(cmd, " ")[1:]
-	job, err := s.manager.Fetch(ctx, c.client.Wid, qs...)
+	job, err := s.nextJob(c, qs, weights)
 	if err != nil {
-		_ = c.Error(cmd, err)
+		_ = c.Error(cmd, errorCode(err), err)
 		return
 	}
 	if job != nil {
-		res, err := json.Marshal(job)
+		res, err := json.Marshal(c.namespace().jobForClient(job))
 		if err != nil {
-			_ = c.Error(cmd, err)
+			_ = c.Error(cmd, errorCode(err), err)
 			return
 		}
 		_ = c.Result(res)
@@ -142,6 +1002,50 @@ func fetch(c *Connection, s *Server, cmd string) {
 	}
 }
 
+// Reserve a job for the connection's worker from the queues, as FETCH
+// does, waiting up to the fetch timeout for one.  Returns nil if there
+// is no job or the worker may not have one right now.
+func (s *Server) nextJob(c *Connection, qs []string, weights []float64) (*client.Job, error) {
+	timeout := s.Options.fetchTimeout()
+	wid := c.client.Wid
+	if c.client.state != Running || s.workers.isDrained(wid) || !s.quota.reserve(wid, s.maxJobsPerWorker(), s.manager.BusyCount) {
+		// quiet or terminated workers should not get new jobs, nor
+		// should workers holding as many jobs as they're allowed
+		time.Sleep(timeout)
+		return nil, nil
+	}
+	// the job is reserved, and counted by BusyCount, once Fetch returns
+	defer s.quota.done(wid)
+	if !s.throttle.acquire(s.reserved) {
+		// nor any worker while the server is throttled
+		time.Sleep(timeout)
+		return nil, nil
+	}
+	var job *client.Job
+	defer func() { s.throttle.settle(job) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	qs = weightedOrder(c.namespace().queues(qs), weights, randomFloat)
+	if err := s.checkRenamed(c.namespace(), qs); err != nil {
+		return nil, err
+	}
+
+	qs, release := s.takeTurns(ctx, c.client, qs)
+	defer release()
+	if len(qs) == 0 {
+		// not this worker's turn
+		return nil, nil
+	}
+
+	// workers with labels only receive labeled jobs meant for them
+	ctx = manager.WithLabels(ctx, c.client.Labels)
+	var err error
+	job, err = s.manager.Fetch(ctx, c.client.Wid, qs...)
+	return job, err
+}
+
 // ACK {"jid":"123456789"}
 func ack(c *Connection, s *Server, cmd string) {
 	data := cmd[4:]
@@ -149,19 +1053,20 @@ func ack(c *Connection, s *Server, cmd string) {
 	var hash map[string]string
 	err := json.Unmarshal([]byte(data), &hash)
 	if err != nil {
-		_ = c.Error(cmd, fmt.Errorf("Invalid ACK %s", data))
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid ACK %s", data))
 		return
 	}
 	jid, ok := hash["jid"]
 	if !ok {
-		_ = c.Error(cmd, fmt.Errorf("Invalid ACK %s", data))
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid ACK %s", data))
 		return
 	}
 	_, err = s.manager.Acknowledge(jid)
 	if err != nil {
-		_ = c.Error(cmd, err)
+		_ = c.Error(cmd, errorCode(err), err)
 		return
 	}
+	c.jobFinished(jid)
 
 	_ = c.Ok()
 }
@@ -173,15 +1078,16 @@ func fail(c *Connection, s *Server, cmd string) {
 	var failure manager.FailPayload
 	err := json.Unmarshal([]byte(data), &failure)
 	if err != nil {
-		_ = c.Error(cmd, fmt.Errorf("Invalid FAIL %s", data))
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid FAIL %s", data))
 		return
 	}
 
 	err = s.manager.Fail(&failure)
 	if err != nil {
-		_ = c.Error(cmd, err)
+		_ = c.Error(cmd, errorCode(err), err)
 		return
 	}
+	c.jobFinished(failure.Jid)
 	_ = c.Ok()
 }
 
@@ -189,12 +1095,29 @@ func fail(c *Connection, s *Server, cmd string) {
 func info(c *Connection, s *Server, cmd string) {
 	data, err := s.CurrentState()
 	if err != nil {
-		_ = c.Error(cmd, err)
+		_ = c.Error(cmd, errorCode(err), err)
 		return
 	}
+	c.namespace().info(data)
 	bytes, err := json.Marshal(data)
 	if err != nil {
-		_ = c.Error(cmd, err)
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+
+	_ = c.Result(bytes)
+}
+
+// METRICS
+func metrics(c *Connection, s *Server, cmd string) {
+	data, err := s.QueueMetrics()
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
 		return
 	}
 
@@ -214,13 +1137,13 @@ func heartbeat(c *Connection, s *Server, cmd string) {
 	var beat ClientBeat
 	err := json.Unmarshal([]byte(data), &beat)
 	if err != nil {
-		_ = c.Error(cmd, fmt.Errorf("Invalid BEAT %s", data))
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid BEAT %s", data))
 		return
 	}
 
 	worker, ok := s.workers.heartbeat(&beat)
 	if !ok {
-		_ = c.Error(cmd, fmt.Errorf("Unknown worker %s", beat.Wid))
+		_ = c.Error(cmd, ErrCodeUnknownWorker, fmt.Errorf("Unknown worker %s", beat.Wid))
 		return
 	}
 
@@ -229,4 +1152,12 @@ func heartbeat(c *Connection, s *Server, cmd string) {
 	} else {
 		_ = c.Result([]byte(fmt.Sprintf(`{"state":"%s"}`, stateString(worker.state))))
 	}
+
+	if worker.state == Terminate && s.workers.forgetDrained(beat.Wid) {
+		// the drained process knows to exit, take back its jobs
+		_, err := s.manager.RequeueWorker(beat.Wid)
+		if err != nil {
+			s.logger().Error("Unable to requeue drained worker's jobs", err, map[string]interface{}{"wid": beat.Wid})
+		}
+	}
 }
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func anySize(int) error {
+	return nil
+}
+
+func TestParseJobs(t *testing.T) {
+	t.Parallel()
+
+	jobs, err := parseJobs([]byte(`[{"jid":"abc123456","jobtype":"Foo","args":[]},{"jid":"def123456","jobtype":"Bar","args":[1],"retry":0}]`), anySize)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 2)
+	assert.Equal(t, "abc123456", jobs[0].Jid)
+	assert.Equal(t, 25, jobs[0].Retry)
+	assert.Equal(t, "Bar", jobs[1].Type)
+	assert.Equal(t, 0, jobs[1].Retry)
+
+	_, err = parseJobs([]byte(`[]`), anySize)
+	assert.Error(t, err)
+	_, err = parseJobs([]byte(`{"jid":"abc123456"}`), anySize)
+	assert.Error(t, err)
+	_, err = parseJobs([]byte(`[{"jid":"abc123456"},"foo"]`), anySize)
+	assert.Error(t, err)
+
+	_, err = parseJobs([]byte(`[{"jid":"abc123456","jobtype":"Foo","args":["a very long argument"]}]`), func(size int) error {
+		return fmt.Errorf("payload too large %d > 32", size)
+	})
+	assert.EqualError(t, err, "Job 0: payload too large 67 > 32")
+}
+
+func TestCheckPayloadSize(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{Options: &ServerOptions{MaxJobPayloadBytes: 100}, Stats: &RuntimeStats{}}
+	assert.NoError(t, s.checkPayloadSize(100))
+	assert.EqualError(t, s.checkPayloadSize(101), "payload too large 101 > 100")
+	assert.EqualValues(t, 1, s.Stats.LargePayloadRejected)
+
+	s.Options.MaxJobPayloadBytes = 0
+	assert.NoError(t, s.checkPayloadSize(1024*1024))
+	assert.Error(t, s.checkPayloadSize(1024*1024+1))
+}
+
+func TestWaitUntilEmpty(t *testing.T) {
+	t.Parallel()
+
+	sizes := []uint64{3, 1, 0}
+	size := func() uint64 {
+		val := sizes[0]
+		if len(sizes) > 1 {
+			sizes = sizes[1:]
+		}
+		return val
+	}
+	assert.True(t, waitUntilEmpty(size, time.Second, nil))
+
+	full := func() uint64 { return 1 }
+	assert.False(t, waitUntilEmpty(full, 10*time.Millisecond, nil))
+
+	stopper := make(chan bool)
+	close(stopper)
+	assert.False(t, waitUntilEmpty(full, time.Second, stopper))
+}
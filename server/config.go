@@ -1,16 +1,444 @@
 package server
 
-import "github.com/contribsys/faktory/util"
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/BurntSushi/toml"
+
+	"github.com/contribsys/faktory/storage"
+	"github.com/contribsys/faktory/util"
+)
+
+// ServerOptions may be loaded from a TOML file with LoadConfig,
+// the toml tags document the file's keys.  Durations are given as
+// strings like "30s" or "5m".
 type ServerOptions struct {
-	Binding          string
-	StorageDirectory string
-	RedisSock        string
-	ConfigDirectory  string
-	Environment      string
-	Password         string
-	PoolSize         int
-	GlobalConfig     map[string]interface{}
+	Binding          string                 `toml:"binding"`
+	StorageDirectory string                 `toml:"storage_directory"`
+	RedisSock        string                 `toml:"redis_sock"`
+	ConfigDirectory  string                 `toml:"config_directory"`
+	Environment      string                 `toml:"environment"`
+	Password         string                 `toml:"password"`
+	PoolSize         int                    `toml:"pool_size"`
+	GlobalConfig     map[string]interface{} `toml:"-"`
+
+	// The TOML file the options were read from, set by LoadConfig.
+	// If set, the server reloads it on SIGHUP, see reload.go.
+	ConfigFile string `toml:"-"`
+
+	// Logging level for the util package: error, warn, info or debug.
+	// Empty leaves the level as the process set it.
+	LogLevel string `toml:"log_level"`
+
+	// Jobs per second which may be fetched from each queue, as set by
+	// QUEUE RATE at runtime.  Applied on boot and on reload.
+	QueueRates map[string]float64 `toml:"queue_rates"`
+
+	// A file holding the password, e.g. a Docker or Kubernetes secret.
+	// Only used if Password and FAKTORY_PASSWORD are both empty.
+	PasswordFile string `toml:"password_file"`
+
+	// Prefix the queues of clients which don't send a namespace in
+	// HELLO, see namespace.go.
+	Namespace string `toml:"namespace"`
+
+	// STORE BACKUP only writes within this directory, defaults to
+	// "backups" in StorageDirectory.
+	BackupDirectory string `toml:"backup_directory"`
+
+	// The registered storage backend to open, defaults to "redis".
+	StorageBackend string `toml:"storage_backend"`
+
+	// A 32 byte AES-256 key.  If set, every job payload is sealed at
+	// rest: in queues, the sorted sets, templates and batch callbacks.
+	EncryptionKey []byte `toml:"-"`
+
+	// How clients prove they know Password, AuthPlain (the default)
+	// or AuthScram.
+	AuthMode string `toml:"auth_mode"`
+
+	// Serve the command port over TLS if both of these are set.
+	TLSCertFile string `toml:"tls_cert"`
+	TLSKeyFile  string `toml:"tls_key"`
+	// Require clients to present a certificate signed by this CA.
+	TLSCAFile string `toml:"tls_ca"`
+
+	// How long Stop waits for in-progress jobs to be acknowledged
+	// before pushing them back onto their queues.  Zero disables
+	// the drain and leaves the working set as-is for the next boot.
+	ShutdownTimeout time.Duration `toml:"shutdown_timeout"`
+
+	// The HELLO handshake must complete within this time or the
+	// connection is closed.  Defaults to 2 seconds.
+	HandshakeTimeout time.Duration `toml:"handshake_timeout"`
+
+	// TCP keep-alive probes are sent this often once a connection
+	// completes HELLO so the kernel notices peers which went away
+	// without closing, e.g. behind a NAT.  Defaults to 30 seconds, a
+	// negative value disables keep-alive.
+	TCPKeepAlive time.Duration `toml:"tcp_keepalive"`
+
+	// Storage writes which fail transiently, e.g. while Redis loads its
+	// dataset, are retried this many times 10, 20, 40ms... apart
+	// before the error reaches the client.  Defaults to 3, a negative
+	// value disables retries.
+	StorageWriteRetries int `toml:"storage_write_retries"`
+
+	// If a client which sent "ping" in its HELLO sends no command for
+	// this long the server sends "+PING" and closes the connection
+	// unless the client answers "PONG" within 5 seconds.  A command
+	// left unfinished this long closes any connection.  Zero, the
+	// default, never times out.
+	IdleTimeout time.Duration `toml:"idle_timeout"`
+
+	// How often the scheduled and retry sets are checked for jobs
+	// which are due.  Defaults to 5 seconds: shorter suits tests and
+	// time-sensitive jobs, longer reduces the load on storage when
+	// millions of jobs are scheduled.
+	SchedulerInterval time.Duration `toml:"scheduler_interval"`
+
+	// How many goroutines push due jobs from the scheduled and retry
+	// sets, defaults to 1.  More keep up when many jobs come due at
+	// once but due jobs are then pushed in no particular order.  Can
+	// be changed while running with RESIZE_POOL.
+	SchedulerWorkers int `toml:"scheduler_workers"`
+
+	// How long FETCH blocks waiting for a job if all of the requested
+	// queues are empty.  Defaults to 2 seconds, maximum 30 seconds.
+	FetchTimeout time.Duration `toml:"fetch_timeout"`
+
+	// Serve Prometheus metrics at http://<MetricsBinding>/metrics,
+	// e.g. "localhost:7421".  Disabled if empty.
+	MetricsBinding string `toml:"metrics_binding"`
+
+	// Also serve net/http/pprof at /debug/pprof/ on MetricsBinding.
+	// The profiles expose the server's internals and collecting them
+	// is expensive: the metrics port must never face the public
+	// internet with this enabled.
+	PProfEnabled bool `toml:"pprof_enabled"`
+
+	// Serve the REST API on this address, e.g. "localhost:7422".
+	// Disabled if empty.
+	HTTPBinding string `toml:"http_binding"`
+	// Browser pages from these origins, e.g. "https://ops.example.com",
+	// may open the API's WebSocket.  A page served from the API's own
+	// host is always allowed, "*" allows any origin.
+	WebSocketOrigins []string `toml:"websocket_origins"`
+
+	// How often to check for workers which have stopped sending BEAT,
+	// and how long a worker may go without a BEAT before it is
+	// considered gone and its connections closed.  Default to
+	// 15 seconds and 1 minute.
+	HeartbeatReapInterval time.Duration `toml:"heartbeat_reap_interval"`
+	HeartbeatTimeout      time.Duration `toml:"heartbeat_timeout"`
+
+	// The TCP listen backlog for the command port, zero uses the
+	// kernel's maximum, net.core.somaxconn on Linux.
+	AcceptBacklog int `toml:"accept_backlog"`
+
+	// Set SO_REUSEPORT so several processes can share the command
+	// port.  Off by default so starting a second server on the same
+	// port fails loudly.
+	ReusePort bool `toml:"reuse_port"`
+
+	// This server's id in the cluster, required with ClusterBindings.
+	ClusterNodeID string `toml:"cluster_node_id"`
+	// Servers in the cluster to gossip with as "<node id>=<host:port>",
+	// the others are discovered, see the cluster package.  Empty if
+	// this server runs on its own.
+	ClusterBindings []string `toml:"cluster_bindings"`
+
+	// Maximum number of open connections from a single IP address,
+	// zero means unlimited.
+	MaxConnsPerIP int `toml:"max_conns_per_ip"`
+
+	// Maximum number of open connections to the command port, zero
+	// means unlimited.
+	MaxConnections int `toml:"max_connections"`
+
+	// FETCH returns no job to a worker which already has this many
+	// jobs reserved, zero means unlimited.
+	MaxJobsPerWorker int `toml:"max_jobs_per_worker"`
+
+	// PUSH rejects jobs larger than this many bytes.  Defaults to 1MB.
+	MaxJobPayloadBytes int `toml:"max_job_payload_bytes"`
+
+	// PUSH rejects jobs whose args are larger than this many bytes as
+	// JSON, asking the client to upload them elsewhere and send an
+	// "args_url" instead.  Zero means unlimited.
+	MaxInlineArgBytes int `toml:"max_inline_arg_bytes"`
+
+	// The most jobs each queue may hold, PUSH rejects jobs beyond
+	// that.  SETLIMIT can change the limits and what happens to
+	// those jobs at runtime.
+	QueueLimits map[string]int64 `toml:"queue_limits"`
+
+	// Retries are delayed by a further random 0 to JitterSeconds
+	// seconds so jobs which failed together don't retry together.
+	// Jobs may set their own "jitter" to override it.
+	JitterSeconds int `toml:"jitter_seconds"`
+
+	// PURGE_DEAD removes dead jobs older than this.  Defaults to 90 days.
+	DeadRetention time.Duration `toml:"dead_retention"`
+
+	// Dead jobs are passed to DeadArchiver as they are purged, see
+	// archive.go.  If it's nil and DeadArchivePath is set they are
+	// appended to that file, otherwise they are discarded.
+	DeadArchiver    DeadArchiver `toml:"-"`
+	DeadArchivePath string       `toml:"dead_archive_path"`
+
+	// How long acknowledged jobs are kept in the completed set, e.g.
+	// 24 hours.  The history is disabled unless this is set, it holds
+	// every job's args.
+	JobHistoryRetention time.Duration `toml:"job_history_retention"`
+
+	// Assigns a JID to jobs pushed without one, e.g. ULIDGenerator.
+	// If nil, such jobs are rejected.
+	JIDGenerator func() string `toml:"-"`
+
+	// Rejects pushed jobs whose JID it returns false for, e.g.
+	// UUIDValidator.  If nil, DefaultJIDValidator.
+	JIDValidator func(jid string) bool `toml:"-"`
+
+	// Records spans for PUSH, FETCH, ACK and FAIL, see tracing.go.
+	TracerProvider TracerProvider `toml:"-"`
+
+	// Keep the last 10,000 job lifecycle events in memory for the
+	// TRACE command, see job_events.go.
+	EnableTracing bool `toml:"enable_tracing"`
+
+	// Where the server's connection and lifecycle messages go, defaults
+	// to JSON lines on stdout.
+	Logger Logger `toml:"-"`
+}
+
+const (
+	DefaultStorageBackend    = "redis"
+	DefaultHandshakeTimeout  = 2 * time.Second
+	DefaultFetchTimeout      = 2 * time.Second
+	DefaultTCPKeepAlive      = 30 * time.Second
+	DefaultSchedulerInterval = 5 * time.Second
+	MaxFetchTimeout          = 30 * time.Second
+	DefaultDeadRetention     = 90 * 24 * time.Hour
+	DefaultMaxJobPayload     = 1024 * 1024
+
+	DefaultHeartbeatReapInterval = 15 * time.Second
+	DefaultHeartbeatTimeout      = 1 * time.Minute
+
+	DefaultSchedulerWorkers = 1
+	MaxSchedulerWorkers     = 64
+)
+
+// The task runner ticks once per second so the interval is
+// rounded to whole seconds.
+func (so *ServerOptions) heartbeatReapSeconds() int64 {
+	secs := int64(so.HeartbeatReapInterval / time.Second)
+	if secs <= 0 {
+		return int64(DefaultHeartbeatReapInterval / time.Second)
+	}
+	return secs
+}
+
+func (so *ServerOptions) storageBackend() string {
+	if so.StorageBackend == "" {
+		return DefaultStorageBackend
+	}
+	return so.StorageBackend
+}
+
+func (so *ServerOptions) heartbeatTimeout() time.Duration {
+	if so.HeartbeatTimeout <= 0 {
+		return DefaultHeartbeatTimeout
+	}
+	return so.HeartbeatTimeout
+}
+
+func (so *ServerOptions) maxJobPayloadBytes() int {
+	if so.MaxJobPayloadBytes <= 0 {
+		return DefaultMaxJobPayload
+	}
+	return so.MaxJobPayloadBytes
+}
+
+func (so *ServerOptions) deadRetention() time.Duration {
+	if so.DeadRetention <= 0 {
+		return DefaultDeadRetention
+	}
+	return so.DeadRetention
+}
+
+// Zero if the history is disabled.
+func (so *ServerOptions) jobHistoryRetention() time.Duration {
+	if so.JobHistoryRetention < 0 {
+		return 0
+	}
+	return so.JobHistoryRetention
+}
+
+func (so *ServerOptions) handshakeTimeout() time.Duration {
+	if so.HandshakeTimeout <= 0 {
+		return DefaultHandshakeTimeout
+	}
+	return so.HandshakeTimeout
+}
+
+func (so *ServerOptions) schedulerInterval() time.Duration {
+	if so.SchedulerInterval <= 0 {
+		return DefaultSchedulerInterval
+	}
+	return so.SchedulerInterval
+}
+
+func (so *ServerOptions) schedulerWorkers() int {
+	if so.SchedulerWorkers <= 0 {
+		return DefaultSchedulerWorkers
+	}
+	if so.SchedulerWorkers > MaxSchedulerWorkers {
+		return MaxSchedulerWorkers
+	}
+	return so.SchedulerWorkers
+}
+
+func (so *ServerOptions) storageWriteRetries() int {
+	if so.StorageWriteRetries < 0 {
+		return 0
+	}
+	if so.StorageWriteRetries == 0 {
+		return storage.DefaultWriteRetries
+	}
+	return so.StorageWriteRetries
+}
+
+// Empty if backups are disabled.
+func (so *ServerOptions) backupDirectory() string {
+	if so.BackupDirectory != "" {
+		return so.BackupDirectory
+	}
+	if so.StorageDirectory == "" {
+		return ""
+	}
+	return filepath.Join(so.StorageDirectory, "backups")
+}
+
+// Zero if keep-alive is disabled.
+func (so *ServerOptions) tcpKeepAlive() time.Duration {
+	if so.TCPKeepAlive < 0 {
+		return 0
+	}
+	if so.TCPKeepAlive == 0 {
+		return DefaultTCPKeepAlive
+	}
+	return so.TCPKeepAlive
+}
+
+func (so *ServerOptions) fetchTimeout() time.Duration {
+	if so.FetchTimeout <= 0 {
+		return DefaultFetchTimeout
+	}
+	if so.FetchTimeout > MaxFetchTimeout {
+		return MaxFetchTimeout
+	}
+	return so.FetchTimeout
+}
+
+// ResolvePassword fills in Password if it isn't set explicitly, from the
+// FAKTORY_PASSWORD environment variable or else from PasswordFile.
+func (so *ServerOptions) ResolvePassword() error {
+	if so.Password != "" {
+		return nil
+	}
+	if val := os.Getenv("FAKTORY_PASSWORD"); val != "" {
+		so.Password = val
+		return nil
+	}
+	if so.PasswordFile == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(so.PasswordFile)
+	if err != nil {
+		return fmt.Errorf("cannot read password file: %w", err)
+	}
+	so.Password = strings.TrimSpace(string(data))
+	return nil
+}
+
+// Passwords shorter than this are rejected by Validate.
+const MinPasswordLength = 8
+
+// Validate checks the options for mistakes which would otherwise only
+// show up when the server boots or a client connects.  NewServer calls
+// it after ResolvePassword.
+func (so *ServerOptions) Validate() error {
+	if path, ok := unixSocketPath(so.Binding); ok {
+		if path == "" {
+			return fmt.Errorf("invalid binding %q: missing socket path", so.Binding)
+		}
+	} else {
+		_, port, err := net.SplitHostPort(so.Binding)
+		if err == nil {
+			_, err = net.LookupPort("tcp", port)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid binding %q: %w", so.Binding, err)
+		}
+	}
+
+	if so.StorageDirectory == "" {
+		return fmt.Errorf("missing or empty storage directory")
+	}
+	// only looked at, storage reports a directory it can't write to
+	// when it opens
+	info, err := os.Stat(so.StorageDirectory)
+	if err != nil {
+		return fmt.Errorf("cannot use storage directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("storage directory %s is not a directory", so.StorageDirectory)
+	}
+
+	if so.Password != "" && len(so.Password) < MinPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+	if so.Namespace != "" && !validNamespace.MatchString(so.Namespace) {
+		return fmt.Errorf("namespace %q must match %v", so.Namespace, validNamespace)
+	}
+	if len(so.EncryptionKey) > 0 && len(so.EncryptionKey) != 32 {
+		return fmt.Errorf("encryption key must be 32 bytes, not %d", len(so.EncryptionKey))
+	}
+	switch so.AuthMode {
+	case "", AuthPlain, AuthScram:
+	default:
+		return fmt.Errorf("unknown auth mode %q, must be %q or %q", so.AuthMode, AuthPlain, AuthScram)
+	}
+
+	for _, file := range []string{so.TLSCertFile, so.TLSKeyFile, so.TLSCAFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("cannot read TLS file: %w", err)
+		}
+	}
+
+	if so.ShutdownTimeout < 0 {
+		return fmt.Errorf("shutdown timeout must not be negative, not %v", so.ShutdownTimeout)
+	}
+	if so.JitterSeconds < 0 {
+		return fmt.Errorf("jitter seconds must not be negative, not %d", so.JitterSeconds)
+	}
+	for name, size := range so.QueueLimits {
+		if size < 0 {
+			return fmt.Errorf("limit for queue %s must not be negative, not %d", name, size)
+		}
+	}
+	return nil
 }
 
 func (so *ServerOptions) String(subsys string, key string, defval string) string {
@@ -41,3 +469,64 @@ func (so *ServerOptions) Config(subsys string, key string, defval interface{}) i
 	}
 	return val
 }
+
+// The TOML library can't decode durations directly so they
+// are parsed from strings like "30s" or "5m".
+type duration struct {
+	time.Duration
+}
+
+func (d *duration) UnmarshalText(text []byte) error {
+	var err error
+	d.Duration, err = time.ParseDuration(string(text))
+	return err
+}
+
+type configFile struct {
+	ServerOptions
+
+	ShutdownTimeout       duration `toml:"shutdown_timeout"`
+	HandshakeTimeout      duration `toml:"handshake_timeout"`
+	TCPKeepAlive          duration `toml:"tcp_keepalive"`
+	IdleTimeout           duration `toml:"idle_timeout"`
+	FetchTimeout          duration `toml:"fetch_timeout"`
+	SchedulerInterval     duration `toml:"scheduler_interval"`
+	HeartbeatReapInterval duration `toml:"heartbeat_reap_interval"`
+	HeartbeatTimeout      duration `toml:"heartbeat_timeout"`
+	DeadRetention         duration `toml:"dead_retention"`
+	JobHistoryRetention   duration `toml:"job_history_retention"`
+}
+
+// LoadConfig reads ServerOptions from the TOML file at +path+.
+// Unknown keys are an error so typos don't silently fall back
+// to the default.
+func LoadConfig(path string) (*ServerOptions, error) {
+	var cfg configFile
+	md, err := toml.DecodeFile(path, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %w", path, err)
+	}
+
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for idx := range undecoded {
+			keys[idx] = undecoded[idx].String()
+		}
+		sort.Strings(keys)
+		return nil, fmt.Errorf("unknown keys in %s: %s", path, strings.Join(keys, ", "))
+	}
+
+	opts := cfg.ServerOptions
+	opts.ShutdownTimeout = cfg.ShutdownTimeout.Duration
+	opts.HandshakeTimeout = cfg.HandshakeTimeout.Duration
+	opts.TCPKeepAlive = cfg.TCPKeepAlive.Duration
+	opts.IdleTimeout = cfg.IdleTimeout.Duration
+	opts.FetchTimeout = cfg.FetchTimeout.Duration
+	opts.SchedulerInterval = cfg.SchedulerInterval.Duration
+	opts.HeartbeatReapInterval = cfg.HeartbeatReapInterval.Duration
+	opts.HeartbeatTimeout = cfg.HeartbeatTimeout.Duration
+	opts.DeadRetention = cfg.DeadRetention.Duration
+	opts.JobHistoryRetention = cfg.JobHistoryRetention.Duration
+	opts.ConfigFile = path
+	return &opts, nil
+}
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/contribsys/faktory/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchTimeout(t *testing.T) {
+	t.Parallel()
+
+	opts := &ServerOptions{}
+	assert.Equal(t, 2*time.Second, opts.fetchTimeout())
+
+	opts.FetchTimeout = 10 * time.Second
+	assert.Equal(t, 10*time.Second, opts.fetchTimeout())
+
+	opts.FetchTimeout = 5 * time.Minute
+	assert.Equal(t, 30*time.Second, opts.fetchTimeout())
+}
+
+func TestSchedulerInterval(t *testing.T) {
+	t.Parallel()
+
+	opts := &ServerOptions{}
+	assert.Equal(t, 5*time.Second, opts.schedulerInterval())
+
+	opts.SchedulerInterval = 100 * time.Millisecond
+	assert.Equal(t, 100*time.Millisecond, opts.schedulerInterval())
+}
+
+func TestSchedulerWorkers(t *testing.T) {
+	t.Parallel()
+
+	opts := &ServerOptions{}
+	assert.Equal(t, 1, opts.schedulerWorkers())
+	opts.SchedulerWorkers = 8
+	assert.Equal(t, 8, opts.schedulerWorkers())
+	opts.SchedulerWorkers = 1000
+	assert.Equal(t, MaxSchedulerWorkers, opts.schedulerWorkers())
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	t.Parallel()
+
+	opts := &ServerOptions{}
+	assert.Equal(t, 2*time.Second, opts.handshakeTimeout())
+
+	opts.HandshakeTimeout = 10 * time.Second
+	assert.Equal(t, 10*time.Second, opts.handshakeTimeout())
+}
+
+func TestDeadRetention(t *testing.T) {
+	t.Parallel()
+
+	opts := &ServerOptions{}
+	assert.Equal(t, 90*24*time.Hour, opts.deadRetention())
+
+	opts.DeadRetention = 24 * time.Hour
+	assert.Equal(t, 24*time.Hour, opts.deadRetention())
+}
+
+func TestJobHistoryRetention(t *testing.T) {
+	t.Parallel()
+
+	opts := &ServerOptions{}
+	assert.Equal(t, time.Duration(0), opts.jobHistoryRetention())
+
+	opts.JobHistoryRetention = time.Hour
+	assert.Equal(t, time.Hour, opts.jobHistoryRetention())
+
+	opts.JobHistoryRetention = -1
+	assert.Equal(t, time.Duration(0), opts.jobHistoryRetention())
+}
+
+func TestHeartbeatReaping(t *testing.T) {
+	t.Parallel()
+
+	opts := &ServerOptions{}
+	assert.EqualValues(t, 15, opts.heartbeatReapSeconds())
+	assert.Equal(t, 1*time.Minute, opts.heartbeatTimeout())
+
+	opts.HeartbeatReapInterval = 5 * time.Second
+	opts.HeartbeatTimeout = 30 * time.Second
+	assert.EqualValues(t, 5, opts.heartbeatReapSeconds())
+	assert.Equal(t, 30*time.Second, opts.heartbeatTimeout())
+
+	opts.HeartbeatReapInterval = 500 * time.Millisecond
+	assert.EqualValues(t, 15, opts.heartbeatReapSeconds())
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Parallel()
+
+	dir, err := os.MkdirTemp("", "faktory-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.toml")
+	err = os.WriteFile(path, []byte(`
+binding = "0.0.0.0:7419"
+storage_directory = "/var/lib/faktory"
+pool_size = 500
+tls_cert = "/etc/faktory/cert.pem"
+max_conns_per_ip = 20
+max_connections = 5000
+shutdown_timeout = "30s"
+fetch_timeout = "5s"
+dead_retention = "720h"
+`), 0600)
+	assert.NoError(t, err)
+
+	opts, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "0.0.0.0:7419", opts.Binding)
+	assert.Equal(t, "/var/lib/faktory", opts.StorageDirectory)
+	assert.Equal(t, 500, opts.PoolSize)
+	assert.Equal(t, "/etc/faktory/cert.pem", opts.TLSCertFile)
+	assert.Equal(t, 20, opts.MaxConnsPerIP)
+	assert.Equal(t, 5000, opts.MaxConnections)
+	assert.Equal(t, 30*time.Second, opts.ShutdownTimeout)
+	assert.Equal(t, 5*time.Second, opts.FetchTimeout)
+	assert.Equal(t, 30*24*time.Hour, opts.DeadRetention)
+	assert.Equal(t, time.Duration(0), opts.HandshakeTimeout)
+
+	err = os.WriteFile(path, []byte(`
+binding = "0.0.0.0:7419"
+bindng = "typo"
+`), 0600)
+	assert.NoError(t, err)
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "bindng")
+
+	err = os.WriteFile(path, []byte(`shutdown_timeout = "soon"`), 0600)
+	assert.NoError(t, err)
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+
+	_, err = LoadConfig(filepath.Join(dir, "missing.toml"))
+	assert.Error(t, err)
+}
+
+func TestResolvePassword(t *testing.T) {
+	// modifies the environment so can't run in parallel
+	dir, err := os.MkdirTemp("", "faktory-password")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "password")
+	err = os.WriteFile(path, []byte("from-file\n"), 0600)
+	assert.NoError(t, err)
+
+	opts := &ServerOptions{PasswordFile: path}
+	assert.NoError(t, opts.ResolvePassword())
+	assert.Equal(t, "from-file", opts.Password)
+
+	os.Setenv("FAKTORY_PASSWORD", "from-env")
+	defer os.Unsetenv("FAKTORY_PASSWORD")
+
+	opts = &ServerOptions{PasswordFile: path}
+	assert.NoError(t, opts.ResolvePassword())
+	assert.Equal(t, "from-env", opts.Password)
+
+	opts = &ServerOptions{Password: "explicit", PasswordFile: path}
+	assert.NoError(t, opts.ResolvePassword())
+	assert.Equal(t, "explicit", opts.Password)
+
+	os.Unsetenv("FAKTORY_PASSWORD")
+	opts = &ServerOptions{PasswordFile: filepath.Join(dir, "missing")}
+	assert.Error(t, opts.ResolvePassword())
+	_, err = NewServer(&ServerOptions{StorageDirectory: dir, PasswordFile: filepath.Join(dir, "missing")})
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	dir, err := os.MkdirTemp("", "faktory-validate")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	valid := func() *ServerOptions {
+		return &ServerOptions{Binding: "localhost:7419", StorageDirectory: dir}
+	}
+	assert.NoError(t, valid().Validate())
+
+	opts := valid()
+	opts.Binding = "unix:///tmp/faktory.sock"
+	assert.NoError(t, opts.Validate())
+	for _, binding := range []string{"localhost", "localhost:nope", "unix://"} {
+		opts.Binding = binding
+		assert.Error(t, opts.Validate(), binding)
+	}
+
+	opts = valid()
+	opts.StorageDirectory = filepath.Join(dir, "missing")
+	assert.Error(t, opts.Validate())
+
+	opts = valid()
+	opts.Password = "short"
+	assert.Error(t, opts.Validate())
+	opts.Password = "long enough"
+	assert.NoError(t, opts.Validate())
+
+	opts = valid()
+	opts.TLSCertFile = filepath.Join(dir, "cert.pem")
+	opts.TLSKeyFile = filepath.Join(dir, "key.pem")
+	assert.Error(t, opts.Validate())
+
+	opts = valid()
+	opts.ShutdownTimeout = -time.Second
+	assert.Error(t, opts.Validate())
+
+	_, err = NewServer(&ServerOptions{StorageDirectory: dir, AuthMode: "kerberos"})
+	assert.Error(t, err)
+}
+
+func TestStorageWriteRetries(t *testing.T) {
+	t.Parallel()
+
+	opts := &ServerOptions{}
+	assert.Equal(t, storage.DefaultWriteRetries, opts.storageWriteRetries())
+	opts.StorageWriteRetries = 5
+	assert.Equal(t, 5, opts.storageWriteRetries())
+	opts.StorageWriteRetries = -1
+	assert.Equal(t, 0, opts.storageWriteRetries())
+}
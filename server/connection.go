@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"net"
 	"strconv"
 
 	"github.com/contribsys/faktory/manager"
@@ -16,20 +17,37 @@ import (
 // Shout out to antirez for his nice design document on it.
 // https://redis.io/topics/protocol
 type Connection struct {
+	// Bytes received and sent, updated atomically.  First so they're
+	// 64-bit aligned.
+	BytesRead    int64
+	BytesWritten int64
+
 	client *ClientData
 	conn   io.WriteCloser
 	buf    *bufio.Reader
+	// for read deadlines, see readCommand
+	netConn net.Conn
+
+	// set by SUBSCRIBE, see subscribe.go
+	sub *subscription
+	// holds LOCKs when the client has no WID, see locks.go
+	holder string
+	// running a command another cluster member forwarded, see
+	// forward.go
+	forwarded bool
 }
 
 func (c *Connection) Close() error {
 	return c.conn.Close()
 }
 
-func (c *Connection) Error(cmd string, err error) error {
+// Error responds with "-ERR <code> <message>", see errors.go for the
+// codes.  A manager.KnownError carries its own code instead.
+func (c *Connection) Error(cmd string, code string, err error) error {
 	if re, ok := err.(manager.KnownError); ok {
 		_, err = c.conn.Write([]byte(fmt.Sprintf("-%s\r\n", re.Error())))
 	} else {
-		_, err = c.conn.Write([]byte(fmt.Sprintf("-ERR %s\r\n", err.Error())))
+		_, err = c.conn.Write([]byte(fmt.Sprintf("-ERR %s %s\r\n", code, err.Error())))
 	}
 	return err
 }
@@ -39,27 +57,52 @@ func (c *Connection) Ok() error {
 	return err
 }
 
+// OkWith responds with "+OK <detail>", e.g. PUSH's JID.  Clients which
+// only check for "OK" should ignore the detail.
+func (c *Connection) OkWith(detail string) error {
+	_, err := c.conn.Write([]byte("+OK " + detail + "\r\n"))
+	return err
+}
+
 func (c *Connection) Number(val int) error {
 	_, err := c.conn.Write([]byte(":" + strconv.Itoa(val) + "\r\n"))
 	return err
 }
 
+// Written in one call so a job sent to a subscriber can't land in the
+// middle of another reply, see subscribe.go.
 func (c *Connection) Result(msg []byte) error {
 	if msg == nil {
 		_, err := c.conn.Write([]byte("$-1\r\n"))
 		return err
 	}
 
-	_, err := c.conn.Write([]byte("$" + strconv.Itoa(len(msg)) + "\r\n"))
-	if err != nil {
-		return err
-	}
-	if msg != nil {
-		_, err = c.conn.Write(msg)
-		if err != nil {
-			return err
-		}
-	}
-	_, err = c.conn.Write([]byte("\r\n"))
+	size := strconv.Itoa(len(msg))
+	reply := make([]byte, 0, len(size)+len(msg)+5)
+	reply = append(reply, '$')
+	reply = append(reply, size...)
+	reply = append(reply, "\r\n"...)
+	reply = append(reply, msg...)
+	reply = append(reply, "\r\n"...)
+	_, err := c.conn.Write(reply)
+	return err
+}
+
+// Push sends a frame the client didn't ask for, e.g. a job sent to a
+// subscriber, as ">2\r\n$<kind length>\r\n<kind>\r\n$<size>\r\n<msg>\r\n"
+// so it can't be mistaken for the reply to a command.  Written in one
+// call for the same reason as Result.
+func (c *Connection) Push(kind string, msg []byte) error {
+	reply := make([]byte, 0, len(kind)+len(msg)+32)
+	reply = append(reply, ">2\r\n$"...)
+	reply = append(reply, strconv.Itoa(len(kind))...)
+	reply = append(reply, "\r\n"...)
+	reply = append(reply, kind...)
+	reply = append(reply, "\r\n$"...)
+	reply = append(reply, strconv.Itoa(len(msg))...)
+	reply = append(reply, "\r\n"...)
+	reply = append(reply, msg...)
+	reply = append(reply, "\r\n"...)
+	_, err := c.conn.Write(reply)
 	return err
 }
@@ -4,10 +4,12 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"net"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/contribsys/faktory/manager"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -32,9 +34,13 @@ func TestConnectionBasics(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "$14\r\n{some:jobjson}\r\n", output(dc))
 
-	err = dc.Error("bad command", fmt.Errorf("permission denied"))
+	err = dc.Error("bad command", ErrCodeInternal, fmt.Errorf("permission denied"))
 	assert.NoError(t, err)
-	assert.Equal(t, "-ERR permission denied\r\n", output(dc))
+	assert.Equal(t, "-ERR ERR_INTERNAL permission denied\r\n", output(dc))
+
+	err = dc.Error("bad command", ErrCodeInternal, manager.ExpectedError("DENIED", "push denied"))
+	assert.NoError(t, err)
+	assert.Equal(t, "-DENIED push denied\r\n", output(dc))
 
 	dc.Close()
 	assert.Equal(t, "", output(dc))
@@ -82,3 +88,50 @@ func dummyClientData() *ClientData {
 		lastHeartbeat: time.Now(),
 	}
 }
+
+func handshakeServer(timeout time.Duration) *Server {
+	return &Server{
+		Options: &ServerOptions{HandshakeTimeout: timeout},
+		workers: newWorkers(),
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Success", func(t *testing.T) {
+		srv, cli := net.Pipe()
+		defer cli.Close()
+
+		go func() {
+			buf := bufio.NewReader(cli)
+			line, err := buf.ReadString('\n')
+			assert.NoError(t, err)
+			assert.Equal(t, "+HI {\"v\":2}\r\n", line)
+			_, _ = cli.Write([]byte("HELLO {\"v\":2}\r\n"))
+			line, err = buf.ReadString('\n')
+			assert.NoError(t, err)
+			assert.Equal(t, "+OK\r\n", line)
+		}()
+
+		c := startConnection(srv, handshakeServer(1*time.Second))
+		assert.NotNil(t, c)
+		assert.False(t, c.client.IsConsumer())
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		srv, cli := net.Pipe()
+		defer cli.Close()
+
+		go func() {
+			// read the HI but never reply
+			buf := bufio.NewReader(cli)
+			_, _ = buf.ReadString('\n')
+		}()
+
+		start := time.Now()
+		c := startConnection(srv, handshakeServer(50*time.Millisecond))
+		assert.Nil(t, c)
+		assert.True(t, time.Since(start) < 1*time.Second)
+	})
+}
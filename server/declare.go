@@ -0,0 +1,163 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/contribsys/faktory/manager"
+	"github.com/contribsys/faktory/storage"
+)
+
+// How a declared queue orders its jobs.
+const (
+	PriorityModePriority = "priority"
+	// Every job is pushed at the default priority so jobs are
+	// fetched in the order they were pushed.
+	PriorityModeFIFO = "fifo"
+)
+
+func validateQueueConfig(cfg *storage.QueueConfig) error {
+	if cfg.MaxSize < 0 {
+		return fmt.Errorf("Invalid max_size %d, must not be negative", cfg.MaxSize)
+	}
+	if cfg.Policy == "" {
+		cfg.Policy = RejectNew
+	}
+	if !validLimitPolicy(cfg.Policy) {
+		return fmt.Errorf("Invalid policy %q, must be %s, %s or %s", cfg.Policy, RejectNew, DropOldest, DropNewest)
+	}
+	if cfg.Rate < 0 {
+		return fmt.Errorf("Invalid rate %v, must not be negative", cfg.Rate)
+	}
+	switch cfg.PriorityMode {
+	case "":
+		cfg.PriorityMode = PriorityModePriority
+	case PriorityModePriority, PriorityModeFIFO:
+	default:
+		return fmt.Errorf("Invalid priority_mode %q, must be %s or %s", cfg.PriorityMode, PriorityModePriority, PriorityModeFIFO)
+	}
+	return nil
+}
+
+// Applies a queue's declared limit, rate and priority mode.  These
+// replace any set with SETLIMIT, RATE or the config file.
+func (s *Server) applyQueueConfig(name string, cfg storage.QueueConfig) error {
+	if err := s.setQueueLimit(name, cfg.MaxSize, cfg.Policy); err != nil {
+		return err
+	}
+	if err := s.manager.SetRate(name, cfg.Rate); err != nil {
+		return err
+	}
+
+	s.declareMu.Lock()
+	defer s.declareMu.Unlock()
+	if s.declared == nil {
+		s.declared = map[string]storage.QueueConfig{}
+	}
+	s.declared[name] = cfg
+	return nil
+}
+
+func (s *Server) loadDeclaredQueues() error {
+	configs, err := s.store.QueueConfigs()
+	if err != nil {
+		return err
+	}
+	for name, cfg := range configs {
+		if err := s.applyQueueConfig(name, cfg); err != nil {
+			return fmt.Errorf("invalid config for queue %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (s *Server) declaredConfig(name string) (storage.QueueConfig, bool) {
+	s.declareMu.RLock()
+	defer s.declareMu.RUnlock()
+	cfg, ok := s.declared[name]
+	return cfg, ok
+}
+
+func (s *Server) applyPriorityMode(next func() error, ctx manager.Context) error {
+	job := ctx.Job()
+	if cfg, ok := s.declaredConfig(job.Queue); ok && cfg.PriorityMode == PriorityModeFIFO {
+		job.Priority = storage.DefaultPriority
+	}
+	return next()
+}
+
+// DECLARE_QUEUE thumbnails {"max_size":10000,"policy":"drop_oldest","rate":50,"priority_mode":"fifo"}
+//
+// Create the queue with the given settings, which are saved and
+// restored when the server restarts.  Declaring a queue again
+// replaces its settings.
+func declareQueue(c *Connection, s *Server, cmd string) {
+	args := strings.SplitN(cmd, " ", 3)[1:]
+	if len(args) != 2 || args[0] == "" {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+
+	var cfg storage.QueueConfig
+	dec := json.NewDecoder(bytes.NewReader([]byte(args[1])))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid JSON: %w", err))
+		return
+	}
+	if err := validateQueueConfig(&cfg); err != nil {
+		_ = c.Error(cmd, ErrCodeInvalidArgument, err)
+		return
+	}
+
+	name := c.namespace().queue(args[0])
+	if err := s.store.DeclareQueue(name, cfg); err != nil {
+		_ = c.Error(cmd, ErrCodeInvalidArgument, err)
+		return
+	}
+	if err := s.applyQueueConfig(name, cfg); err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	_ = c.Ok()
+}
+
+type queueListing struct {
+	Name   string               `json:"name"`
+	Size   uint64               `json:"size"`
+	Paused bool                 `json:"paused"`
+	Config *storage.QueueConfig `json:"config,omitempty"`
+}
+
+// LIST_QUEUES
+//
+// Every declared queue and every queue which has received jobs, sorted
+// by name.  Only declared queues have a "config".
+func listQueues(c *Connection, s *Server, cmd string) {
+	ns := c.namespace()
+	listings := []*queueListing{}
+	s.store.EachQueue(func(q storage.Queue) {
+		name, ok := ns.local(q.Name())
+		if !ok {
+			return
+		}
+		ql := &queueListing{Name: name, Size: q.Size(), Paused: q.IsPaused()}
+		if cfg, ok := s.declaredConfig(q.Name()); ok {
+			ql.Config = &cfg
+		}
+		listings = append(listings, ql)
+	})
+	sort.Slice(listings, func(i, j int) bool {
+		return listings[i].Name < listings[j].Name
+	})
+
+	data, err := json.Marshal(listings)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	_ = c.Result(data)
+}
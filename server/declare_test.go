@@ -0,0 +1,45 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateQueueConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg := storage.QueueConfig{MaxSize: 100}
+	assert.NoError(t, validateQueueConfig(&cfg))
+	assert.Equal(t, storage.QueueConfig{MaxSize: 100, Policy: RejectNew, PriorityMode: PriorityModePriority}, cfg)
+
+	assert.NoError(t, validateQueueConfig(&storage.QueueConfig{Policy: DropOldest, Rate: 2.5, PriorityMode: PriorityModeFIFO}))
+	assert.EqualError(t, validateQueueConfig(&storage.QueueConfig{MaxSize: -1}), "Invalid max_size -1, must not be negative")
+	assert.EqualError(t, validateQueueConfig(&storage.QueueConfig{Policy: "drop_all"}),
+		`Invalid policy "drop_all", must be reject_new, drop_oldest or drop_newest`)
+	assert.EqualError(t, validateQueueConfig(&storage.QueueConfig{Rate: -1}), "Invalid rate -1, must not be negative")
+	assert.EqualError(t, validateQueueConfig(&storage.QueueConfig{PriorityMode: "lifo"}),
+		`Invalid priority_mode "lifo", must be priority or fifo`)
+}
+
+func TestApplyPriorityMode(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{declared: map[string]storage.QueueConfig{
+		"thumbnails": {PriorityMode: PriorityModeFIFO},
+		"emails":     {PriorityMode: PriorityModePriority},
+	}}
+	push := func(queue string) int {
+		job := client.NewJob("Something")
+		job.Queue = queue
+		job.Priority = 9
+		assert.NoError(t, s.applyPriorityMode(func() error { return nil }, jobContext{job: job}))
+		return job.Priority
+	}
+
+	assert.Equal(t, storage.DefaultPriority, push("thumbnails"))
+	assert.Equal(t, 9, push("emails"))
+	assert.Equal(t, 9, push("default"))
+}
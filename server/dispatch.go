@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Workers pull jobs so normally whichever FETCH reaches Redis first
+// gets the next job.  A DispatchStrategy instead takes turns: workers
+// fetching from the queue wait until the strategy chooses them, then
+// only the chosen worker may pop a job.
+//
+// Only one worker at a time is fetching from a queue with a strategy,
+// so this trades throughput for fairness.
+type DispatchStrategy interface {
+	// Choose the next worker from those waiting to fetch.  workers is
+	// never empty.
+	Next(workers []*ClientData) *ClientData
+}
+
+// RoundRobin chooses each waiting worker in turn.
+type RoundRobin struct {
+	counter uint64
+}
+
+func (rr *RoundRobin) Next(workers []*ClientData) *ClientData {
+	n := atomic.AddUint64(&rr.counter, 1) - 1
+	return workers[n%uint64(len(workers))]
+}
+
+// LeastRecentlyUsed chooses the waiting worker which was chosen
+// longest ago, or never.
+type LeastRecentlyUsed struct {
+	mu       sync.Mutex
+	lastUsed map[string]time.Time
+}
+
+func (lru *LeastRecentlyUsed) Next(workers []*ClientData) *ClientData {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	if lru.lastUsed == nil {
+		lru.lastUsed = map[string]time.Time{}
+	}
+
+	chosen := workers[0]
+	for _, worker := range workers[1:] {
+		if lru.lastUsed[worker.Wid].Before(lru.lastUsed[chosen.Wid]) {
+			chosen = worker
+		}
+	}
+	lru.lastUsed[chosen.Wid] = time.Now()
+	return chosen
+}
+
+// SetDispatchStrategy controls which worker gets the next job from the
+// queue.  A nil strategy removes it so workers race for jobs as usual.
+func (s *Server) SetDispatchStrategy(queue string, strategy DispatchStrategy) {
+	s.dispatchMu.Lock()
+	defer s.dispatchMu.Unlock()
+	if strategy == nil {
+		delete(s.dispatchers, queue)
+		return
+	}
+	if s.dispatchers == nil {
+		s.dispatchers = map[string]*dispatcher{}
+	}
+	s.dispatchers[queue] = newDispatcher(strategy)
+}
+
+// Wait for the worker's turn on the first of the queues with a dispatch
+// strategy and take its turn on any other such queue where it's free
+// right now, rather than holding one turn while waiting for another.
+// Returns the queues the worker may fetch from, in order, leaving out
+// those it didn't get a turn on, and a func which gives the turns back.
+func (s *Server) takeTurns(ctx context.Context, worker *ClientData, queues []string) ([]string, func()) {
+	s.dispatchMu.RLock()
+	ds := make([]*dispatcher, len(queues))
+	found := false
+	for idx, name := range queues {
+		ds[idx] = s.dispatchers[name]
+		found = found || ds[idx] != nil
+	}
+	s.dispatchMu.RUnlock()
+	if !found {
+		return queues, func() {}
+	}
+
+	now, cancel := context.WithCancel(ctx)
+	cancel()
+
+	var held []*dispatcher
+	result := make([]string, 0, len(queues))
+	for idx, name := range queues {
+		d := ds[idx]
+		if d == nil {
+			result = append(result, name)
+			continue
+		}
+		turnCtx := ctx
+		if len(held) > 0 {
+			turnCtx = now
+		}
+		if d.acquire(turnCtx, worker) {
+			held = append(held, d)
+			result = append(result, name)
+		}
+	}
+	return result, func() {
+		for _, d := range held {
+			d.release(worker)
+		}
+	}
+}
+
+type dispatcher struct {
+	strategy DispatchStrategy
+
+	mu      sync.Mutex
+	waiting []*ClientData
+	chosen  *ClientData
+	taken   bool
+	// closed whenever the chosen worker changes
+	changed chan struct{}
+}
+
+func newDispatcher(strategy DispatchStrategy) *dispatcher {
+	return &dispatcher{strategy: strategy, changed: make(chan struct{})}
+}
+
+// Wait until the worker's turn to fetch.  Returns false if the context
+// is done first.  A worker may have several connections fetching at
+// once, only one of them gets the turn.
+func (d *dispatcher) acquire(ctx context.Context, worker *ClientData) bool {
+	d.mu.Lock()
+	d.waiting = append(d.waiting, worker)
+	for {
+		if d.chosen == nil {
+			d.chosen = d.strategy.Next(unique(d.waiting))
+		}
+		if d.chosen == worker && !d.taken {
+			d.taken = true
+			d.mu.Unlock()
+			return true
+		}
+
+		changed := d.changed
+		d.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			d.mu.Lock()
+			d.remove(worker)
+			if d.chosen == worker && !d.taken && !contains(d.waiting, worker) {
+				// chosen but gave up, let someone else go
+				d.choose()
+			}
+			d.mu.Unlock()
+			return false
+		case <-changed:
+			d.mu.Lock()
+		}
+	}
+}
+
+// Give up the turn after fetching so the next worker can be chosen.
+func (d *dispatcher) release(worker *ClientData) {
+	d.mu.Lock()
+	d.remove(worker)
+	d.choose()
+	d.mu.Unlock()
+}
+
+// Clear the chosen worker and wake the waiting workers, the first to
+// wake chooses again.  Must be called with mu held.
+func (d *dispatcher) choose() {
+	d.chosen = nil
+	d.taken = false
+	close(d.changed)
+	d.changed = make(chan struct{})
+}
+
+// Must be called with mu held.
+func (d *dispatcher) remove(worker *ClientData) {
+	for idx := range d.waiting {
+		if d.waiting[idx] == worker {
+			d.waiting = append(d.waiting[:idx], d.waiting[idx+1:]...)
+			return
+		}
+	}
+}
+
+func unique(workers []*ClientData) []*ClientData {
+	result := make([]*ClientData, 0, len(workers))
+	for _, worker := range workers {
+		if !contains(result, worker) {
+			result = append(result, worker)
+		}
+	}
+	return result
+}
+
+func contains(workers []*ClientData, worker *ClientData) bool {
+	for idx := range workers {
+		if workers[idx] == worker {
+			return true
+		}
+	}
+	return false
+}
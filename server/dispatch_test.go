@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatchStrategies(t *testing.T) {
+	t.Parallel()
+
+	a := &ClientData{Wid: "a"}
+	b := &ClientData{Wid: "b"}
+	c := &ClientData{Wid: "c"}
+
+	rr := &RoundRobin{}
+	assert.Equal(t, a, rr.Next([]*ClientData{a, b, c}))
+	assert.Equal(t, b, rr.Next([]*ClientData{a, b, c}))
+	assert.Equal(t, c, rr.Next([]*ClientData{a, b, c}))
+	assert.Equal(t, a, rr.Next([]*ClientData{a, b, c}))
+
+	lru := &LeastRecentlyUsed{}
+	assert.Equal(t, a, lru.Next([]*ClientData{a, b}))
+	assert.Equal(t, b, lru.Next([]*ClientData{a, b}))
+	assert.Equal(t, c, lru.Next([]*ClientData{a, b, c}))
+	assert.Equal(t, a, lru.Next([]*ClientData{c, b, a}))
+}
+
+func TestDispatcher(t *testing.T) {
+	t.Parallel()
+
+	a := &ClientData{Wid: "a"}
+	b := &ClientData{Wid: "b"}
+	d := newDispatcher(&RoundRobin{})
+
+	assert.True(t, d.acquire(context.Background(), a))
+
+	// a has the turn so b waits
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.False(t, d.acquire(ctx, b))
+	assert.Equal(t, []*ClientData{a}, d.waiting)
+
+	done := make(chan bool)
+	go func() {
+		done <- d.acquire(context.Background(), b)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	d.release(a)
+	assert.True(t, <-done)
+	d.release(b)
+	assert.Empty(t, d.waiting)
+	assert.Nil(t, d.chosen)
+
+	s := &Server{}
+	s.SetDispatchStrategy("slow", &LeastRecentlyUsed{})
+	s.SetDispatchStrategy("other", &RoundRobin{})
+	qs, release := s.takeTurns(context.Background(), a, []string{"default", "slow", "other"})
+	assert.Equal(t, []string{"default", "slow", "other"}, qs)
+
+	// b waits for slow, then skips other rather than waiting for it
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	qs, _ = s.takeTurns(ctx, b, []string{"slow", "default"})
+	assert.Equal(t, []string{"default"}, qs)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release()
+	}()
+	qs, releaseB := s.takeTurns(context.Background(), b, []string{"slow", "other"})
+	assert.Equal(t, []string{"slow", "other"}, qs)
+	releaseB()
+
+	s.SetDispatchStrategy("slow", nil)
+	s.SetDispatchStrategy("other", nil)
+	qs, _ = s.takeTurns(context.Background(), a, []string{"default", "slow"})
+	assert.Equal(t, []string{"default", "slow"}, qs)
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/contribsys/faktory/manager"
+	"github.com/contribsys/faktory/storage"
+)
+
+// Every error response is "-ERR <code> <message>" so clients can
+// switch on the code rather than matching the message, which may
+// change.  Middleware which rejects a job with a manager.KnownError
+// still responds with "-<code> <message>".
+const (
+	// Anything unexpected: a storage error, IO error, etc.
+	ErrCodeInternal = "ERR_INTERNAL"
+	// The command's arguments couldn't be parsed.
+	ErrCodeInvalidFormat = "ERR_INVALID_FORMAT"
+	// The arguments were parsed but rejected, e.g. a job without
+	// a jobtype or an invalid cron expression.
+	ErrCodeInvalidArgument = "ERR_INVALID_ARGUMENT"
+	ErrCodeUnknownCommand  = "ERR_UNKNOWN_COMMAND"
+	ErrCodeJobNotFound     = "ERR_JOB_NOT_FOUND"
+	ErrCodeUnknownWorker   = "ERR_UNKNOWN_WORKER"
+	ErrCodeDuplicate       = "ERR_DUPLICATE"
+	ErrCodePayloadTooLarge = "ERR_PAYLOAD_TOO_LARGE"
+	ErrCodeAuthFailed      = "ERR_AUTH_FAILED"
+	ErrCodeTooManyConns    = "ERR_TOO_MANY_CONNECTIONS"
+	ErrCodeServerBusy      = "ERR_SERVER_BUSY"
+	ErrCodeShuttingDown    = "ERR_SHUTTING_DOWN"
+	ErrCodeTimeout         = "ERR_TIMEOUT"
+	ErrCodeNotSupported    = "ERR_NOT_SUPPORTED"
+	// The queue holds as many jobs as SETLIMIT allows.
+	ErrCodeQueueFull = "ERR_QUEUE_FULL"
+	// FETCH named a queue which RENAME_QUEUE has renamed.
+	ErrCodeQueueRenamed = "ERR_QUEUE_RENAMED"
+	// HEALTH found the storage or the scheduler isn't working.
+	ErrCodeDegraded = "ERR_DEGRADED"
+	// The cluster member which owns the job or batch can't be
+	// reached, retry later.
+	ErrCodeUnavailable = "ERR_UNAVAILABLE"
+)
+
+var (
+	errPayloadTooLarge = errors.New("payload too large")
+)
+
+// The code for an error returned by the manager or storage, which
+// know nothing about the wire protocol.
+func errorCode(err error) string {
+	var ve *manager.ValidationError
+	var se *schemaError
+	switch {
+	case errors.Is(err, errPayloadTooLarge):
+		return ErrCodePayloadTooLarge
+	case errors.Is(err, storage.ErrQueueFull):
+		return ErrCodeQueueFull
+	case errors.Is(err, errQueueRenamed):
+		return ErrCodeQueueRenamed
+	case errors.Is(err, ErrUnavailable):
+		return ErrCodeUnavailable
+	case errors.Is(err, manager.ErrDuplicate):
+		return ErrCodeDuplicate
+	case errors.Is(err, manager.ErrJobNotFound):
+		return ErrCodeJobNotFound
+	case errors.As(err, &ve), errors.As(err, &se),
+		errors.Is(err, storage.ErrNoSuchQueue), errors.Is(err, storage.ErrQueueNotEmpty),
+		errors.Is(err, errNoSuchTemplate), errors.Is(err, errInvalidJid):
+		return ErrCodeInvalidArgument
+	}
+	return ErrCodeInternal
+}
@@ -0,0 +1,22 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/contribsys/faktory/manager"
+	"github.com/contribsys/faktory/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCode(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{Options: &ServerOptions{MaxJobPayloadBytes: 10}, Stats: &RuntimeStats{}}
+	assert.Equal(t, ErrCodePayloadTooLarge, errorCode(s.checkPayloadSize(11)))
+	assert.Equal(t, ErrCodeDuplicate, errorCode(manager.ErrDuplicate))
+	assert.Equal(t, ErrCodeQueueFull, errorCode(fmt.Errorf("%w: bulk holds 10 jobs", storage.ErrQueueFull)))
+	assert.Equal(t, ErrCodeJobNotFound, errorCode(fmt.Errorf("%w 123456789", manager.ErrJobNotFound)))
+	assert.Equal(t, ErrCodeInternal, errorCode(fmt.Errorf("connection refused")))
+	assert.Equal(t, ErrCodeInvalidArgument, errorCode(fmt.Errorf("Job 0: %w", &manager.ValidationError{})))
+}
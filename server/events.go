@@ -0,0 +1,164 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/contribsys/faktory/manager"
+)
+
+// GET /events streams job lifecycle events as Server-Sent Events for
+// analytics pipelines and dashboards.  Each event is a "data:" line
+// holding a BusEvent as JSON; "?queue=name" limits the stream to one
+// queue.
+
+// The events buffered for each subscriber, once full further events
+// are dropped until the subscriber catches up.
+const eventBufferSize = 1000
+
+// How often an idle stream sends a comment so a disconnected
+// subscriber is noticed.
+const eventKeepAlive = 15 * time.Second
+
+type BusEvent struct {
+	Event   string `json:"event"`
+	Jid     string `json:"jid"`
+	Queue   string `json:"queue"`
+	Jobtype string `json:"jobtype"`
+}
+
+type eventBus struct {
+	mu          sync.RWMutex
+	subscribers map[chan BusEvent]struct{}
+}
+
+func (eb *eventBus) subscribe() chan BusEvent {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	if eb.subscribers == nil {
+		eb.subscribers = map[chan BusEvent]struct{}{}
+	}
+	ch := make(chan BusEvent, eventBufferSize)
+	eb.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (eb *eventBus) unsubscribe(ch chan BusEvent) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	delete(eb.subscribers, ch)
+}
+
+// Never blocks, a slow subscriber misses events rather than slowing
+// down job processing.
+func (eb *eventBus) publish(event BusEvent) {
+	eb.mu.RLock()
+	defer eb.mu.RUnlock()
+	for ch := range eb.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (s *Server) enableEventBus() {
+	if s.Options.HTTPBinding == "" {
+		return
+	}
+	s.manager.AddMiddleware("push", s.publishEvent("push"))
+	s.manager.AddMiddleware("fetch", s.publishEvent("fetch"))
+	s.manager.AddMiddleware("ack", s.publishEvent("ack"))
+	s.manager.AddMiddleware("fail", s.publishEvent("fail"))
+}
+
+func (s *Server) publishEvent(event string) manager.MiddlewareFunc {
+	return func(next func() error, ctx manager.Context) error {
+		err := next()
+		if err != nil {
+			return err
+		}
+		job := ctx.Job()
+		s.events.publish(BusEvent{Event: event, Jid: job.Jid, Queue: job.Queue, Jobtype: job.Type})
+		return nil
+	}
+}
+
+// GET /events
+func (s *Server) httpEvents(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	ns := namespace(s.Options.Namespace)
+	queue := ""
+	if name := r.URL.Query().Get("queue"); name != "" {
+		queue = ns.queue(name)
+	}
+
+	// the stream outlives the HTTP server's write timeout so take
+	// over the connection, like /ws
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		httpError(w, ErrCodeNotSupported, fmt.Errorf("Event streams not supported"))
+		return
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		s.logger().Error("Unable to stream events", err, nil)
+		return
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Time{})
+
+	events := s.events.subscribe()
+	defer s.events.unsubscribe(events)
+
+	// the subscriber sends nothing more, a read returns when it hangs up
+	gone := make(chan struct{})
+	go func() {
+		_, _ = rw.Read(make([]byte, 1))
+		close(gone)
+	}()
+
+	_, err = rw.WriteString("HTTP/1.1 200 OK\r\n" +
+		"Content-Type: text/event-stream\r\n" +
+		"Cache-Control: no-cache\r\n" +
+		"Connection: close\r\n\r\n")
+	if err == nil {
+		err = rw.Flush()
+	}
+
+	ticker := time.NewTicker(eventKeepAlive)
+	defer ticker.Stop()
+	for err == nil {
+		select {
+		case <-gone:
+			return
+		case <-s.stopper:
+			return
+		case <-ticker.C:
+			_, err = rw.WriteString(": keep-alive\n\n")
+		case event := <-events:
+			if queue != "" && event.Queue != queue {
+				continue
+			}
+			local, ok := ns.local(event.Queue)
+			if !ok {
+				continue
+			}
+			event.Queue = local
+			data, merr := json.Marshal(event)
+			if merr != nil {
+				s.logger().Error("Unable to encode event", merr, nil)
+				continue
+			}
+			_, err = rw.WriteString("data: " + string(data) + "\n\n")
+		}
+		if err == nil {
+			err = rw.Flush()
+		}
+	}
+}
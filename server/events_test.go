@@ -0,0 +1,66 @@
+package server
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventBus(t *testing.T) {
+	t.Parallel()
+
+	var eb eventBus
+	ch := eb.subscribe()
+	for i := 0; i < eventBufferSize+5; i++ {
+		eb.publish(BusEvent{Event: "push", Jid: "abc"})
+	}
+	assert.Len(t, ch, eventBufferSize)
+
+	eb.unsubscribe(ch)
+	eb.publish(BusEvent{Event: "ack", Jid: "abc"})
+	assert.Len(t, ch, eventBufferSize)
+}
+
+func TestHTTPEvents(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{
+		Options: &ServerOptions{},
+		Stats:   &RuntimeStats{},
+		stopper: make(chan bool),
+	}
+	ts := httptest.NewServer(s.httpHandler())
+	defer ts.Close()
+	defer close(s.stopper)
+
+	resp, err := http.Get(ts.URL + "/events?queue=critical")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// the subscription starts before the headers are sent
+	s.events.publish(BusEvent{Event: "push", Jid: "1", Queue: "default", Jobtype: "Report"})
+	s.events.publish(BusEvent{Event: "fetch", Jid: "2", Queue: "critical", Jobtype: "Report"})
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if strings.HasPrefix(scanner.Text(), "data: ") {
+				lines <- scanner.Text()
+			}
+		}
+	}()
+	select {
+	case line := <-lines:
+		assert.Equal(t, `data: {"event":"fetch","jid":"2","queue":"critical","jobtype":"Report"}`, line)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event received")
+	}
+}
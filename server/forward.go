@@ -0,0 +1,130 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/contribsys/faktory/client"
+)
+
+// A Forwarder sends the jobs this server doesn't own to the cluster
+// member which does, see the cluster package.  It returns the jobs
+// which should be pushed here.  The jobs already have their JID,
+// route and namespace.
+type Forwarder func(jobs []*client.Job) ([]*client.Job, error)
+
+// A Gossiper merges the member list another cluster member sent with
+// GOSSIP into this member's and returns this member's, see the cluster
+// package.
+type Gossiper func(members string) (string, error)
+
+// ErrUnavailable means the cluster member which owns a job or batch
+// can't be reached.  The client should retry later.
+var ErrUnavailable = errors.New("cluster member unavailable")
+
+// FORWARD runs commands from CommandSet so it can't be part of its
+// initializer.
+func init() {
+	CommandSet["FORWARD"] = forward
+	CommandSet["GOSSIP"] = gossip
+}
+
+// The commands another member may forward to this one.
+var forwardable = map[string]bool{
+	"PUSH":  true,
+	"MPUSH": true,
+	"BATCH": true,
+}
+
+// SetForwarder routes every pushed job through fn.  Set it before
+// calling Run.
+func (s *Server) SetForwarder(fn Forwarder) {
+	s.mu.Lock()
+	s.forwarder = fn
+	s.mu.Unlock()
+}
+
+// SetGossiper answers GOSSIP with fn.  Set it before calling Run.
+func (s *Server) SetGossiper(fn Gossiper) {
+	s.mu.Lock()
+	s.gossiper = fn
+	s.mu.Unlock()
+}
+
+// Forwarded is true while the connection runs a command another
+// cluster member forwarded, which must not be forwarded again.
+func (c *Connection) Forwarded() bool {
+	return c.forwarded
+}
+
+// Forward runs a PUSH, MPUSH or BATCH command for the connection as if
+// another cluster member had forwarded it: the middleware sees
+// Forwarded() and the connection's namespace and the routes aren't
+// applied, the member did that already.
+func (s *Server) Forward(c *Connection, cmd string) {
+	verb := strings.SplitN(cmd, " ", 2)[0]
+	if !forwardable[verb] {
+		_ = c.Error(cmd, ErrCodeInvalidArgument, fmt.Errorf("Unable to forward %s", verb))
+		return
+	}
+	c.forwarded = true
+	defer func() { c.forwarded = false }()
+	callCommand(s.middleware, c, s, cmd, CommandSet[verb])
+}
+
+// The jobs to push here, the rest were forwarded.
+func (s *Server) forwardJobs(c *Connection, jobs []*client.Job) ([]*client.Job, error) {
+	s.mu.Lock()
+	fn := s.forwarder
+	s.mu.Unlock()
+	if fn == nil || c.forwarded {
+		return jobs, nil
+	}
+	return fn(jobs)
+}
+
+// FORWARD PUSH {json}
+// FORWARD MPUSH [{json},...]
+// FORWARD BATCH NEW {json}
+//
+// Sent by another cluster member for the jobs and batches this server
+// owns, see Server.Forward.
+func forward(c *Connection, s *Server, cmd string) {
+	s.mu.Lock()
+	clustered := s.forwarder != nil
+	s.mu.Unlock()
+	if !clustered {
+		_ = c.Error(cmd, ErrCodeNotSupported, fmt.Errorf("Clustering is not enabled"))
+		return
+	}
+	if len(cmd) < 9 {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+	s.Forward(c, cmd[8:])
+}
+
+// GOSSIP {json}
+//
+// Sent by another cluster member with the members it knows of, the
+// response holds the members this server knows of.
+func gossip(c *Connection, s *Server, cmd string) {
+	s.mu.Lock()
+	fn := s.gossiper
+	s.mu.Unlock()
+	if fn == nil {
+		_ = c.Error(cmd, ErrCodeNotSupported, fmt.Errorf("Clustering is not enabled"))
+		return
+	}
+	if len(cmd) < 8 {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+	members, err := fn(cmd[7:])
+	if err != nil {
+		_ = c.Error(cmd, ErrCodeInvalidArgument, err)
+		return
+	}
+	_ = c.Result([]byte(members))
+}
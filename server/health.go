@@ -0,0 +1,55 @@
+package server
+
+import (
+	"fmt"
+	"time"
+)
+
+// The storage must answer HEALTH's ping within this time.
+const healthTimeout = 500 * time.Millisecond
+
+// The scheduled tasks run every second, if they haven't started a cycle
+// for this long something is stuck.  The scheduler gets this long on
+// top of its interval.
+const schedulerStallTimeout = 30 * time.Second
+
+// Why the server can't do its job, empty if it's healthy.
+func (s *Server) degraded() string {
+	if s.taskRunner == nil || s.taskRunner.stalled(schedulerStallTimeout) ||
+		s.scheduler == nil || s.scheduler.stalled(schedulerStallTimeout+s.Options.schedulerInterval()) {
+		return "scheduler has stopped"
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.store.Redis().Ping().Result()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Sprintf("storage unavailable: %v", err)
+		}
+	case <-time.After(healthTimeout):
+		return fmt.Sprintf("storage did not respond within %v", healthTimeout)
+	}
+	return ""
+}
+
+// The raw response line, HEALTH may be sent before the handshake
+// when there's no Connection to respond with.
+func (s *Server) healthResponse() string {
+	if reason := s.degraded(); reason != "" {
+		return "-ERR " + ErrCodeDegraded + " degraded: " + reason + "\r\n"
+	}
+	return "+OK\r\n"
+}
+
+// HEALTH
+func health(c *Connection, s *Server, cmd string) {
+	if reason := s.degraded(); reason != "" {
+		_ = c.Error(cmd, ErrCodeDegraded, fmt.Errorf("degraded: %s", reason))
+		return
+	}
+	_ = c.Ok()
+}
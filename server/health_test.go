@@ -0,0 +1,62 @@
+package server
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskRunnerStalled(t *testing.T) {
+	t.Parallel()
+
+	ts := newTaskRunner()
+	assert.True(t, ts.stalled(time.Second))
+
+	ts.cycle()
+	assert.False(t, ts.stalled(time.Second))
+
+	ts.lastCycle = time.Now().Add(-time.Minute).UnixNano()
+	assert.True(t, ts.stalled(schedulerStallTimeout))
+}
+
+type countingTask struct {
+	runs int64
+}
+
+func (ct *countingTask) Name() string {
+	return "Counting"
+}
+
+func (ct *countingTask) Execute() error {
+	atomic.AddInt64(&ct.runs, 1)
+	return nil
+}
+
+func (ct *countingTask) Stats() map[string]interface{} {
+	return map[string]interface{}{"runs": atomic.LoadInt64(&ct.runs)}
+}
+
+func TestTaskRunnerTick(t *testing.T) {
+	t.Parallel()
+
+	ct := &countingTask{}
+	ts := newTaskRunnerEvery(10 * time.Millisecond)
+	ts.AddTask(1, ct)
+	stopper := make(chan bool)
+	ts.Run(stopper)
+	time.Sleep(200 * time.Millisecond)
+	close(stopper)
+
+	assert.True(t, atomic.LoadInt64(&ct.runs) >= 5)
+	assert.False(t, ts.stalled(time.Second))
+}
+
+func TestHealthWithoutScheduler(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{}
+	assert.Equal(t, "scheduler has stopped", s.degraded())
+	assert.Equal(t, "-ERR ERR_DEGRADED degraded: scheduler has stopped\r\n", s.healthResponse())
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/manager"
+	"github.com/contribsys/faktory/util"
+)
+
+// Acknowledged jobs are kept in the completed set for
+// Options.JobHistoryRetention so operators can see what ran recently.
+type completedJob struct {
+	*client.Job
+	CompletedAt string `json:"completed_at"`
+}
+
+func (s *Server) enableHistory() {
+	if s.Options.jobHistoryRetention() == 0 {
+		return
+	}
+	s.manager.AddMiddleware("ack", func(next func() error, ctx manager.Context) error {
+		err := next()
+		if err != nil {
+			return err
+		}
+		// the job is acknowledged either way, don't fail the ACK
+		err = s.recordCompleted(ctx.Job(), time.Now())
+		if err != nil {
+			s.logger().Error("Unable to record completed job", err, map[string]interface{}{"jid": ctx.Job().Jid})
+		}
+		return nil
+	})
+}
+
+func (s *Server) recordCompleted(job *client.Job, when time.Time) error {
+	completedAt := util.Thens(when)
+	data, err := json.Marshal(&completedJob{Job: job, CompletedAt: completedAt})
+	if err != nil {
+		return err
+	}
+	return s.store.Completed().AddElement(completedAt, job.Jid, data)
+}
+
+// Remove completed jobs older than the retention period.
+func (s *Server) purgeHistory(when time.Time) (int64, error) {
+	cutoff := util.Thens(when.Add(-s.Options.jobHistoryRetention()))
+	total := int64(0)
+	for {
+		count, err := s.store.Completed().RemoveBefore(cutoff, 100, func([]byte) error {
+			return nil
+		})
+		total += count
+		if err != nil {
+			return total, err
+		}
+		if count != 100 {
+			break
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompletedJobJSON(t *testing.T) {
+	t.Parallel()
+
+	job := client.NewJob("Report", 1)
+	data, err := json.Marshal(&completedJob{Job: job, CompletedAt: "2026-10-15T12:00:00Z"})
+	assert.NoError(t, err)
+
+	var hash map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &hash))
+	assert.Equal(t, job.Jid, hash["jid"])
+	assert.Equal(t, "Report", hash["jobtype"])
+	assert.Equal(t, "2026-10-15T12:00:00Z", hash["completed_at"])
+}
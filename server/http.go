@@ -0,0 +1,377 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/contribsys/faktory/manager"
+	"github.com/contribsys/faktory/storage"
+)
+
+// A REST API for scripts and tools which don't speak the command
+// protocol, served on Options.HTTPBinding:
+//
+//	POST /jobs                  push the job in the body
+//	GET  /jobs/queues/<name>    fetch a job for ?wid=, 204 if there's none
+//	PUT  /jobs/<jid>/ack        acknowledge a fetched job
+//	PUT  /jobs/<jid>/fail       fail a fetched job, the body is optional
+//	GET  /info                  same as INFO
+//	GET  /queues                each queue's size and paused state
+//	GET  /events                stream job events, see events.go
+//	GET  /ws                    the command protocol over a WebSocket
+//
+// The jobs and info endpoints run the PUSH, FETCH, ACK, FAIL and INFO
+// commands.  If the server has a password, requests must send it with
+// HTTP Basic Auth; the username is ignored.  Errors are returned as
+// {"code":"ERR_...","error":"..."} with the same codes as the
+// command protocol.
+func (s *Server) startHTTP() error {
+	if s.Options.HTTPBinding == "" {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", s.Options.HTTPBinding)
+	if err != nil {
+		return fmt.Errorf("cannot listen on %s: %w", s.Options.HTTPBinding, err)
+	}
+
+	hs := &http.Server{
+		ReadTimeout: 5 * time.Second,
+		// leave time for GET /jobs/queues to wait for a job
+		WriteTimeout:   s.Options.fetchTimeout() + 10*time.Second,
+		MaxHeaderBytes: 1 << 16,
+		Handler:        s.httpHandler(),
+	}
+
+	go func() {
+		err := hs.Serve(listener)
+		if err != http.ErrServerClosed {
+			s.logger().Error("HTTP server crashed", err, map[string]interface{}{"binding": s.Options.HTTPBinding})
+		}
+	}()
+	s.logger().Info("HTTP API now listening", map[string]interface{}{"binding": s.Options.HTTPBinding})
+	s.httpServer = hs
+	return nil
+}
+
+// Called without s.mu, the handlers may need it to finish.
+func shutdownHTTP(hs *http.Server) {
+	if hs == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_ = hs.Shutdown(ctx)
+}
+
+func (s *Server) httpHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jobs", s.httpPush)
+	mux.HandleFunc("/jobs/", s.httpJob)
+	mux.HandleFunc("/info", s.httpInfo)
+	mux.HandleFunc("/queues", s.httpQueues)
+	mux.HandleFunc("/events", s.httpEvents)
+
+	// WebSocket clients authenticate with HELLO instead
+	root := http.NewServeMux()
+	root.HandleFunc("/ws", s.httpWebSocket)
+	root.Handle("/", s.basicAuth(mux))
+	return root
+}
+
+func (s *Server) basicAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if password := s.password(); password != "" {
+			_, pwd, ok := r.BasicAuth()
+			if !ok || subtle.ConstantTimeCompare([]byte(pwd), []byte(password)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="Faktory"`)
+				httpError(w, ErrCodeAuthFailed, fmt.Errorf("Invalid password"))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Run a command for an HTTP request as a client in the server's
+// default namespace, so the API shares the commands' validation,
+// middleware and cluster forwarding.  Returns the reply, nil for a null
+// bulk string, or responds with the error and returns false.
+func (s *Server) httpCommand(w http.ResponseWriter, wid string, cmd string) ([]byte, bool) {
+	var out bytes.Buffer
+	c := &Connection{
+		client: &ClientData{Wid: wid, Namespace: s.Options.Namespace},
+		conn:   nopCloser{&out},
+	}
+	verb := strings.SplitN(cmd, " ", 2)[0]
+	atomic.AddUint64(&s.Stats.Commands, 1)
+	callCommand(s.middleware, c, s, cmd, CommandSet[verb])
+	return httpReply(w, out.Bytes())
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// Parse a command's "+OK", "$<size>" or "-ERR <code> <message>" reply.
+func httpReply(w http.ResponseWriter, reply []byte) ([]byte, bool) {
+	line, rest := reply, []byte(nil)
+	if idx := bytes.Index(reply, []byte("\r\n")); idx >= 0 {
+		line, rest = reply[:idx], reply[idx+2:]
+	}
+	if len(line) == 0 {
+		httpError(w, ErrCodeInternal, fmt.Errorf("No response"))
+		return nil, false
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], true
+	case '$':
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size > len(rest) {
+			httpError(w, ErrCodeInternal, fmt.Errorf("Invalid response %q", line))
+			return nil, false
+		}
+		if size < 0 {
+			return nil, true
+		}
+		return rest[:size], true
+	case '-':
+		parts := strings.SplitN(string(line[1:]), " ", 3)
+		if parts[0] == "ERR" && len(parts) > 1 {
+			status, ok := httpStatus[parts[1]]
+			if !ok {
+				status = http.StatusInternalServerError
+			}
+			msg := ""
+			if len(parts) == 3 {
+				msg = parts[2]
+			}
+			writeJSON(w, status, map[string]string{"code": parts[1], "error": msg})
+			return nil, false
+		}
+		// a job rejected by middleware, e.g. DENIED
+		code, msg := parts[0], strings.TrimPrefix(string(line[1:]), parts[0]+" ")
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"code": code, "error": msg})
+		return nil, false
+	}
+	httpError(w, ErrCodeInternal, fmt.Errorf("Invalid response %q", line))
+	return nil, false
+}
+
+// POST /jobs
+func (s *Server) httpPush(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	// PUSH rejects anything larger
+	limit := s.Options.maxJobPayloadBytes()
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, int64(limit)+1))
+	if err != nil {
+		httpError(w, ErrCodeInvalidFormat, err)
+		return
+	}
+
+	reply, ok := s.httpCommand(w, "", "PUSH "+string(data))
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]string{"jid": strings.TrimPrefix(string(reply), "OK ")})
+}
+
+// GET /jobs/queues/<name>
+// PUT /jobs/<jid>/ack
+// PUT /jobs/<jid>/fail
+func (s *Server) httpJob(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case parts[0] == "queues":
+		s.httpFetch(w, r, parts[1])
+	case parts[1] == "ack":
+		s.httpAck(w, r, parts[0])
+	case parts[1] == "fail":
+		s.httpFail(w, r, parts[0])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Reservations are tracked per worker, so the caller must identify
+// itself with ?wid=.
+func (s *Server) httpFetch(w http.ResponseWriter, r *http.Request, queue string) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	wid := r.URL.Query().Get("wid")
+	if wid == "" {
+		httpError(w, ErrCodeInvalidFormat, fmt.Errorf("Missing wid"))
+		return
+	}
+	if strings.Contains(queue, " ") {
+		httpError(w, ErrCodeInvalidArgument, fmt.Errorf("Invalid queue %q", queue))
+		return
+	}
+
+	reply, ok := s.httpCommand(w, wid, "FETCH "+queue)
+	if !ok {
+		return
+	}
+	if reply == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeRawJSON(w, http.StatusOK, reply)
+}
+
+func (s *Server) httpAck(w http.ResponseWriter, r *http.Request, jid string) {
+	if !allowMethod(w, r, http.MethodPut) {
+		return
+	}
+
+	data, err := json.Marshal(map[string]string{"jid": jid})
+	if err != nil {
+		httpError(w, ErrCodeInternal, err)
+		return
+	}
+	if _, ok := s.httpCommand(w, "", "ACK "+string(data)); ok {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) httpFail(w http.ResponseWriter, r *http.Request, jid string) {
+	if !allowMethod(w, r, http.MethodPut) {
+		return
+	}
+
+	var failure manager.FailPayload
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		httpError(w, ErrCodeInvalidFormat, err)
+		return
+	}
+	if len(data) > 0 {
+		err = json.Unmarshal(data, &failure)
+		if err != nil {
+			httpError(w, ErrCodeInvalidFormat, fmt.Errorf("Invalid JSON: %w", err))
+			return
+		}
+	}
+	failure.Jid = jid
+	data, err = json.Marshal(&failure)
+	if err != nil {
+		httpError(w, ErrCodeInternal, err)
+		return
+	}
+
+	if _, ok := s.httpCommand(w, "", "FAIL "+string(data)); ok {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GET /info
+func (s *Server) httpInfo(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	if reply, ok := s.httpCommand(w, "", "INFO"); ok {
+		writeRawJSON(w, http.StatusOK, reply)
+	}
+}
+
+type queueState struct {
+	Name   string `json:"name"`
+	Size   uint64 `json:"size"`
+	Paused bool   `json:"paused"`
+}
+
+// GET /queues
+func (s *Server) httpQueues(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	ns := namespace(s.Options.Namespace)
+	queues := []queueState{}
+	s.store.EachQueue(func(q storage.Queue) {
+		name, ok := ns.local(q.Name())
+		if !ok {
+			return
+		}
+		queues = append(queues, queueState{Name: name, Size: q.Size(), Paused: q.IsPaused()})
+	})
+	sort.Slice(queues, func(i, j int) bool {
+		return queues[i].Name < queues[j].Name
+	})
+	writeJSON(w, http.StatusOK, queues)
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeJSON(w, http.StatusMethodNotAllowed, map[string]string{
+		"code":  ErrCodeInvalidFormat,
+		"error": fmt.Sprintf("Method %s not allowed", r.Method),
+	})
+	return false
+}
+
+var httpStatus = map[string]int{
+	ErrCodeInvalidFormat:   http.StatusBadRequest,
+	ErrCodeInvalidArgument: http.StatusBadRequest,
+	ErrCodeJobNotFound:     http.StatusNotFound,
+	ErrCodeDuplicate:       http.StatusConflict,
+	ErrCodePayloadTooLarge: http.StatusRequestEntityTooLarge,
+	ErrCodeAuthFailed:      http.StatusUnauthorized,
+}
+
+func httpError(w http.ResponseWriter, code string, err error) {
+	status, ok := httpStatus[code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	// a job rejected by middleware, e.g. DENIED
+	if ke, ok := err.(manager.KnownError); ok {
+		code = ke.Code()
+		status = http.StatusUnprocessableEntity
+	}
+	writeJSON(w, status, map[string]string{"code": code, "error": err.Error()})
+}
+
+func writeRawJSON(w http.ResponseWriter, status int, data []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+	_, _ = w.Write([]byte("\n"))
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
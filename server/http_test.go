@@ -0,0 +1,97 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{
+		Options: &ServerOptions{Password: "sekrit", MaxJobPayloadBytes: 64},
+		Stats:   &RuntimeStats{},
+	}
+	handler := s.httpHandler()
+
+	call := func(method, path, body, pwd string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if pwd != "" {
+			req.SetBasicAuth("", pwd)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := call("GET", "/info", "", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Basic realm="Faktory"`, w.Header().Get("WWW-Authenticate"))
+	assert.Contains(t, w.Body.String(), `"code":"ERR_AUTH_FAILED"`)
+
+	w = call("GET", "/info", "", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = call("GET", "/jobs", "", "sekrit")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "POST", w.Header().Get("Allow"))
+
+	w = call("POST", "/jobs", "{", "sekrit")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"ERR_INVALID_FORMAT"`)
+
+	w = call("POST", "/jobs", `{"jobtype":"Big","args":["`+strings.Repeat("x", 64)+`"]}`, "sekrit")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"ERR_PAYLOAD_TOO_LARGE"`)
+
+	w = call("GET", "/jobs/queues/default", "", "sekrit")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"ERR_INVALID_FORMAT"`)
+
+	w = call("POST", "/jobs/queues/default", "", "sekrit")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET", w.Header().Get("Allow"))
+
+	w = call("GET", "/jobs/123456789/ack", "", "sekrit")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	w = call("PUT", "/jobs/123456789/fail", "not json", "sekrit")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = call("PUT", "/jobs/123456789/retry", "", "sekrit")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = call("PUT", "/jobs/123456789", "", "sekrit")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHTTPReply(t *testing.T) {
+	t.Parallel()
+
+	w := httptest.NewRecorder()
+	reply, ok := httpReply(w, []byte("+OK 123456789\r\n"))
+	assert.True(t, ok)
+	assert.Equal(t, "OK 123456789", string(reply))
+
+	reply, ok = httpReply(w, []byte("$7\r\n{\"a\":1}\r\n"))
+	assert.True(t, ok)
+	assert.Equal(t, `{"a":1}`, string(reply))
+
+	reply, ok = httpReply(w, []byte("$-1\r\n"))
+	assert.True(t, ok)
+	assert.Nil(t, reply)
+
+	_, ok = httpReply(w, []byte("-ERR ERR_JOB_NOT_FOUND Job not found\r\n"))
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), `"error":"Job not found"`)
+
+	w = httptest.NewRecorder()
+	_, ok = httpReply(w, []byte("-DENIED Not today\r\n"))
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"DENIED"`)
+}
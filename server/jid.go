@@ -0,0 +1,117 @@
+package server
+
+import (
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/manager"
+)
+
+// Jobs pushed without a JID are given one by Options.JIDGenerator,
+// which may be one of the generators below.  Clients which set their
+// own JID are unaffected.  A JID must be at least 8 characters.
+
+// RandomJID returns 16 random URL-safe characters, as client.NewJob does.
+func RandomJID() string {
+	return client.RandomJid()
+}
+
+// Crockford's base32, which omits I, L, O and U.
+const ulidAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDGenerator returns a ULID: 26 characters which sort by creation
+// time to the millisecond, see https://github.com/ulid/spec.
+func ULIDGenerator() string {
+	var entropy [10]byte
+	_, _ = cryptorand.Read(entropy[:])
+	return ulid(time.Now(), entropy)
+}
+
+// A 48 bit millisecond timestamp followed by 80 bits of entropy.
+func ulid(at time.Time, entropy [10]byte) string {
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], uint64(at.UnixNano()/int64(time.Millisecond))<<16)
+	copy(id[6:], entropy[:])
+
+	// 128 bits as 26 5-bit characters, the first holds the top 3 bits
+	hi := binary.BigEndian.Uint64(id[:8])
+	lo := binary.BigEndian.Uint64(id[8:])
+	var out [26]byte
+	for idx := 25; idx >= 0; idx-- {
+		out[idx] = ulidAlphabet[lo&0x1F]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// Seeded from the clock so JIDs keep increasing across restarts.
+var sequence = time.Now().UnixNano()
+
+// SequentialJID returns increasing integers.
+func SequentialJID() string {
+	return strconv.FormatInt(atomic.AddInt64(&sequence, 1), 10)
+}
+
+func (s *Server) assignJid(job *client.Job) {
+	if job.Jid == "" && s.Options.JIDGenerator != nil {
+		job.Jid = s.Options.JIDGenerator()
+	}
+}
+
+// Pushed jobs' JIDs are checked by Options.JIDValidator, which may be
+// one of the validators below, so a JID can't break the protocol with
+// a space or newline.  DefaultJIDValidator is used if it's nil.
+
+var errInvalidJid = errors.New("invalid JID")
+
+var (
+	alphanumericJid = regexp.MustCompile(`^[A-Za-z0-9_-]{8,32}$`)
+	uuidJid         = regexp.MustCompile(`^[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}$`)
+	ulidJid         = regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Za-hjkmnp-tv-z]{25}$`)
+)
+
+// AlphanumericValidator accepts 8 to 32 letters, digits, dashes and
+// underscores, which covers the JIDs the generators above produce.
+func AlphanumericValidator(jid string) bool {
+	return alphanumericJid.MatchString(jid)
+}
+
+// UUIDValidator accepts a UUID in its 36 character form.
+func UUIDValidator(jid string) bool {
+	return uuidJid.MatchString(jid)
+}
+
+// ULIDValidator accepts a ULID, upper or lower case.
+func ULIDValidator(jid string) bool {
+	return ulidJid.MatchString(jid)
+}
+
+// DefaultJIDValidator accepts what AlphanumericValidator or
+// UUIDValidator do, since some clients use UUIDs as JIDs.
+func DefaultJIDValidator(jid string) bool {
+	return AlphanumericValidator(jid) || UUIDValidator(jid)
+}
+
+func (s *Server) jidValidator() func(string) bool {
+	if s.Options.JIDValidator != nil {
+		return s.Options.JIDValidator
+	}
+	return DefaultJIDValidator
+}
+
+func (s *Server) validateJid(next func() error, ctx manager.Context) error {
+	jid := ctx.Job().Jid
+	if !s.jidValidator()(jid) {
+		s.logger().Info("Rejected job with an invalid JID", map[string]interface{}{"jid": jid})
+		return fmt.Errorf("%w %q", errInvalidJid, jid)
+	}
+	return next()
+}
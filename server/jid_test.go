@@ -0,0 +1,93 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJIDGenerators(t *testing.T) {
+	t.Parallel()
+
+	// the example from the ULID spec
+	at := time.Unix(0, 1469918176385*int64(time.Millisecond))
+	assert.Equal(t, "01ARYZ6S410000000000000000", ulid(at, [10]byte{}))
+	var ones [10]byte
+	for idx := range ones {
+		ones[idx] = 0xFF
+	}
+	assert.Equal(t, "01ARYZ6S41ZZZZZZZZZZZZZZZZ", ulid(at, ones))
+
+	first := ULIDGenerator()
+	time.Sleep(2 * time.Millisecond)
+	second := ULIDGenerator()
+	assert.Len(t, first, 26)
+	assert.True(t, first < second)
+
+	a, b := SequentialJID(), SequentialJID()
+	assert.True(t, len(a) >= 8)
+	assert.True(t, a < b)
+	assert.Len(t, RandomJID(), 16)
+
+	s := &Server{Options: &ServerOptions{}}
+	job := client.NewJob("Report")
+	job.Jid = ""
+	s.assignJid(job)
+	assert.Equal(t, "", job.Jid)
+
+	s.Options.JIDGenerator = func() string { return "generated" }
+	s.assignJid(job)
+	assert.Equal(t, "generated", job.Jid)
+	job.Jid = "explicit"
+	s.assignJid(job)
+	assert.Equal(t, "explicit", job.Jid)
+}
+
+func TestJIDValidators(t *testing.T) {
+	t.Parallel()
+
+	uuid := "3b241101-e2bb-4255-8caf-4136c566a962"
+	id := ULIDGenerator()
+
+	assert.True(t, AlphanumericValidator("abc_123-XYZ"))
+	assert.True(t, AlphanumericValidator(RandomJID()))
+	assert.False(t, AlphanumericValidator(""))
+	assert.False(t, AlphanumericValidator("abc_123"))
+	assert.False(t, AlphanumericValidator("has space"))
+	assert.False(t, AlphanumericValidator("has/slash"))
+	assert.False(t, AlphanumericValidator("123456789012345678901234567890123"))
+	assert.False(t, AlphanumericValidator(uuid))
+
+	assert.True(t, UUIDValidator(uuid))
+	assert.False(t, UUIDValidator("3b241101e2bb42558caf4136c566a962"))
+	assert.False(t, UUIDValidator(id))
+
+	assert.True(t, ULIDValidator(id))
+	assert.True(t, ULIDValidator("01aryz6s41zzzzzzzzzzzzzzzz"))
+	assert.False(t, ULIDValidator("81ARYZ6S410000000000000000"))
+	assert.False(t, ULIDValidator("01ARYZ6S41000000000000000U"))
+
+	assert.True(t, DefaultJIDValidator(uuid))
+	assert.True(t, DefaultJIDValidator(id))
+	assert.False(t, DefaultJIDValidator("a\nb"))
+
+	s := &Server{Options: &ServerOptions{}}
+	job := client.NewJob("Report")
+	push := func() error {
+		return s.validateJid(func() error { return nil }, jobContext{job: job})
+	}
+	assert.NoError(t, push())
+	job.Jid = "not valid"
+	err := push()
+	assert.True(t, errors.Is(err, errInvalidJid))
+	assert.Equal(t, ErrCodeInvalidArgument, errorCode(err))
+
+	s.Options.JIDValidator = UUIDValidator
+	job.Jid = RandomJID()
+	assert.True(t, errors.Is(push(), errInvalidJid))
+	job.Jid = uuid
+	assert.NoError(t, push())
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/contribsys/faktory/manager"
+	"github.com/contribsys/faktory/util"
+)
+
+// The number of lifecycle events kept for TRACE.
+const jobEventCapacity = 10000
+
+// A step in a job's lifecycle: "push", "schedule", "fetch", "ack" or
+// "fail".  Unlike a Tracer's spans these stay in memory, for debugging
+// why a job was delayed with TRACE.
+type JobEvent struct {
+	EventType string `json:"event_type"`
+	Jid       string `json:"jid"`
+	Queue     string `json:"queue"`
+	Wid       string `json:"worker_wid,omitempty"`
+	Timestamp string `json:"timestamp"`
+}
+
+// The most recent events, once full the oldest event is overwritten.
+type jobEventLog struct {
+	mu     sync.Mutex
+	events []JobEvent
+	next   int
+}
+
+func (jl *jobEventLog) record(event JobEvent) {
+	jl.mu.Lock()
+	defer jl.mu.Unlock()
+
+	if len(jl.events) < jobEventCapacity {
+		jl.events = append(jl.events, event)
+		return
+	}
+	jl.events[jl.next] = event
+	jl.next = (jl.next + 1) % jobEventCapacity
+}
+
+// The job's events, oldest first.
+func (jl *jobEventLog) find(jid string) []JobEvent {
+	jl.mu.Lock()
+	defer jl.mu.Unlock()
+
+	found := []JobEvent{}
+	for idx := range jl.events {
+		event := jl.events[(jl.next+idx)%len(jl.events)]
+		if event.Jid == jid {
+			found = append(found, event)
+		}
+	}
+	return found
+}
+
+func (s *Server) enableJobEvents() {
+	if !s.Options.EnableTracing {
+		return
+	}
+	s.manager.AddMiddleware("push", s.recordJobEvent("push"))
+	s.manager.AddMiddleware("fetch", s.recordJobEvent("fetch"))
+	s.manager.AddMiddleware("ack", s.recordJobEvent("ack"))
+	s.manager.AddMiddleware("fail", s.recordJobEvent("fail"))
+}
+
+func (s *Server) recordJobEvent(eventType string) manager.MiddlewareFunc {
+	return func(next func() error, ctx manager.Context) error {
+		err := next()
+		if err != nil {
+			return err
+		}
+
+		job := ctx.Job()
+		event := JobEvent{EventType: eventType, Jid: job.Jid, Queue: job.Queue, Timestamp: util.Nows()}
+		if eventType == "push" && job.At != "" {
+			at, perr := util.ParseTime(job.At)
+			if perr == nil && at.After(time.Now()) {
+				event.EventType = "schedule"
+			}
+		}
+		res := ctx.Reservation()
+		if res == nil && eventType == "fetch" {
+			// reserved by the rest of the chain
+			res = ctx.Manager().FindReservation(job.Jid)
+		}
+		if res != nil {
+			event.Wid = res.Wid
+		}
+		s.jobEvents.record(event)
+		return nil
+	}
+}
+
+// TRACE <jid>
+//
+// The job's lifecycle events still held in memory, oldest first.
+// Requires the enable_tracing option.
+func trace(c *Connection, s *Server, cmd string) {
+	args := strings.Split(cmd, " ")[1:]
+	if len(args) != 1 || args[0] == "" {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+	if !s.Options.EnableTracing {
+		_ = c.Error(cmd, ErrCodeNotSupported, fmt.Errorf("Job tracing is disabled, see enable_tracing"))
+		return
+	}
+
+	ns := c.namespace()
+	events := []JobEvent{}
+	for _, event := range s.jobEvents.find(args[0]) {
+		local, ok := ns.local(event.Queue)
+		if !ok {
+			continue
+		}
+		event.Queue = local
+		events = append(events, event)
+	}
+
+	data, err := json.Marshal(events)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	_ = c.Result(data)
+}
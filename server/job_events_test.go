@@ -0,0 +1,35 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobEventLog(t *testing.T) {
+	t.Parallel()
+
+	var jl jobEventLog
+	assert.Empty(t, jl.find("abc"))
+
+	jl.record(JobEvent{EventType: "push", Jid: "abc"})
+	jl.record(JobEvent{EventType: "push", Jid: "def"})
+	jl.record(JobEvent{EventType: "fetch", Jid: "abc", Wid: "worker1"})
+	assert.Equal(t, []JobEvent{
+		{EventType: "push", Jid: "abc"},
+		{EventType: "fetch", Jid: "abc", Wid: "worker1"},
+	}, jl.find("abc"))
+
+	// the oldest events are overwritten once full
+	for idx := 0; idx < jobEventCapacity-2; idx++ {
+		jl.record(JobEvent{EventType: "push", Jid: fmt.Sprintf("job%d", idx)})
+	}
+	jl.record(JobEvent{EventType: "ack", Jid: "abc"})
+	assert.Equal(t, []JobEvent{
+		{EventType: "fetch", Jid: "abc", Wid: "worker1"},
+		{EventType: "ack", Jid: "abc"},
+	}, jl.find("abc"))
+	assert.Empty(t, jl.find("def"))
+	assert.Len(t, jl.events, jobEventCapacity)
+}
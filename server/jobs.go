@@ -0,0 +1,570 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/manager"
+	"github.com/contribsys/faktory/storage"
+	"github.com/contribsys/faktory/util"
+)
+
+// Commands which operate on a single job, looked up by JID.
+// These scan the persistent sets so they are O(N) and intended
+// for operators, not for use within normal job processing.
+
+// Search the scheduled, retry and dead sets for the given JID.
+// Returns nil if the job is not in any set.
+func (s *Server) findJob(jid string) (storage.SortedSet, storage.SortedEntry, error) {
+	sets := []storage.SortedSet{s.store.Scheduled(), s.store.Retries(), s.store.Dead()}
+	for _, set := range sets {
+		ent, err := storage.FindByJid(set, jid)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ent != nil {
+			return set, ent, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+func jidArgument(cmd string) (string, error) {
+	parts := strings.Split(cmd, " ")
+	if len(parts) != 2 || parts[1] == "" {
+		return "", fmt.Errorf("Invalid format")
+	}
+	return parts[1], nil
+}
+
+// DELETE <jid>
+func deleteJob(c *Connection, s *Server, cmd string) {
+	jid, err := jidArgument(cmd)
+	if err != nil {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, err)
+		return
+	}
+
+	job, err := s.manager.Unreserve(jid)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	if job != nil {
+		s.manager.Removed(job)
+		_ = c.Ok()
+		return
+	}
+
+	set, ent, err := s.findJob(jid)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	if ent == nil {
+		_ = c.Error(cmd, ErrCodeJobNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	job, err = ent.Job()
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	err = set.RemoveEntry(ent)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	s.manager.Removed(job)
+	_ = c.Ok()
+}
+
+// CANCEL <jid>
+//
+// Remove a job which is being worked or is scheduled.  Unlike FAIL the
+// job isn't retried and neither the processed nor failed counts change.
+func cancel(c *Connection, s *Server, cmd string) {
+	jid, err := jidArgument(cmd)
+	if err != nil {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, err)
+		return
+	}
+
+	job, err := s.manager.Cancel(jid)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	if job == nil {
+		_ = c.Error(cmd, ErrCodeJobNotFound, fmt.Errorf("not found"))
+		return
+	}
+	_ = c.Ok()
+}
+
+// RESURRECT <jid>
+//
+// Move a job from the dead set back onto its queue with a clean
+// failure history so it gets the full number of retries again.
+func resurrect(c *Connection, s *Server, cmd string) {
+	jid, err := jidArgument(cmd)
+	if err != nil {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, err)
+		return
+	}
+
+	dead := s.store.Dead()
+	ent, err := storage.FindByJid(dead, jid)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	if ent == nil {
+		_ = c.Error(cmd, ErrCodeJobNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	job, err := ent.Job()
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	key, err := ent.Key()
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	q, err := s.store.GetQueue(job.Queue)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+
+	// claim the job first so a concurrent RESURRECT or purge can't
+	// also act on it
+	removed, err := dead.Remove(key)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	if !removed {
+		_ = c.Error(cmd, ErrCodeJobNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	job.Failure = nil
+	err = q.Add(job)
+	if err != nil {
+		expiry := util.Thens(time.Now().Add(manager.DeadTTL))
+		if rerr := dead.AddElement(expiry, jid, ent.Value()); rerr != nil {
+			s.logger().Error("Unable to return job to the dead set", rerr, map[string]interface{}{"jid": jid})
+		}
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	_ = c.Ok()
+}
+
+// MOVE <jid> <queue>
+//
+// Move a scheduled or retrying job onto the given queue so it runs
+// right away.  A job which is being worked moves if it fails or is
+// requeued, see Manager.MoveWhenDone.
+func move(c *Connection, s *Server, cmd string) {
+	parts := strings.Split(cmd, " ")
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+	if !storage.ValidQueueName.MatchString(parts[2]) {
+		_ = c.Error(cmd, ErrCodeInvalidArgument, fmt.Errorf("Invalid queue %q, queue names must match %v", parts[2], storage.ValidQueueName))
+		return
+	}
+	jid, queue := parts[1], c.namespace().queue(parts[2])
+	if renamed, ok := s.manager.RenamedQueue(queue); ok {
+		queue = renamed
+	}
+
+	moved, err := s.manager.MoveWhenDone(jid, queue)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	if moved {
+		_ = c.Ok()
+		return
+	}
+
+	for _, set := range []storage.SortedSet{s.store.Scheduled(), s.store.Retries()} {
+		ent, err := storage.FindByJid(set, jid)
+		if err != nil {
+			_ = c.Error(cmd, errorCode(err), err)
+			return
+		}
+		if ent == nil {
+			continue
+		}
+
+		job, err := ent.Job()
+		if err != nil {
+			_ = c.Error(cmd, errorCode(err), err)
+			return
+		}
+		job.Queue = queue
+
+		q, err := s.store.GetQueue(queue)
+		if err != nil {
+			_ = c.Error(cmd, errorCode(err), err)
+			return
+		}
+		err = q.Add(job)
+		if err != nil {
+			_ = c.Error(cmd, errorCode(err), err)
+			return
+		}
+		err = set.RemoveEntry(ent)
+		if err != nil {
+			_ = c.Error(cmd, errorCode(err), err)
+			return
+		}
+		_ = c.Ok()
+		return
+	}
+	_ = c.Error(cmd, ErrCodeJobNotFound, fmt.Errorf("not found"))
+}
+
+// PROMOTE <jid>
+//
+// Push a scheduled or retrying job onto its queue so it runs right
+// away, keeping its JID.
+func promote(c *Connection, s *Server, cmd string) {
+	jid, err := jidArgument(cmd)
+	if err != nil {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, err)
+		return
+	}
+
+	// it's enqueued once its dependencies are done
+	waiting, err := s.manager.Waiting(jid)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	if waiting {
+		_ = c.Error(cmd, ErrCodeInvalidArgument, fmt.Errorf("Job %s is waiting for its dependencies", jid))
+		return
+	}
+
+	for _, set := range []storage.SortedSet{s.store.Scheduled(), s.store.Retries()} {
+		ent, err := storage.FindByJid(set, jid)
+		if err != nil {
+			_ = c.Error(cmd, errorCode(err), err)
+			return
+		}
+		if ent == nil {
+			continue
+		}
+
+		key, err := ent.Key()
+		if err != nil {
+			_ = c.Error(cmd, errorCode(err), err)
+			return
+		}
+		err = s.store.EnqueueFrom(set, key)
+		if err != nil {
+			_ = c.Error(cmd, errorCode(err), err)
+			return
+		}
+		_ = c.Ok()
+		return
+	}
+	_ = c.Error(cmd, ErrCodeJobNotFound, fmt.Errorf("not found"))
+}
+
+// COPY <jid> <queue>
+//
+// Push a copy of the job, wherever it is, onto the given queue.  The
+// copy gets a new JID, which is the response, and runs right away with
+// a clean failure history; the original job is left alone.
+func copyJob(c *Connection, s *Server, cmd string) {
+	parts := strings.Split(cmd, " ")
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+
+	jids, err := s.fanout(parts[1], c.namespace().queues(parts[2:]))
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	_ = c.OkWith(jids[0])
+}
+
+// FANOUT <jid> <queue> [<queue> ...]
+//
+// COPY the job to each of the queues, responds with a JSON array of the
+// copies' JIDs in the same order as the queues.
+func fanout(c *Connection, s *Server, cmd string) {
+	parts := strings.Split(cmd, " ")
+	if len(parts) < 3 || parts[1] == "" {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+	for _, queue := range parts[2:] {
+		if queue == "" {
+			_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+			return
+		}
+	}
+
+	jids, err := s.fanout(parts[1], c.namespace().queues(parts[2:]))
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	data, err := json.Marshal(jids)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	_ = c.Result(data)
+}
+
+// Push a copy of the job onto each queue, returning the new JIDs.  If
+// a push fails the copies already pushed remain enqueued.
+func (s *Server) fanout(jid string, queues []string) ([]string, error) {
+	found, err := s.inspectJob(jid)
+	if err != nil {
+		return nil, err
+	}
+	if found.Job == nil {
+		return nil, fmt.Errorf("%w %s", manager.ErrJobNotFound, jid)
+	}
+
+	jids := make([]string, 0, len(queues))
+	for _, queue := range queues {
+		clone, err := s.cloneJob(found.Job, queue)
+		if err != nil {
+			return nil, err
+		}
+		err = s.manager.Push(clone)
+		if err != nil {
+			return nil, err
+		}
+		jids = append(jids, clone.Jid)
+	}
+	return jids, nil
+}
+
+// A deep copy of the job, ready to push as a new job onto the queue.
+// The copy doesn't join the job's batch, wait for its dependencies or
+// replace its template.
+func (s *Server) cloneJob(job *client.Job, queue string) (*client.Job, error) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	var clone client.Job
+	err = json.Unmarshal(data, &clone)
+	if err != nil {
+		return nil, err
+	}
+
+	clone.Jid = ""
+	s.assignJid(&clone)
+	if clone.Jid == "" {
+		clone.Jid = client.RandomJid()
+	}
+	clone.Queue = queue
+	clone.CreatedAt = util.Nows()
+	clone.EnqueuedAt = ""
+	clone.At = ""
+	clone.Failure = nil
+	clone.Annotations = nil
+	clone.DependsOn = nil
+	clone.BaseJid = ""
+	delete(clone.Custom, "bid")
+	return &clone, nil
+}
+
+// The states returned by INSPECT.
+const (
+	JobStateWorking   = "working"
+	JobStateScheduled = "scheduled"
+	JobStateRetry     = "retry"
+	JobStateDead      = "dead"
+	JobStateQueued    = "queued"
+	JobStateNotFound  = "not_found"
+)
+
+// ANNOTATE <jid> <key> <value>
+//
+// Set a key in the annotations of a job being worked, e.g. progress or
+// diagnostic notes for INSPECT.  The value is the rest of the line.
+func annotate(c *Connection, s *Server, cmd string) {
+	args := strings.SplitN(cmd, " ", 4)[1:]
+	if len(args) != 3 || args[0] == "" || args[1] == "" {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+
+	err := s.manager.Annotate(args[0], args[1], args[2])
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	_ = c.Ok()
+}
+
+// The job's fields plus its state.  Job is nil if the job
+// wasn't found.
+type inspection struct {
+	*client.Job
+	Jid   string `json:"jid"`
+	State string `json:"state"`
+}
+
+// INSPECT <jid>
+//
+// Find the job and respond with it as JSON plus its "state".  A job
+// which can't be found is {"jid":"...","state":"not_found"}.
+func inspect(c *Connection, s *Server, cmd string) {
+	jid, err := jidArgument(cmd)
+	if err != nil {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, err)
+		return
+	}
+
+	result, err := s.inspectJob(jid)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	_ = c.Result(data)
+}
+
+// Search working, scheduled, retry, dead and then every queue,
+// stopping at the first match.
+func (s *Server) inspectJob(jid string) (*inspection, error) {
+	if res := s.manager.FindReservation(jid); res != nil {
+		return &inspection{Job: res.Job, Jid: jid, State: JobStateWorking}, nil
+	}
+
+	sets := []struct {
+		set   storage.SortedSet
+		state string
+	}{
+		{s.store.Scheduled(), JobStateScheduled},
+		{s.store.Retries(), JobStateRetry},
+		{s.store.Dead(), JobStateDead},
+	}
+	for _, ss := range sets {
+		ent, err := storage.FindByJid(ss.set, jid)
+		if err != nil {
+			return nil, err
+		}
+		if ent != nil {
+			job, err := ent.Job()
+			if err != nil {
+				return nil, err
+			}
+			return &inspection{Job: job, Jid: jid, State: ss.state}, nil
+		}
+	}
+
+	var found *client.Job
+	var err error
+	s.store.EachQueue(func(q storage.Queue) {
+		if found != nil || err != nil {
+			return
+		}
+		found, err = storage.FindInQueue(q, jid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found != nil {
+		return &inspection{Job: found, Jid: jid, State: JobStateQueued}, nil
+	}
+	return &inspection{Jid: jid, State: JobStateNotFound}, nil
+}
+
+// PURGE_DEAD
+//
+// Remove every job which died more than DeadRetention ago, passing
+// them to the DeadArchiver, responds with the number of jobs removed.
+func purgeDead(c *Connection, s *Server, cmd string) {
+	// dead jobs are scored by their expiry, DeadTTL after they died
+	cutoff := time.Now().Add(manager.DeadTTL - s.Options.deadRetention())
+
+	total, err := s.purgeDead(cutoff)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	_ = c.Number(int(total))
+}
+
+const defaultQueryLimit = 100
+
+// QUERY <set> jobtype=<type> [LIMIT <n>]
+//
+// Return a JSON array of up to 100 jobs of the given type in the
+// scheduled, retry or dead set.
+func query(c *Connection, s *Server, cmd string) {
+	args := strings.Split(cmd, " ")[1:]
+	if len(args) != 2 && len(args) != 4 {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+
+	name := args[0]
+	if name == "retry" {
+		name = "retries"
+	}
+	set := setForTarget(s.store, name)
+	if set == nil {
+		_ = c.Error(cmd, ErrCodeInvalidArgument, fmt.Errorf("Invalid set %s, must be scheduled, retry or dead", args[0]))
+		return
+	}
+
+	if !strings.HasPrefix(args[1], "jobtype=") || len(args[1]) == len("jobtype=") {
+		_ = c.Error(cmd, ErrCodeInvalidArgument, fmt.Errorf("Invalid filter %s, expected jobtype=<type>", args[1]))
+		return
+	}
+	jobtype := strings.TrimPrefix(args[1], "jobtype=")
+
+	limit := defaultQueryLimit
+	if len(args) == 4 {
+		val, err := strconv.Atoi(args[3])
+		if strings.ToUpper(args[2]) != "LIMIT" || err != nil || val < 1 {
+			_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+			return
+		}
+		limit = val
+	}
+
+	jobs, err := storage.FindByType(set, jobtype, limit)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+
+	data, err := json.Marshal(jobs)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	_ = c.Result(data)
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJidArgument(t *testing.T) {
+	t.Parallel()
+
+	jid, err := jidArgument("DELETE 12345abcde")
+	assert.NoError(t, err)
+	assert.Equal(t, "12345abcde", jid)
+
+	for _, cmd := range []string{"DELETE", "DELETE ", "DELETE abc def"} {
+		_, err = jidArgument(cmd)
+		assert.Error(t, err, cmd)
+	}
+}
+
+func TestInspectionJSON(t *testing.T) {
+	t.Parallel()
+
+	job := client.NewJob("Report", 1)
+	data, err := json.Marshal(&inspection{Job: job, Jid: job.Jid, State: JobStateRetry})
+	assert.NoError(t, err)
+	var hash map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &hash))
+	assert.Equal(t, job.Jid, hash["jid"])
+	assert.Equal(t, "Report", hash["jobtype"])
+	assert.Equal(t, "retry", hash["state"])
+
+	data, err = json.Marshal(&inspection{Jid: "12345abcde", State: JobStateNotFound})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"jid":"12345abcde","state":"not_found"}`, string(data))
+}
+
+func TestCloneJob(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{Options: &ServerOptions{}}
+	job := client.NewJob("Report", 1, map[string]interface{}{"user": "mike"})
+	job.At = "2030-01-01T00:00:00Z"
+	job.EnqueuedAt = "2020-01-01T00:00:00Z"
+	job.Failure = &client.Failure{RetryCount: 3, ErrorMessage: "boom"}
+	job.Annotations = map[string]string{"step": "2"}
+	job.Custom = map[string]interface{}{"trace": "abc", "bid": "b-12345"}
+	job.DependsOn = []string{"12345abcde"}
+	job.BaseJid = "template123"
+
+	clone, err := s.cloneJob(job, "analytics")
+	assert.NoError(t, err)
+	assert.NotEqual(t, job.Jid, clone.Jid)
+	assert.NotEmpty(t, clone.Jid)
+	assert.Equal(t, "analytics", clone.Queue)
+	assert.Equal(t, "Report", clone.Type)
+	assert.Equal(t, "", clone.At)
+	assert.Equal(t, "", clone.EnqueuedAt)
+	assert.Nil(t, clone.Failure)
+	assert.Nil(t, clone.Annotations)
+	assert.Nil(t, clone.DependsOn)
+	assert.Equal(t, "", clone.BaseJid)
+	assert.Equal(t, "abc", clone.Custom["trace"])
+	assert.NotContains(t, clone.Custom, "bid")
+
+	// the original is untouched
+	clone.Custom["trace"] = "xyz"
+	assert.Equal(t, "default", job.Queue)
+	assert.Equal(t, "abc", job.Custom["trace"])
+	assert.Equal(t, "b-12345", job.Custom["bid"])
+	assert.Equal(t, []string{"12345abcde"}, job.DependsOn)
+	assert.Equal(t, 3, job.Failure.RetryCount)
+
+	s.Options.JIDGenerator = func() string { return "generated" }
+	clone, err = s.cloneJob(job, "analytics")
+	assert.NoError(t, err)
+	assert.Equal(t, "generated", clone.Jid)
+}
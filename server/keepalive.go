@@ -0,0 +1,94 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// How long a client has to answer "+PING" with "PONG".
+const pongTimeout = 5 * time.Second
+
+var (
+	errNoPong      = errors.New("no PONG after PING")
+	errPartialLine = errors.New("incomplete command")
+)
+
+// A worker blocked waiting for jobs may sit behind a NAT or firewall
+// which silently drops idle connections.  Keep-alive probes let the
+// kernel notice so the connection doesn't linger forever.
+func (s *Server) enableKeepAlive(conn net.Conn) {
+	period := s.Options.tcpKeepAlive()
+	if period == 0 {
+		return
+	}
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok {
+		// a Unix socket
+		return
+	}
+	_ = tcp.SetKeepAlive(true)
+	_ = tcp.SetKeepAlivePeriod(period)
+}
+
+// Read the next command.  If Options.IdleTimeout passes without one,
+// ping a client which sent "ping" in its HELLO.  Any line within
+// pongTimeout answers, a "PONG" line is skipped, otherwise the
+// connection is given up on with errNoPong.  Other clients aren't
+// pinged, since they'd take "+PING" as the response to their next
+// command, but a command they leave unfinished for IdleTimeout is
+// given up on with errPartialLine.
+func (s *Server) readCommand(c *Connection) (string, error) {
+	idle := s.Options.IdleTimeout
+	if idle <= 0 || c.netConn == nil {
+		return c.buf.ReadString('\n')
+	}
+	ping := c.client != nil && c.client.Ping
+
+	var line string
+	pinged := false
+	for {
+		timeout := idle
+		if pinged {
+			timeout = pongTimeout
+		}
+		_ = c.netConn.SetReadDeadline(time.Now().Add(timeout))
+		part, err := c.buf.ReadString('\n')
+		line += part
+
+		if err == nil {
+			pinged = false
+			if ping && strings.TrimSpace(line) == "PONG" {
+				line = ""
+				continue
+			}
+			return line, nil
+		}
+
+		var ne net.Error
+		if !errors.As(err, &ne) || !ne.Timeout() {
+			return line, err
+		}
+		if pinged {
+			return "", errNoPong
+		}
+		if line != "" {
+			return "", errPartialLine
+		}
+		if !ping {
+			continue
+		}
+		if _, err := c.conn.Write([]byte("+PING\r\n")); err != nil {
+			return "", err
+		}
+		if err := c.flush(); err != nil {
+			return "", err
+		}
+		pinged = true
+	}
+}
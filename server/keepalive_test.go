@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func idleConnection(timeout time.Duration) (*Server, *Connection, *bufio.Reader, net.Conn) {
+	cli, srv := net.Pipe()
+	s := &Server{Options: &ServerOptions{IdleTimeout: timeout}}
+	c := &Connection{client: &ClientData{Ping: true}, conn: newReplyBuffer(srv), buf: bufio.NewReader(srv), netConn: srv}
+	return s, c, bufio.NewReader(cli), cli
+}
+
+func TestIdlePing(t *testing.T) {
+	t.Parallel()
+
+	s, c, rdr, cli := idleConnection(20 * time.Millisecond)
+	defer cli.Close()
+
+	go func() {
+		line, _ := rdr.ReadString('\n')
+		if line == "+PING\r\n" {
+			_, _ = cli.Write([]byte("PONG\r\nFLUSH\r\n"))
+		}
+	}()
+	cmd, err := s.readCommand(c)
+	assert.NoError(t, err)
+	assert.Equal(t, "FLUSH\r\n", cmd)
+}
+
+func TestIdleNoPong(t *testing.T) {
+	t.Parallel()
+
+	s, c, rdr, cli := idleConnection(20 * time.Millisecond)
+	defer cli.Close()
+
+	go func() {
+		_, _ = rdr.ReadString('\n')
+	}()
+	_, err := s.readCommand(c)
+	assert.Equal(t, errNoPong, err)
+}
+
+func TestIdleCommandAnswersPing(t *testing.T) {
+	t.Parallel()
+
+	s, c, rdr, cli := idleConnection(20 * time.Millisecond)
+	defer cli.Close()
+
+	go func() {
+		_, _ = rdr.ReadString('\n')
+		// the client sent a command before it read the ping
+		_, _ = cli.Write([]byte("PUSH {}\r\nPONG\r\nFLUSH\r\n"))
+	}()
+	cmd, err := s.readCommand(c)
+	assert.NoError(t, err)
+	assert.Equal(t, "PUSH {}\r\n", cmd)
+	cmd, err = s.readCommand(c)
+	assert.NoError(t, err)
+	assert.Equal(t, "FLUSH\r\n", cmd)
+}
+
+func TestIdleWithoutPing(t *testing.T) {
+	t.Parallel()
+
+	s, c, _, cli := idleConnection(20 * time.Millisecond)
+	defer cli.Close()
+	c.client.Ping = false
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, _ = cli.Write([]byte("FLUSH\r\n"))
+	}()
+	cmd, err := s.readCommand(c)
+	assert.NoError(t, err)
+	assert.Equal(t, "FLUSH\r\n", cmd)
+}
+
+func TestIdlePartialLine(t *testing.T) {
+	t.Parallel()
+
+	s, c, _, cli := idleConnection(20 * time.Millisecond)
+	defer cli.Close()
+
+	go func() {
+		_, _ = cli.Write([]byte("PUSH {"))
+	}()
+	_, err := s.readCommand(c)
+	assert.Equal(t, errPartialLine, err)
+}
+
+func TestTCPKeepAlive(t *testing.T) {
+	t.Parallel()
+
+	opts := &ServerOptions{}
+	assert.Equal(t, 30*time.Second, opts.tcpKeepAlive())
+
+	opts.TCPKeepAlive = time.Minute
+	assert.Equal(t, time.Minute, opts.tcpKeepAlive())
+
+	opts.TCPKeepAlive = -1
+	assert.Equal(t, time.Duration(0), opts.tcpKeepAlive())
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/contribsys/faktory/manager"
+	"github.com/contribsys/faktory/util"
+)
+
+// The number of recent fetches per queue used to calculate latency
+// percentiles.
+const latencySamples = 1000
+
+// How long each queue's recently fetched jobs waited to be fetched,
+// i.e. the time between EnqueuedAt and FETCH.
+type latencyTracker struct {
+	mu     sync.Mutex
+	queues map[string]*latencyRing
+}
+
+// A fixed size ring buffer, once full the oldest sample is overwritten.
+type latencyRing struct {
+	samples []time.Duration
+	next    int
+}
+
+type LatencyPercentiles struct {
+	P50Ms int64 `json:"latency_p50_ms"`
+	P99Ms int64 `json:"latency_p99_ms"`
+}
+
+func (lt *latencyTracker) record(queue string, latency time.Duration) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	if lt.queues == nil {
+		lt.queues = map[string]*latencyRing{}
+	}
+	ring, ok := lt.queues[queue]
+	if !ok {
+		ring = &latencyRing{samples: make([]time.Duration, 0, latencySamples)}
+		lt.queues[queue] = ring
+	}
+	if len(ring.samples) < latencySamples {
+		ring.samples = append(ring.samples, latency)
+		return
+	}
+	ring.samples[ring.next] = latency
+	ring.next = (ring.next + 1) % latencySamples
+}
+
+func (lt *latencyTracker) percentiles() map[string]LatencyPercentiles {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	result := map[string]LatencyPercentiles{}
+	for name, ring := range lt.queues {
+		sorted := make([]time.Duration, len(ring.samples))
+		copy(sorted, ring.samples)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		result[name] = LatencyPercentiles{
+			P50Ms: percentile(sorted, 50).Milliseconds(),
+			P99Ms: percentile(sorted, 99).Milliseconds(),
+		}
+	}
+	return result
+}
+
+// Nearest-rank percentile of the sorted samples.
+func percentile(sorted []time.Duration, pct int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (pct*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func (s *Server) trackLatency(next func() error, ctx manager.Context) error {
+	err := next()
+	if err != nil {
+		return err
+	}
+	job := ctx.Job()
+	if job.EnqueuedAt == "" {
+		return nil
+	}
+	enqueuedAt, perr := util.ParseTime(job.EnqueuedAt)
+	if perr != nil {
+		return nil
+	}
+	s.latency.record(job.Queue, time.Since(enqueuedAt))
+	return nil
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyTracker(t *testing.T) {
+	t.Parallel()
+
+	var lt latencyTracker
+	assert.Empty(t, lt.percentiles())
+
+	for i := 1; i <= 100; i++ {
+		lt.record("default", time.Duration(i)*time.Millisecond)
+	}
+	lt.record("critical", 7*time.Millisecond)
+
+	pcts := lt.percentiles()
+	assert.Equal(t, LatencyPercentiles{P50Ms: 50, P99Ms: 99}, pcts["default"])
+	assert.Equal(t, LatencyPercentiles{P50Ms: 7, P99Ms: 7}, pcts["critical"])
+
+	// once full, new samples replace the oldest
+	for i := 0; i < latencySamples; i++ {
+		lt.record("default", time.Second)
+	}
+	assert.Len(t, lt.queues["default"].samples, latencySamples)
+	assert.Equal(t, LatencyPercentiles{P50Ms: 1000, P99Ms: 1000}, lt.percentiles()["default"])
+}
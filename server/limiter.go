@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net"
+	"sync"
+)
+
+// Tracks the number of open connections per remote IP so a single
+// misbehaving host can't exhaust the server's file descriptors.
+type connLimiter struct {
+	max    int
+	counts map[string]int
+	mu     sync.Mutex
+}
+
+func newConnLimiter(max int) *connLimiter {
+	return &connLimiter{
+		max:    max,
+		counts: map[string]int{},
+	}
+}
+
+// Returns the IP the connection was counted against and false if
+// that IP already has the maximum number of connections open.
+// Connections over Unix sockets are not limited.
+func (cl *connLimiter) acquire(addr net.Addr) (string, bool) {
+	if cl.max <= 0 {
+		return "", true
+	}
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return "", true
+	}
+	ip := tcp.IP.String()
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.counts[ip] >= cl.max {
+		return "", false
+	}
+	cl.counts[ip]++
+	return ip, true
+}
+
+func (cl *connLimiter) release(ip string) {
+	if ip == "" {
+		return
+	}
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.counts[ip]--
+	if cl.counts[ip] <= 0 {
+		delete(cl.counts, ip)
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnLimiter(t *testing.T) {
+	t.Parallel()
+
+	cl := newConnLimiter(2)
+	addr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 50001}
+	other := &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 50001}
+
+	ip, ok := cl.acquire(addr)
+	assert.True(t, ok)
+	assert.Equal(t, "10.0.0.1", ip)
+	_, ok = cl.acquire(addr)
+	assert.True(t, ok)
+	_, ok = cl.acquire(addr)
+	assert.False(t, ok)
+
+	_, ok = cl.acquire(other)
+	assert.True(t, ok)
+
+	cl.release(ip)
+	_, ok = cl.acquire(addr)
+	assert.True(t, ok)
+
+	// unix sockets are never limited
+	for i := 0; i < 5; i++ {
+		ip, ok = cl.acquire(&net.UnixAddr{Name: "/tmp/faktory.sock", Net: "unix"})
+		assert.True(t, ok)
+		assert.Equal(t, "", ip)
+	}
+
+	unlimited := newConnLimiter(0)
+	for i := 0; i < 5; i++ {
+		_, ok = unlimited.acquire(addr)
+		assert.True(t, ok)
+	}
+}
+
+func TestMaxConnections(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{
+		Options: &ServerOptions{MaxConnections: 1},
+		Stats:   &RuntimeStats{StartedAt: time.Now(), Connections: 1},
+	}
+	cli, srv := net.Pipe()
+	defer cli.Close()
+
+	go s.accept(srv)
+	line, err := bufio.NewReader(cli).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "-ERR ERR_SERVER_BUSY server busy\r\n", line)
+	assert.EqualValues(t, 1, atomic.LoadUint64(&s.Stats.ConnectionsRejected))
+	assert.EqualValues(t, 1, atomic.LoadUint64(&s.Stats.Connections))
+
+	// a client which never reads doesn't hold up the accept loop
+	idle, srv := net.Pipe()
+	defer idle.Close()
+	done := make(chan bool)
+	go func() {
+		s.accept(srv)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("accept blocked on a rejected client")
+	}
+	assert.EqualValues(t, 2, atomic.LoadUint64(&s.Stats.ConnectionsRejected))
+}
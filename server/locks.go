@@ -0,0 +1,83 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/contribsys/faktory/util"
+)
+
+// How long a lock is held if LOCK doesn't give a TTL.
+const defaultLockTTL = 60 * time.Second
+
+// Locks belong to the worker process so a worker can release a lock
+// after reconnecting.  A producer without a WID can only release its
+// locks on the connection which took them; closing the connection
+// doesn't release them, they're held until their TTL passes.
+func (c *Connection) lockHolder() string {
+	if c.client != nil && c.client.Wid != "" {
+		return c.client.Wid
+	}
+	if c.holder == "" {
+		c.holder = util.RandomJid()
+	}
+	return c.holder
+}
+
+// LOCK <name> [ttl_seconds]
+//
+// Take an advisory lock, responds with OK or nil if it's already held.
+// The lock expires after the TTL, 60 seconds by default.
+func lock(c *Connection, s *Server, cmd string) {
+	args := strings.Split(cmd, " ")[1:]
+	if len(args) < 1 || len(args) > 2 || args[0] == "" {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+
+	ttl := defaultLockTTL
+	if len(args) == 2 {
+		secs, err := strconv.Atoi(args[1])
+		if err != nil || secs < 1 {
+			_ = c.Error(cmd, ErrCodeInvalidArgument, fmt.Errorf("Invalid TTL %s, must be a positive number of seconds", args[1]))
+			return
+		}
+		ttl = time.Duration(secs) * time.Second
+	}
+
+	ok, err := s.store.Lock(c.namespace().queue(args[0]), c.lockHolder(), ttl)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	if !ok {
+		_ = c.Result(nil)
+		return
+	}
+	_ = c.Ok()
+}
+
+// UNLOCK <name>
+//
+// Release a lock taken with LOCK, responds with OK or nil if the lock
+// isn't held by this client.
+func unlock(c *Connection, s *Server, cmd string) {
+	args := strings.Split(cmd, " ")[1:]
+	if len(args) != 1 || args[0] == "" {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+
+	ok, err := s.store.Unlock(c.namespace().queue(args[0]), c.lockHolder())
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	if !ok {
+		_ = c.Result(nil)
+		return
+	}
+	_ = c.Ok()
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockHolder(t *testing.T) {
+	t.Parallel()
+
+	c := dummyConnection()
+	c.client.Wid = ""
+	holder := c.lockHolder()
+	assert.NotEmpty(t, holder)
+	assert.Equal(t, holder, c.lockHolder())
+	other := dummyConnection()
+	other.client.Wid = ""
+	assert.NotEqual(t, holder, other.lockHolder())
+
+	c.client.Wid = "4a3b2c1d"
+	assert.Equal(t, "4a3b2c1d", c.lockHolder())
+}
+
+func TestLockFormat(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{}
+	c := dummyConnection()
+	for _, cmd := range []string{"LOCK", "LOCK ", "LOCK report 60 extra"} {
+		lock(c, s, cmd)
+		assert.Contains(t, output(c), "ERR_INVALID_FORMAT", cmd)
+	}
+	for _, cmd := range []string{"LOCK report soon", "LOCK report 0", "LOCK report -5"} {
+		lock(c, s, cmd)
+		assert.Contains(t, output(c), "ERR_INVALID_ARGUMENT", cmd)
+	}
+	for _, cmd := range []string{"UNLOCK", "UNLOCK report extra"} {
+		unlock(c, s, cmd)
+		assert.Contains(t, output(c), "ERR_INVALID_FORMAT", cmd)
+	}
+}
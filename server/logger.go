@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/contribsys/faktory/util"
+)
+
+// Logger receives the server's connection and lifecycle messages.  Set
+// ServerOptions.Logger to adapt it to zerolog, zap or whatever your log
+// pipeline expects.  Background tasks and the manager still log through
+// util.
+type Logger interface {
+	Info(msg string, fields map[string]interface{})
+	Warn(msg string, fields map[string]interface{})
+	Error(msg string, err error, fields map[string]interface{})
+}
+
+var defaultLogger = NewJSONLogger(os.Stdout)
+
+// NewJSONLogger returns a Logger which writes one JSON object per line
+// to +w+.  Info messages respect the global log level, as util.Info does.
+func NewJSONLogger(w io.Writer) Logger {
+	return &jsonLogger{enc: json.NewEncoder(w)}
+}
+
+type jsonLogger struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (jl *jsonLogger) Info(msg string, fields map[string]interface{}) {
+	if !util.InfoEnabled() {
+		return
+	}
+	jl.write("info", msg, nil, fields)
+}
+
+func (jl *jsonLogger) Warn(msg string, fields map[string]interface{}) {
+	jl.write("warn", msg, nil, fields)
+}
+
+func (jl *jsonLogger) Error(msg string, err error, fields map[string]interface{}) {
+	jl.write("error", msg, err, fields)
+}
+
+func (jl *jsonLogger) write(level string, msg string, err error, fields map[string]interface{}) {
+	entry := make(map[string]interface{}, len(fields)+4)
+	for k, v := range fields {
+		entry[k] = v
+	}
+	entry["ts"] = time.Now().UTC().Format(util.TimeFormat)
+	entry["level"] = level
+	entry["msg"] = msg
+	if err != nil {
+		entry["error"] = err.Error()
+	}
+
+	jl.mu.Lock()
+	defer jl.mu.Unlock()
+	_ = jl.enc.Encode(entry)
+}
+
+func (s *Server) logger() Logger {
+	if s.Options.Logger != nil {
+		return s.Options.Logger
+	}
+	return defaultLogger
+}
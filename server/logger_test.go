@@ -0,0 +1,56 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/contribsys/faktory/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONLogger(t *testing.T) {
+	var buf bytes.Buffer
+	log := NewJSONLogger(&buf)
+
+	log.Error("Bad connection", fmt.Errorf("boom"), map[string]interface{}{"remote": "1.2.3.4"})
+
+	var entry map[string]interface{}
+	err := json.Unmarshal(buf.Bytes(), &entry)
+	assert.NoError(t, err)
+	assert.Equal(t, "error", entry["level"])
+	assert.Equal(t, "Bad connection", entry["msg"])
+	assert.Equal(t, "boom", entry["error"])
+	assert.Equal(t, "1.2.3.4", entry["remote"])
+	assert.NotEmpty(t, entry["ts"])
+
+	// Info respects the global log level
+	prev := util.LogInfo
+	defer func() { util.LogInfo = prev }()
+
+	buf.Reset()
+	util.LogInfo = false
+	log.Info("hidden", nil)
+	assert.Equal(t, 0, buf.Len())
+
+	util.LogInfo = true
+	log.Info("shown", map[string]interface{}{"msg": "ignored"})
+	entry = nil
+	err = json.Unmarshal(buf.Bytes(), &entry)
+	assert.NoError(t, err)
+	assert.Equal(t, "info", entry["level"])
+	assert.Equal(t, "shown", entry["msg"])
+	_, ok := entry["error"]
+	assert.False(t, ok)
+
+	// Warn doesn't
+	buf.Reset()
+	util.LogInfo = false
+	log.Warn("restart needed", map[string]interface{}{"option": "binding"})
+	entry = nil
+	err = json.Unmarshal(buf.Bytes(), &entry)
+	assert.NoError(t, err)
+	assert.Equal(t, "warn", entry["level"])
+	assert.Equal(t, "binding", entry["option"])
+}
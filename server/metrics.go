@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/storage"
+	"github.com/contribsys/faktory/util"
+)
+
+type QueueMetrics struct {
+	Size          uint64 `json:"size"`
+	LatencyMs     int64  `json:"latency_ms"`
+	EnqueuedTotal int64  `json:"enqueued_total"`
+}
+
+// QueueMetrics returns the current size and latency for every known queue,
+// along with the number of jobs enqueued to it since the server booted.
+func (s *Server) QueueMetrics() (map[string]*QueueMetrics, error) {
+	now := time.Now()
+	metrics := map[string]*QueueMetrics{}
+
+	var err error
+	s.store.EachQueue(func(q storage.Queue) {
+		if err != nil {
+			return
+		}
+		qm := &QueueMetrics{
+			Size:          q.Size(),
+			EnqueuedTotal: s.manager.EnqueuedCount(q.Name()),
+		}
+		// jobs are pushed onto the head of the list and fetched from
+		// the tail, so the last element is the oldest job.
+		err = q.Page(-1, 0, func(_ int, data []byte) error {
+			latency, lerr := queueLatency(data, now)
+			if lerr != nil {
+				return lerr
+			}
+			qm.LatencyMs = latency
+			return nil
+		})
+		metrics[q.Name()] = qm
+	})
+	if err != nil {
+		return nil, err
+	}
+	return metrics, nil
+}
+
+// The number of milliseconds the given job has been waiting in its queue.
+func queueLatency(data []byte, now time.Time) (int64, error) {
+	var job client.Job
+	err := json.Unmarshal(data, &job)
+	if err != nil {
+		return 0, err
+	}
+	if job.EnqueuedAt == "" {
+		return 0, nil
+	}
+	tm, err := util.ParseTime(job.EnqueuedAt)
+	if err != nil {
+		return 0, err
+	}
+	return now.Sub(tm).Milliseconds(), nil
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/contribsys/faktory/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueLatency(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	data := []byte(`{"jid":"abc123456","jobtype":"Foo","args":[],"enqueued_at":"` + util.Thens(now.Add(-1500*time.Millisecond)) + `"}`)
+	latency, err := queueLatency(data, now)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1500, latency)
+
+	latency, err = queueLatency([]byte(`{"jid":"abc123456"}`), now)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, latency)
+
+	_, err = queueLatency([]byte(`{"jid":"abc123456","enqueued_at":"yesterday"}`), now)
+	assert.Error(t, err)
+
+	_, err = queueLatency([]byte(`{`), now)
+	assert.Error(t, err)
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/manager"
+)
+
+// Middleware wraps every command sent to the server.  Call +next+ to
+// continue processing the command or write a response to the connection
+// and return without calling +next+ to reject it.
+type Middleware func(c *Connection, s *Server, cmd string, next func())
+type MiddlewareChain []Middleware
+
+// Use adds the given middleware to the end of the command chain.
+// Middleware is called in the order it is registered, so the first
+// registered is the outermost.  Register middleware before calling Run.
+func (s *Server) Use(middleware Middleware) {
+	s.mu.Lock()
+	s.middleware = append(s.middleware, middleware)
+	s.mu.Unlock()
+}
+
+// Run the command through the middleware chain, calling the command
+// itself if the entire chain passes it along.
+func callCommand(chain MiddlewareChain, c *Connection, s *Server, cmd string, final command) {
+	if len(chain) == 0 {
+		final(c, s, cmd)
+		return
+	}
+
+	link := chain[0]
+	rest := chain[1:]
+	link(c, s, cmd, func() { callCommand(rest, c, s, cmd, final) })
+}
+
+// JobMiddleware inspects or modifies a job as it is pushed or fetched.
+// Returning an error rejects the job.
+type JobMiddleware func(job *client.Job) error
+
+// AddPushMiddleware adds a function called for every job before it is
+// enqueued.  An error aborts the push and is returned to the client.
+func (s *Server) AddPushMiddleware(fn JobMiddleware) {
+	s.mu.Lock()
+	s.pushHooks = append(s.pushHooks, fn)
+	s.mu.Unlock()
+}
+
+// AddPopMiddleware adds a function called for every job fetched from a
+// queue before it is reserved for the worker.  An error puts the job
+// back on its queue and is returned to the client.
+func (s *Server) AddPopMiddleware(fn JobMiddleware) {
+	s.mu.Lock()
+	s.popHooks = append(s.popHooks, fn)
+	s.mu.Unlock()
+}
+
+func (s *Server) callPushMiddleware(next func() error, ctx manager.Context) error {
+	s.mu.Lock()
+	hooks := s.pushHooks
+	s.mu.Unlock()
+	return callJobMiddleware(hooks, ctx.Job(), next)
+}
+
+func (s *Server) callPopMiddleware(next func() error, ctx manager.Context) error {
+	s.mu.Lock()
+	hooks := s.popHooks
+	s.mu.Unlock()
+	return callJobMiddleware(hooks, ctx.Job(), next)
+}
+
+// Middleware is called in the order it is registered, stopping at
+// the first error.
+func callJobMiddleware(hooks []JobMiddleware, job *client.Job, next func() error) error {
+	for idx := range hooks {
+		if err := hooks[idx](job); err != nil {
+			return err
+		}
+	}
+	return next()
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/contribsys/faktory/client"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareChain(t *testing.T) {
+	t.Parallel()
+
+	calls := []string{}
+	final := func(c *Connection, s *Server, cmd string) {
+		calls = append(calls, "command "+cmd)
+	}
+	record := func(name string) Middleware {
+		return func(c *Connection, s *Server, cmd string, next func()) {
+			calls = append(calls, name+" before")
+			next()
+			calls = append(calls, name+" after")
+		}
+	}
+
+	callCommand(nil, nil, nil, "INFO", final)
+	assert.Equal(t, []string{"command INFO"}, calls)
+
+	calls = []string{}
+	callCommand(MiddlewareChain{record("outer"), record("inner")}, nil, nil, "INFO", final)
+	assert.Equal(t, []string{"outer before", "inner before", "command INFO", "inner after", "outer after"}, calls)
+
+	calls = []string{}
+	halt := func(c *Connection, s *Server, cmd string, next func()) {
+		calls = append(calls, "halted")
+	}
+	callCommand(MiddlewareChain{record("outer"), halt, record("inner")}, nil, nil, "INFO", final)
+	assert.Equal(t, []string{"outer before", "halted", "outer after"}, calls)
+
+	srv := &Server{}
+	srv.Use(record("first"))
+	srv.Use(record("second"))
+	assert.Len(t, srv.middleware, 2)
+}
+
+func TestJobMiddleware(t *testing.T) {
+	t.Parallel()
+
+	srv := &Server{}
+	calls := []string{}
+	srv.AddPushMiddleware(func(job *client.Job) error {
+		calls = append(calls, "first "+job.Type)
+		return nil
+	})
+	srv.AddPushMiddleware(func(job *client.Job) error {
+		calls = append(calls, "second "+job.Type)
+		if job.Type == "Nope" {
+			return fmt.Errorf("rejected")
+		}
+		return nil
+	})
+
+	next := func() error {
+		calls = append(calls, "push")
+		return nil
+	}
+	err := callJobMiddleware(srv.pushHooks, client.NewJob("Yep"), next)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first Yep", "second Yep", "push"}, calls)
+
+	calls = []string{}
+	err = callJobMiddleware(srv.pushHooks, client.NewJob("Nope"), next)
+	assert.EqualError(t, err, "rejected")
+	assert.Equal(t, []string{"first Nope", "second Nope"}, calls)
+
+	assert.Empty(t, srv.popHooks)
+	err = callJobMiddleware(srv.popHooks, client.NewJob("Yep"), next)
+	assert.NoError(t, err)
+}
@@ -17,7 +17,7 @@ var (
 	}
 )
 
-func mutateKill(store storage.Store, op client.Operation) error {
+func mutateKill(store storage.Store, m manager.Manager, op client.Operation) error {
 	ss := setForTarget(store, string(op.Target))
 	if ss == nil {
 		return fmt.Errorf("Invalid target for mutation command")
@@ -25,7 +25,15 @@ func mutateKill(store storage.Store, op client.Operation) error {
 	match, matchfn := matchForFilter(op.Filter)
 	return ss.Find(match, func(idx int, ent storage.SortedEntry) error {
 		if matchfn(string(ent.Value())) {
-			return ss.MoveTo(store.Dead(), ent, time.Now().Add(manager.DeadTTL))
+			job, err := ent.Job()
+			if err != nil {
+				return err
+			}
+			err = ss.MoveTo(store.Dead(), ent, time.Now().Add(manager.DeadTTL))
+			if err != nil {
+				return err
+			}
+			m.Removed(job)
 		}
 		return nil
 	})
@@ -47,7 +55,7 @@ func mutateRequeue(store storage.Store, op client.Operation) error {
 			if err != nil {
 				return err
 			}
-			err = q.Push(ent.Value())
+			err = q.Add(j)
 			if err != nil {
 				return err
 			}
@@ -57,18 +65,26 @@ func mutateRequeue(store storage.Store, op client.Operation) error {
 	})
 }
 
-func mutateDiscard(store storage.Store, op client.Operation) error {
+func mutateDiscard(store storage.Store, m manager.Manager, op client.Operation) error {
 	ss := setForTarget(store, string(op.Target))
 	if ss == nil {
 		return fmt.Errorf("Invalid target for mutation command")
 	}
 	if op.Filter == nil {
-		return ss.Clear()
+		return mutateClear(store, m, string(op.Target))
 	}
 	match, matchfn := matchForFilter(op.Filter)
 	return ss.Find(match, func(idx int, ent storage.SortedEntry) error {
 		if matchfn(string(ent.Value())) {
-			return ss.RemoveEntry(ent)
+			job, err := ent.Job()
+			if err != nil {
+				return err
+			}
+			err = ss.RemoveEntry(ent)
+			if err != nil {
+				return err
+			}
+			m.Removed(job)
 		}
 		return nil
 	})
@@ -112,7 +128,7 @@ func matchForFilter(filter *client.JobFilter) (string, func(value string) bool)
 func mutate(c *Connection, s *Server, cmd string) {
 	parts := strings.Split(cmd, " ")
 	if len(parts) != 2 {
-		_ = c.Error(cmd, fmt.Errorf("Invalid format"))
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
 		return
 	}
 
@@ -120,37 +136,49 @@ func mutate(c *Connection, s *Server, cmd string) {
 	var op client.Operation
 	err = json.Unmarshal([]byte(parts[1]), &op)
 	if err != nil {
-		_ = c.Error(cmd, err)
+		_ = c.Error(cmd, ErrCodeInvalidFormat, err)
 		return
 	}
 
 	switch op.Cmd {
 	case "clear":
-		err = mutateClear(s.Store(), string(op.Target))
+		err = mutateClear(s.Store(), s.Manager(), string(op.Target))
 	case "kill":
-		err = mutateKill(s.Store(), op)
+		err = mutateKill(s.Store(), s.Manager(), op)
 	case "discard":
-		err = mutateDiscard(s.Store(), op)
+		err = mutateDiscard(s.Store(), s.Manager(), op)
 	case "requeue":
 		err = mutateRequeue(s.Store(), op)
 	default:
-		err = fmt.Errorf("Unknown mutate operation")
+		_ = c.Error(cmd, ErrCodeInvalidArgument, fmt.Errorf("Unknown mutate operation"))
+		return
 	}
 
 	if err != nil {
-		_ = c.Error(cmd, err)
+		_ = c.Error(cmd, errorCode(err), err)
 		return
 	}
 
 	_ = c.Ok()
 }
 
-func mutateClear(store storage.Store, target string) error {
+func mutateClear(store storage.Store, m manager.Manager, target string) error {
 	ss := setForTarget(store, target)
 	if ss == nil {
 		return fmt.Errorf("Invalid target for mutation command")
 	}
-	return ss.Clear()
+	jobs, err := m.SetJobs(ss)
+	if err != nil {
+		return err
+	}
+	err = ss.Clear()
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		m.Removed(job)
+	}
+	return nil
 }
 
 func setForTarget(store storage.Store, name string) storage.SortedSet {
@@ -10,7 +10,7 @@ import (
 )
 
 func TestMutateCommands(t *testing.T) {
-	runServer(":7419", func() {
+	runServer(":7419", func(s *Server) {
 		cl, err := faktory.Open()
 		assert.NoError(t, err)
 		nfo, err := cl.Info()
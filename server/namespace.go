@@ -0,0 +1,163 @@
+package server
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/contribsys/faktory/client"
+)
+
+// A namespace lets several tenants share one server without seeing
+// each other's queues: every queue a namespaced client names is stored
+// as "<namespace>.<queue>".  Clients send their namespace in HELLO,
+// those which don't use Options.Namespace.
+//
+// The separator must be allowed by storage.ValidQueueName, and ":" is
+// taken by the priority lists, e.g. "default:p9".  Namespaces can't
+// contain the separator so "acme.x" + "y" can't collide with "acme" +
+// "x.y".
+//
+// Only queue names are namespaced.  The scheduled, retry and dead sets
+// are shared, although their jobs return to the right queue since the
+// namespace is part of the job's queue.
+type namespace string
+
+const namespaceSeparator = "."
+
+var validNamespace = regexp.MustCompile(`\A[a-zA-Z0-9_-]+\z`)
+
+func (ns namespace) queue(name string) string {
+	if ns == "" {
+		return name
+	}
+	return string(ns) + namespaceSeparator + name
+}
+
+func (ns namespace) queues(names []string) []string {
+	if ns == "" {
+		return names
+	}
+	result := make([]string, len(names))
+	for idx := range names {
+		result[idx] = ns.queue(names[idx])
+	}
+	return result
+}
+
+// The queue's name within the namespace, false if the queue belongs to
+// another namespace.
+func (ns namespace) local(name string) (string, bool) {
+	if ns == "" {
+		return name, true
+	}
+	prefix := string(ns) + namespaceSeparator
+	if !strings.HasPrefix(name, prefix) {
+		return "", false
+	}
+	return name[len(prefix):], true
+}
+
+// Put a pushed job into the namespace, an empty queue is "default".
+func (ns namespace) job(job *client.Job) {
+	if ns == "" {
+		return
+	}
+	if job.Queue == "" {
+		job.Queue = "default"
+	}
+	job.Queue = ns.queue(job.Queue)
+}
+
+// A copy of the job as the client should see it, the job's
+// reservation keeps the namespaced queue.
+func (ns namespace) jobForClient(job *client.Job) *client.Job {
+	if ns == "" {
+		return job
+	}
+	copied := *job
+	copied.Queue, _ = ns.local(job.Queue)
+	return &copied
+}
+
+// Rewrite INFO's queue details to only show the namespace's queues.
+func (ns namespace) info(data map[string]interface{}) {
+	if ns == "" {
+		return
+	}
+	fak, ok := data["faktory"].(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	queues := map[string]int64{}
+	total := int64(0)
+	if all, ok := fak["queues"].(map[string]int64); ok {
+		for name, size := range all {
+			if local, ok := ns.local(name); ok {
+				queues[local] = size
+				total += size
+			}
+		}
+	}
+	fak["queues"] = queues
+	fak["total_queues"] = len(queues)
+	fak["total_enqueued"] = total
+
+	paused := []string{}
+	if all, ok := fak["paused"].([]string); ok {
+		for _, name := range all {
+			if local, ok := ns.local(name); ok {
+				paused = append(paused, local)
+			}
+		}
+	}
+	fak["paused"] = paused
+
+	rates := map[string]float64{}
+	if all, ok := fak["rate_limits"].(map[string]float64); ok {
+		for name, rate := range all {
+			if local, ok := ns.local(name); ok {
+				rates[local] = rate
+			}
+		}
+	}
+	fak["rate_limits"] = rates
+
+	latencies := map[string]LatencyPercentiles{}
+	if all, ok := fak["queue_latency"].(map[string]LatencyPercentiles); ok {
+		for name, pcts := range all {
+			if local, ok := ns.local(name); ok {
+				latencies[local] = pcts
+			}
+		}
+	}
+	fak["queue_latency"] = latencies
+
+	throughput := map[string]QueueThroughput{}
+	if all, ok := fak["queue_throughput"].(map[string]QueueThroughput); ok {
+		for name, qt := range all {
+			if local, ok := ns.local(name); ok {
+				throughput[local] = qt
+			}
+		}
+	}
+	fak["queue_throughput"] = throughput
+
+	traffic := map[string]WorkerTraffic{}
+	if all, ok := data["workers"].(map[string]WorkerTraffic); ok {
+		for wid, wt := range all {
+			if wt.namespace == string(ns) {
+				traffic[wid] = wt
+			}
+		}
+	}
+	data["workers"] = traffic
+}
+
+func (c *Connection) namespace() namespace {
+	// the member which forwarded the command applied it
+	if c.client == nil || c.forwarded {
+		return ""
+	}
+	return namespace(c.client.Namespace)
+}
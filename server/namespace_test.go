@@ -0,0 +1,133 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespace(t *testing.T) {
+	t.Parallel()
+
+	var none namespace
+	assert.Equal(t, "default", none.queue("default"))
+	local, ok := none.local("acme.default")
+	assert.True(t, ok)
+	assert.Equal(t, "acme.default", local)
+
+	ns := namespace("acme")
+	assert.Equal(t, "acme.default", ns.queue("default"))
+	assert.Equal(t, []string{"acme.critical", "acme.default"}, ns.queues([]string{"critical", "default"}))
+
+	local, ok = ns.local("acme.default")
+	assert.True(t, ok)
+	assert.Equal(t, "default", local)
+	_, ok = ns.local("globex.default")
+	assert.False(t, ok)
+	_, ok = ns.local("default")
+	assert.False(t, ok)
+
+	job := client.NewJob("Report")
+	job.Queue = ""
+	ns.job(job)
+	assert.Equal(t, "acme.default", job.Queue)
+
+	fetched := ns.jobForClient(job)
+	assert.Equal(t, "default", fetched.Queue)
+	assert.Equal(t, "acme.default", job.Queue)
+
+	assert.Equal(t, "default", (&Connection{}).namespace().queue("default"))
+	c := &Connection{client: &ClientData{Namespace: "acme"}}
+	assert.Equal(t, ns, c.namespace())
+
+	// storage must accept the namespaced names
+	assert.True(t, storage.ValidQueueName.MatchString(ns.queue("default")))
+	assert.True(t, validNamespace.MatchString("acme-prod_2"))
+	assert.False(t, validNamespace.MatchString("acme.prod"))
+	assert.False(t, validNamespace.MatchString("acme:prod"))
+}
+
+func TestNamespacedJobs(t *testing.T) {
+	runServer("localhost:7436", func(s *Server) {
+		conn, err := net.DialTimeout("tcp", "localhost:7436", 1*time.Second)
+		assert.NoError(t, err)
+		defer conn.Close()
+		buf := bufio.NewReader(conn)
+		send := func(cmd string) string {
+			_, err := conn.Write([]byte(cmd + "\r\n"))
+			assert.NoError(t, err)
+			line, err := buf.ReadString('\n')
+			assert.NoError(t, err)
+			return line
+		}
+
+		_, err = buf.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "+OK\r\n", send(`HELLO {"v":2,"wid":"acme-worker","hostname":"localhost","pid":1,"namespace":"acme"}`))
+
+		assert.Equal(t, "+OK 12345678901234567890acme\r\n", send(`PUSH {"jid":"12345678901234567890acme","jobtype":"Report","args":[],"queue":"default"}`))
+		q, err := s.store.GetQueue("acme.default")
+		assert.NoError(t, err)
+		assert.EqualValues(t, 1, q.Size())
+
+		assert.Regexp(t, `^\$\d+`, send("FETCH default"))
+		payload, err := buf.ReadString('\n')
+		assert.NoError(t, err)
+		var job client.Job
+		assert.NoError(t, json.Unmarshal([]byte(payload), &job))
+		assert.Equal(t, "12345678901234567890acme", job.Jid)
+		assert.Equal(t, "default", job.Queue)
+		assert.EqualValues(t, 0, q.Size())
+
+		assert.Equal(t, "+OK\r\n", send(`ACK {"jid":"12345678901234567890acme"}`))
+		assert.Equal(t, 0, s.manager.WorkingCount())
+
+		other, err := net.DialTimeout("tcp", "localhost:7436", 1*time.Second)
+		assert.NoError(t, err)
+		defer other.Close()
+		obuf := bufio.NewReader(other)
+		_, err = obuf.ReadString('\n')
+		assert.NoError(t, err)
+		_, _ = other.Write([]byte(`HELLO {"v":2,"namespace":"acme.prod"}` + "\r\n"))
+		line, err := obuf.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Regexp(t, "^-ERR ERR_INVALID_ARGUMENT Invalid namespace", line)
+	})
+}
+
+func TestNamespaceInfo(t *testing.T) {
+	t.Parallel()
+
+	data := map[string]interface{}{
+		"faktory": map[string]interface{}{
+			"queues":           map[string]int64{"acme.default": 3, "acme.critical": 1, "globex.default": 5},
+			"total_queues":     3,
+			"total_enqueued":   int64(9),
+			"paused":           []string{"acme.critical", "globex.default"},
+			"rate_limits":      map[string]float64{"globex.default": 2},
+			"queue_latency":    map[string]LatencyPercentiles{"acme.default": {P50Ms: 5, P99Ms: 20}, "globex.default": {}},
+			"queue_throughput": map[string]QueueThroughput{"acme.default": {JobsPerMinute: 30}, "globex.default": {JobsPerMinute: 7}},
+		},
+		"workers": map[string]WorkerTraffic{
+			"w1": {BytesRead: 10, namespace: "acme"},
+			"w2": {BytesRead: 20, namespace: "globex"},
+		},
+	}
+	namespace("acme").info(data)
+
+	fak := data["faktory"].(map[string]interface{})
+	assert.Equal(t, map[string]int64{"default": 3, "critical": 1}, fak["queues"])
+	assert.Equal(t, 2, fak["total_queues"])
+	assert.Equal(t, int64(4), fak["total_enqueued"])
+	assert.Equal(t, []string{"critical"}, fak["paused"])
+	assert.Equal(t, map[string]float64{}, fak["rate_limits"])
+	assert.Equal(t, map[string]LatencyPercentiles{"default": {P50Ms: 5, P99Ms: 20}}, fak["queue_latency"])
+	assert.Equal(t, map[string]QueueThroughput{"default": {JobsPerMinute: 30}}, fak["queue_throughput"])
+	assert.Equal(t, map[string]WorkerTraffic{"w1": {BytesRead: 10, namespace: "acme"}}, data["workers"])
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// Clients may pipeline commands, sending several without waiting for
+// each reply.  Replies are buffered while more commands are waiting to
+// be read so a pipeline's replies go out in as few writes as possible.
+// The buffer is written once this many bytes are waiting.
+const pipelineFlushBytes = 64 * 1024
+
+type replyBuffer struct {
+	mu   sync.Mutex
+	conn io.WriteCloser
+	out  *bufio.Writer
+}
+
+func newReplyBuffer(conn io.WriteCloser) *replyBuffer {
+	return &replyBuffer{conn: conn, out: bufio.NewWriterSize(conn, pipelineFlushBytes)}
+}
+
+func (rb *replyBuffer) Write(p []byte) (int, error) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	return rb.out.Write(p)
+}
+
+func (rb *replyBuffer) Flush() error {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	return rb.out.Flush()
+}
+
+// The reaper may close the connection while a command is running or
+// a write is blocked on a dead peer, so Close doesn't wait for rb.mu:
+// closing the connection fails the blocked write.  Replies still
+// buffered are dropped, flush first to send them.
+func (rb *replyBuffer) Close() error {
+	return rb.conn.Close()
+}
+
+// Send any buffered replies unless the client has pipelined more
+// commands.
+func (c *Connection) flush() error {
+	rb, ok := c.conn.(*replyBuffer)
+	if !ok || c.buf.Buffered() > 0 {
+		return nil
+	}
+	return rb.Flush()
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type writeRecorder struct {
+	writes []string
+}
+
+func (wr *writeRecorder) Write(p []byte) (int, error) {
+	wr.writes = append(wr.writes, string(p))
+	return len(p), nil
+}
+
+func (wr *writeRecorder) Close() error {
+	return nil
+}
+
+func TestPipelining(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{Options: &ServerOptions{}, Stats: &RuntimeStats{}}
+	input := "NOPE1\r\nNOPE2\r\n"
+
+	// both commands arrive together so the replies are written together
+	wr := &writeRecorder{}
+	s.processLines(&Connection{
+		client: dummyClientData(),
+		conn:   newReplyBuffer(wr),
+		buf:    bufio.NewReader(strings.NewReader(input)),
+	})
+	assert.Equal(t, []string{
+		"-ERR ERR_UNKNOWN_COMMAND Unknown command NOPE1\r\n" +
+			"-ERR ERR_UNKNOWN_COMMAND Unknown command NOPE2\r\n",
+	}, wr.writes)
+
+	// the client waits for each reply
+	wr = &writeRecorder{}
+	s.processLines(&Connection{
+		client: dummyClientData(),
+		conn:   newReplyBuffer(wr),
+		buf:    bufio.NewReader(iotest.OneByteReader(strings.NewReader(input))),
+	})
+	assert.Equal(t, []string{
+		"-ERR ERR_UNKNOWN_COMMAND Unknown command NOPE1\r\n",
+		"-ERR ERR_UNKNOWN_COMMAND Unknown command NOPE2\r\n",
+	}, wr.writes)
+}
+
+// A writer stuck on a dead peer.
+type blockedWriter struct {
+	unblock chan struct{}
+}
+
+func (bw *blockedWriter) Write(p []byte) (int, error) {
+	<-bw.unblock
+	return 0, io.ErrClosedPipe
+}
+
+func (bw *blockedWriter) Close() error {
+	close(bw.unblock)
+	return nil
+}
+
+func TestReplyBufferCloseWhileBlocked(t *testing.T) {
+	t.Parallel()
+
+	rb := newReplyBuffer(&blockedWriter{unblock: make(chan struct{})})
+	_, _ = rb.Write([]byte("+OK\r\n"))
+	flushed := make(chan error, 1)
+	go func() { flushed <- rb.Flush() }()
+
+	closed := make(chan error, 1)
+	go func() { closed <- rb.Close() }()
+	select {
+	case err := <-closed:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Close waited for the blocked write")
+	}
+	assert.Error(t, <-flushed)
+}
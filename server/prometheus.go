@@ -0,0 +1,125 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/contribsys/faktory/storage"
+)
+
+// Serve /metrics in the Prometheus text exposition format on
+// Options.MetricsBinding.  The listener is opened synchronously so
+// a bad binding fails Boot rather than being logged and ignored.
+func (s *Server) startMetrics() error {
+	if s.Options.MetricsBinding == "" {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", s.Options.MetricsBinding)
+	if err != nil {
+		return fmt.Errorf("cannot listen on %s: %w", s.Options.MetricsBinding, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", s.metricsHandler)
+	hs := &http.Server{
+		ReadTimeout:    1 * time.Second,
+		WriteTimeout:   10 * time.Second,
+		MaxHeaderBytes: 1 << 16,
+		Handler:        mux,
+	}
+	if s.Options.PProfEnabled {
+		mountPProf(mux)
+		// a CPU profile or trace streams for ?seconds=N, 30 by default
+		hs.WriteTimeout = pprofWriteTimeout
+	}
+
+	go func() {
+		err := hs.Serve(listener)
+		if err != http.ErrServerClosed {
+			s.logger().Error("Metrics server crashed", err, map[string]interface{}{"binding": s.Options.MetricsBinding})
+		}
+	}()
+	s.logger().Info("Metrics server now listening", map[string]interface{}{"binding": s.Options.MetricsBinding})
+	s.metrics = hs
+	return nil
+}
+
+const pprofWriteTimeout = 2 * time.Minute
+
+// Only for operators on a trusted network, see Options.PProfEnabled.
+// pprof registers itself on http.DefaultServeMux, which nothing serves,
+// so the handlers are mounted on the metrics mux explicitly.
+func mountPProf(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
+
+func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	err := s.writePrometheus(w)
+	if err != nil {
+		s.logger().Error("Unable to write metrics", err, nil)
+	}
+}
+
+func (s *Server) writePrometheus(out io.Writer) error {
+	queues := map[string]float64{}
+	s.store.EachQueue(func(q storage.Queue) {
+		queues[q.Name()] = float64(q.Size())
+	})
+
+	w := bufio.NewWriter(out)
+	writeMetric(w, "faktory_jobs_processed_total", "counter",
+		"Total number of jobs processed.", float64(s.store.TotalProcessed()))
+	writeMetric(w, "faktory_jobs_failed_total", "counter",
+		"Total number of jobs which have failed.", float64(s.store.TotalFailures()))
+	writeLabeledMetric(w, "faktory_queue_size", "gauge",
+		"Number of jobs enqueued.", "queue", queues)
+	writeMetric(w, "faktory_working_size", "gauge",
+		"Number of jobs currently reserved by workers.", float64(s.manager.WorkingCount()))
+	writeMetric(w, "faktory_scheduled_size", "gauge",
+		"Number of jobs in the scheduled set.", float64(s.store.Scheduled().Size()))
+	writeMetric(w, "faktory_retries_size", "gauge",
+		"Number of jobs in the retry set.", float64(s.store.Retries().Size()))
+	writeMetric(w, "faktory_dead_size", "gauge",
+		"Number of jobs in the dead set.", float64(s.store.Dead().Size()))
+	writeMetric(w, "faktory_workers_connected", "gauge",
+		"Number of worker processes with an active heartbeat.", float64(s.workers.Count()))
+	return w.Flush()
+}
+
+func writeMetric(w io.Writer, name, typ, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	fmt.Fprintf(w, "%s %v\n", name, value)
+}
+
+func writeLabeledMetric(w io.Writer, name, typ, help, label string, values map[string]float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %v\n", name, label, escapeLabel(key), values[key])
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
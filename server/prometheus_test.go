@@ -0,0 +1,54 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheusFormat(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	writeMetric(&buf, "faktory_jobs_processed_total", "counter", "Total number of jobs processed.", 123)
+	assert.Equal(t, "# HELP faktory_jobs_processed_total Total number of jobs processed.\n"+
+		"# TYPE faktory_jobs_processed_total counter\n"+
+		"faktory_jobs_processed_total 123\n", buf.String())
+
+	buf.Reset()
+	writeLabeledMetric(&buf, "faktory_queue_size", "gauge", "Number of jobs enqueued.", "queue",
+		map[string]float64{"default": 3, "critical": 0, `we"ird\`: 1})
+	assert.Equal(t, "# HELP faktory_queue_size Number of jobs enqueued.\n"+
+		"# TYPE faktory_queue_size gauge\n"+
+		"faktory_queue_size{queue=\"critical\"} 0\n"+
+		"faktory_queue_size{queue=\"default\"} 3\n"+
+		"faktory_queue_size{queue=\"we\\\"ird\\\\\"} 1\n", buf.String())
+}
+
+func TestPProfEndpoints(t *testing.T) {
+	t.Parallel()
+
+	for _, enabled := range []bool{false, true} {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		binding := l.Addr().String()
+		l.Close()
+
+		s := &Server{Options: &ServerOptions{MetricsBinding: binding, PProfEnabled: enabled}}
+		assert.NoError(t, s.startMetrics())
+
+		resp, err := http.Get("http://" + binding + "/debug/pprof/")
+		assert.NoError(t, err)
+		resp.Body.Close()
+		if enabled {
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, pprofWriteTimeout, s.metrics.WriteTimeout)
+		} else {
+			assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		}
+		shutdownHTTP(s.metrics)
+	}
+}
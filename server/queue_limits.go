@@ -0,0 +1,69 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/contribsys/faktory/manager"
+)
+
+// What happens to a job pushed to a queue which already holds its
+// limit, see SETLIMIT.
+const (
+	RejectNew  = manager.RejectNew
+	DropOldest = manager.DropOldest
+	DropNewest = manager.DropNewest
+)
+
+type queueLimit struct {
+	size   int64
+	policy string
+}
+
+func validLimitPolicy(policy string) bool {
+	switch policy {
+	case RejectNew, DropOldest, DropNewest:
+		return true
+	}
+	return false
+}
+
+// A size of 0 removes the queue's limit.
+func (s *Server) setQueueLimit(queue string, size int64, policy string) error {
+	if size < 0 {
+		return fmt.Errorf("Invalid size %d, must not be negative", size)
+	}
+	if !validLimitPolicy(policy) {
+		return fmt.Errorf("Invalid policy %q, must be %s, %s or %s", policy, RejectNew, DropOldest, DropNewest)
+	}
+
+	s.limitMu.Lock()
+	defer s.limitMu.Unlock()
+	if s.limits == nil {
+		s.limits = map[string]queueLimit{}
+	}
+	if size == 0 {
+		delete(s.limits, queue)
+		return nil
+	}
+	s.limits[queue] = queueLimit{size: size, policy: policy}
+	return nil
+}
+
+// Options.QueueLimits reject new jobs until SETLIMIT says otherwise.
+func (s *Server) loadQueueLimits() error {
+	for name, size := range s.Options.QueueLimits {
+		if err := s.setQueueLimit(name, size, RejectNew); err != nil {
+			return fmt.Errorf("invalid limit for queue %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// The queue's limit, applied by the manager in the same transaction as
+// the push, see manager.SetQueueLimits.
+func (s *Server) queueLimit(queue string) (manager.QueueLimit, bool) {
+	s.limitMu.RLock()
+	defer s.limitMu.RUnlock()
+	limit, ok := s.limits[queue]
+	return manager.QueueLimit{Size: uint64(limit.size), Policy: limit.policy}, ok
+}
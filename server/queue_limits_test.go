@@ -0,0 +1,42 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetQueueLimit(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{Options: &ServerOptions{QueueLimits: map[string]int64{"bulk": 100}}}
+	assert.NoError(t, s.loadQueueLimits())
+	assert.Equal(t, queueLimit{size: 100, policy: RejectNew}, s.limits["bulk"])
+
+	assert.NoError(t, s.setQueueLimit("bulk", 5, DropOldest))
+	assert.Equal(t, queueLimit{size: 5, policy: DropOldest}, s.limits["bulk"])
+
+	assert.Error(t, s.setQueueLimit("bulk", -1, DropOldest))
+	assert.Error(t, s.setQueueLimit("bulk", 5, "drop_random"))
+	assert.Equal(t, queueLimit{size: 5, policy: DropOldest}, s.limits["bulk"])
+
+	assert.NoError(t, s.setQueueLimit("bulk", 0, RejectNew))
+	assert.Empty(t, s.limits)
+}
+
+func TestSetLimitCommand(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{}
+	c := dummyConnection()
+	setLimit(c, s, "SETLIMIT bulk 10")
+	assert.Contains(t, output(c), "ERR_INVALID_FORMAT")
+
+	setLimit(c, s, "SETLIMIT bulk ten drop_newest")
+	assert.Contains(t, output(c), "ERR_INVALID_ARGUMENT")
+
+	c.client.Namespace = "acme"
+	setLimit(c, s, "SETLIMIT bulk 10 drop_newest")
+	assert.Equal(t, "+OK\r\n", output(c))
+	assert.Equal(t, queueLimit{size: 10, policy: DropNewest}, s.limits["acme.bulk"])
+}
@@ -0,0 +1,40 @@
+package server
+
+import "sync"
+
+// A jobQuota caps the jobs each worker holds at MaxJobsPerWorker.  The
+// jobs a worker holds are counted by the manager once they're
+// reserved, the quota adds the FETCHes still in progress so two
+// connections from the same worker can't both take the last slot.
+type jobQuota struct {
+	mu sync.Mutex
+	// wid -> FETCHes in progress
+	fetching map[string]int
+}
+
+// Take a slot for a FETCH, false if the worker holds limit jobs.  busy
+// returns the jobs the worker has reserved.  Call done once the
+// fetched job, if any, is reserved.
+func (q *jobQuota) reserve(wid string, limit int, busy func(wid string) int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if limit > 0 && busy(wid)+q.fetching[wid] >= limit {
+		return false
+	}
+	if q.fetching == nil {
+		q.fetching = map[string]int{}
+	}
+	q.fetching[wid]++
+	return true
+}
+
+func (q *jobQuota) done(wid string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.fetching[wid]--
+	if q.fetching[wid] <= 0 {
+		delete(q.fetching, wid)
+	}
+}
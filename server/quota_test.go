@@ -0,0 +1,65 @@
+package server
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobQuota(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	reserved := map[string]int{}
+	busy := func(wid string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return reserved[wid]
+	}
+
+	var q jobQuota
+	// unlimited
+	assert.True(t, q.reserve("a", 0, busy))
+	q.done("a")
+
+	// a second FETCH from the worker waits for the first to reserve
+	// its job
+	assert.True(t, q.reserve("a", 2, busy))
+	assert.True(t, q.reserve("a", 2, busy))
+	assert.False(t, q.reserve("a", 2, busy))
+	assert.True(t, q.reserve("b", 2, busy))
+
+	mu.Lock()
+	reserved["a"]++
+	mu.Unlock()
+	q.done("a")
+	assert.False(t, q.reserve("a", 2, busy))
+
+	// a FETCH which found no job gives its slot back
+	q.done("a")
+	assert.True(t, q.reserve("a", 2, busy))
+	q.done("a")
+	q.done("b")
+	assert.Empty(t, q.fetching)
+
+	// concurrent FETCHes never exceed the limit
+	var wg sync.WaitGroup
+	var taken int
+	reserved = map[string]int{}
+	for idx := 0; idx < 20; idx++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if q.reserve("c", 3, busy) {
+				mu.Lock()
+				reserved["c"]++
+				taken++
+				mu.Unlock()
+				q.done("c")
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 3, taken)
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/contribsys/faktory/util"
+)
+
+// Re-read Options.ConfigFile and apply it with ApplyOptions.
+func (s *Server) reloadConfig() error {
+	opts, err := LoadConfig(s.Options.ConfigFile)
+	if err != nil {
+		return err
+	}
+	if err := opts.ResolvePassword(); err != nil {
+		return err
+	}
+	return s.ApplyOptions(opts)
+}
+
+// ApplyOptions applies the options in +next+ which can change while the
+// server is running: Password, LogLevel, QueueRates, MaxJobsPerWorker and
+// ShutdownTimeout.  Changes to options which require a restart are logged
+// and ignored.
+func (s *Server) ApplyOptions(next *ServerOptions) error {
+	if next.Password != "" && len(next.Password) < MinPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+	if next.ShutdownTimeout < 0 {
+		return fmt.Errorf("shutdown timeout must not be negative, not %v", next.ShutdownTimeout)
+	}
+
+	for _, name := range s.Options.structuralChanges(next) {
+		s.logger().Warn("Config change requires a restart, ignoring", map[string]interface{}{"option": name})
+	}
+
+	s.mu.Lock()
+	if s.Options.Password != next.Password {
+		s.Options.Password = next.Password
+		// derived from the old password
+		s.scram = nil
+	}
+	s.Options.LogLevel = next.LogLevel
+	s.Options.QueueRates = next.QueueRates
+	s.Options.MaxJobsPerWorker = next.MaxJobsPerWorker
+	s.Options.ShutdownTimeout = next.ShutdownTimeout
+	s.mu.Unlock()
+
+	applyLogLevel(next.LogLevel)
+	return s.applyQueueRates(next.QueueRates)
+}
+
+// Password, MaxJobsPerWorker and ShutdownTimeout may be changed by
+// ApplyOptions so they're read under s.mu.
+
+func (s *Server) password() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Options.Password
+}
+
+func (s *Server) maxJobsPerWorker() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Options.MaxJobsPerWorker
+}
+
+func (s *Server) shutdownTimeout() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Options.ShutdownTimeout
+}
+
+func applyLogLevel(level string) {
+	if level != "" {
+		util.InitLogger(level)
+	}
+}
+
+// Queues which are rate limited but missing from +rates+ keep their
+// limit, it may have been set with QUEUE RATE.
+func (s *Server) applyQueueRates(rates map[string]float64) error {
+	for name, perSec := range rates {
+		if err := s.manager.SetRate(name, perSec); err != nil {
+			return fmt.Errorf("invalid rate for queue %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// The names of the options in +next+ which differ from +so+ but are
+// only read when the server boots.
+func (so *ServerOptions) structuralChanges(next *ServerOptions) []string {
+	binding := next.Binding
+	if binding == "" {
+		binding = "localhost:7419"
+	}
+
+	var changed []string
+	if binding != so.Binding {
+		changed = append(changed, "binding")
+	}
+	if next.StorageDirectory != so.StorageDirectory {
+		changed = append(changed, "storage_directory")
+	}
+	if next.TLSCertFile != so.TLSCertFile {
+		changed = append(changed, "tls_cert")
+	}
+	if next.TLSKeyFile != so.TLSKeyFile {
+		changed = append(changed, "tls_key")
+	}
+	if next.TLSCAFile != so.TLSCAFile {
+		changed = append(changed, "tls_ca")
+	}
+	return changed
+}
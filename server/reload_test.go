@@ -0,0 +1,59 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloadConfig(t *testing.T) {
+	runServer("localhost:7431", func(s *Server) {
+		dir, err := os.MkdirTemp("", "faktory-reload")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "config.toml")
+		err = os.WriteFile(path, []byte(`
+binding = "0.0.0.0:7431"
+password = "rotated-secret"
+max_jobs_per_worker = 5
+shutdown_timeout = "10s"
+
+[queue_rates]
+bulk = 2.5
+`), 0600)
+		assert.NoError(t, err)
+
+		s.Options.ConfigFile = path
+		s.Reload()
+		assert.Equal(t, "rotated-secret", s.Options.Password)
+		assert.Equal(t, 5, s.Options.MaxJobsPerWorker)
+		assert.Equal(t, 10*time.Second, s.Options.ShutdownTimeout)
+		assert.Equal(t, 2.5, s.manager.Rates()["bulk"])
+		// structural, needs a restart
+		assert.Equal(t, "localhost:7431", s.Options.Binding)
+
+		err = os.WriteFile(path, []byte(`password = "short"`), 0600)
+		assert.NoError(t, err)
+		err = s.reloadConfig()
+		assert.Error(t, err)
+		assert.Equal(t, "rotated-secret", s.Options.Password)
+
+		s.Options.ConfigFile = ""
+		s.Options.Password = ""
+		s.Options.ShutdownTimeout = 0
+	})
+}
+
+func TestStructuralChanges(t *testing.T) {
+	t.Parallel()
+
+	current := &ServerOptions{Binding: "localhost:7419", StorageDirectory: "/var/lib/faktory"}
+	assert.Empty(t, current.structuralChanges(&ServerOptions{StorageDirectory: "/var/lib/faktory"}))
+
+	next := &ServerOptions{Binding: ":7419", StorageDirectory: "/tmp", TLSCertFile: "cert.pem"}
+	assert.Equal(t, []string{"binding", "storage_directory", "tls_cert"}, current.structuralChanges(next))
+}
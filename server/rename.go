@@ -0,0 +1,71 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/contribsys/faktory/storage"
+)
+
+var errQueueRenamed = errors.New("queue renamed")
+
+// RENAME_QUEUE thumbnails images
+//
+// Move every job in the queue to the new, empty queue along with its
+// settings, responds with the number of jobs moved.  Jobs pushed to the
+// old name go to the new queue and FETCH from the old name fails with
+// ERR_QUEUE_RENAMED so workers know to switch to the new name.
+func renameQueue(c *Connection, s *Server, cmd string) {
+	args := strings.Split(cmd, " ")[1:]
+	if len(args) != 2 || args[0] == "" || args[1] == "" {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+	if _, ok := s.store.(storage.Renamable); !ok {
+		_ = c.Error(cmd, ErrCodeNotSupported, fmt.Errorf("RENAME_QUEUE is not supported by this storage backend"))
+		return
+	}
+	ns := c.namespace()
+	from, to := ns.queue(args[0]), ns.queue(args[1])
+
+	count, err := s.manager.RenameQueue(from, to)
+	if err != nil && !errors.Is(err, storage.ErrRenameIncomplete) {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	s.queueRenamed(from, to)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	_ = c.Number(int(count))
+}
+
+// Settings the server holds for the queue follow it to its new name.
+func (s *Server) queueRenamed(from, to string) {
+	s.limitMu.Lock()
+	if limit, ok := s.limits[from]; ok {
+		delete(s.limits, from)
+		s.limits[to] = limit
+	}
+	s.limitMu.Unlock()
+
+	s.declareMu.Lock()
+	if cfg, ok := s.declared[from]; ok {
+		delete(s.declared, from)
+		s.declared[to] = cfg
+	}
+	s.declareMu.Unlock()
+}
+
+// An error if any of the (namespaced) queues has been renamed.
+func (s *Server) checkRenamed(ns namespace, qs []string) error {
+	for _, name := range qs {
+		if to, ok := s.manager.RenamedQueue(name); ok {
+			local, _ := ns.local(to)
+			return fmt.Errorf("%w to %s", errQueueRenamed, local)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/contribsys/faktory/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueRenamed(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{
+		limits:   map[string]queueLimit{"images": {size: 10, policy: RejectNew}},
+		declared: map[string]storage.QueueConfig{"images": {Rate: 5}},
+	}
+	s.queueRenamed("images", "thumbnails")
+	assert.Equal(t, map[string]queueLimit{"thumbnails": {size: 10, policy: RejectNew}}, s.limits)
+	assert.Equal(t, map[string]storage.QueueConfig{"thumbnails": {Rate: 5}}, s.declared)
+}
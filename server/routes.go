@@ -0,0 +1,76 @@
+package server
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/storage"
+)
+
+// Routes send pushed jobs to a queue chosen by their jobtype,
+// overriding the queue the client asked for.  Patterns are globs like
+// "*EmailJob", or regular expressions between slashes like
+// "/^(Send|Bulk)Email$/".  The first matching route wins.  Routes are
+// kept in memory and must be added again after a restart.
+type Route struct {
+	Pattern string `json:"pattern"`
+	Queue   string `json:"queue"`
+
+	match func(jobtype string) bool
+}
+
+func (s *Server) AddRoute(pattern string, queueName string) error {
+	if !storage.ValidQueueName.MatchString(queueName) {
+		return fmt.Errorf("Invalid queue %q, queue names must match %v", queueName, storage.ValidQueueName)
+	}
+	match, err := routeMatcher(pattern)
+	if err != nil {
+		return err
+	}
+
+	s.routeMu.Lock()
+	s.routes = append(s.routes, Route{Pattern: pattern, Queue: queueName, match: match})
+	s.routeMu.Unlock()
+	return nil
+}
+
+func (s *Server) Routes() []Route {
+	s.routeMu.RLock()
+	defer s.routeMu.RUnlock()
+	return append([]Route{}, s.routes...)
+}
+
+func routeMatcher(pattern string) (func(string) bool, error) {
+	if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid pattern %q: %w", pattern, err)
+		}
+		return re.MatchString, nil
+	}
+	if pattern == "" {
+		return nil, fmt.Errorf("Invalid pattern, must not be blank")
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("Invalid pattern %q: %w", pattern, err)
+	}
+	return func(jobtype string) bool {
+		ok, _ := path.Match(pattern, jobtype)
+		return ok
+	}, nil
+}
+
+// Called before the job is namespaced.
+func (s *Server) routeJob(job *client.Job) {
+	s.routeMu.RLock()
+	defer s.routeMu.RUnlock()
+	for idx := range s.routes {
+		if s.routes[idx].match(job.Type) {
+			job.Queue = s.routes[idx].Queue
+			return
+		}
+	}
+}
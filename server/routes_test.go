@@ -0,0 +1,43 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutes(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{}
+	assert.NoError(t, s.AddRoute("*EmailJob", "email"))
+	assert.NoError(t, s.AddRoute("/^Report(Daily|Weekly)$/", "reports"))
+	// the first matching route wins
+	assert.NoError(t, s.AddRoute("Welcome*", "onboarding"))
+
+	route := func(jobtype string) string {
+		job := client.NewJob(jobtype)
+		job.Queue = "critical"
+		s.routeJob(job)
+		return job.Queue
+	}
+	assert.Equal(t, "email", route("WelcomeEmailJob"))
+	assert.Equal(t, "reports", route("ReportWeekly"))
+	assert.Equal(t, "critical", route("ReportMonthly"))
+	assert.Equal(t, "onboarding", route("WelcomeTour"))
+
+	assert.Error(t, s.AddRoute("[", "email"))
+	assert.Error(t, s.AddRoute("/(/", "email"))
+	assert.Error(t, s.AddRoute("", "email"))
+	assert.Error(t, s.AddRoute("*", "no spaces"))
+
+	data, err := json.Marshal(s.Routes())
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"pattern":"*EmailJob","queue":"email"},
+		{"pattern":"/^Report(Daily|Weekly)$/","queue":"reports"},
+		{"pattern":"Welcome*","queue":"onboarding"}
+	]`, string(data))
+}
@@ -0,0 +1,373 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/contribsys/faktory/manager"
+)
+
+// RegisterSchema validates the args of every job of the given type
+// pushed from now on against the JSON Schema, rejecting the push with
+// ERR_INVALID_ARGUMENT if they don't match.  The schema describes the
+// args array, e.g. {"type":"array","items":[{"type":"integer"}]}.
+// A nil schema removes the jobtype's schema.
+//
+// This supports the draft-07 validation keywords for types, objects,
+// arrays, strings, numbers, enum and const.  Annotations like title and
+// description are ignored; a schema using any other keyword, e.g. $ref,
+// format or the allOf/anyOf/oneOf/not combinators, is rejected so it
+// can't silently accept args it was written to refuse.
+func (s *Server) RegisterSchema(jobtype string, schema json.RawMessage) error {
+	if schema == nil {
+		s.schemaMu.Lock()
+		delete(s.schemas, jobtype)
+		s.schemaMu.Unlock()
+		return nil
+	}
+
+	compiled, err := compileSchema(schema)
+	if err != nil {
+		return fmt.Errorf("invalid schema for %s: %w", jobtype, err)
+	}
+	s.schemaMu.Lock()
+	if s.schemas == nil {
+		s.schemas = map[string]*jsonSchema{}
+	}
+	s.schemas[jobtype] = compiled
+	s.schemaMu.Unlock()
+	return nil
+}
+
+func (s *Server) validateArgs(next func() error, ctx manager.Context) error {
+	job := ctx.Job()
+	s.schemaMu.RLock()
+	schema := s.schemas[job.Type]
+	s.schemaMu.RUnlock()
+	if schema == nil || job.ArgsUrl != "" {
+		// the args are downloaded by the worker, see args_url.go
+		return next()
+	}
+
+	// jobs built in Go may hold ints, structs, etc. so validate the
+	// args as they'll be sent to workers
+	data, err := json.Marshal(job.Args)
+	if err != nil {
+		return err
+	}
+	var args interface{}
+	if err := json.Unmarshal(data, &args); err != nil {
+		return err
+	}
+	if args == nil {
+		args = []interface{}{}
+	}
+	if err := schema.validate("args", args); err != nil {
+		return err
+	}
+	return next()
+}
+
+// Reported as "validation: <path>: <reason>".
+type schemaError struct {
+	path   string
+	reason string
+}
+
+func (se *schemaError) Error() string {
+	return fmt.Sprintf("validation: %s: %s", se.path, se.reason)
+}
+
+func invalidArgs(path string, format string, args ...interface{}) error {
+	return &schemaError{path: path, reason: fmt.Sprintf(format, args...)}
+}
+
+type jsonSchema struct {
+	// false schemas match nothing, an empty schema matches anything
+	never bool
+
+	types      []string
+	enum       []interface{}
+	constant   *interface{}
+	properties map[string]*jsonSchema
+	required   []string
+	// nil allows any additional properties
+	additional *jsonSchema
+	items      *jsonSchema
+	tuple      []*jsonSchema
+	minItems   *int
+	maxItems   *int
+	minLength  *int
+	maxLength  *int
+	pattern    *regexp.Regexp
+	minimum    *float64
+	maximum    *float64
+	exclMin    *float64
+	exclMax    *float64
+}
+
+// Keywords which don't affect validation.
+var annotations = map[string]bool{
+	"$schema":     true,
+	"$id":         true,
+	"$comment":    true,
+	"title":       true,
+	"description": true,
+	"default":     true,
+	"examples":    true,
+	"readOnly":    true,
+	"writeOnly":   true,
+}
+
+func compileSchema(data json.RawMessage) (*jsonSchema, error) {
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		return &jsonSchema{never: !b}, nil
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("a schema must be an object or boolean")
+	}
+	keywords := make([]string, 0, len(raw))
+	for keyword := range raw {
+		keywords = append(keywords, keyword)
+	}
+	// report the same keyword every time
+	sort.Strings(keywords)
+
+	js := &jsonSchema{}
+	var err error
+	for _, keyword := range keywords {
+		val := raw[keyword]
+		switch keyword {
+		case "type":
+			var single string
+			if json.Unmarshal(val, &single) == nil {
+				js.types = []string{single}
+			} else {
+				err = json.Unmarshal(val, &js.types)
+			}
+		case "enum":
+			err = json.Unmarshal(val, &js.enum)
+		case "const":
+			var c interface{}
+			err = json.Unmarshal(val, &c)
+			js.constant = &c
+		case "properties":
+			var props map[string]json.RawMessage
+			err = json.Unmarshal(val, &props)
+			js.properties = map[string]*jsonSchema{}
+			for name, prop := range props {
+				if js.properties[name], err = compileSchema(prop); err != nil {
+					break
+				}
+			}
+		case "required":
+			err = json.Unmarshal(val, &js.required)
+		case "additionalProperties":
+			js.additional, err = compileSchema(val)
+		case "items":
+			if strings.HasPrefix(strings.TrimSpace(string(val)), "[") {
+				var tuple []json.RawMessage
+				err = json.Unmarshal(val, &tuple)
+				for idx := range tuple {
+					var item *jsonSchema
+					if item, err = compileSchema(tuple[idx]); err != nil {
+						break
+					}
+					js.tuple = append(js.tuple, item)
+				}
+			} else {
+				js.items, err = compileSchema(val)
+			}
+		case "minItems":
+			err = json.Unmarshal(val, &js.minItems)
+		case "maxItems":
+			err = json.Unmarshal(val, &js.maxItems)
+		case "minLength":
+			err = json.Unmarshal(val, &js.minLength)
+		case "maxLength":
+			err = json.Unmarshal(val, &js.maxLength)
+		case "pattern":
+			var pattern string
+			if err = json.Unmarshal(val, &pattern); err == nil {
+				js.pattern, err = regexp.Compile(pattern)
+			}
+		case "minimum":
+			err = json.Unmarshal(val, &js.minimum)
+		case "maximum":
+			err = json.Unmarshal(val, &js.maximum)
+		case "exclusiveMinimum":
+			err = json.Unmarshal(val, &js.exclMin)
+		case "exclusiveMaximum":
+			err = json.Unmarshal(val, &js.exclMax)
+		default:
+			if !annotations[keyword] {
+				return nil, fmt.Errorf("%s is not supported", keyword)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", keyword, err)
+		}
+	}
+	return js, nil
+}
+
+// The JSON type of a value decoded by encoding/json.
+func jsonType(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+func (js *jsonSchema) validate(path string, val interface{}) error {
+	if js.never {
+		return invalidArgs(path, "not allowed")
+	}
+
+	actual := jsonType(val)
+	if len(js.types) > 0 {
+		ok := false
+		for _, typ := range js.types {
+			if typ == actual || (typ == "number" && actual == "integer") {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return invalidArgs(path, "expected %s, not %s", strings.Join(js.types, " or "), actual)
+		}
+	}
+	if js.enum != nil {
+		ok := false
+		for idx := range js.enum {
+			if reflect.DeepEqual(js.enum[idx], val) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return invalidArgs(path, "not one of the allowed values")
+		}
+	}
+	if js.constant != nil && !reflect.DeepEqual(*js.constant, val) {
+		return invalidArgs(path, "not the allowed value")
+	}
+
+	switch v := val.(type) {
+	case float64:
+		return js.validateNumber(path, v)
+	case string:
+		return js.validateString(path, v)
+	case []interface{}:
+		return js.validateArray(path, v)
+	case map[string]interface{}:
+		return js.validateObject(path, v)
+	}
+	return nil
+}
+
+func (js *jsonSchema) validateNumber(path string, num float64) error {
+	if js.minimum != nil && num < *js.minimum {
+		return invalidArgs(path, "must be at least %v", *js.minimum)
+	}
+	if js.maximum != nil && num > *js.maximum {
+		return invalidArgs(path, "must be at most %v", *js.maximum)
+	}
+	if js.exclMin != nil && num <= *js.exclMin {
+		return invalidArgs(path, "must be greater than %v", *js.exclMin)
+	}
+	if js.exclMax != nil && num >= *js.exclMax {
+		return invalidArgs(path, "must be less than %v", *js.exclMax)
+	}
+	return nil
+}
+
+func (js *jsonSchema) validateString(path string, str string) error {
+	length := utf8.RuneCountInString(str)
+	if js.minLength != nil && length < *js.minLength {
+		return invalidArgs(path, "must be at least %d characters", *js.minLength)
+	}
+	if js.maxLength != nil && length > *js.maxLength {
+		return invalidArgs(path, "must be at most %d characters", *js.maxLength)
+	}
+	if js.pattern != nil && !js.pattern.MatchString(str) {
+		return invalidArgs(path, "must match %s", js.pattern.String())
+	}
+	return nil
+}
+
+func (js *jsonSchema) validateArray(path string, items []interface{}) error {
+	if js.minItems != nil && len(items) < *js.minItems {
+		return invalidArgs(path, "must have at least %d items", *js.minItems)
+	}
+	if js.maxItems != nil && len(items) > *js.maxItems {
+		return invalidArgs(path, "must have at most %d items", *js.maxItems)
+	}
+	for idx := range items {
+		item := js.items
+		if js.tuple != nil {
+			item = nil
+			if idx < len(js.tuple) {
+				item = js.tuple[idx]
+			}
+		}
+		if item == nil {
+			continue
+		}
+		if err := item.validate(fmt.Sprintf("%s[%d]", path, idx), items[idx]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (js *jsonSchema) validateObject(path string, obj map[string]interface{}) error {
+	for _, name := range js.required {
+		if _, ok := obj[name]; !ok {
+			return invalidArgs(path, "missing required property %q", name)
+		}
+	}
+
+	// sorted so the first error reported doesn't vary
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prop, ok := js.properties[name]
+		if !ok {
+			prop = js.additional
+		}
+		if prop == nil {
+			continue
+		}
+		if err := prop.validate(path+"."+name, obj[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/manager"
+	"github.com/stretchr/testify/assert"
+)
+
+// Only provides the job.
+type jobContext struct {
+	manager.Context
+	job *client.Job
+}
+
+func (jc jobContext) Job() *client.Job {
+	return jc.job
+}
+
+func TestSchemaValidation(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{}
+	err := s.RegisterSchema("SendEmail", json.RawMessage(`{
+		"type": "array",
+		"minItems": 1,
+		"items": [{
+			"type": "object",
+			"required": ["email"],
+			"properties": {
+				"email": {"type": "string", "pattern": "@"},
+				"retries": {"type": "integer", "minimum": 0}
+			},
+			"additionalProperties": false
+		}, {
+			"enum": ["html", "text"]
+		}]
+	}`))
+	assert.NoError(t, err)
+
+	validate := func(args ...interface{}) error {
+		job := client.NewJob("SendEmail", args...)
+		return s.validateArgs(func() error { return nil }, jobContext{job: job})
+	}
+
+	assert.NoError(t, validate(map[string]interface{}{"email": "mike@example.com", "retries": 3}, "html"))
+	assert.NoError(t, validate(map[string]string{"email": "mike@example.com"}))
+
+	err = validate(map[string]interface{}{"email": 5})
+	assert.EqualError(t, err, "validation: args[0].email: expected string, not integer")
+	assert.Equal(t, ErrCodeInvalidArgument, errorCode(err))
+
+	assert.EqualError(t, validate(), "validation: args: must have at least 1 items")
+	assert.EqualError(t, validate(map[string]interface{}{}), `validation: args[0]: missing required property "email"`)
+	assert.EqualError(t, validate(map[string]interface{}{"email": "mike"}), "validation: args[0].email: must match @")
+	assert.EqualError(t, validate(map[string]interface{}{"email": "a@b", "retries": 1.5}), "validation: args[0].retries: expected integer, not number")
+	assert.EqualError(t, validate(map[string]interface{}{"email": "a@b", "retries": -1}), "validation: args[0].retries: must be at least 0")
+	assert.EqualError(t, validate(map[string]interface{}{"email": "a@b", "cc": "c@d"}), "validation: args[0].cc: not allowed")
+	assert.EqualError(t, validate(map[string]interface{}{"email": "a@b"}, "pdf"), "validation: args[1]: not one of the allowed values")
+
+	// the worker downloads the args
+	job := client.NewJob("SendEmail")
+	job.ArgsUrl = "https://storage.example.com/args/123"
+	assert.NoError(t, s.validateArgs(func() error { return nil }, jobContext{job: job}))
+
+	// other jobtypes aren't validated
+	job = client.NewJob("Other", 1)
+	assert.NoError(t, s.validateArgs(func() error { return nil }, jobContext{job: job}))
+
+	assert.NoError(t, s.RegisterSchema("SendEmail", nil))
+	assert.NoError(t, validate())
+
+	assert.Error(t, s.RegisterSchema("Bad", json.RawMessage(`{"anyOf": []}`)))
+	assert.Error(t, s.RegisterSchema("Bad", json.RawMessage(`{"minLength": "x"}`)))
+	assert.Error(t, s.RegisterSchema("Bad", json.RawMessage(`[]`)))
+	// keywords it can't enforce, or misspelled, aren't ignored
+	assert.Error(t, s.RegisterSchema("Bad", json.RawMessage(`{"uniqueItems": true}`)))
+	assert.Error(t, s.RegisterSchema("Bad", json.RawMessage(`{"items": {"type": "string", "format": "email"}}`)))
+	assert.Error(t, s.RegisterSchema("Bad", json.RawMessage(`{"type": "array", "minimun": 1}`)))
+	assert.NoError(t, s.RegisterSchema("Good", json.RawMessage(`{"$schema": "http://json-schema.org/draft-07/schema#", "description": "ids", "type": "array"}`)))
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/stretchr/testify/assert"
+)
+
+type pipeDialer struct {
+	conn net.Conn
+}
+
+func (pd *pipeDialer) Dial(network, addr string) (net.Conn, error) {
+	return pd.conn, nil
+}
+
+func scramHandshake(serverPassword, clientPassword string) (*Connection, error) {
+	srv, cli := net.Pipe()
+	s := &Server{
+		Options: &ServerOptions{Password: serverPassword, AuthMode: AuthScram, HandshakeTimeout: 1 * time.Second},
+		workers: newWorkers(),
+	}
+
+	conns := make(chan *Connection, 1)
+	go func() {
+		conns <- startConnection(srv, s)
+	}()
+
+	_, err := client.DialWithDialer(&client.Server{Address: "pipe"}, clientPassword, &pipeDialer{cli})
+	c := <-conns
+	srv.Close()
+	cli.Close()
+	return c, err
+}
+
+func TestScramHandshake(t *testing.T) {
+	t.Parallel()
+
+	c, err := scramHandshake("sekret", "sekret")
+	assert.NoError(t, err)
+	assert.NotNil(t, c)
+
+	c, err = scramHandshake("sekret", "wrong")
+	assert.Error(t, err)
+	assert.Nil(t, c)
+}
@@ -2,12 +2,16 @@ package server
 
 import (
 	"bufio"
+	"context"
 	"crypto/sha256"
 	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"math/rand"
 	"net"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
@@ -16,6 +20,7 @@ import (
 	"time"
 
 	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/internal/scram"
 	"github.com/contribsys/faktory/manager"
 	"github.com/contribsys/faktory/storage"
 	"github.com/contribsys/faktory/util"
@@ -26,6 +31,11 @@ type RuntimeStats struct {
 	Connections uint64
 	Commands    uint64
 	StartedAt   time.Time
+
+	// Jobs rejected for exceeding MaxJobPayloadBytes
+	LargePayloadRejected uint64
+	// Connections refused for exceeding MaxConnections
+	ConnectionsRejected uint64
 }
 
 type Server struct {
@@ -38,17 +48,64 @@ type Server struct {
 	manager    manager.Manager
 	workers    *workers
 	taskRunner *taskRunner
+	scheduler  *taskRunner
+	metrics    *http.Server
+	httpServer *http.Server
+	conns      *connLimiter
+	middleware MiddlewareChain
+	forwarder  Forwarder
+	gossiper   Gossiper
+	pushHooks  []JobMiddleware
+	popHooks   []JobMiddleware
+	scram      *scramCredentials
 	mu         sync.Mutex
 	stopper    chan bool
 	closed     bool
+
+	dispatchers map[string]*dispatcher
+	dispatchMu  sync.RWMutex
+	latency     latencyTracker
+	throughput  throughputTracker
+
+	// jobtype -> schema for its args
+	schemas  map[string]*jsonSchema
+	schemaMu sync.RWMutex
+
+	routes  []Route
+	routeMu sync.RWMutex
+
+	throttle throttle
+	quota    jobQuota
+	trends   statsHistory
+	archiver DeadArchiver
+
+	// for TRACE, see job_events.go
+	jobEvents jobEventLog
+	// for GET /events, see events.go
+	events eventBus
+
+	// queue name -> limit, see queue_limits.go
+	limits  map[string]queueLimit
+	limitMu sync.RWMutex
+
+	// queue name -> config, see declare.go
+	declared  map[string]storage.QueueConfig
+	declareMu sync.RWMutex
+
+	// SUBSCRIBE queues -> turn, see subscribe.go
+	turns  map[string]chan struct{}
+	turnMu sync.Mutex
 }
 
 func NewServer(opts *ServerOptions) (*Server, error) {
 	if opts.Binding == "" {
 		opts.Binding = "localhost:7419"
 	}
-	if opts.StorageDirectory == "" {
-		return nil, fmt.Errorf("missing or empty storage directory")
+	if err := opts.ResolvePassword(); err != nil {
+		return nil, err
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid server options: %w", err)
 	}
 
 	s := &Server{
@@ -56,6 +113,8 @@ func NewServer(opts *ServerOptions) (*Server, error) {
 		Stats:      &RuntimeStats{StartedAt: time.Now()},
 		Subsystems: []Subsystem{},
 
+		conns: newConnLimiter(opts.MaxConnsPerIP),
+
 		stopper: make(chan bool),
 		closed:  false,
 	}
@@ -75,11 +134,18 @@ func (s *Server) Manager() manager.Manager {
 	return s.manager
 }
 
+// Reload re-reads Options.ConfigFile, if the server was built with
+// LoadConfig, and then reloads each subsystem.
 func (s *Server) Reload() {
+	if s.Options.ConfigFile != "" {
+		if err := s.reloadConfig(); err != nil {
+			s.logger().Error("Unable to reload config", err, map[string]interface{}{"path": s.Options.ConfigFile})
+		}
+	}
 	for idx := range s.Subsystems {
 		subsystem := s.Subsystems[idx]
 		if err := subsystem.Reload(s); err != nil {
-			util.Warnf("Subsystem %s returned reload error: %v", subsystem.Name(), err)
+			s.logger().Error("Subsystem returned reload error", err, map[string]interface{}{"subsystem": subsystem.Name()})
 		}
 	}
 }
@@ -89,29 +155,120 @@ func (s *Server) AddTask(everySec int64, task Taskable) {
 }
 
 func (s *Server) Boot() error {
-	store, err := storage.Open(s.Options.RedisSock, s.Options.PoolSize)
+	backend := s.Options.storageBackend()
+	store, err := storage.OpenBackend(backend, s.Options.RedisSock, s.Options.PoolSize)
+	if err != nil {
+		return fmt.Errorf("cannot open %s database: %w", backend, err)
+	}
+
+	err = s.enableEncryption(store)
 	if err != nil {
-		return fmt.Errorf("cannot open redis database: %w", err)
+		store.Close()
+		return err
+	}
+	if wr, ok := store.(storage.WriteRetrier); ok {
+		wr.SetWriteRetries(s.Options.storageWriteRetries())
 	}
 
-	listener, err := net.Listen("tcp", s.Options.Binding)
+	listener, err := listen(s.Options)
 	if err != nil {
 		store.Close()
 		return fmt.Errorf("cannot listen on %s: %w", s.Options.Binding, err)
 	}
 
+	if s.Options.TLSEnabled() {
+		cfg, err := tlsConfig(s.Options)
+		if err != nil {
+			listener.Close()
+			store.Close()
+			return err
+		}
+		listener = tls.NewListener(listener, cfg)
+	}
+
 	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.store = store
 	s.workers = newWorkers()
 	s.manager = manager.NewManager(store)
+	s.manager.AddMiddleware("push", s.validateJid)
+	s.manager.AddMiddleware("push", s.limitInlineArgs)
+	s.manager.AddMiddleware("push", s.expandTemplate)
+	s.manager.AddMiddleware("push", s.validateArgs)
+	s.manager.AddMiddleware("push", s.callPushMiddleware)
+	s.manager.SetQueueLimits(s.queueLimit)
+	s.manager.AddMiddleware("push", s.applyPriorityMode)
+	s.manager.AddMiddleware("fetch", s.callPopMiddleware)
+	s.manager.AddMiddleware("fetch", s.trackLatency)
+	s.manager.AddMiddleware("fetch", s.trackThroughput)
+	s.manager.AddMiddleware("ack", s.releaseThrottle)
+	s.manager.AddMiddleware("fail", s.releaseThrottle)
+	s.manager.SetRetryJitter(s.Options.JitterSeconds)
+	s.manager.SetSchedulerWorkers(s.Options.schedulerWorkers())
+	s.manager.SetLiveness(s.workers.alive)
+	s.enableHistory()
+	s.archiver = s.deadArchiver()
+	s.enableTracing()
+	s.enableJobEvents()
+	s.enableEventBus()
+	applyLogLevel(s.Options.LogLevel)
+	if err := s.applyQueueRates(s.Options.QueueRates); err != nil {
+		listener.Close()
+		store.Close()
+		return err
+	}
+	if err := s.loadQueueLimits(); err != nil {
+		listener.Close()
+		store.Close()
+		return err
+	}
+	if err := s.loadDeclaredQueues(); err != nil {
+		listener.Close()
+		store.Close()
+		return err
+	}
 	s.listener = listener
 	s.stopper = make(chan bool)
 	s.startTasks()
-	s.mu.Unlock()
+
+	err = s.startMetrics()
+	if err != nil {
+		close(s.stopper)
+		listener.Close()
+		store.Close()
+		return err
+	}
+
+	err = s.startHTTP()
+	if err != nil {
+		// nothing has been served yet
+		shutdownHTTP(s.metrics)
+		s.metrics = nil
+		close(s.stopper)
+		listener.Close()
+		store.Close()
+		return err
+	}
 
 	return nil
 }
 
+func (s *Server) enableEncryption(store storage.Store) error {
+	if len(s.Options.EncryptionKey) == 0 {
+		return nil
+	}
+	es, ok := store.(storage.Encryptable)
+	if !ok {
+		return fmt.Errorf("%s storage does not support encryption", s.Options.storageBackend())
+	}
+	pc, err := storage.NewPayloadCipher(s.Options.EncryptionKey)
+	if err != nil {
+		return err
+	}
+	es.SetCipher(pc)
+	return nil
+}
+
 func (s *Server) Run() error {
 	if s.store == nil {
 		panic("Server hasn't been booted")
@@ -125,7 +282,7 @@ func (s *Server) Run() error {
 		}
 	}
 
-	util.Infof("PID %d listening at %s, press Ctrl-C to stop", os.Getpid(), s.Options.Binding)
+	s.logger().Info("Listening, press Ctrl-C to stop", map[string]interface{}{"pid": os.Getpid(), "binding": s.Options.Binding})
 
 	// this is the runtime loop for the command server
 	for {
@@ -133,19 +290,71 @@ func (s *Server) Run() error {
 		if err != nil {
 			return nil
 		}
-		// Each connection gets its own goroutine which ultimately limits Faktory's scalability.
-		// Faktory hardcodes a limit of 1000 Redis connections but does not put a limit here
-		// because Go's runtime scheduler will get better over time.
-		// TODO: Look into alternatives like a reactor + goroutine pool.
-		go func(conn net.Conn) {
-			c := startConnection(conn, s)
-			if c == nil {
-				return
-			}
-			defer cleanupConnection(s, c)
-			s.processLines(c)
-		}(conn)
+		s.accept(conn)
+	}
+}
+
+// Each connection gets its own goroutine which ultimately limits
+// Faktory's scalability.  MaxConnections caps them so a burst of
+// connects can't exhaust memory; over the cap the connection is
+// refused without starting a goroutine.
+func (s *Server) accept(conn net.Conn) {
+	if !s.openConnection() {
+		// with TLS the write first reads the handshake, a client which
+		// sends nothing mustn't stall the accept loop
+		go func() {
+			_ = conn.SetDeadline(time.Now().Add(time.Second))
+			_, _ = conn.Write([]byte("-ERR " + ErrCodeServerBusy + " server busy\r\n"))
+			conn.Close()
+		}()
+		return
 	}
+
+	go func() {
+		defer atomic.AddUint64(&s.Stats.Connections, ^uint64(0))
+		s.serve(conn)
+	}()
+}
+
+// Count a new connection, from the command port or a WebSocket, unless
+// MaxConnections are already open.
+func (s *Server) openConnection() bool {
+	max := uint64(s.Options.MaxConnections)
+	for {
+		count := atomic.LoadUint64(&s.Stats.Connections)
+		if max > 0 && count >= max {
+			atomic.AddUint64(&s.Stats.ConnectionsRejected, 1)
+			return false
+		}
+		if atomic.CompareAndSwapUint64(&s.Stats.Connections, count, count+1) {
+			return true
+		}
+	}
+}
+
+// Handle a client connection, from the command port or a WebSocket,
+// until it closes.
+func (s *Server) serve(conn net.Conn) {
+	ip, ok := s.conns.acquire(conn.RemoteAddr())
+	if !ok {
+		_, _ = conn.Write([]byte("-ERR " + ErrCodeTooManyConns + " too many connections\r\n"))
+		conn.Close()
+		return
+	}
+	defer s.conns.release(ip)
+
+	// Go sets this by default but commands and responses are small and
+	// latency matters more than packet count, so don't rely on it.
+	if tc, ok := conn.(*net.TCPConn); ok {
+		_ = tc.SetNoDelay(true)
+	}
+
+	c := startConnection(conn, s)
+	if c == nil {
+		return
+	}
+	defer cleanupConnection(s, c)
+	s.processLines(c)
 }
 
 func (s *Server) Stopper() chan bool {
@@ -155,12 +364,26 @@ func (s *Server) Stopper() chan bool {
 func (s *Server) Stop(f func()) {
 	// Don't allow new network connections
 	s.mu.Lock()
-	s.closed = true
 	if s.listener != nil {
 		s.listener.Close()
+		if path, ok := unixSocketPath(s.Options.Binding); ok {
+			_ = os.Remove(path)
+		}
 	}
 	s.mu.Unlock()
 
+	if timeout := s.shutdownTimeout(); timeout > 0 {
+		s.drain(timeout)
+	}
+
+	s.mu.Lock()
+	s.closed = true
+	metrics, hs := s.metrics, s.httpServer
+	s.metrics, s.httpServer = nil, nil
+	s.mu.Unlock()
+	shutdownHTTP(metrics)
+	shutdownHTTP(hs)
+
 	time.Sleep(100 * time.Millisecond)
 
 	if f != nil {
@@ -170,8 +393,85 @@ func (s *Server) Stop(f func()) {
 	s.store.Close()
 }
 
+// Tell all workers to terminate and give them up to +timeout+ to
+// acknowledge their in-progress jobs.  Anything still working after
+// that point is pushed back onto its queue so it isn't lost.
+func (s *Server) drain(timeout time.Duration) {
+	s.workers.signalAll(Terminate)
+
+	deadline := time.Now().Add(timeout)
+	for s.manager.WorkingCount() > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if s.manager.WorkingCount() == 0 {
+		return
+	}
+
+	count, err := s.manager.RequeueAll()
+	if err != nil {
+		s.logger().Error("Unable to requeue working jobs", err, nil)
+	}
+	if count > 0 {
+		s.logger().Error("Shutdown timeout expired, requeued working jobs", nil, map[string]interface{}{"count": count})
+	}
+}
+
+const unixPrefix = "unix://"
+
+func unixSocketPath(binding string) (string, bool) {
+	if !strings.HasPrefix(binding, unixPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(binding, unixPrefix), true
+}
+
+// Listen on a TCP address like "localhost:7419" or, for clients on
+// the same host, a Unix socket like "unix:///var/run/faktory.sock".
+// The socket file is only accessible to the user running Faktory.
+func listen(opts *ServerOptions) (net.Listener, error) {
+	binding := opts.Binding
+	path, ok := unixSocketPath(binding)
+	if !ok {
+		return listenTCP(opts)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Chmod(path, 0600)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+func listenTCP(opts *ServerOptions) (net.Listener, error) {
+	var lc net.ListenConfig
+	if opts.ReusePort {
+		lc.Control = reusePort
+	}
+	listener, err := lc.Listen(context.Background(), "tcp", opts.Binding)
+	if err != nil {
+		return nil, err
+	}
+	if opts.AcceptBacklog > 0 {
+		err = setBacklog(listener, opts.AcceptBacklog)
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+	return listener, nil
+}
+
 func cleanupConnection(s *Server, c *Connection) {
 	//util.Debugf("Removing client connection %v", c)
+	if c.sub != nil {
+		close(c.sub.done)
+	}
 	s.workers.RemoveConnection(c)
 }
 
@@ -187,17 +487,29 @@ func hash(pwd, salt string, iterations int) string {
 }
 
 func startConnection(conn net.Conn, s *Server) *Connection {
-	// Handshake must complete within 2 seconds.
+	// Handshake must complete within 2 seconds by default.
 	// This is a DoS mitigation so clients can't start a handshake
 	// but never complete it, leaving a connection open.
-	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+	_ = conn.SetDeadline(time.Now().Add(s.Options.handshakeTimeout()))
+
+	raw := conn
+	cn := &Connection{}
+	conn = &countingConn{Conn: conn, read: &cn.BytesRead, written: &cn.BytesWritten}
 
 	// 4000 iterations is about 1ms on my 2016 MBP w/ 2.9Ghz Core i5
 	iter := rand.Intn(4096) + 4000
 
 	var salt string
+	var creds *scramCredentials
+	var serverNonce string
+	password := s.password()
 	_, _ = conn.Write([]byte(`+HI {"v":2`))
-	if s.Options.Password != "" {
+	if password != "" && s.Options.AuthMode == AuthScram {
+		creds = s.scramCredentials()
+		serverNonce, _ = scram.Nonce()
+		_, _ = conn.Write([]byte(fmt.Sprintf(`,"a":"scram","i":%d,"s":"%s","r":"%s"}`,
+			creds.iterations, creds.salt, serverNonce)))
+	} else if password != "" {
 		_, _ = conn.Write([]byte(`,"i":`))
 		iters := strconv.FormatInt(int64(iter), 10)
 		_, _ = conn.Write([]byte(iters))
@@ -217,79 +529,104 @@ func startConnection(conn net.Conn, s *Server) *Connection {
 		// TCP probes on the socket will close connection
 		// immediately and lead to EOF. Don't flood logs with them.
 		if err != io.EOF {
-			util.Error("Bad connection", err)
+			s.logger().Error("Bad connection", err, map[string]interface{}{"remote": conn.RemoteAddr().String()})
 		}
 		conn.Close()
 		return nil
 	}
 
+	// load balancer probes may check health without a HELLO
+	if strings.TrimSpace(line) == "HEALTH" {
+		_, _ = conn.Write([]byte(s.healthResponse()))
+		conn.Close()
+		return nil
+	}
+
 	valid := strings.HasPrefix(line, "HELLO {")
 	if !valid {
-		util.Infof("Invalid preamble: %s", line)
-		util.Info("Need a valid HELLO")
+		s.logger().Info("Need a valid HELLO", map[string]interface{}{"preamble": line})
 		conn.Close()
 		return nil
 	}
 
 	cl, err := clientDataFromHello(line[5:])
 	if err != nil {
-		util.Error("Invalid client data in HELLO", err)
+		s.logger().Error("Invalid client data in HELLO", err, nil)
 		conn.Close()
 		return nil
 	}
 
-	if s.Options.Password != "" {
+	var serverFinal string
+	if creds != nil {
+		authMessage := creds.authMessage(cl.ScramNonce, serverNonce)
+		proof, err := base64.StdEncoding.DecodeString(cl.ScramProof)
+		if cl.ScramNonce == "" || err != nil || !creds.verify(authMessage, proof) {
+			_, _ = conn.Write([]byte("-ERR " + ErrCodeAuthFailed + " Invalid password\r\n"))
+			_ = conn.Close()
+			return nil
+		}
+		serverFinal = " v=" + creds.serverSignature(authMessage)
+	} else if password != "" {
 		if cl.Version < 2 {
 			iter = 1
 		}
 
-		if subtle.ConstantTimeCompare([]byte(cl.PasswordHash), []byte(hash(s.Options.Password, salt, iter))) != 1 {
-			_, _ = conn.Write([]byte("-ERR Invalid password\r\n"))
+		if subtle.ConstantTimeCompare([]byte(cl.PasswordHash), []byte(hash(password, salt, iter))) != 1 {
+			_, _ = conn.Write([]byte("-ERR " + ErrCodeAuthFailed + " Invalid password\r\n"))
 			_ = conn.Close()
 			return nil
 		}
 	}
 
-	cn := &Connection{
-		client: cl,
-		conn:   conn,
-		buf:    buf,
+	if cl.Namespace == "" {
+		cl.Namespace = s.Options.Namespace
+	}
+	if cl.Namespace != "" && !validNamespace.MatchString(cl.Namespace) {
+		_, _ = conn.Write([]byte("-ERR " + ErrCodeInvalidArgument + " Invalid namespace, must match " + validNamespace.String() + "\r\n"))
+		_ = conn.Close()
+		return nil
 	}
 
+	cn.client = cl
+	cn.conn = newReplyBuffer(conn)
+	cn.buf = buf
+	cn.netConn = conn
+
 	if cl.Wid == "" {
 		// a producer, not a consumer connection
 	} else {
 		s.workers.setupHeartbeat(cl, cn)
 	}
 
-	_, err = conn.Write([]byte("+OK\r\n"))
+	_, err = conn.Write([]byte("+OK" + serverFinal + "\r\n"))
 	if err != nil {
-		util.Error("Closing connection", err)
+		s.logger().Error("Closing connection", err, nil)
 		conn.Close()
 		return nil
 	}
 
 	// disable deadline
 	_ = conn.SetDeadline(time.Time{})
+	s.enableKeepAlive(raw)
 
 	return cn
 }
 
 func (s *Server) processLines(conn *Connection) {
-	atomic.AddUint64(&s.Stats.Connections, 1)
-	defer atomic.AddUint64(&s.Stats.Connections, ^uint64(0))
-
 	for {
-		cmd, e := conn.buf.ReadString('\n')
+		cmd, e := s.readCommand(conn)
 		if e != nil {
-			if e != io.EOF {
-				util.Error("Unexpected socket error", e)
+			if e == errNoPong || e == errPartialLine {
+				s.logger().Info("Closing idle connection", map[string]interface{}{"remote": conn.netConn.RemoteAddr().String(), "reason": e.Error()})
+			} else if e != io.EOF {
+				s.logger().Error("Unexpected socket error", e, nil)
 			}
 			conn.Close()
 			return
 		}
 		if s.closed {
-			_ = conn.Error("Closing connection", fmt.Errorf("Shutdown in progress"))
+			_ = conn.Error("Closing connection", ErrCodeShuttingDown, fmt.Errorf("Shutdown in progress"))
+			_ = conn.flush()
 			_ = conn.Close()
 			return
 		}
@@ -304,10 +641,14 @@ func (s *Server) processLines(conn *Connection) {
 		}
 		proc, ok := CommandSet[verb]
 		if !ok {
-			_ = conn.Error(cmd, fmt.Errorf("Unknown command %s", verb))
+			_ = conn.Error(cmd, ErrCodeUnknownCommand, fmt.Errorf("Unknown command %s", verb))
 		} else {
 			atomic.AddUint64(&s.Stats.Commands, 1)
-			proc(conn, s, cmd)
+			callCommand(s.middleware, conn, s, cmd, proc)
+		}
+		if err := conn.flush(); err != nil {
+			conn.Close()
+			return
 		}
 		if verb == "END" {
 			break
@@ -319,11 +660,17 @@ func (s *Server) uptimeInSeconds() int {
 	return int(time.Since(s.Stats.StartedAt).Seconds())
 }
 
-func (s *Server) CurrentState() (map[string]interface{}, error) {
-	queueCmd := map[string]*redis.IntCmd{}
+// The size of every queue, read in a single round trip.
+func (s *Server) queueSizes() (map[string]int64, error) {
+	queueCmd := map[string][]*redis.IntCmd{}
 	_, err := s.store.Redis().Pipelined(func(pipe redis.Pipeliner) error {
 		s.store.EachQueue(func(q storage.Queue) {
-			queueCmd[q.Name()] = pipe.LLen(q.Name())
+			keys := storage.PriorityKeys(q.Name())
+			cmds := make([]*redis.IntCmd, len(keys))
+			for idx := range keys {
+				cmds[idx] = pipe.LLen(keys[idx])
+			}
+			queueCmd[q.Name()] = cmds
 		})
 		return nil
 	})
@@ -331,33 +678,59 @@ func (s *Server) CurrentState() (map[string]interface{}, error) {
 		return nil, err
 	}
 
-	queues := map[string]int64{}
+	queues := make(map[string]int64, len(queueCmd))
+	for name, cmds := range queueCmd {
+		qsize := int64(0)
+		for idx := range cmds {
+			qsize += cmds[idx].Val()
+		}
+		queues[name] = qsize
+	}
+	return queues, nil
+}
+
+func (s *Server) CurrentState() (map[string]interface{}, error) {
+	queues, err := s.queueSizes()
+	if err != nil {
+		return nil, err
+	}
 	totalQueued := int64(0)
-	totalQueues := len(queueCmd)
-	for name, cmd := range queueCmd {
-		qsize := cmd.Val()
+	totalQueues := len(queues)
+	for _, qsize := range queues {
 		totalQueued += qsize
-		queues[name] = qsize
 	}
+	throttleLimit, throttleInUse := s.throttle.usage()
 
 	return map[string]interface{}{
 		"now":             util.Nows(),
 		"server_utc_time": time.Now().UTC().Format("15:04:05 UTC"),
 		"faktory": map[string]interface{}{
-			"total_failures":  s.store.TotalFailures(),
-			"total_processed": s.store.TotalProcessed(),
-			"total_enqueued":  totalQueued,
-			"total_queues":    totalQueues,
-			"queues":          queues,
-			"tasks":           s.taskRunner.Stats(),
+			"total_failures":   s.store.TotalFailures(),
+			"total_processed":  s.store.TotalProcessed(),
+			"total_enqueued":   totalQueued,
+			"total_queues":     totalQueues,
+			"queues":           queues,
+			"paused":           s.manager.PausedQueues(),
+			"rate_limits":      s.manager.Rates(),
+			"history_size":     s.store.Completed().Size(),
+			"queue_latency":    s.latency.percentiles(),
+			"queue_throughput": s.throughput.rates(time.Now()),
+			"throttle_limit":   throttleLimit,
+			"throttle_in_use":  throttleInUse,
+			"jobtype_stats":    s.manager.JobtypeStats(),
+			"tasks":            s.taskStats(),
 		},
+		"workers": s.workers.traffic(),
 		"server": map[string]interface{}{
-			"description":     client.Name,
-			"faktory_version": client.Version,
-			"uptime":          s.uptimeInSeconds(),
-			"connections":     atomic.LoadUint64(&s.Stats.Connections),
-			"command_count":   atomic.LoadUint64(&s.Stats.Commands),
-			"used_memory_mb":  util.MemoryUsageMB(),
+			"description":            client.Name,
+			"faktory_version":        client.Version,
+			"uptime":                 s.uptimeInSeconds(),
+			"connections":            atomic.LoadUint64(&s.Stats.Connections),
+			"command_count":          atomic.LoadUint64(&s.Stats.Commands),
+			"large_payload_rejected": atomic.LoadUint64(&s.Stats.LargePayloadRejected),
+			"connections_rejected":   atomic.LoadUint64(&s.Stats.ConnectionsRejected),
+			"scheduler_workers":      s.manager.SchedulerWorkers(),
+			"used_memory_mb":         util.MemoryUsageMB(),
 		},
 	}, nil
 }
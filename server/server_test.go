@@ -16,7 +16,7 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func runServer(binding string, runner func()) {
+func runServer(binding string, runner func(s *Server)) {
 	dir := fmt.Sprintf("/tmp/%s", strings.Replace(binding, ":", "_", 1))
 	defer os.RemoveAll(dir)
 
@@ -48,12 +48,12 @@ func runServer(binding string, runner func()) {
 			panic(err)
 		}
 	}()
-	runner()
+	runner(s)
 	s.Stop(nil)
 }
 
 func TestServerStart(t *testing.T) {
-	runServer("localhost:4477", func() {
+	runServer("localhost:4477", func(s *Server) {
 		conn, err := net.DialTimeout("tcp", "localhost:4477", 1*time.Second)
 		assert.NoError(t, err)
 		buf := bufio.NewReader(conn)
@@ -83,12 +83,12 @@ func TestServerStart(t *testing.T) {
 		_, _ = conn.Write([]byte("CMD foo\n"))
 		result, err = buf.ReadString('\n')
 		assert.NoError(t, err)
-		assert.Equal(t, "-ERR Unknown command CMD\r\n", result)
+		assert.Equal(t, "-ERR ERR_UNKNOWN_COMMAND Unknown command CMD\r\n", result)
 
 		_, _ = conn.Write([]byte("PUSH {\"jid\":\"12345678901234567890abcd\",\"jobtype\":\"Thing\",\"args\":[123],\"queue\":\"default\"}\n"))
 		result, err = buf.ReadString('\n')
 		assert.NoError(t, err)
-		assert.Equal(t, "+OK\r\n", result)
+		assert.Equal(t, "+OK 12345678901234567890abcd\r\n", result)
 
 		_, _ = conn.Write([]byte("FETCH default some other\n"))
 		_, err = buf.ReadString('\n')
@@ -115,6 +115,75 @@ func TestServerStart(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, "+OK\r\n", result)
 
+		_, _ = conn.Write([]byte("PAUSE default\n"))
+		result, err = buf.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "+OK\r\n", result)
+
+		_, _ = conn.Write([]byte("RESUME default\n"))
+		result, err = buf.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "+OK\r\n", result)
+
+		_, _ = conn.Write([]byte("PAUSE\n"))
+		result, err = buf.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "-ERR ERR_INVALID_FORMAT Invalid format\r\n", result)
+
+		_, _ = conn.Write([]byte("RESURRECT 12345678901234567890abcd\n"))
+		result, err = buf.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "-ERR ERR_JOB_NOT_FOUND not found\r\n", result)
+
+		_, _ = conn.Write([]byte("PROMOTE 12345678901234567890abcd\n"))
+		result, err = buf.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "-ERR ERR_JOB_NOT_FOUND not found\r\n", result)
+
+		_, _ = conn.Write([]byte("RESIZE_POOL 0\n"))
+		result, err = buf.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "-ERR ERR_INVALID_ARGUMENT Invalid pool size 0, must be 1 to 64\r\n", result)
+
+		_, _ = conn.Write([]byte("RESIZE_POOL 4\n"))
+		result, err = buf.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "+OK\r\n", result)
+
+		_, _ = conn.Write([]byte("ANNOTATE 12345678901234567890abcd step 1\n"))
+		result, err = buf.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "-ERR ERR_JOB_NOT_FOUND Job not found 12345678901234567890abcd\r\n", result)
+
+		_, _ = conn.Write([]byte("PURGE_DEAD\n"))
+		result, err = buf.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, ":0\r\n", result)
+
+		_, _ = conn.Write([]byte("SCHEDULE 0 * * * * {\"jobtype\":\"Cleanup\",\"args\":[]}\n"))
+		result, err = buf.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "+OK\r\n", result)
+
+		_, _ = conn.Write([]byte("LIST_SCHEDULES\n"))
+		_, err = buf.ReadString('\n')
+		assert.NoError(t, err)
+		result, err = buf.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Regexp(t, "\"cron\":\"0 \\* \\* \\* \\*\"", result)
+
+		_, _ = conn.Write([]byte("QUERY retry jobtype=Thing LIMIT 10\n"))
+		_, err = buf.ReadString('\n')
+		assert.NoError(t, err)
+		result, err = buf.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Regexp(t, "12345678901234567890abcd", result)
+
+		_, _ = conn.Write([]byte("QUERY working jobtype=Thing\n"))
+		result, err = buf.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "-ERR ERR_INVALID_ARGUMENT Invalid set working, must be scheduled, retry or dead\r\n", result)
+
 		_, _ = conn.Write([]byte(fmt.Sprintf("INFO\n")))
 		_, err = buf.ReadString('\n')
 		assert.NoError(t, err)
@@ -124,13 +193,29 @@ func TestServerStart(t *testing.T) {
 		var stats map[string]interface{}
 		err = json.Unmarshal([]byte(result), &stats)
 		assert.NoError(t, err)
-		assert.Equal(t, 4, len(stats))
+		assert.Equal(t, 5, len(stats))
+
+		snap := s.Snapshot()
+		assert.EqualValues(t, 1, snap.Failures)
+		assert.Equal(t, 1, snap.RetrySize)
+		assert.Equal(t, 0, snap.WorkingSize)
+		assert.Contains(t, snap.Queues, "default")
 
 		_, _ = conn.Write([]byte(fmt.Sprintf("BEAT {\"wid\":\"%s\"}\n", client.Wid)))
 		result, err = buf.ReadString('\n')
 		assert.NoError(t, err)
 		assert.Equal(t, "+OK\r\n", result)
 
+		_, _ = conn.Write([]byte(fmt.Sprintf("SIGNAL %s quiet\n", client.Wid)))
+		result, err = buf.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "+OK\r\n", result)
+
+		_, _ = conn.Write([]byte(fmt.Sprintf("SIGNAL %s stop\n", client.Wid)))
+		result, err = buf.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "-ERR ERR_INVALID_ARGUMENT Invalid signal stop, must be quiet or terminate\r\n", result)
+
 		_, _ = conn.Write([]byte(fmt.Sprintf("FLUSH\n")))
 		result, err = buf.ReadString('\n')
 		assert.NoError(t, err)
@@ -155,6 +240,38 @@ func TestPasswordHashing(t *testing.T) {
 	assert.Equal(t, "6d877f8e5544b1f2598768f817413ab8a357afffa924dedae99eb91472d4ec30", result)
 }
 
+func TestListenUnix(t *testing.T) {
+	dir, err := os.MkdirTemp("", "faktory-sock")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := dir + "/faktory.sock"
+	listener, err := listen(&ServerOptions{Binding: "unix://" + path})
+	assert.NoError(t, err)
+	assert.Equal(t, "unix", listener.Addr().Network())
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0600, info.Mode().Perm())
+
+	go func() {
+		conn, err := net.Dial("unix", path)
+		if err == nil {
+			conn.Close()
+		}
+	}()
+	conn, err := listener.Accept()
+	assert.NoError(t, err)
+	conn.Close()
+
+	listener.Close()
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	_, ok := unixSocketPath("localhost:7419")
+	assert.False(t, ok)
+}
+
 func BenchmarkHash(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		// 1550 µs per call with 5545 iterations
@@ -165,3 +282,22 @@ func BenchmarkHash(b *testing.B) {
 		hash(pwd, salt, iterations)
 	}
 }
+
+func TestListenTCP(t *testing.T) {
+	t.Parallel()
+
+	opts := &ServerOptions{Binding: "127.0.0.1:0", ReusePort: true, AcceptBacklog: 16}
+	listener, err := listen(opts)
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	// a second listener may share the port
+	opts.Binding = listener.Addr().String()
+	second, err := listen(opts)
+	assert.NoError(t, err)
+	second.Close()
+
+	// but not without SO_REUSEPORT
+	_, err = listen(&ServerOptions{Binding: opts.Binding})
+	assert.Error(t, err)
+}
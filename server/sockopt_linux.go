@@ -0,0 +1,8 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+// +build linux,!mips,!mipsle,!mips64,!mips64le
+
+package server
+
+// The syscall package doesn't define SO_REUSEPORT on Linux,
+// this is the value from asm-generic/socket.h.
+const soReusePort = 0xf
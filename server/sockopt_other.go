@@ -0,0 +1,22 @@
+//go:build !((linux && !mips && !mipsle && !mips64 && !mips64le) || darwin || freebsd || netbsd || openbsd)
+// +build !linux mips mipsle mips64 mips64le
+// +build !darwin
+// +build !freebsd
+// +build !netbsd
+// +build !openbsd
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+func reusePort(network, address string, c syscall.RawConn) error {
+	return fmt.Errorf("reuse_port is not supported on this platform")
+}
+
+func setBacklog(listener net.Listener, backlog int) error {
+	return fmt.Errorf("accept_backlog is not supported on this platform")
+}
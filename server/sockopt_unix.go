@@ -0,0 +1,41 @@
+//go:build (linux && !mips && !mipsle && !mips64 && !mips64le) || darwin || freebsd || netbsd || openbsd
+// +build linux,!mips,!mipsle,!mips64,!mips64le darwin freebsd netbsd openbsd
+
+package server
+
+import (
+	"net"
+	"syscall"
+)
+
+func reusePort(network, address string, c syscall.RawConn) error {
+	var serr error
+	err := c.Control(func(fd uintptr) {
+		serr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
+
+// Go listens with the kernel's maximum backlog, listen(2) may be
+// called again on a listening socket to change it.
+func setBacklog(listener net.Listener, backlog int) error {
+	tl, ok := listener.(*net.TCPListener)
+	if !ok {
+		return nil
+	}
+	rc, err := tl.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	err = rc.Control(func(fd uintptr) {
+		serr = syscall.Listen(int(fd), backlog)
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
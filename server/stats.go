@@ -0,0 +1,54 @@
+package server
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// A snapshot of the server's counters and job counts, the typed
+// equivalent of INFO for code which embeds the server.
+type ServerStats struct {
+	Processed int64
+	Failures  int64
+	// jobs waiting in every queue
+	Enqueued      int64
+	WorkingSize   int
+	ScheduledSize int
+	RetrySize     int
+	DeadSize      int
+	// queue name -> size
+	Queues map[string]int64
+
+	Connections uint64
+	Commands    uint64
+	Uptime      time.Duration
+}
+
+// Snapshot reads the stats straight from the server and its storage.
+// If the queue sizes can't be read, Queues is empty and the error is
+// logged; every other field is still filled in.
+func (s *Server) Snapshot() ServerStats {
+	stats := ServerStats{
+		Processed:     int64(s.store.TotalProcessed()),
+		Failures:      int64(s.store.TotalFailures()),
+		WorkingSize:   s.manager.WorkingCount(),
+		ScheduledSize: int(s.store.Scheduled().Size()),
+		RetrySize:     int(s.store.Retries().Size()),
+		DeadSize:      int(s.store.Dead().Size()),
+		Queues:        map[string]int64{},
+		Connections:   atomic.LoadUint64(&s.Stats.Connections),
+		Commands:      atomic.LoadUint64(&s.Stats.Commands),
+		Uptime:        time.Since(s.Stats.StartedAt),
+	}
+
+	queues, err := s.queueSizes()
+	if err != nil {
+		s.logger().Error("Unable to read queue sizes", err, nil)
+		return stats
+	}
+	stats.Queues = queues
+	for _, size := range queues {
+		stats.Enqueued += size
+	}
+	return stats
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The most jobs a subscriber may be sent without acknowledging them.
+const maxSubscribeCredits = 1000
+
+// SUBSCRIBE critical default bulk
+// SUBSCRIBE critical:2 default:1 bulk:0.5
+//
+// Rather than polling with FETCH, a subscribed worker is sent each job
+// as soon as it's reserved for it, as a push frame rather than a reply.
+// The subscriber starts with one credit: each job sent uses one and each
+// ACK or FAIL of a job sent on the connection returns it, CREDIT grants
+// more.  Jobs are reserved exactly as FETCH does so subscribers and
+// fetching workers share the queues, and jobs wait in their queue while
+// nobody is subscribed.  Subscribers to the same queues take turns in
+// the order they started waiting.  The subscription ends when the
+// connection closes.
+func subscribe(c *Connection, s *Server, cmd string) {
+	if c.client.Wid == "" {
+		_ = c.Error(cmd, ErrCodeInvalidArgument, fmt.Errorf("Only consumers may subscribe"))
+		return
+	}
+	if c.sub != nil {
+		_ = c.Error(cmd, ErrCodeInvalidArgument, fmt.Errorf("Connection is already subscribed"))
+		return
+	}
+	qs, weights, err := parseQueueWeights(strings.Split(cmd, " ")[1:])
+	if err != nil {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, err)
+		return
+	}
+
+	if err := s.checkRenamed(c.namespace(), c.namespace().queues(qs)); err != nil {
+		_ = c.Error(cmd, ErrCodeQueueRenamed, err)
+		return
+	}
+
+	c.sub = newSubscription()
+	_ = c.Ok()
+	go s.deliver(c, qs, weights, c.sub)
+}
+
+// CREDIT 10
+//
+// Allow a subscriber to be sent more jobs before it acknowledges the
+// ones it has.
+func credit(c *Connection, s *Server, cmd string) {
+	if c.sub == nil {
+		_ = c.Error(cmd, ErrCodeInvalidArgument, fmt.Errorf("Connection is not subscribed"))
+		return
+	}
+	count, err := strconv.Atoi(strings.TrimPrefix(cmd, "CREDIT "))
+	if err != nil || count < 1 {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+	if !c.sub.grant(count) {
+		_ = c.Error(cmd, ErrCodeInvalidArgument, fmt.Errorf("A subscriber may hold at most %d credits", maxSubscribeCredits))
+		return
+	}
+	_ = c.Ok()
+}
+
+type subscription struct {
+	// closed to stop delivering jobs
+	done chan struct{}
+	// one token for each job the subscriber may be sent
+	credits chan struct{}
+
+	mu sync.Mutex
+	// JIDs sent and not yet acknowledged
+	sent map[string]bool
+}
+
+func newSubscription() *subscription {
+	sub := &subscription{
+		done:    make(chan struct{}),
+		credits: make(chan struct{}, maxSubscribeCredits),
+		sent:    map[string]bool{},
+	}
+	sub.credits <- struct{}{}
+	return sub
+}
+
+// Adds +count+ credits, false if that would exceed maxSubscribeCredits.
+func (sub *subscription) grant(count int) bool {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if len(sub.credits)+len(sub.sent)+count > maxSubscribeCredits {
+		return false
+	}
+	for i := 0; i < count; i++ {
+		sub.credits <- struct{}{}
+	}
+	return true
+}
+
+func (sub *subscription) delivered(jid string) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	sub.sent[jid] = true
+}
+
+// The job sent to the subscriber was acknowledged or failed, so it may
+// be sent another.
+func (sub *subscription) finished(jid string) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.sent[jid] {
+		delete(sub.sent, jid)
+		sub.refund()
+	}
+}
+
+// Never blocks, grant keeps the credits within the channel's capacity.
+func (sub *subscription) refund() {
+	select {
+	case sub.credits <- struct{}{}:
+	default:
+	}
+}
+
+// The job's ACK or FAIL was accepted, see subscription.finished.
+func (c *Connection) jobFinished(jid string) {
+	if c.sub != nil {
+		c.sub.finished(jid)
+	}
+}
+
+// Subscribers to the same queues wait for their turn in a line so each
+// is sent jobs in turn; a receive from a channel is served to waiting
+// goroutines in order.
+func (s *Server) subscriberTurn(qs []string) chan struct{} {
+	key := strings.Join(qs, " ")
+	s.turnMu.Lock()
+	defer s.turnMu.Unlock()
+	if s.turns == nil {
+		s.turns = map[string]chan struct{}{}
+	}
+	turn, ok := s.turns[key]
+	if !ok {
+		turn = make(chan struct{}, 1)
+		turn <- struct{}{}
+		s.turns[key] = turn
+	}
+	return turn
+}
+
+// How long to wait before reserving again after an error.
+const deliverRetryInterval = 1 * time.Second
+
+func (s *Server) deliver(c *Connection, qs []string, weights []float64, sub *subscription) {
+	turn := s.subscriberTurn(qs)
+	for {
+		select {
+		case <-sub.done:
+			return
+		case <-s.Stopper():
+			return
+		case <-sub.credits:
+		}
+
+		var job []byte
+		var jid string
+		select {
+		case <-sub.done:
+			return
+		case <-s.Stopper():
+			return
+		case <-turn:
+			j, err := s.nextJob(c, qs, weights)
+			turn <- struct{}{}
+			if errors.Is(err, errQueueRenamed) {
+				// the worker must reconnect with the new name
+				_ = c.Error("SUBSCRIBE", ErrCodeQueueRenamed, err)
+				if rb, ok := c.conn.(*replyBuffer); ok {
+					_ = rb.Flush()
+				}
+				return
+			}
+			if err != nil {
+				s.logger().Error("Unable to reserve job for subscriber", err, map[string]interface{}{"wid": c.client.Wid})
+				time.Sleep(deliverRetryInterval)
+			}
+			if j != nil {
+				jid = j.Jid
+				job, err = json.Marshal(c.namespace().jobForClient(j))
+				if err != nil {
+					s.logger().Error("Unable to deliver job to subscriber", err, map[string]interface{}{"wid": c.client.Wid, "jid": jid})
+					return
+				}
+			}
+		}
+		if job == nil {
+			// nothing was sent, keep the credit
+			sub.refund()
+			continue
+		}
+
+		sub.delivered(jid)
+		err := c.Push("job", job)
+		if err == nil {
+			if rb, ok := c.conn.(*replyBuffer); ok {
+				err = rb.Flush()
+			}
+		}
+		if err != nil {
+			// the reservation expires and the job is retried
+			s.logger().Error("Unable to deliver job to subscriber", err, map[string]interface{}{"wid": c.client.Wid, "jid": jid})
+			return
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribeErrors(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{}
+
+	c := dummyConnection()
+	c.client.Wid = ""
+	subscribe(c, s, "SUBSCRIBE default")
+	assert.Contains(t, output(c), "ERR_INVALID_ARGUMENT Only consumers")
+	assert.Nil(t, c.sub)
+
+	c = dummyConnection()
+	subscribe(c, s, "SUBSCRIBE default:heavy")
+	assert.Contains(t, output(c), "ERR_INVALID_FORMAT")
+	assert.Nil(t, c.sub)
+
+	c = dummyConnection()
+	c.sub = newSubscription()
+	subscribe(c, s, "SUBSCRIBE default")
+	assert.Contains(t, output(c), "already subscribed")
+}
+
+func TestSubscribeCredits(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{}
+	c := dummyConnection()
+	credit(c, s, "CREDIT 5")
+	assert.Contains(t, output(c), "not subscribed")
+
+	c = dummyConnection()
+	c.sub = newSubscription()
+	assert.Equal(t, 1, len(c.sub.credits))
+
+	// a job sent uses a credit until it's acknowledged
+	<-c.sub.credits
+	c.sub.delivered("abc123456789")
+	c.jobFinished("somethingelse")
+	assert.Equal(t, 0, len(c.sub.credits))
+	c.jobFinished("abc123456789")
+	assert.Equal(t, 1, len(c.sub.credits))
+	c.jobFinished("abc123456789")
+	assert.Equal(t, 1, len(c.sub.credits))
+
+	credit(c, s, "CREDIT 4")
+	assert.Equal(t, 5, len(c.sub.credits))
+	credit(c, s, "CREDIT zero")
+	assert.Contains(t, output(c), "ERR_INVALID_FORMAT")
+	credit(c, s, "CREDIT 996")
+	assert.Contains(t, output(c), "at most 1000 credits")
+	assert.Equal(t, 5, len(c.sub.credits))
+}
+
+func TestPushFrame(t *testing.T) {
+	t.Parallel()
+
+	c := dummyConnection()
+	assert.NoError(t, c.Push("job", []byte(`{"jid":"abc"}`)))
+	assert.Equal(t, ">2\r\n$3\r\njob\r\n$13\r\n{\"jid\":\"abc\"}\r\n", output(c))
+}
@@ -1,7 +1,10 @@
 package server
 
 import (
+	"fmt"
 	"math/rand"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -19,11 +22,15 @@ import (
  */
 type taskRunner struct {
 	tasks []*task
+	// how often the runner cycles, tasks run every N ticks
+	tick time.Duration
 
 	walltimeNs int64
 	cycles     int64
 	executions int64
-	mutex      sync.RWMutex
+	// UnixNano of the most recent cycle, see stalled
+	lastCycle int64
+	mutex     sync.RWMutex
 }
 
 type task struct {
@@ -40,8 +47,13 @@ type Taskable interface {
 }
 
 func newTaskRunner() *taskRunner {
+	return newTaskRunnerEvery(1 * time.Second)
+}
+
+func newTaskRunnerEvery(tick time.Duration) *taskRunner {
 	return &taskRunner{
 		tasks: make([]*task, 0),
+		tick:  tick,
 	}
 }
 
@@ -55,10 +67,11 @@ func (ts *taskRunner) AddTask(sec int64, thing Taskable) {
 }
 
 func (ts *taskRunner) Run(stopper chan bool) {
+	atomic.StoreInt64(&ts.lastCycle, time.Now().UnixNano())
 	go func() {
 		// add random jitter so the runner goroutine doesn't fire at 000ms
-		time.Sleep(time.Duration(rand.Float64()) * time.Second)
-		timer := time.NewTicker(1 * time.Second)
+		time.Sleep(time.Duration(rand.Float64() * float64(ts.tick)))
+		timer := time.NewTicker(ts.tick)
 		defer timer.Stop()
 
 		for {
@@ -73,6 +86,13 @@ func (ts *taskRunner) Run(stopper chan bool) {
 	}()
 }
 
+// Whether the runner has gone more than +timeout+ without starting a
+// cycle, i.e. it has stopped or a task is stuck.
+func (ts *taskRunner) stalled(timeout time.Duration) bool {
+	last := time.Unix(0, atomic.LoadInt64(&ts.lastCycle))
+	return time.Since(last) > timeout
+}
+
 func (ts *taskRunner) Stats() map[string]map[string]interface{} {
 	data := map[string]map[string]interface{}{}
 
@@ -87,9 +107,11 @@ func (ts *taskRunner) Stats() map[string]map[string]interface{} {
 func (ts *taskRunner) cycle() {
 	count := int64(0)
 	start := time.Now()
-	sec := start.Unix()
+	// whole seconds for the default runner
+	sec := start.UnixNano() / int64(ts.tick)
 	ts.mutex.RLock()
 	defer ts.mutex.RUnlock()
+	atomic.StoreInt64(&ts.lastCycle, start.UnixNano())
 	for _, t := range ts.tasks {
 		if sec%t.every != 0 {
 			continue
@@ -114,15 +136,57 @@ func (ts *taskRunner) cycle() {
 func (s *Server) startTasks() {
 	ts := newTaskRunner()
 	// scan the various sets, looking for things to do
-	ts.AddTask(5, &scanner{name: "Scheduled", set: s.store.Scheduled(), task: s.manager.EnqueueScheduledJobs})
-	ts.AddTask(5, &scanner{name: "Retries", set: s.store.Retries(), task: s.manager.RetryJobs})
-	ts.AddTask(60, &scanner{name: "Dead", set: s.store.Dead(), task: s.manager.Purge})
+	ts.AddTask(60, &scanner{name: "Dead", set: s.store.Dead(), task: s.purgeDead})
+	ts.AddTask(5, &recurringScheduler{s.manager, 0})
+	if s.Options.jobHistoryRetention() > 0 {
+		ts.AddTask(60, &scanner{name: "History", set: s.store.Completed(), task: s.purgeHistory})
+	}
+
+	// dead-letters jobs which waited too long for their depends_on
+	ts.AddTask(60, &scanner{name: "Waiting", set: s.store.Waiting(), task: s.manager.ExpireWaitingJobs})
 
 	// reaps job reservations which have expired
 	ts.AddTask(15, &reservationReaper{s.manager, 0})
 	// reaps workers who have not heartbeated
-	ts.AddTask(15, &beatReaper{s.workers, 0})
+	ts.AddTask(s.Options.heartbeatReapSeconds(), &beatReaper{w: s.workers, timeout: s.Options.heartbeatTimeout(), m: s.manager})
+	// samples counters and queue sizes for STATS
+	ts.AddTask(60, &statsSampler{s})
 
 	ts.Run(s.Stopper())
 	s.taskRunner = ts
+
+	// the scheduled and retry sets are scanned on their own interval
+	sched := newTaskRunnerEvery(s.Options.schedulerInterval())
+	sched.AddTask(1, &scanner{name: "Scheduled", set: s.store.Scheduled(), task: s.manager.EnqueueScheduledJobs})
+	sched.AddTask(1, &scanner{name: "Retries", set: s.store.Retries(), task: s.manager.RetryJobs})
+	sched.Run(s.Stopper())
+	s.scheduler = sched
+}
+
+func (s *Server) taskStats() map[string]map[string]interface{} {
+	stats := s.taskRunner.Stats()
+	for name, data := range s.scheduler.Stats() {
+		stats[name] = data
+	}
+	return stats
+}
+
+// RESIZE_POOL 8
+//
+// Set how many goroutines push due scheduled and retrying jobs, see
+// Options.SchedulerWorkers.  A scan in progress picks up the new size.
+func resizePool(c *Connection, s *Server, cmd string) {
+	args := strings.Split(cmd, " ")[1:]
+	if len(args) != 1 {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 || n > MaxSchedulerWorkers {
+		_ = c.Error(cmd, ErrCodeInvalidArgument, fmt.Errorf("Invalid pool size %s, must be 1 to %d", args[0], MaxSchedulerWorkers))
+		return
+	}
+	s.manager.SetSchedulerWorkers(n)
+	s.logger().Info("Resized scheduler pool", map[string]interface{}{"workers": n})
+	_ = c.Ok()
 }
@@ -34,11 +34,15 @@ func (r *reservationReaper) Stats() map[string]interface{} {
 }
 
 /*
- * Removes any heartbeat records over 1 minute old.
+ * Removes any heartbeat records older than HeartbeatTimeout,
+ * 1 minute by default.
  */
 type beatReaper struct {
-	w     *workers
-	count int64
+	w       *workers
+	count   int64
+	timeout time.Duration
+	// requeues the jobs of drained processes which expired
+	m manager.Manager
 }
 
 func (r *beatReaper) Name() string {
@@ -46,8 +50,13 @@ func (r *beatReaper) Name() string {
 }
 
 func (r *beatReaper) Execute() error {
-	count := r.w.reapHeartbeats(time.Now().Add(-1 * time.Minute))
+	count, drained := r.w.reapHeartbeats(time.Now().Add(-r.timeout))
 	atomic.AddInt64(&r.count, int64(count))
+	for _, wid := range drained {
+		if _, err := r.m.RequeueWorker(wid); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -57,3 +66,31 @@ func (r *beatReaper) Stats() map[string]interface{} {
 		"reaped": atomic.LoadInt64(&r.count),
 	}
 }
+
+/*
+ * Pushes recurring jobs registered with SCHEDULE when they come due.
+ */
+type recurringScheduler struct {
+	m     manager.Manager
+	count int64
+}
+
+func (r *recurringScheduler) Name() string {
+	return "Recurring"
+}
+
+func (r *recurringScheduler) Execute() error {
+	count, err := r.m.EnqueueRecurringJobs(time.Now())
+	if err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&r.count, count)
+	return nil
+}
+
+func (r *recurringScheduler) Stats() map[string]interface{} {
+	return map[string]interface{}{
+		"enqueued": atomic.LoadInt64(&r.count),
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/manager"
+)
+
+var errNoSuchTemplate = errors.New("no such template")
+
+// Jobs which share most of their args, e.g. a large config hash, can
+// push it once with PUSH_TEMPLATE and name the template's JID as their
+// "base_jid".  The job's args are merged over the template's as it's
+// pushed, so it's stored and fetched like any other job.
+func (s *Server) expandTemplate(next func() error, ctx manager.Context) error {
+	job := ctx.Job()
+	if job.BaseJid == "" {
+		return next()
+	}
+
+	tmpl, err := s.store.Template(job.BaseJid)
+	if err != nil {
+		return err
+	}
+	if tmpl == nil {
+		return fmt.Errorf("%w %s", errNoSuchTemplate, job.BaseJid)
+	}
+	job.Args = mergeArgs(tmpl.Args, job.Args)
+	return next()
+}
+
+// Each arg replaces the base arg at the same position, except that
+// when both are hashes the arg's keys are merged over the base's.
+// Args beyond the end of the base are appended.
+func mergeArgs(base, args []interface{}) []interface{} {
+	merged := make([]interface{}, len(base), len(base)+len(args))
+	copy(merged, base)
+	for idx, arg := range args {
+		if idx >= len(merged) {
+			merged = append(merged, arg)
+			continue
+		}
+		bhash, bok := merged[idx].(map[string]interface{})
+		hash, ok := arg.(map[string]interface{})
+		if !bok || !ok {
+			merged[idx] = arg
+			continue
+		}
+		combined := make(map[string]interface{}, len(bhash)+len(hash))
+		for k, v := range bhash {
+			combined[k] = v
+		}
+		for k, v := range hash {
+			combined[k] = v
+		}
+		merged[idx] = combined
+	}
+	return merged
+}
+
+// PUSH_TEMPLATE {"jid":"123861239abnadsa","args":[{"config":...}]}
+//
+// Save a template for jobs to inherit args from, responds with its JID
+// which is generated if missing.  Pushing a template with the same JID
+// replaces it.
+func pushTemplate(c *Connection, s *Server, cmd string) {
+	data := strings.TrimPrefix(cmd, "PUSH_TEMPLATE ")
+	if err := s.checkPayloadSize(len(data)); err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+
+	var tmpl client.Job
+	err := json.Unmarshal([]byte(data), &tmpl)
+	if err != nil {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid JSON: %w", err))
+		return
+	}
+	if tmpl.Args == nil {
+		_ = c.Error(cmd, ErrCodeInvalidArgument, fmt.Errorf("Templates must have an args parameter"))
+		return
+	}
+	s.assignJid(&tmpl)
+	if tmpl.Jid == "" {
+		tmpl.Jid = client.RandomJid()
+	}
+
+	err = s.store.PushTemplate(&tmpl)
+	if err != nil {
+		_ = c.Error(cmd, errorCode(err), err)
+		return
+	}
+	_, _ = c.conn.Write([]byte("+OK " + tmpl.Jid + "\r\n"))
+}
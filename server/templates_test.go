@@ -0,0 +1,32 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeArgs(t *testing.T) {
+	t.Parallel()
+
+	base := []interface{}{
+		map[string]interface{}{"config": "large", "region": "us"},
+		"report",
+	}
+
+	merged := mergeArgs(base, []interface{}{map[string]interface{}{"user": 5.0, "region": "eu"}})
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"config": "large", "region": "eu", "user": 5.0},
+		"report",
+	}, merged)
+
+	merged = mergeArgs(base, []interface{}{"replaced", "summary", 3.0})
+	assert.Equal(t, []interface{}{"replaced", "summary", 3.0}, merged)
+
+	assert.Equal(t, base, mergeArgs(base, []interface{}{}))
+	assert.Equal(t, []interface{}{1.0}, mergeArgs(nil, []interface{}{1.0}))
+
+	// the template is never modified
+	assert.Equal(t, map[string]interface{}{"config": "large", "region": "us"}, base[0])
+	assert.Equal(t, "report", base[1])
+}
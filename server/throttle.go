@@ -0,0 +1,118 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/manager"
+)
+
+// A throttle caps the jobs being worked across the whole server, e.g.
+// when they all share a database which allows 10 connections.  FETCH
+// takes a slot before fetching a job, the slot is held by the job
+// until it's acknowledged or fails.  A job which leaves the working set
+// some other way, e.g. REQUEUE, gives its slot back the next time the
+// throttle is full.
+type throttle struct {
+	mu sync.Mutex
+	// zero when unlimited
+	limit int
+	// the slots taken, by FETCHes in progress and the jobs in held
+	inUse int
+	// the jobs holding slots
+	held map[string]bool
+}
+
+// Zero removes the limit.  Jobs already holding slots keep them, so
+// lowering the limit takes effect as they finish.
+func (t *throttle) setLimit(limit int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if limit <= 0 {
+		t.limit = 0
+		t.inUse = 0
+		t.held = nil
+		return
+	}
+	t.limit = limit
+	if t.held == nil {
+		t.held = map[string]bool{}
+	}
+}
+
+func (t *throttle) usage() (int, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limit, t.inUse
+}
+
+// Take a slot, false if they're all in use.  reserved reports whether
+// a job is still being worked.
+func (t *throttle) acquire(reserved func(jid string) bool) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.limit == 0 {
+		return true
+	}
+
+	if t.inUse >= t.limit {
+		for jid := range t.held {
+			if !reserved(jid) {
+				t.releaseLocked(jid)
+			}
+		}
+	}
+	if t.inUse >= t.limit {
+		return false
+	}
+	t.inUse++
+	return true
+}
+
+// Called once FETCH is done with the slot it acquired: the fetched job
+// holds it, without a job it's released.
+func (t *throttle) settle(job *client.Job) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.limit == 0 {
+		return
+	}
+	if job == nil {
+		t.free()
+		return
+	}
+	t.held[job.Jid] = true
+}
+
+func (t *throttle) release(jid string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.releaseLocked(jid)
+}
+
+func (t *throttle) releaseLocked(jid string) {
+	if !t.held[jid] {
+		return
+	}
+	delete(t.held, jid)
+	t.free()
+}
+
+// A FETCH which acquired its slot before the limit was set didn't
+// take one.
+func (t *throttle) free() {
+	if t.inUse > 0 {
+		t.inUse--
+	}
+}
+
+func (s *Server) reserved(jid string) bool {
+	return s.manager.FindReservation(jid) != nil
+}
+
+// Registered for ACK and FAIL.
+func (s *Server) releaseThrottle(next func() error, ctx manager.Context) error {
+	defer s.throttle.release(ctx.Job().Jid)
+	return next()
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottle(t *testing.T) {
+	t.Parallel()
+
+	working := map[string]bool{}
+	reserved := func(jid string) bool { return working[jid] }
+	fetch := func(t *throttle) string {
+		if !t.acquire(reserved) {
+			return ""
+		}
+		job := client.NewJob("SomeJob")
+		working[job.Jid] = true
+		t.settle(job)
+		return job.Jid
+	}
+
+	var th throttle
+	// unlimited by default
+	assert.True(t, th.acquire(reserved))
+	th.settle(nil)
+	limit, inUse := th.usage()
+	assert.Equal(t, 0, limit)
+	assert.Equal(t, 0, inUse)
+
+	th.setLimit(2)
+	first := fetch(&th)
+	second := fetch(&th)
+	assert.NotEmpty(t, first)
+	assert.NotEmpty(t, second)
+	assert.Empty(t, fetch(&th))
+	limit, inUse = th.usage()
+	assert.Equal(t, 2, limit)
+	assert.Equal(t, 2, inUse)
+
+	// ACK or FAIL frees the slot
+	delete(working, first)
+	th.release(first)
+	third := fetch(&th)
+	assert.NotEmpty(t, third)
+
+	// a job which left the working set some other way, e.g. REQUEUE
+	delete(working, second)
+	assert.NotEmpty(t, fetch(&th))
+
+	// a fetch which found no job doesn't hold a slot
+	th.release(third)
+	assert.True(t, th.acquire(reserved))
+	th.settle(nil)
+	_, inUse = th.usage()
+	assert.Equal(t, 1, inUse)
+
+	// lowering the limit keeps the slots in use
+	th.setLimit(1)
+	_, inUse = th.usage()
+	assert.Equal(t, 1, inUse)
+	assert.Empty(t, fetch(&th))
+
+	th.setLimit(0)
+	assert.NotEmpty(t, fetch(&th))
+}
+
+func TestThrottleLowerLimit(t *testing.T) {
+	t.Parallel()
+
+	working := map[string]bool{}
+	reserved := func(jid string) bool { return working[jid] }
+	var jids []string
+
+	var th throttle
+	th.setLimit(3)
+	for idx := 0; idx < 3; idx++ {
+		assert.True(t, th.acquire(reserved))
+		job := client.NewJob("SomeJob")
+		working[job.Jid] = true
+		th.settle(job)
+		jids = append(jids, job.Jid)
+	}
+
+	// the three jobs keep their slots, a fourth waits until only one
+	// is left
+	th.setLimit(1)
+	limit, inUse := th.usage()
+	assert.Equal(t, 1, limit)
+	assert.Equal(t, 3, inUse)
+	assert.False(t, th.acquire(reserved))
+
+	delete(working, jids[0])
+	th.release(jids[0])
+	assert.False(t, th.acquire(reserved))
+	_, inUse = th.usage()
+	assert.Equal(t, 2, inUse)
+
+	delete(working, jids[1])
+	th.release(jids[1])
+	assert.False(t, th.acquire(reserved))
+
+	delete(working, jids[2])
+	th.release(jids[2])
+	assert.True(t, th.acquire(reserved))
+	assert.False(t, th.acquire(reserved))
+
+	// raising it again hands out the difference
+	th.setLimit(3)
+	assert.True(t, th.acquire(reserved))
+	assert.True(t, th.acquire(reserved))
+	assert.False(t, th.acquire(reserved))
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/contribsys/faktory/manager"
+)
+
+// The jobs fetched from each queue in the last complete minute, for
+// autoscalers such as Kubernetes' HPA to scale workers on.
+type throughputTracker struct {
+	mu sync.Mutex
+	// the minute since the epoch being counted
+	minute  int64
+	current map[string]int64
+	last    map[string]int64
+}
+
+type QueueThroughput struct {
+	JobsPerMinute int64 `json:"jobs_per_minute"`
+}
+
+// Counts are kept per wall clock minute and rolled over lazily, so a
+// minute without fetches reads as zero without a timer.
+func (tt *throughputTracker) roll(now time.Time) {
+	minute := now.Unix() / 60
+	if minute == tt.minute {
+		return
+	}
+	if minute == tt.minute+1 {
+		tt.last = tt.current
+	} else {
+		tt.last = nil
+	}
+	tt.current = nil
+	tt.minute = minute
+}
+
+func (tt *throughputTracker) record(queue string, now time.Time) {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	tt.roll(now)
+	if tt.current == nil {
+		tt.current = map[string]int64{}
+	}
+	tt.current[queue]++
+}
+
+func (tt *throughputTracker) perMinute(queue string, now time.Time) int64 {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	tt.roll(now)
+	return tt.last[queue]
+}
+
+// Every queue fetched from in the last complete minute.
+func (tt *throughputTracker) rates(now time.Time) map[string]QueueThroughput {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	tt.roll(now)
+	result := make(map[string]QueueThroughput, len(tt.last))
+	for name, count := range tt.last {
+		result[name] = QueueThroughput{JobsPerMinute: count}
+	}
+	return result
+}
+
+func (s *Server) trackThroughput(next func() error, ctx manager.Context) error {
+	err := next()
+	if err != nil {
+		return err
+	}
+	s.throughput.record(ctx.Job().Queue, time.Now())
+	return nil
+}
+
+// THROUGHPUT <queue>
+//
+// The number of jobs fetched from the queue in the last complete
+// minute.
+func throughput(c *Connection, s *Server, cmd string) {
+	parts := strings.Split(cmd, " ")
+	if len(parts) != 2 || parts[1] == "" {
+		_ = c.Error(cmd, ErrCodeInvalidFormat, fmt.Errorf("Invalid format"))
+		return
+	}
+	name := c.namespace().queue(parts[1])
+	_ = c.Number(int(s.throughput.perMinute(name, time.Now())))
+}
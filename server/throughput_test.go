@@ -0,0 +1,38 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThroughputTracker(t *testing.T) {
+	t.Parallel()
+
+	var tt throughputTracker
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		tt.record("default", start.Add(time.Duration(i)*time.Second))
+	}
+	tt.record("critical", start.Add(59*time.Second))
+	// the minute isn't complete yet
+	assert.EqualValues(t, 0, tt.perMinute("default", start.Add(59*time.Second)))
+
+	next := start.Add(time.Minute)
+	tt.record("default", next)
+	assert.EqualValues(t, 3, tt.perMinute("default", next))
+	assert.EqualValues(t, 1, tt.perMinute("critical", next))
+	assert.EqualValues(t, 0, tt.perMinute("bulk", next))
+	assert.Equal(t, map[string]QueueThroughput{
+		"default":  {JobsPerMinute: 3},
+		"critical": {JobsPerMinute: 1},
+	}, tt.rates(next))
+
+	assert.EqualValues(t, 1, tt.perMinute("default", next.Add(time.Minute)))
+
+	// a minute without fetches
+	assert.EqualValues(t, 0, tt.perMinute("default", next.Add(3*time.Minute)))
+	assert.Empty(t, tt.rates(next.Add(3*time.Minute)))
+}
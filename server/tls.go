@@ -0,0 +1,41 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// TLS is enabled when both TLSCertFile and TLSKeyFile are set.
+func (so *ServerOptions) TLSEnabled() bool {
+	return so.TLSCertFile != "" && so.TLSKeyFile != ""
+}
+
+// Build the tls.Config for the command port.  If TLSCAFile is
+// set, clients must present a certificate signed by that CA (mutual TLS).
+func tlsConfig(opts *ServerOptions) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(opts.TLSCertFile, opts.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load TLS keypair: %w", err)
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if opts.TLSCAFile != "" {
+		data, err := ioutil.ReadFile(opts.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read TLS CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no valid certificates in %s", opts.TLSCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().Add(1 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	kder, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	assert.NoError(t, err)
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder}), 0600)
+	assert.NoError(t, err)
+	return certFile, keyFile
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "faktory-tls")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	opts := &ServerOptions{}
+	assert.False(t, opts.TLSEnabled())
+
+	opts.TLSCertFile = filepath.Join(dir, "missing.pem")
+	opts.TLSKeyFile = filepath.Join(dir, "missing.key")
+	assert.True(t, opts.TLSEnabled())
+	_, err = tlsConfig(opts)
+	assert.Error(t, err)
+
+	opts.TLSCertFile, opts.TLSKeyFile = writeTestCert(t, dir)
+	cfg, err := tlsConfig(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(cfg.Certificates))
+	assert.Equal(t, tls.NoClientCert, cfg.ClientAuth)
+
+	opts.TLSCAFile = opts.TLSCertFile
+	cfg, err = tlsConfig(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, cfg.ClientAuth)
+	assert.NotNil(t, cfg.ClientCAs)
+
+	opts.TLSCAFile = opts.TLSKeyFile
+	_, err = tlsConfig(opts)
+	assert.Error(t, err)
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/manager"
+)
+
+// A TracerProvider hands out the Tracer which records spans for each
+// job's lifecycle in the server: "faktory.push", "faktory.pop",
+// "faktory.ack" and "faktory.fail".  Trace context travels with the
+// job as a W3C traceparent in its "traceparent" custom field: a
+// producer may set it to continue its own trace, and PUSH replaces it
+// with the push span's so the worker's span can be a child of it.
+//
+// Faktory doesn't depend on a tracing library.  TracerProvider follows
+// the shape of OpenTelemetry's so an application exporting to it wraps
+// its trace.TracerProvider: Tracer(name) returns tp.Tracer(name), and
+// StartSpan extracts parent with propagation.TraceContext, starts the
+// span and injects its context back into a traceparent.
+type TracerProvider interface {
+	Tracer(name string) Tracer
+}
+
+type Tracer interface {
+	// Start a span, the child of parent if it's a valid traceparent.
+	StartSpan(name string, parent string, attrs map[string]string) Span
+}
+
+type Span interface {
+	// The span's context as a W3C traceparent.
+	TraceParent() string
+	// End the span, marking it failed if err isn't nil.
+	End(err error)
+}
+
+const traceParentField = "traceparent"
+
+const tracerName = "github.com/contribsys/faktory"
+
+func (s *Server) enableTracing() {
+	tp := s.Options.TracerProvider
+	if tp == nil {
+		return
+	}
+
+	tracer := tp.Tracer(tracerName)
+	s.manager.AddMiddleware("push", tracePush(tracer))
+	s.manager.AddMiddleware("fetch", traceStep(tracer, "faktory.pop"))
+	s.manager.AddMiddleware("ack", traceStep(tracer, "faktory.ack"))
+	s.manager.AddMiddleware("fail", traceStep(tracer, "faktory.fail"))
+}
+
+func tracePush(tracer Tracer) manager.MiddlewareFunc {
+	return func(next func() error, ctx manager.Context) error {
+		job := ctx.Job()
+		span := tracer.StartSpan("faktory.push", traceParent(job), spanAttributes(job))
+		job.SetCustom(traceParentField, span.TraceParent())
+		err := next()
+		span.End(err)
+		return err
+	}
+}
+
+func traceStep(tracer Tracer, name string) manager.MiddlewareFunc {
+	return func(next func() error, ctx manager.Context) error {
+		job := ctx.Job()
+		span := tracer.StartSpan(name, traceParent(job), spanAttributes(job))
+		err := next()
+		span.End(err)
+		return err
+	}
+}
+
+func traceParent(job *client.Job) string {
+	val, ok := job.GetCustom(traceParentField)
+	if !ok {
+		return ""
+	}
+	tp, _ := val.(string)
+	return tp
+}
+
+func spanAttributes(job *client.Job) map[string]string {
+	return map[string]string{
+		"faktory.jid":     job.Jid,
+		"faktory.jobtype": job.Type,
+		"faktory.queue":   job.Queue,
+	}
+}
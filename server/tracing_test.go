@@ -0,0 +1,68 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/stretchr/testify/assert"
+)
+
+type testSpan struct {
+	name   string
+	parent string
+	id     string
+	err    error
+	ended  bool
+}
+
+func (ts *testSpan) TraceParent() string {
+	return ts.id
+}
+
+func (ts *testSpan) End(err error) {
+	ts.err = err
+	ts.ended = true
+}
+
+type testTracer struct {
+	spans []*testSpan
+}
+
+func (tt *testTracer) Tracer(name string) Tracer {
+	return tt
+}
+
+func (tt *testTracer) StartSpan(name string, parent string, attrs map[string]string) Span {
+	span := &testSpan{name: name, parent: parent, id: fmt.Sprintf("00-%032x-%016x-01", 1, len(tt.spans)+1)}
+	tt.spans = append(tt.spans, span)
+	return span
+}
+
+func TestTracing(t *testing.T) {
+	t.Parallel()
+
+	tp := &testTracer{}
+	tracer := tp.Tracer(tracerName)
+	job := client.NewJob("Report")
+	producer := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	job.SetCustom("traceparent", producer)
+
+	err := tracePush(tracer)(func() error { return nil }, jobContext{job: job})
+	assert.NoError(t, err)
+	push := tp.spans[0]
+	assert.Equal(t, "faktory.push", push.name)
+	assert.Equal(t, producer, push.parent)
+	assert.True(t, push.ended)
+	// the worker continues from the push span
+	assert.Equal(t, push.id, traceParent(job))
+
+	boom := fmt.Errorf("boom")
+	err = traceStep(tracer, "faktory.fail")(func() error { return boom }, jobContext{job: job})
+	assert.Equal(t, boom, err)
+	fail := tp.spans[1]
+	assert.Equal(t, "faktory.fail", fail.name)
+	assert.Equal(t, push.id, fail.parent)
+	assert.Equal(t, boom, fail.err)
+	assert.Equal(t, push.id, traceParent(job))
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// How long the traffic of a process which has gone is still reported.
+const departedTrafficTTL = 24 * time.Hour
+
+// Bytes sent and received by a worker process over all of its
+// connections, so shared servers can charge each team for its traffic.
+// Closed connections still count, and a process which has gone is
+// reported for departedTrafficTTL.  The process's hostname and PID,
+// from HELLO, let operators find it.
+type WorkerTraffic struct {
+	Hostname     string `json:"hostname"`
+	Pid          int    `json:"pid"`
+	BytesRead    int64  `json:"bytes_read"`
+	BytesWritten int64  `json:"bytes_written"`
+
+	namespace string
+}
+
+// The traffic of a process which has gone, w.mu guards it.
+type departedTraffic struct {
+	WorkerTraffic
+	at time.Time
+}
+
+// Forget the process, keeping its traffic.  Its open connections add
+// theirs as they close.  w.mu must be held.
+func (w *workers) depart(wid string) {
+	cd := w.heartbeats[wid]
+	delete(w.heartbeats, wid)
+	dt := w.departed[wid]
+	if dt == nil {
+		dt = &departedTraffic{}
+		w.departed[wid] = dt
+	}
+	dt.Hostname = cd.Hostname
+	dt.Pid = cd.Pid
+	dt.namespace = cd.Namespace
+	dt.BytesRead += cd.closedRead
+	dt.BytesWritten += cd.closedWritten
+	dt.at = time.Now()
+}
+
+// w.mu must be held.
+func (w *workers) closedAfterDeparture(c *Connection) {
+	dt := w.departed[c.client.Wid]
+	if dt == nil {
+		return
+	}
+	dt.BytesRead += atomic.LoadInt64(&c.BytesRead)
+	dt.BytesWritten += atomic.LoadInt64(&c.BytesWritten)
+}
+
+// w.mu must be held.
+func (w *workers) pruneDeparted(now time.Time) {
+	for wid, dt := range w.departed {
+		if now.Sub(dt.at) > departedTrafficTTL {
+			delete(w.departed, wid)
+		}
+	}
+}
+
+// Counts the bytes read from and written to the network into the
+// Connection, including the handshake.
+type countingConn struct {
+	net.Conn
+	read    *int64
+	written *int64
+}
+
+func (cc *countingConn) Read(p []byte) (int, error) {
+	n, err := cc.Conn.Read(p)
+	atomic.AddInt64(cc.read, int64(n))
+	return n, err
+}
+
+func (cc *countingConn) Write(p []byte) (int, error) {
+	n, err := cc.Conn.Write(p)
+	atomic.AddInt64(cc.written, int64(n))
+	return n, err
+}
+
+// The traffic of each worker process by WID.
+func (w *workers) traffic() map[string]WorkerTraffic {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	result := make(map[string]WorkerTraffic, len(w.heartbeats)+len(w.departed))
+	for wid, dt := range w.departed {
+		result[wid] = dt.WorkerTraffic
+	}
+	for wid, worker := range w.heartbeats {
+		wt := WorkerTraffic{
+			Hostname:     worker.Hostname,
+			Pid:          worker.Pid,
+			BytesRead:    worker.closedRead,
+			BytesWritten: worker.closedWritten,
+			namespace:    worker.Namespace,
+		}
+		for conn := range worker.connections {
+			if c, ok := conn.(*Connection); ok {
+				wt.BytesRead += atomic.LoadInt64(&c.BytesRead)
+				wt.BytesWritten += atomic.LoadInt64(&c.BytesWritten)
+			}
+		}
+		// a process which reconnected with the same WID
+		if dt, ok := w.departed[wid]; ok {
+			wt.BytesRead += dt.BytesRead
+			wt.BytesWritten += dt.BytesWritten
+		}
+		result[wid] = wt
+	}
+	return result
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerTraffic(t *testing.T) {
+	t.Parallel()
+
+	server, client := net.Pipe()
+	defer client.Close()
+	first := &Connection{client: &ClientData{Wid: "w1", Namespace: "acme", Hostname: "worker-1.example.com", Pid: 4321}}
+	cc := &countingConn{Conn: server, read: &first.BytesRead, written: &first.BytesWritten}
+
+	go func() {
+		_, _ = client.Write([]byte("BEAT\r\n"))
+		buf := make([]byte, 5)
+		_, _ = client.Read(buf)
+	}()
+	buf := make([]byte, 6)
+	_, err := cc.Read(buf)
+	assert.NoError(t, err)
+	_, err = cc.Write([]byte("+OK\r\n"))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 6, first.BytesRead)
+	assert.EqualValues(t, 5, first.BytesWritten)
+
+	second := &Connection{client: first.client, BytesRead: 100, BytesWritten: 200}
+	w := newWorkers()
+	w.setupHeartbeat(first.client, first)
+	w.setupHeartbeat(second.client, second)
+	assert.Equal(t, map[string]WorkerTraffic{
+		"w1": {Hostname: "worker-1.example.com", Pid: 4321, BytesRead: 106, BytesWritten: 205, namespace: "acme"},
+	}, w.traffic())
+
+	// a closed connection still counts
+	w.RemoveConnection(first)
+	second.BytesRead++
+	assert.Equal(t, map[string]WorkerTraffic{
+		"w1": {Hostname: "worker-1.example.com", Pid: 4321, BytesRead: 107, BytesWritten: 205, namespace: "acme"},
+	}, w.traffic())
+
+	// and the process's totals once it has gone
+	w.RemoveConnection(second)
+	assert.Equal(t, map[string]WorkerTraffic{
+		"w1": {Hostname: "worker-1.example.com", Pid: 4321, BytesRead: 107, BytesWritten: 205, namespace: "acme"},
+	}, w.traffic())
+
+	// until they expire
+	w.pruneDeparted(time.Now().Add(departedTrafficTTL + time.Minute))
+	assert.Empty(t, w.traffic())
+}
+
+func TestDrainedWorkerTraffic(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	conn := &Connection{
+		client:       &ClientData{Wid: "w2", Hostname: "worker-2.example.com", Pid: 99},
+		conn:         &TestingWriteCloser{Writer: bufio.NewWriter(buf), output: buf},
+		BytesRead:    10,
+		BytesWritten: 20,
+	}
+	w := newWorkers()
+	w.setupHeartbeat(conn.client, conn)
+	assert.True(t, w.drain("w2"))
+
+	// the drained connection closes afterwards
+	w.RemoveConnection(conn)
+	assert.Equal(t, map[string]WorkerTraffic{
+		"w2": {Hostname: "worker-2.example.com", Pid: 99, BytesRead: 10, BytesWritten: 20},
+	}, w.traffic())
+}
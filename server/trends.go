@@ -0,0 +1,115 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/contribsys/faktory/util"
+)
+
+// The number of one-minute samples kept for STATS.
+const statsSamples = 60
+
+type StatsSample struct {
+	At        string `json:"at"`
+	Processed int64  `json:"processed"`
+	Failures  int64  `json:"failures"`
+	// queue name -> size
+	Queues map[string]int64 `json:"queues"`
+}
+
+// The most recent samples, once full the oldest sample is overwritten.
+type statsHistory struct {
+	mu      sync.Mutex
+	samples []StatsSample
+	next    int
+}
+
+func (sh *statsHistory) record(sample StatsSample) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if len(sh.samples) < statsSamples {
+		sh.samples = append(sh.samples, sample)
+		return
+	}
+	sh.samples[sh.next] = sample
+	sh.next = (sh.next + 1) % statsSamples
+}
+
+// Up to +count+ of the newest samples, oldest first.
+func (sh *statsHistory) recent(count int) []StatsSample {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	ordered := make([]StatsSample, 0, len(sh.samples))
+	ordered = append(ordered, sh.samples[sh.next:]...)
+	ordered = append(ordered, sh.samples[:sh.next]...)
+	if count < len(ordered) {
+		ordered = ordered[len(ordered)-count:]
+	}
+	return ordered
+}
+
+func (sh *statsHistory) reset() {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	sh.samples = nil
+	sh.next = 0
+}
+
+func (sh *statsHistory) size() int {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return len(sh.samples)
+}
+
+/*
+ * Samples the processed and failure counters and the queue sizes
+ * every minute for STATS.
+ */
+type statsSampler struct {
+	s *Server
+}
+
+func (ss *statsSampler) Name() string {
+	return "Stats"
+}
+
+func (ss *statsSampler) Execute() error {
+	queues, err := ss.s.queueSizes()
+	if err != nil {
+		return err
+	}
+	ss.s.trends.record(StatsSample{
+		At:        util.Nows(),
+		Processed: int64(ss.s.store.TotalProcessed()),
+		Failures:  int64(ss.s.store.TotalFailures()),
+		Queues:    queues,
+	})
+	return nil
+}
+
+func (ss *statsSampler) Stats() map[string]interface{} {
+	return map[string]interface{}{
+		"size": ss.s.trends.size(),
+	}
+}
+
+// Only the namespace's queues, named as the client knows them.
+func (ns namespace) samples(all []StatsSample) []StatsSample {
+	if ns == "" {
+		return all
+	}
+	result := make([]StatsSample, len(all))
+	for idx, sample := range all {
+		queues := map[string]int64{}
+		for name, size := range sample.Queues {
+			if local, ok := ns.local(name); ok {
+				queues[local] = size
+			}
+		}
+		sample.Queues = queues
+		result[idx] = sample
+	}
+	return result
+}
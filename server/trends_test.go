@@ -0,0 +1,47 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsHistory(t *testing.T) {
+	t.Parallel()
+
+	var sh statsHistory
+	assert.Empty(t, sh.recent(statsSamples))
+
+	for i := 1; i <= 3; i++ {
+		sh.record(StatsSample{Processed: int64(i)})
+	}
+	samples := sh.recent(2)
+	assert.Len(t, samples, 2)
+	assert.Equal(t, int64(2), samples[0].Processed)
+	assert.Equal(t, int64(3), samples[1].Processed)
+
+	// once full, new samples replace the oldest
+	for i := 4; i <= statsSamples+5; i++ {
+		sh.record(StatsSample{Processed: int64(i)})
+	}
+	samples = sh.recent(statsSamples)
+	assert.Len(t, samples, statsSamples)
+	assert.Equal(t, int64(6), samples[0].Processed)
+	assert.Equal(t, int64(statsSamples+5), samples[statsSamples-1].Processed)
+
+	sh.reset()
+	assert.Empty(t, sh.recent(statsSamples))
+	sh.record(StatsSample{Processed: 1})
+	assert.Len(t, sh.recent(statsSamples), 1)
+}
+
+func TestNamespaceSamples(t *testing.T) {
+	t.Parallel()
+
+	all := []StatsSample{{Queues: map[string]int64{"acme.default": 3, "other.default": 7}}}
+	assert.Equal(t, all, namespace("").samples(all))
+
+	samples := namespace("acme").samples(all)
+	assert.Equal(t, map[string]int64{"default": 3}, samples[0].Queues)
+	assert.Len(t, all[0].Queues, 2)
+}
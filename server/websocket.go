@@ -0,0 +1,325 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1" //nolint:gosec
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// GET /ws upgrades to a WebSocket which speaks the command protocol
+// for clients, like browsers, which can't open a TCP connection.
+// Each text or binary message the client sends holds one or more
+// commands, a missing trailing CRLF is added.  The server sends its
+// responses as text messages, a message holds one or more complete
+// lines but a response may span several messages, e.g. a Bulk String's
+// length and data, so clients should treat them as a stream.
+//
+// The connection goes through the usual HI/HELLO handshake so it
+// doesn't require HTTP Basic Auth.  Browsers send any page's cookies
+// and credentials with the upgrade, so a browser's Origin must be the
+// API's own host or listed in Options.WebSocketOrigins.
+//
+// This implements the parts of RFC 6455 a server needs: no extensions
+// or subprotocols.
+
+// from RFC 6455, section 1.3
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+
+	// close status for a message larger than the server accepts
+	wsMessageTooBig = 1009
+	// room for the verb and framing of a command carrying a job of
+	// MaxJobPayloadBytes, larger commands must span several messages
+	wsCommandOverhead = 4 * 1024
+)
+
+var errWebSocketTooLarge = errors.New("WebSocket message too large")
+
+func (s *Server) httpWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" || key == "" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		httpError(w, ErrCodeInvalidFormat, fmt.Errorf("Expected a WebSocket upgrade"))
+		return
+	}
+
+	if !s.allowOrigin(r) {
+		writeJSON(w, http.StatusForbidden, map[string]string{
+			"code":  ErrCodeAuthFailed,
+			"error": fmt.Sprintf("Origin %s not allowed", r.Header.Get("Origin")),
+		})
+		return
+	}
+	if !s.openConnection() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{
+			"code":  ErrCodeServerBusy,
+			"error": "server busy",
+		})
+		return
+	}
+	defer atomic.AddUint64(&s.Stats.Connections, ^uint64(0))
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		httpError(w, ErrCodeNotSupported, fmt.Errorf("WebSocket not supported"))
+		return
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		s.logger().Error("Unable to upgrade to WebSocket", err, nil)
+		return
+	}
+	limit := s.Options.maxJobPayloadBytes() + wsCommandOverhead
+
+	_, err = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + websocketAccept(key) + "\r\n\r\n")
+	if err == nil {
+		err = rw.Flush()
+	}
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	s.serve(newWebSocketConn(conn, rw.Reader, limit))
+}
+
+// Clients which aren't browsers don't send an Origin.
+func (s *Server) allowOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range s.Options.WebSocketOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func websocketAccept(key string) string {
+	//nolint:gosec
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func headerContains(h http.Header, name string, token string) bool {
+	for _, val := range h.Values(name) {
+		for _, part := range strings.Split(val, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Adapts a WebSocket to the byte stream the command protocol expects.
+type websocketConn struct {
+	net.Conn
+	reader *bufio.Reader
+
+	// the unread remainder of the current message
+	pending []byte
+	// the largest message the client may send
+	limit int
+
+	mu       sync.Mutex
+	outgoing bytes.Buffer
+	closed   bool
+}
+
+func newWebSocketConn(conn net.Conn, reader *bufio.Reader, limit int) *websocketConn {
+	return &websocketConn{Conn: conn, reader: reader, limit: limit}
+}
+
+func (ws *websocketConn) Read(p []byte) (int, error) {
+	for len(ws.pending) == 0 {
+		msg, err := ws.readMessage()
+		if err != nil {
+			return 0, err
+		}
+		if len(msg) > 0 && !bytes.HasSuffix(msg, []byte("\n")) {
+			msg = append(msg, '\r', '\n')
+		}
+		ws.pending = msg
+	}
+	n := copy(p, ws.pending)
+	ws.pending = ws.pending[n:]
+	return n, nil
+}
+
+// Buffer writes until they end a line so a response isn't split
+// across many small messages.
+func (ws *websocketConn) Write(p []byte) (int, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.closed {
+		return 0, io.ErrClosedPipe
+	}
+	ws.outgoing.Write(p)
+	if !bytes.HasSuffix(ws.outgoing.Bytes(), []byte("\r\n")) {
+		return len(p), nil
+	}
+	err := ws.writeFrame(wsText, ws.outgoing.Bytes())
+	ws.outgoing.Reset()
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (ws *websocketConn) Close() error {
+	ws.mu.Lock()
+	if !ws.closed {
+		ws.closed = true
+		_ = ws.writeFrame(wsClose, nil)
+	}
+	ws.mu.Unlock()
+	return ws.Conn.Close()
+}
+
+// Send a close frame with the status, the connection is closed later.
+func (ws *websocketConn) closeWith(status uint16) {
+	var payload [2]byte
+	binary.BigEndian.PutUint16(payload[:], status)
+	ws.mu.Lock()
+	if !ws.closed {
+		ws.closed = true
+		_ = ws.writeFrame(wsClose, payload[:])
+	}
+	ws.mu.Unlock()
+}
+
+// Read frames until a complete data message arrives, answering pings
+// along the way.  A close frame is io.EOF.
+func (ws *websocketConn) readMessage() ([]byte, error) {
+	var msg []byte
+	for {
+		fin, opcode, payload, err := ws.readFrame(ws.limit - len(msg))
+		if err == errWebSocketTooLarge {
+			ws.closeWith(wsMessageTooBig)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case wsPing:
+			ws.mu.Lock()
+			err = ws.writeFrame(wsPong, payload)
+			ws.mu.Unlock()
+			if err != nil {
+				return nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			return nil, io.EOF
+		case wsText, wsBinary, wsContinuation:
+		default:
+			return nil, fmt.Errorf("Unknown WebSocket opcode %d", opcode)
+		}
+
+		msg = append(msg, payload...)
+		if fin {
+			return msg, nil
+		}
+	}
+}
+
+// Read a frame whose payload is at most +limit+ bytes, a larger one
+// isn't read and returns errWebSocketTooLarge.
+func (ws *websocketConn) readFrame(limit int) (bool, byte, []byte, error) {
+	var header [2]byte
+	_, err := io.ReadFull(ws.reader, header[:])
+	if err != nil {
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		_, err = io.ReadFull(ws.reader, ext[:])
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		_, err = io.ReadFull(ws.reader, ext[:])
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if err != nil {
+		return false, 0, nil, err
+	}
+	// clients must mask every frame
+	if !masked {
+		return false, 0, nil, fmt.Errorf("Unmasked WebSocket frame")
+	}
+	if length > uint64(limit) {
+		return false, 0, nil, errWebSocketTooLarge
+	}
+
+	var mask [4]byte
+	_, err = io.ReadFull(ws.reader, mask[:])
+	if err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(ws.reader, payload)
+	if err != nil {
+		return false, 0, nil, err
+	}
+	for idx := range payload {
+		payload[idx] ^= mask[idx%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// Servers never mask their frames.  Must be called with mu held.
+func (ws *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	length := len(payload)
+	switch {
+	case length < 126:
+		header = append(header, byte(length))
+	case length <= 0xFFFF:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+	_, err := ws.Conn.Write(append(header, payload...))
+	return err
+}
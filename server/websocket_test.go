@@ -0,0 +1,207 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A masked client frame.
+func clientFrame(opcode byte, fin bool, payload string) []byte {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{first, 0x80 | byte(len(payload))}
+	frame = append(frame, mask...)
+	for idx := range payload {
+		frame = append(frame, payload[idx]^mask[idx%4])
+	}
+	return frame
+}
+
+func readServerFrame(t *testing.T, r io.Reader) (byte, string) {
+	header := make([]byte, 2)
+	_, err := io.ReadFull(r, header)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, header[1]&0x80, "server frames aren't masked")
+	payload := make([]byte, header[1]&0x7F)
+	_, err = io.ReadFull(r, payload)
+	assert.NoError(t, err)
+	return header[0] & 0x0F, string(payload)
+}
+
+func TestWebSocketAccept(t *testing.T) {
+	t.Parallel()
+
+	// the example from RFC 6455
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", websocketAccept("dGhlIHNhbXBsZSBub25jZQ=="))
+}
+
+func TestWebSocketConn(t *testing.T) {
+	t.Parallel()
+
+	server, client := net.Pipe()
+	defer client.Close()
+	ws := newWebSocketConn(server, bufio.NewReader(server), 1024)
+
+	go func() {
+		_, _ = client.Write(clientFrame(wsText, false, "HELLO "))
+		_, _ = client.Write(clientFrame(wsPing, true, "hi"))
+		_, _ = client.Write(clientFrame(wsContinuation, true, "{}"))
+		_, _ = client.Write(clientFrame(wsText, true, "INFO\r\n"))
+		_, _ = client.Write(clientFrame(wsClose, true, ""))
+	}()
+
+	// the ping is answered while the message is incomplete
+	pong := make(chan string)
+	go func() {
+		opcode, payload := readServerFrame(t, client)
+		assert.EqualValues(t, wsPong, opcode)
+		pong <- payload
+	}()
+
+	buf := bufio.NewReader(ws)
+	line, err := buf.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "HELLO {}\r\n", line)
+	assert.Equal(t, "hi", <-pong)
+
+	line, err = buf.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "INFO\r\n", line)
+
+	_, err = buf.ReadString('\n')
+	assert.Equal(t, io.EOF, err)
+
+	// writes are sent once they end a line
+	go func() {
+		_, _ = ws.Write([]byte("$2\r\n"))
+		_, _ = ws.Write([]byte("{}"))
+		_, _ = ws.Write([]byte("\r\n"))
+		ws.Close()
+	}()
+	opcode, payload := readServerFrame(t, client)
+	assert.EqualValues(t, wsText, opcode)
+	assert.Equal(t, "$2\r\n", payload)
+	_, payload = readServerFrame(t, client)
+	assert.Equal(t, "{}\r\n", payload)
+	opcode, _ = readServerFrame(t, client)
+	assert.EqualValues(t, wsClose, opcode)
+
+	_, err = ws.Write([]byte("+OK\r\n"))
+	assert.Error(t, err)
+}
+
+func TestWebSocketTooLarge(t *testing.T) {
+	t.Parallel()
+
+	for _, frames := range [][][]byte{
+		{clientFrame(wsText, true, "INFO INFO\r\n")},
+		// the limit covers the whole message
+		{clientFrame(wsText, false, "INFO "), clientFrame(wsContinuation, true, "INFO\r\n")},
+	} {
+		server, client := net.Pipe()
+		ws := newWebSocketConn(server, bufio.NewReader(server), 8)
+		go func() {
+			for _, frame := range frames {
+				_, _ = client.Write(frame)
+			}
+		}()
+
+		closed := make(chan string)
+		go func() {
+			opcode, payload := readServerFrame(t, client)
+			assert.EqualValues(t, wsClose, opcode)
+			closed <- payload
+		}()
+		_, err := ws.Read(make([]byte, 16))
+		assert.Equal(t, errWebSocketTooLarge, err)
+		assert.Equal(t, "\x03\xf1", <-closed)
+		ws.Close()
+		client.Close()
+	}
+}
+
+func TestWebSocketUpgrade(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{
+		Options: &ServerOptions{Password: "sekrit"},
+		Stats:   &RuntimeStats{},
+		conns:   newConnLimiter(0),
+	}
+	ts := httptest.NewServer(s.httpHandler())
+	defer ts.Close()
+
+	// not an upgrade, but it isn't behind Basic Auth either
+	resp, err := http.Get(ts.URL + "/ws")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /ws HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"))
+	assert.NoError(t, err)
+
+	buf := bufio.NewReader(conn)
+	resp, err = http.ReadResponse(buf, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+
+	opcode, payload := readServerFrame(t, buf)
+	assert.EqualValues(t, wsText, opcode)
+	assert.True(t, strings.HasPrefix(payload, `+HI {"v":2,"i":`), payload)
+
+	// upgrades count towards MaxConnections
+	s.Options.MaxConnections = 1
+	req, err := http.NewRequest("GET", ts.URL+"/ws", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.EqualValues(t, 1, atomic.LoadUint64(&s.Stats.ConnectionsRejected))
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{Options: &ServerOptions{WebSocketOrigins: []string{"https://ops.example.com"}}}
+	check := func(origin string) bool {
+		req := httptest.NewRequest("GET", "http://faktory.local:7422/ws", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		return s.allowOrigin(req)
+	}
+
+	assert.True(t, check(""))
+	assert.True(t, check("http://faktory.local:7422"))
+	assert.True(t, check("https://ops.example.com"))
+	assert.False(t, check("https://evil.example.com"))
+	assert.False(t, check("http://faktory.local"))
+
+	s.Options.WebSocketOrigins = []string{"*"}
+	assert.True(t, check("https://evil.example.com"))
+}
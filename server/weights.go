@@ -0,0 +1,77 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Parse the queue list given to FETCH.  Each queue may carry an
+// optional weight, e.g. "critical:2 default:1 bulk:0.5".  If no
+// weights are given, the queues are returned as-is and will be
+// checked in strict order.
+func parseQueueWeights(args []string) ([]string, []float64, error) {
+	queues := make([]string, len(args))
+	var weights []float64
+
+	for idx, arg := range args {
+		name := arg
+		weight := 1.0
+		if i := strings.LastIndex(arg, ":"); i >= 0 {
+			name = arg[0:i]
+			w, err := strconv.ParseFloat(arg[i+1:], 64)
+			if err != nil || w <= 0 || math.IsInf(w, 0) || math.IsNaN(w) {
+				return nil, nil, fmt.Errorf("Invalid weight for queue %s: %s", name, arg[i+1:])
+			}
+			weight = w
+			if weights == nil {
+				weights = make([]float64, len(args))
+				for j := 0; j < idx; j++ {
+					weights[j] = 1.0
+				}
+			}
+		}
+		queues[idx] = name
+		if weights != nil {
+			weights[idx] = weight
+		}
+	}
+	return queues, weights, nil
+}
+
+// Order the queues with a weighted random shuffle so that a queue with
+// weight 2 is checked first twice as often as a queue with weight 1.
+// The remaining queues act as fallbacks if the chosen queue is empty.
+func weightedOrder(queues []string, weights []float64, rnd func() float64) []string {
+	if len(weights) == 0 {
+		return queues
+	}
+
+	type keyed struct {
+		name string
+		key  float64
+	}
+
+	// Efraimidis-Spirakis weighted sampling without replacement
+	keys := make([]keyed, len(queues))
+	for idx := range queues {
+		keys[idx] = keyed{queues[idx], math.Pow(rnd(), 1/weights[idx])}
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].key > keys[j].key
+	})
+
+	ordered := make([]string, len(keys))
+	for idx := range keys {
+		ordered[idx] = keys[idx].name
+	}
+	return ordered
+}
+
+//nolint:gosec
+func randomFloat() float64 {
+	return rand.Float64()
+}
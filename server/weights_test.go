@@ -0,0 +1,52 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQueueWeights(t *testing.T) {
+	t.Parallel()
+
+	queues, weights, err := parseQueueWeights([]string{"critical", "default"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"critical", "default"}, queues)
+	assert.Nil(t, weights)
+
+	queues, weights, err = parseQueueWeights([]string{"critical:2", "default", "bulk:0.5"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"critical", "default", "bulk"}, queues)
+	assert.Equal(t, []float64{2, 1, 0.5}, weights)
+
+	queues, weights, err = parseQueueWeights([]string{"default", "critical:3"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"default", "critical"}, queues)
+	assert.Equal(t, []float64{1, 3}, weights)
+
+	for _, bad := range []string{"default:", "default:x", "default:0", "default:-1", "default:NaN", "default:Inf"} {
+		_, _, err = parseQueueWeights([]string{bad})
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestWeightedOrder(t *testing.T) {
+	t.Parallel()
+
+	queues := []string{"critical", "default", "bulk"}
+	assert.Equal(t, queues, weightedOrder(queues, nil, randomFloat))
+
+	ordered := weightedOrder(queues, []float64{1, 1, 1}, func() float64 { return 0.5 })
+	assert.Equal(t, queues, ordered)
+
+	firsts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		ordered := weightedOrder(queues, []float64{2, 1, 1}, randomFloat)
+		assert.Equal(t, 3, len(ordered))
+		firsts[ordered[0]]++
+	}
+	// critical should be chosen first roughly half of the time
+	assert.InDelta(t, 5000, firsts["critical"], 500)
+	assert.InDelta(t, 2500, firsts["default"], 500)
+	assert.InDelta(t, 2500, firsts["bulk"], 500)
+}
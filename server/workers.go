@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/contribsys/faktory/util"
@@ -54,15 +55,26 @@ type ClientData struct {
 	Pid          int      `json:"pid"`
 	RssKb        int64    `json:"rss_kb"`
 	Labels       []string `json:"labels"`
+	Namespace    string   `json:"namespace"`
 	PasswordHash string   `json:"pwdhash"`
+	ScramNonce   string   `json:"scram_nonce"`
+	ScramProof   string   `json:"scram_proof"`
 	Version      uint8    `json:"v"`
-	StartedAt    time.Time
+	// answers "+PING" with "PONG", see readCommand
+	Ping      bool `json:"ping"`
+	StartedAt time.Time
 
 	// this only applies to clients that are workers and
 	// are sending BEAT
 	lastHeartbeat time.Time
 	state         WorkerState
-	connections   map[io.Closer]bool
+	// DRAIN_WORKER was called, the process is forgotten once a BEAT
+	// tells it to terminate
+	draining    bool
+	connections map[io.Closer]bool
+	// traffic of the connections which have closed
+	closedRead    int64
+	closedWritten int64
 }
 
 type WorkerState int
@@ -139,14 +151,24 @@ func (worker *ClientData) IsConsumer() bool {
 	return worker.Wid != ""
 }
 
+// How long a drained process is kept from fetching and told to
+// terminate if it connects again.
+const drainedTTL = 1 * time.Hour
+
 type workers struct {
 	heartbeats map[string]*ClientData
-	mu         sync.RWMutex
+	// traffic of the processes which have gone, see traffic.go
+	departed map[string]*departedTraffic
+	// when each process was drained
+	drained map[string]time.Time
+	mu      sync.RWMutex
 }
 
 func newWorkers() *workers {
 	return &workers{
 		heartbeats: make(map[string]*ClientData, 12),
+		departed:   map[string]*departedTraffic{},
+		drained:    map[string]time.Time{},
 	}
 }
 
@@ -156,10 +178,22 @@ func (w *workers) Count() int {
 	return len(w.heartbeats)
 }
 
-func (w *workers) setupHeartbeat(client *ClientData, cls io.Closer) (*ClientData, bool) {
+// Whether the worker process is connected and heartbeating.
+func (w *workers) alive(wid string) bool {
 	w.mu.RLock()
+	defer w.mu.RUnlock()
+	_, ok := w.heartbeats[wid]
+	return ok
+}
+
+func (w *workers) setupHeartbeat(client *ClientData, cls io.Closer) (*ClientData, bool) {
+	w.mu.Lock()
 	entry, ok := w.heartbeats[client.Wid]
-	w.mu.RUnlock()
+	if ok {
+		// another connection from a known process
+		entry.connections[cls] = true
+	}
+	w.mu.Unlock()
 
 	if ok {
 		return entry, ok
@@ -170,6 +204,12 @@ func (w *workers) setupHeartbeat(client *ClientData, cls io.Closer) (*ClientData
 	client.connections = map[io.Closer]bool{}
 
 	w.mu.Lock()
+	if _, ok := w.drained[client.Wid]; ok {
+		// a drained process which reconnected is told to terminate
+		// again
+		client.state = Terminate
+		client.draining = true
+	}
 	if c, ok := w.heartbeats[client.Wid]; ok {
 		entry = c
 	} else {
@@ -205,48 +245,131 @@ func (w *workers) heartbeat(client *ClientBeat) (*ClientData, bool) {
 	return entry, ok
 }
 
+// Signal every known worker process.  They will be notified
+// of their new state in the response to their next BEAT.
+func (w *workers) signalAll(state WorkerState) {
+	w.mu.Lock()
+	for _, worker := range w.heartbeats {
+		worker.Signal(state)
+	}
+	w.mu.Unlock()
+}
+
+// Signal a single worker process, returns false if the
+// worker is unknown.
+func (w *workers) signal(wid string, state WorkerState) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	worker, ok := w.heartbeats[wid]
+	if !ok {
+		return false
+	}
+	worker.Signal(state)
+	return true
+}
+
+// Signal a worker process to terminate and stop giving it jobs, e.g.
+// a pod which is going away.  It's kept until its next BEAT delivers
+// the signal, see forgetDrained, or it expires.  Returns false if the
+// worker is unknown.
+func (w *workers) drain(wid string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	worker, ok := w.heartbeats[wid]
+	if !ok {
+		return false
+	}
+	worker.Signal(Terminate)
+	worker.draining = true
+	w.drained[wid] = time.Now()
+	return true
+}
+
+// Whether DRAIN_WORKER was called for the process recently.
+func (w *workers) isDrained(wid string) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	_, ok := w.drained[wid]
+	return ok
+}
+
+// Forget a draining process once a BEAT has told it to terminate,
+// returns false if it isn't draining.
+func (w *workers) forgetDrained(wid string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	worker, ok := w.heartbeats[wid]
+	if !ok || !worker.draining {
+		return false
+	}
+	w.depart(wid)
+	return true
+}
+
 func (w *workers) RemoveConnection(c *Connection) {
 	w.mu.Lock()
 	cd, ok := w.heartbeats[c.client.Wid]
-	if ok {
+	if ok && cd.connections[c] {
+		cd.closedRead += atomic.LoadInt64(&c.BytesRead)
+		cd.closedWritten += atomic.LoadInt64(&c.BytesWritten)
 		delete(cd.connections, c)
 		if len(cd.connections) == 0 {
 			//util.Debugf("All worker connections closed, reaping %s", c.client.Wid)
-			delete(w.heartbeats, c.client.Wid)
+			w.depart(c.client.Wid)
 		}
+	} else if c.client.Wid != "" {
+		// the process was drained or reaped before the connection
+		// closed
+		w.closedAfterDeparture(c)
 	}
 	w.mu.Unlock()
 }
 
-func (w *workers) reapHeartbeats(t time.Time) int {
+// Forget the processes which haven't sent a BEAT since +t+ and close
+// their connections.  Returns how many were reaped and the draining
+// ones among them, whose jobs should be requeued.
+func (w *workers) reapHeartbeats(t time.Time) (int, []string) {
 	toDelete := []string{}
+	drained := []string{}
+	conns := []io.Closer{}
 
 	w.mu.Lock()
-	defer w.mu.Unlock()
-
 	for k, worker := range w.heartbeats {
 		if worker.lastHeartbeat.Before(t) {
 			toDelete = append(toDelete, k)
 		}
 	}
+	now := time.Now()
+	w.pruneDeparted(now)
+	for wid, at := range w.drained {
+		if now.Sub(at) > drainedTTL {
+			delete(w.drained, wid)
+		}
+	}
+	for _, wid := range toDelete {
+		cd := w.heartbeats[wid]
+		for conn := range cd.connections {
+			conns = append(conns, conn)
+		}
+		if cd.draining {
+			drained = append(drained, wid)
+		}
+		w.depart(wid)
+	}
+	w.mu.Unlock()
+
+	// a connection blocked on a dead peer mustn't hold up every BEAT
+	for _, conn := range conns {
+		conn.Close()
+	}
 
 	count := len(toDelete)
-	conns := 0
 	if count > 0 {
-		for idx := range toDelete {
-			cd := w.heartbeats[toDelete[idx]]
-			for conn := range cd.connections {
-				conn.Close()
-				conns += 1
-			}
-			delete(w.heartbeats, toDelete[idx])
-		}
-
 		util.Debugf("Reaped %d worker heartbeats", count)
-		if conns > 0 {
-			util.Warnf("Reaped %d lingering connections, this is a sign your workers are having problems", conns)
+		if len(conns) > 0 {
+			util.Warnf("Reaped %d lingering connections, this is a sign your workers are having problems", len(conns))
 			util.Warn("All worker processes should send a heartbeat every 15 seconds")
 		}
 	}
-	return count
+	return count, drained
 }
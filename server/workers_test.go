@@ -1,10 +1,12 @@
 package server
 
 import (
+	"fmt"
 	"io"
 	"testing"
 	"time"
 
+	"github.com/contribsys/faktory/manager"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -98,17 +100,155 @@ func TestWorkers(t *testing.T) {
 	entry, _ = workers.heartbeat(beat)
 	assert.Equal(t, Terminate, entry.state)
 
-	count := workers.reapHeartbeats(client.lastHeartbeat)
+	count, _ := workers.reapHeartbeats(client.lastHeartbeat)
 	assert.Equal(t, 1, workers.Count())
 	assert.Equal(t, 0, count)
 
-	count = workers.reapHeartbeats(time.Now())
+	count, _ = workers.reapHeartbeats(time.Now())
 	assert.Equal(t, 0, workers.Count())
 	assert.Equal(t, 1, count)
 }
 
+func TestSignalAllWorkers(t *testing.T) {
+	t.Parallel()
+
+	workers := newWorkers()
+	for _, wid := range []string{"abc123", "def456"} {
+		client := &ClientData{Wid: wid}
+		workers.setupHeartbeat(client, &cls{})
+	}
+	workers.heartbeats["def456"].Signal(Quiet)
+
+	workers.signalAll(Terminate)
+	for _, worker := range workers.heartbeats {
+		assert.Equal(t, Terminate, worker.state)
+	}
+
+	entry, ok := workers.heartbeat(&ClientBeat{Wid: "abc123"})
+	assert.True(t, ok)
+	assert.Equal(t, "terminate", stateString(entry.state))
+}
+
 type cls struct{}
 
 func (c cls) Close() error {
 	return nil
 }
+
+func TestBeatReaperTimeout(t *testing.T) {
+	t.Parallel()
+
+	workers := newWorkers()
+	client := &ClientData{Wid: "abc123"}
+	workers.setupHeartbeat(client, &cls{})
+	client.lastHeartbeat = time.Now().Add(-45 * time.Second)
+
+	reaper := &beatReaper{w: workers, timeout: 1 * time.Minute}
+	assert.NoError(t, reaper.Execute())
+	assert.Equal(t, 1, workers.Count())
+
+	reaper.timeout = 30 * time.Second
+	assert.NoError(t, reaper.Execute())
+	assert.Equal(t, 0, workers.Count())
+	assert.EqualValues(t, 1, reaper.Stats()["reaped"])
+}
+
+func TestSignalWorker(t *testing.T) {
+	t.Parallel()
+
+	workers := newWorkers()
+	client := &ClientData{Wid: "abc123"}
+	workers.setupHeartbeat(client, &cls{})
+
+	assert.False(t, workers.signal("unknown", Quiet))
+	assert.True(t, workers.signal("abc123", Quiet))
+	assert.Equal(t, Quiet, client.state)
+	assert.True(t, workers.signal("abc123", Terminate))
+	assert.Equal(t, Terminate, client.state)
+}
+
+type closeCounter struct {
+	closed int
+}
+
+func (cc *closeCounter) Close() error {
+	cc.closed++
+	return nil
+}
+
+func TestDrainWorker(t *testing.T) {
+	t.Parallel()
+
+	workers := newWorkers()
+	client := &ClientData{Wid: "abc123"}
+	first, second := &closeCounter{}, &closeCounter{}
+	workers.setupHeartbeat(client, first)
+	workers.setupHeartbeat(&ClientData{Wid: "abc123"}, second)
+
+	assert.False(t, workers.drain("unknown"))
+	assert.False(t, workers.forgetDrained("abc123"))
+	assert.True(t, workers.drain("abc123"))
+	assert.Equal(t, Terminate, client.state)
+	assert.True(t, workers.isDrained("abc123"))
+	// kept until a BEAT delivers the signal
+	assert.Equal(t, 1, workers.Count())
+	assert.Equal(t, 0, first.closed)
+
+	// unless it expires first
+	client.lastHeartbeat = time.Now().Add(-time.Hour)
+	count, drained := workers.reapHeartbeats(time.Now().Add(-time.Minute))
+	assert.Equal(t, 1, count)
+	assert.Equal(t, []string{"abc123"}, drained)
+	assert.Equal(t, 1, first.closed)
+	assert.Equal(t, 1, second.closed)
+	assert.False(t, workers.drain("abc123"))
+
+	// and is told to terminate again if it reconnects
+	again := &ClientData{Wid: "abc123"}
+	workers.setupHeartbeat(again, &cls{})
+	assert.Equal(t, Terminate, again.state)
+	assert.True(t, workers.forgetDrained("abc123"))
+	assert.Equal(t, 0, workers.Count())
+}
+
+// Only RequeueWorker is called.
+type requeueManager struct {
+	manager.Manager
+	requeued []string
+}
+
+func (m *requeueManager) RequeueWorker(wid string) (int, error) {
+	m.requeued = append(m.requeued, wid)
+	return 2, nil
+}
+
+func TestDrainWorkerBeat(t *testing.T) {
+	t.Parallel()
+
+	m := &requeueManager{}
+	s := &Server{Options: &ServerOptions{FetchTimeout: time.Millisecond}, workers: newWorkers(), manager: m}
+	worker := dummyConnection()
+	s.workers.setupHeartbeat(worker.client, worker)
+	op := dummyConnection()
+	op.client.Wid = ""
+
+	beat := fmt.Sprintf(`BEAT {"wid":"%s"}`, worker.client.Wid)
+	heartbeat(worker, s, beat)
+	assert.Equal(t, "+OK\r\n", output(worker))
+
+	drainWorker(op, s, "DRAIN_WORKER "+worker.client.Wid)
+	assert.Equal(t, ":0\r\n", output(op))
+	assert.Empty(t, m.requeued)
+	job, err := s.nextJob(worker, []string{"default"}, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, job)
+
+	heartbeat(worker, s, beat)
+	assert.Equal(t, "$21\r\n{\"state\":\"terminate\"}\r\n", output(worker))
+	assert.Equal(t, []string{worker.client.Wid}, m.requeued)
+	assert.Equal(t, 0, s.workers.Count())
+
+	// an unknown worker is requeued right away
+	drainWorker(op, s, "DRAIN_WORKER "+worker.client.Wid)
+	assert.Equal(t, ":2\r\n", output(op))
+}
@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/contribsys/faktory/util"
+)
+
+// Backups are Redis RDB snapshots.  BGSAVE writes the dataset from a
+// forked child so jobs keep flowing while it runs, then the RDB file
+// is copied to the destination.  Each backup is recorded in an index
+// next to the RDB file so it can be listed and restored later.
+//
+// Redis can't load an RDB file while running so a restore copies the
+// backup next to the RDB file and Boot swaps it in before starting
+// Redis, i.e. the restore takes effect when Faktory restarts.
+//
+// This requires Redis's data directory to be local, which is always
+// true for the Redis Faktory boots.
+
+const (
+	rdbFilename     = "faktory.rdb"
+	restoreFilename = "faktory.rdb.restore"
+	backupIndex     = "backups.json"
+	bgsaveTimeout   = 10 * time.Minute
+)
+
+var (
+	ErrBackupNotFound = errors.New("No such backup")
+
+	backupMutex sync.Mutex
+)
+
+func (store *redisStore) Backup(dest string) (*BackupInfo, error) {
+	backupMutex.Lock()
+	defer backupMutex.Unlock()
+
+	dir, err := store.dataDir()
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(dest, os.ModeDir|0755)
+	if err != nil {
+		return nil, err
+	}
+	err = store.bgsave()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	info := &BackupInfo{
+		Id:        now.UnixNano() / int64(time.Millisecond),
+		FileCount: 1,
+		Timestamp: now.Unix(),
+	}
+	info.Path = filepath.Join(dest, fmt.Sprintf("faktory-%d.rdb", info.Id))
+	info.Size, err = copyFile(filepath.Join(dir, rdbFilename), info.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	backups, err := readBackupIndex(dir)
+	if err != nil {
+		return nil, err
+	}
+	backups = append(backups, info)
+	err = writeBackupIndex(dir, backups)
+	if err != nil {
+		return nil, err
+	}
+	util.Infof("Backed up to %s", info.Path)
+	return info, nil
+}
+
+// The backups whose files still exist, oldest first.
+func (store *redisStore) Backups() ([]*BackupInfo, error) {
+	dir, err := store.dataDir()
+	if err != nil {
+		return nil, err
+	}
+	backups, err := readBackupIndex(dir)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*BackupInfo, 0, len(backups))
+	for _, info := range backups {
+		if _, err := os.Stat(info.Path); err == nil {
+			result = append(result, info)
+		}
+	}
+	return result, nil
+}
+
+func (store *redisStore) Restore(id int64) error {
+	backupMutex.Lock()
+	defer backupMutex.Unlock()
+
+	dir, err := store.dataDir()
+	if err != nil {
+		return err
+	}
+	backups, err := readBackupIndex(dir)
+	if err != nil {
+		return err
+	}
+	for _, info := range backups {
+		if info.Id == id {
+			_, err = copyFile(info.Path, filepath.Join(dir, restoreFilename))
+			if err == nil {
+				util.Infof("Backup %d will be restored when Faktory restarts", id)
+			}
+			return err
+		}
+	}
+	return fmt.Errorf("%w %d", ErrBackupNotFound, id)
+}
+
+func (store *redisStore) dataDir() (string, error) {
+	vals, err := store.rclient.ConfigGet("dir").Result()
+	if err != nil {
+		return "", err
+	}
+	if len(vals) != 2 {
+		return "", fmt.Errorf("Unable to find Redis's data directory")
+	}
+	dir, _ := vals[1].(string)
+	return dir, nil
+}
+
+// Take a snapshot with BGSAVE and wait for it to finish.
+func (store *redisStore) bgsave() error {
+	deadline := time.Now().Add(bgsaveTimeout)
+
+	// a save already in progress may not include the latest writes,
+	// wait for it to finish and start another
+	for {
+		err := store.rclient.BgSave().Err()
+		if err == nil {
+			break
+		}
+		if !strings.Contains(err.Error(), "in progress") || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	for {
+		info, err := store.rclient.Info("persistence").Result()
+		if err != nil {
+			return err
+		}
+		fields := infoFields(info)
+		if fields["rdb_bgsave_in_progress"] == "0" {
+			if status := fields["rdb_last_bgsave_status"]; status != "ok" {
+				return fmt.Errorf("Redis BGSAVE failed: %s", status)
+			}
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timed out waiting for Redis BGSAVE")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func infoFields(info string) map[string]string {
+	fields := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(info))
+	for scanner.Scan() {
+		parts := strings.SplitN(strings.TrimSpace(scanner.Text()), ":", 2)
+		if len(parts) == 2 {
+			fields[parts[0]] = parts[1]
+		}
+	}
+	return fields
+}
+
+// Swap in a backup staged by Restore, called before Redis starts.
+func restoreBackup(dir string) error {
+	staged := filepath.Join(dir, restoreFilename)
+	if _, err := os.Stat(staged); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	util.Infof("Restoring backup %s", staged)
+	return os.Rename(staged, filepath.Join(dir, rdbFilename))
+}
+
+func readBackupIndex(dir string) ([]*BackupInfo, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, backupIndex))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var backups []*BackupInfo
+	err = json.Unmarshal(data, &backups)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Id < backups[j].Id })
+	return backups, nil
+}
+
+func writeBackupIndex(dir string, backups []*BackupInfo) error {
+	data, err := json.Marshal(backups)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, backupIndex)
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Copy via a temporary file so a partial copy is never mistaken for a
+// complete one.
+func copyFile(src string, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	return size, nil
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInfoFields(t *testing.T) {
+	t.Parallel()
+
+	fields := infoFields("# Persistence\r\nloading:0\r\nrdb_bgsave_in_progress:1\r\nrdb_last_bgsave_status:ok\r\n")
+	assert.Equal(t, "1", fields["rdb_bgsave_in_progress"])
+	assert.Equal(t, "ok", fields["rdb_last_bgsave_status"])
+	assert.Len(t, fields, 3)
+}
+
+func TestRestoreBackup(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "faktory-restore")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// nothing staged
+	assert.NoError(t, restoreBackup(dir))
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, rdbFilename), []byte("current"), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "backup.rdb"), []byte("backup"), 0600))
+	size, err := copyFile(filepath.Join(dir, "backup.rdb"), filepath.Join(dir, restoreFilename))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 6, size)
+
+	assert.NoError(t, restoreBackup(dir))
+	data, err := ioutil.ReadFile(filepath.Join(dir, rdbFilename))
+	assert.NoError(t, err)
+	assert.Equal(t, "backup", string(data))
+	_, err = os.Stat(filepath.Join(dir, restoreFilename))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestBackup(t *testing.T) {
+	withRedis(t, "backup", func(t *testing.T, store Store) {
+		store.Flush()
+		bs := store.(Backupable)
+		q, err := store.GetQueue("default")
+		assert.NoError(t, err)
+		assert.NoError(t, q.Add(client.NewJob("Report")))
+
+		dest, err := ioutil.TempDir("", "faktory-backups")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dest)
+
+		backup, err := bs.Backup(dest)
+		assert.NoError(t, err)
+		assert.True(t, backup.Size > 0)
+		assert.Equal(t, dest, filepath.Dir(backup.Path))
+
+		backups, err := bs.Backups()
+		assert.NoError(t, err)
+		assert.Equal(t, backup.Id, backups[len(backups)-1].Id)
+
+		assert.NoError(t, bs.Restore(backup.Id))
+		assert.True(t, errors.Is(bs.Restore(1), ErrBackupNotFound))
+	})
+}
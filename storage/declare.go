@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// QueueConfig holds the settings declared for a queue before any jobs
+// arrive, see DECLARE_QUEUE.  They're kept in storage so they survive
+// a restart.
+type QueueConfig struct {
+	// The most jobs the queue may hold and what happens to jobs pushed
+	// beyond that, zero means unlimited.
+	MaxSize int64  `json:"max_size,omitempty"`
+	Policy  string `json:"policy,omitempty"`
+	// Jobs fetched per second, zero means unlimited.
+	Rate float64 `json:"rate,omitempty"`
+	// "priority", the default, or "fifo" which ignores job priorities.
+	PriorityMode string `json:"priority_mode,omitempty"`
+}
+
+const queueConfigsKey = "queue-configs"
+
+// DeclareQueue creates the queue if necessary and saves its config,
+// replacing any config declared before.
+func (store *redisStore) DeclareQueue(name string, cfg QueueConfig) error {
+	_, err := store.GetQueue(name)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return store.rclient.HSet(queueConfigsKey, name, data).Err()
+}
+
+// QueueConfigs returns the config of every declared queue.
+func (store *redisStore) QueueConfigs() (map[string]QueueConfig, error) {
+	vals, err := store.rclient.HGetAll(queueConfigsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	configs := make(map[string]QueueConfig, len(vals))
+	for name, data := range vals {
+		var cfg QueueConfig
+		if err := json.Unmarshal([]byte(data), &cfg); err != nil {
+			return nil, fmt.Errorf("invalid config for queue %s: %w", name, err)
+		}
+		configs[name] = cfg
+	}
+	return configs, nil
+}
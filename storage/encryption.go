@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrUnencrypted = errors.New("payload is not encrypted")
+)
+
+// An encrypted payload: a job or, in the working set, a reservation.
+// The JID, queue, jobtype and priority stay in the clear so jobs can
+// still be routed, found and listed, the payload itself is sealed with
+// AES-256-GCM.
+type Envelope struct {
+	Jid        string `json:"jid"`
+	Queue      string `json:"queue,omitempty"`
+	Type       string `json:"jobtype,omitempty"`
+	Priority   int    `json:"priority,omitempty"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+type PayloadCipher struct {
+	aead cipher.AEAD
+	// derives each nonce from the payload, see Seal
+	nonceKey []byte
+}
+
+func NewPayloadCipher(key []byte) (*PayloadCipher, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, not %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("faktory payload nonce"))
+	return &PayloadCipher{aead: aead, nonceKey: mac.Sum(nil)}, nil
+}
+
+// Seal wraps a job payload in an Envelope.  Payloads which are already
+// sealed are returned as-is.
+//
+// The nonce is an HMAC of the payload so sealing the same payload twice
+// gives the same Envelope: Redis can find and remove a sealed job by
+// value, as it does a plain one, and different payloads never share a
+// nonce.
+func (pc *PayloadCipher) Seal(payload []byte) ([]byte, error) {
+	return pc.SealFor("", payload)
+}
+
+// SealFor seals a payload whose JID isn't a top-level attribute, e.g.
+// a reservation in the working set.  An empty +jid+ is read from the
+// payload.
+func (pc *PayloadCipher) SealFor(jid string, payload []byte) ([]byte, error) {
+	if IsEncrypted(payload) {
+		return payload, nil
+	}
+
+	var env Envelope
+	err := json.Unmarshal(payload, &env)
+	if err != nil {
+		return nil, err
+	}
+	if jid != "" {
+		env.Jid = jid
+	}
+	mac := hmac.New(sha256.New, pc.nonceKey)
+	mac.Write([]byte(env.Jid))
+	mac.Write(payload)
+	env.Nonce = mac.Sum(nil)[:pc.aead.NonceSize()]
+	env.Ciphertext = pc.aead.Seal(nil, env.Nonce, payload, []byte(env.Jid))
+	return json.Marshal(&env)
+}
+
+// Open returns the job payload sealed in an Envelope or ErrUnencrypted
+// if the payload was stored in the clear.
+func (pc *PayloadCipher) Open(payload []byte) ([]byte, error) {
+	if !IsEncrypted(payload) {
+		return nil, ErrUnencrypted
+	}
+
+	var env Envelope
+	err := json.Unmarshal(payload, &env)
+	if err != nil {
+		return nil, err
+	}
+	data, err := pc.aead.Open(nil, env.Nonce, env.Ciphertext, []byte(env.Jid))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt job %s: %w", env.Jid, err)
+	}
+	return data, nil
+}
+
+// Jobs never have a top-level "ciphertext" attribute so its presence
+// identifies an Envelope.
+func IsEncrypted(payload []byte) bool {
+	if !bytes.Contains(payload, []byte(`"ciphertext"`)) {
+		return false
+	}
+	var probe struct {
+		Ciphertext []byte `json:"ciphertext"`
+	}
+	err := json.Unmarshal(payload, &probe)
+	return err == nil && probe.Ciphertext != nil
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPayloadCipher(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewPayloadCipher([]byte("too short"))
+	assert.Error(t, err)
+
+	key := bytes.Repeat([]byte{7}, 32)
+	pc, err := NewPayloadCipher(key)
+	assert.NoError(t, err)
+
+	job := client.NewJob("ChargeCard", "4111-1111-1111-1111")
+	job.Queue = "billing"
+	job.Priority = 9
+	data, err := json.Marshal(job)
+	assert.NoError(t, err)
+	assert.False(t, IsEncrypted(data))
+
+	sealed, err := pc.Seal(data)
+	assert.NoError(t, err)
+	assert.True(t, IsEncrypted(sealed))
+	assert.NotContains(t, string(sealed), "4111")
+
+	var env Envelope
+	assert.NoError(t, json.Unmarshal(sealed, &env))
+	assert.Equal(t, job.Jid, env.Jid)
+	assert.Equal(t, "billing", env.Queue)
+	assert.Equal(t, 9, env.Priority)
+
+	resealed, err := pc.Seal(sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, sealed, resealed)
+	// the same payload always seals the same way so it can be found
+	again, err := pc.Seal(data)
+	assert.NoError(t, err)
+	assert.Equal(t, sealed, again)
+	assert.Equal(t, "ChargeCard", env.Type)
+
+	// reservations hold the job, its JID is given
+	res, err := pc.SealFor(job.Jid, []byte(`{"job":{"jid":"`+job.Jid+`"},"wid":"worker1"}`))
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(res, &env))
+	assert.Equal(t, job.Jid, env.Jid)
+	assert.NotEqual(t, sealed, res)
+
+	opened, err := pc.Open(sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, data, opened)
+
+	_, err = pc.Open(data)
+	assert.Equal(t, ErrUnencrypted, err)
+
+	other, err := NewPayloadCipher(bytes.Repeat([]byte{8}, 32))
+	assert.NoError(t, err)
+	_, err = other.Open(sealed)
+	assert.Error(t, err)
+
+	// the JID is authenticated so it can't be swapped
+	env.Jid = "somethingelse"
+	tampered, err := json.Marshal(&env)
+	assert.NoError(t, err)
+	_, err = pc.Open(tampered)
+	assert.Error(t, err)
+}
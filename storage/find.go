@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/contribsys/faktory/client"
+)
+
+var (
+	errFound = errors.New("found")
+
+	globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+)
+
+// FindByJid scans the given job set for the entry with the given JID.
+// Returns nil if the JID is not in the set.  This is O(N) so it should
+// only be used for operator actions, never within normal job processing.
+func FindByJid(set SortedSet, jid string) (SortedEntry, error) {
+	var found SortedEntry
+	match := fmt.Sprintf(`*"jid":"%s"*`, globEscaper.Replace(jid))
+	err := set.Find(match, func(idx int, ent SortedEntry) error {
+		job, err := ent.Job()
+		if err != nil {
+			return err
+		}
+		if job.Jid != jid {
+			return nil
+		}
+		found = ent
+		return errFound
+	})
+	if err != nil && err != errFound {
+		return nil, err
+	}
+	return found, nil
+}
+
+// FindByType scans the given job set for up to +limit+ jobs of the
+// given jobtype.  Like FindByJid, this is O(N) and meant for operators.
+func FindByType(set SortedSet, jobtype string, limit int) ([]*client.Job, error) {
+	jobs := []*client.Job{}
+	match := fmt.Sprintf(`*"jobtype":"%s"*`, globEscaper.Replace(jobtype))
+	err := set.Find(match, func(idx int, ent SortedEntry) error {
+		job, err := ent.Job()
+		if err != nil {
+			return err
+		}
+		if job.Type != jobtype {
+			return nil
+		}
+		jobs = append(jobs, job)
+		if len(jobs) >= limit {
+			return errFound
+		}
+		return nil
+	})
+	if err != nil && err != errFound {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// FindInQueue scans the given queue for the job with the given JID.
+// Returns nil if the JID is not in the queue.  Like FindByJid, this is
+// O(N) and meant for operators.
+func FindInQueue(q Queue, jid string) (*client.Job, error) {
+	var found *client.Job
+	err := q.Each(func(idx int, data []byte) error {
+		if !bytes.Contains(data, []byte(jid)) {
+			return nil
+		}
+		var job client.Job
+		err := json.Unmarshal(data, &job)
+		if err != nil {
+			return err
+		}
+		if job.Jid != jid {
+			return nil
+		}
+		found = &job
+		return errFound
+	})
+	if err != nil && err != errFound {
+		return nil, err
+	}
+	return found, nil
+}
@@ -21,6 +21,27 @@ func (store *redisStore) TotalFailures() uint64 {
 	return uint64(store.rclient.IncrBy("failures", 0).Val())
 }
 
+// Zero the processed and failure totals in one transaction, returning
+// their values beforehand.  The daily history is untouched.
+func (store *redisStore) ResetStats() (uint64, uint64, error) {
+	var processed, failures *redis.StringCmd
+	_, err := store.rclient.TxPipelined(func(pipe redis.Pipeliner) error {
+		processed = pipe.GetSet("processed", 0)
+		failures = pipe.GetSet("failures", 0)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return 0, 0, err
+	}
+	return counterVal(processed), counterVal(failures), nil
+}
+
+// Zero if the counter didn't exist.
+func counterVal(cmd *redis.StringCmd) uint64 {
+	val, _ := cmd.Uint64()
+	return val
+}
+
 func (store *redisStore) Failure() error {
 	store.rclient.Incr("processed")
 	store.rclient.Incr("failures")
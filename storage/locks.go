@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// Advisory locks for workers, e.g. so only one runs the daily report.
+// Redis expires a lock once its TTL passes so a crashed holder can't
+// keep it forever.
+
+func lockKey(name string) string {
+	return "lock:" + name
+}
+
+// Lock takes the named lock for holder, returning false if it's
+// already held.
+func (store *redisStore) Lock(name, holder string, ttl time.Duration) (bool, error) {
+	return store.rclient.SetNX(lockKey(name), holder, ttl).Result()
+}
+
+// Unlock releases the named lock, returning false if holder doesn't
+// hold it: it may have expired and been taken by someone else.
+func (store *redisStore) Unlock(name, holder string) (bool, error) {
+	key := lockKey(name)
+	released := false
+	err := store.rclient.Watch(func(tx *redis.Tx) error {
+		current, err := tx.Get(key).Result()
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if current != holder {
+			return nil
+		}
+		_, err = tx.TxPipelined(func(pipe redis.Pipeliner) error {
+			pipe.Del(key)
+			return nil
+		})
+		released = err == nil
+		return err
+	}, key)
+	if err == redis.TxFailedErr {
+		// changed hands between GET and DEL
+		return false, nil
+	}
+	return released, err
+}
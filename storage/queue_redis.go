@@ -3,6 +3,8 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/contribsys/faktory/client"
@@ -10,6 +12,33 @@ import (
 	"github.com/go-redis/redis"
 )
 
+const (
+	MinPriority     = 1
+	DefaultPriority = 5
+	MaxPriority     = 9
+)
+
+// Each priority level within a queue is stored in its own Redis list.
+// The default priority uses the bare queue name so existing data and
+// clients which don't know about priorities continue to work.
+//
+// Returns the list keys for the named queue in fetch order,
+// highest priority first.
+func PriorityKeys(name string) []string {
+	keys := make([]string, 0, MaxPriority-MinPriority+1)
+	for p := MaxPriority; p >= MinPriority; p-- {
+		keys = append(keys, priorityKey(name, p))
+	}
+	return keys
+}
+
+func priorityKey(name string, priority int) string {
+	if priority == DefaultPriority || priority == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s:p%d", name, priority)
+}
+
 type redisQueue struct {
 	name  string
 	store *redisStore
@@ -45,18 +74,92 @@ func (q *redisQueue) Name() string {
 	return q.name
 }
 
+// Page walks the queue's lists in priority order as if they were a
+// single Redis list, with the same inclusive LRANGE semantics.
 func (q *redisQueue) Page(start int64, count int64, fn func(index int, data []byte) error) error {
+	keys := q.keys()
+	sizes := make([]*redis.IntCmd, len(keys))
+	_, err := q.store.rclient.Pipelined(func(pipe redis.Pipeliner) error {
+		for idx := range keys {
+			sizes[idx] = pipe.LLen(keys[idx])
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	total := int64(0)
+	for idx := range sizes {
+		total += sizes[idx].Val()
+	}
+
+	stop := start + count
+	if count < 0 {
+		stop = total - 1
+	}
+	if start < 0 {
+		start += total
+		stop += total
+	}
+
 	index := 0
+	offset := int64(0)
+	for idx := range keys {
+		size := sizes[idx].Val()
+		if size == 0 || start >= offset+size {
+			offset += size
+			continue
+		}
+		if stop < offset {
+			break
+		}
 
-	slice, err := q.store.rclient.LRange(q.name, start, start+count).Result()
-	for idx := range slice {
-		err = fn(index, []byte(slice[idx]))
+		from := start - offset
+		if from < 0 {
+			from = 0
+		}
+		slice, err := q.store.rclient.LRange(keys[idx], from, stop-offset).Result()
 		if err != nil {
 			return err
 		}
-		index += 1
+		for sidx := range slice {
+			data, err := q.open([]byte(slice[sidx]))
+			if err != nil {
+				return err
+			}
+			err = fn(index, data)
+			if err != nil {
+				return err
+			}
+			index += 1
+		}
+		offset += size
 	}
-	return err
+	return nil
+}
+
+// Jobs are pushed onto the head of each list and fetched from the tail,
+// so walk each list backwards.
+func (q *redisQueue) Peek(n int) ([][]byte, error) {
+	result := make([][]byte, 0, n)
+	for _, key := range q.keys() {
+		if len(result) >= n {
+			break
+		}
+		slice, err := q.store.rclient.LRange(key, int64(len(result)-n), -1).Result()
+		if err != nil {
+			return nil, err
+		}
+		for idx := len(slice) - 1; idx >= 0; idx-- {
+			data, err := q.open([]byte(slice[idx]))
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, data)
+		}
+	}
+	return result, nil
 }
 
 func (q *redisQueue) Each(fn func(index int, data []byte) error) error {
@@ -64,19 +167,59 @@ func (q *redisQueue) Each(fn func(index int, data []byte) error) error {
 }
 
 func (q *redisQueue) Clear() (uint64, error) {
-	q.store.rclient.Unlink(q.name)
+	q.store.rclient.Unlink(q.keys()...)
 	q.store.rclient.SRem("queues", q.name)
 	delete(q.store.queueSet, q.name)
 	return 0, nil
 }
 
+func (q *redisQueue) Flush() (uint64, error) {
+	keys := q.keys()
+	sizes := make([]*redis.IntCmd, len(keys))
+	_, err := q.store.rclient.TxPipelined(func(pipe redis.Pipeliner) error {
+		for idx := range keys {
+			sizes[idx] = pipe.LLen(keys[idx])
+		}
+		pipe.Unlink(keys...)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	var count uint64
+	for idx := range sizes {
+		count += uint64(sizes[idx].Val())
+	}
+	return count, nil
+}
+
 func (q *redisQueue) init() error {
 	util.Debugf("Queue init: %s %d elements", q.name, q.Size())
 	return nil
 }
 
+func (q *redisQueue) keys() []string {
+	return PriorityKeys(q.name)
+}
+
 func (q *redisQueue) Size() uint64 {
-	return uint64(q.store.rclient.LLen(q.name).Val())
+	keys := q.keys()
+	sizes := make([]*redis.IntCmd, len(keys))
+	_, err := q.store.rclient.Pipelined(func(pipe redis.Pipeliner) error {
+		for idx := range keys {
+			sizes[idx] = pipe.LLen(keys[idx])
+		}
+		return nil
+	})
+	if err != nil {
+		return 0
+	}
+
+	total := uint64(0)
+	for idx := range sizes {
+		total += uint64(sizes[idx].Val())
+	}
+	return total
 }
 
 func (q *redisQueue) Add(job *client.Job) error {
@@ -86,12 +229,125 @@ func (q *redisQueue) Add(job *client.Job) error {
 		return err
 	}
 
-	return q.Push(data)
+	return q.PushPriority(job.Priority, data)
 }
 
 func (q *redisQueue) Push(payload []byte) error {
-	q.store.rclient.LPush(q.name, payload)
-	return nil
+	return q.PushPriority(DefaultPriority, payload)
+}
+
+func (q *redisQueue) PushPriority(priority int, payload []byte) error {
+	if priority != 0 && (priority < MinPriority || priority > MaxPriority) {
+		return fmt.Errorf("Invalid priority %d, must be between %d and %d", priority, MinPriority, MaxPriority)
+	}
+	payload, err := q.seal(payload)
+	if err != nil {
+		return err
+	}
+	return q.store.retryWrite(func() error {
+		return q.store.rclient.LPush(priorityKey(q.name, priority), payload).Err()
+	})
+}
+
+func (q *redisQueue) PushBack(priority int, payload []byte) error {
+	if priority != 0 && (priority < MinPriority || priority > MaxPriority) {
+		return fmt.Errorf("Invalid priority %d, must be between %d and %d", priority, MinPriority, MaxPriority)
+	}
+	payload, err := q.seal(payload)
+	if err != nil {
+		return err
+	}
+	return q.store.retryWrite(func() error {
+		return q.store.rclient.RPush(priorityKey(q.name, priority), payload).Err()
+	})
+}
+
+var ErrQueueFull = errors.New("queue full")
+
+// The size check and the push, and the removal of the next job when
+// +dropNext+ is set, happen in one transaction so concurrent pushes
+// can't take the queue past its limit.
+func (q *redisQueue) PushBounded(priority int, payload []byte, limit uint64, dropNext bool) ([]byte, error) {
+	if priority != 0 && (priority < MinPriority || priority > MaxPriority) {
+		return nil, fmt.Errorf("Invalid priority %d, must be between %d and %d", priority, MinPriority, MaxPriority)
+	}
+	payload, err := q.seal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := q.keys()
+	for i := 0; i < maxTransferAttempts; i++ {
+		var dropped []byte
+		err := q.store.rclient.Watch(func(tx *redis.Tx) error {
+			dropped = nil
+			size := uint64(0)
+			next := ""
+			for _, key := range keys {
+				count, err := tx.LLen(key).Result()
+				if err != nil {
+					return err
+				}
+				if count > 0 && next == "" {
+					next = key
+				}
+				size += uint64(count)
+			}
+
+			if size >= limit && !dropNext {
+				return fmt.Errorf("%w: %s holds %d jobs", ErrQueueFull, q.name, limit)
+			}
+			var drop *redis.StringCmd
+			_, err := tx.TxPipelined(func(pipe redis.Pipeliner) error {
+				if size >= limit && next != "" {
+					drop = pipe.RPop(next)
+				}
+				pipe.LPush(priorityKey(q.name, priority), payload)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if drop != nil {
+				dropped, err = q.open([]byte(drop.Val()))
+			}
+			return err
+		}, keys...)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		return dropped, err
+	}
+	return nil, fmt.Errorf("Unable to push to %s, the queue is too busy", q.name)
+}
+
+// Each list is fetched from its tail, highest priority first.
+func (q *redisQueue) TakeMatching(limit int, match func(data []byte) bool) ([]byte, error) {
+	for _, key := range q.keys() {
+		if limit <= 0 {
+			break
+		}
+		vals, err := q.store.rclient.LRange(key, int64(-limit), -1).Result()
+		if err != nil {
+			return nil, err
+		}
+		limit -= len(vals)
+		for idx := len(vals) - 1; idx >= 0; idx-- {
+			data, err := q.open([]byte(vals[idx]))
+			if err != nil || !match(data) {
+				continue
+			}
+			count, err := q.store.rclient.LRem(key, 1, vals[idx]).Result()
+			if err != nil {
+				return nil, err
+			}
+			// otherwise fetched by someone else in the meantime
+			if count == 1 {
+				return []byte(vals[idx]), nil
+			}
+		}
+	}
+	return nil, nil
 }
 
 // non-blocking, returns immediately if there's nothing enqueued
@@ -104,15 +360,20 @@ func (q *redisQueue) Pop() ([]byte, error) {
 }
 
 func (q *redisQueue) _pop() ([]byte, error) {
-	val, err := q.store.rclient.RPop(q.name).Result()
-	if val == "" {
-		return nil, nil
+	for _, key := range q.keys() {
+		val, err := q.store.rclient.RPop(key).Result()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		if val != "" {
+			return q.open([]byte(val))
+		}
 	}
-	return []byte(val), err
+	return nil, nil
 }
 
 func (q *redisQueue) BPop(ctx context.Context) ([]byte, error) {
-	val, err := q.store.rclient.BRPop(2*time.Second, q.name).Result()
+	val, err := q.store.rclient.BRPop(2*time.Second, q.keys()...).Result()
 	if err != nil {
 		if err == redis.Nil {
 			return nil, nil
@@ -120,16 +381,66 @@ func (q *redisQueue) BPop(ctx context.Context) ([]byte, error) {
 		return nil, err
 	}
 
-	return []byte(val[1]), nil
+	return q.open([]byte(val[1]))
+}
+
+func (q *redisQueue) seal(payload []byte) ([]byte, error) {
+	if q.store.cipher == nil {
+		return payload, nil
+	}
+	return q.store.cipher.Seal(payload)
+}
+
+// Payloads pushed before encryption was enabled are returned as-is,
+// it's up to the caller to decide whether to accept them.
+func (q *redisQueue) open(payload []byte) ([]byte, error) {
+	if q.store.cipher == nil {
+		return payload, nil
+	}
+	data, err := q.store.cipher.Open(payload)
+	if err == ErrUnencrypted {
+		return payload, nil
+	}
+	return data, err
 }
 
 func (q *redisQueue) Delete(vals [][]byte) error {
+	keys := q.keys()
 	for idx := range vals {
-		err := q.store.rclient.LRem(q.name, 1, vals[idx]).Err()
-		if err != nil {
-			return err
+		// sealing is deterministic so the stored value can be found
+		// directly, it may also have been pushed before encryption
+		// was enabled
+		members := [][]byte{vals[idx]}
+		if q.store.cipher != nil {
+			sealed, err := q.seal(vals[idx])
+			if err != nil {
+				return err
+			}
+			members = [][]byte{sealed, vals[idx]}
+		}
+		for _, member := range members {
+			removed, err := q.remove(keys, member)
+			if err != nil {
+				return err
+			}
+			if removed {
+				break
+			}
 		}
 	}
 
 	return nil
 }
+
+func (q *redisQueue) remove(keys []string, member []byte) (bool, error) {
+	for _, key := range keys {
+		count, err := q.store.rclient.LRem(key, 1, member).Result()
+		if err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -1,11 +1,14 @@
 package storage
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"sync/atomic"
 	"testing"
 
+	"github.com/contribsys/faktory/client"
 	"github.com/contribsys/faktory/util"
 	"github.com/stretchr/testify/assert"
 )
@@ -75,6 +78,114 @@ func TestBasicQueueOps(t *testing.T) {
 			assert.Error(t, err)
 		})
 
+		t.Run("Priority", func(t *testing.T) {
+			store.Flush()
+			q, err := store.GetQueue("default")
+			assert.NoError(t, err)
+			pq := q.(PriorityQueue)
+
+			err = pq.PushPriority(1, []byte("low"))
+			assert.NoError(t, err)
+			err = q.Push([]byte("normal"))
+			assert.NoError(t, err)
+			err = pq.PushPriority(9, []byte("high"))
+			assert.NoError(t, err)
+			err = pq.PushPriority(10, []byte("invalid"))
+			assert.Error(t, err)
+			assert.EqualValues(t, 3, q.Size())
+
+			values := []string{"high", "normal", "low"}
+			err = q.Each(func(idx int, value []byte) error {
+				assert.Equal(t, values[idx], string(value))
+				return nil
+			})
+			assert.NoError(t, err)
+
+			err = q.Page(1, 0, func(idx int, value []byte) error {
+				assert.Equal(t, "normal", string(value))
+				return nil
+			})
+			assert.NoError(t, err)
+
+			for _, expected := range values {
+				data, err := q.Pop()
+				assert.NoError(t, err)
+				assert.Equal(t, expected, string(data))
+			}
+			assert.EqualValues(t, 0, q.Size())
+		})
+
+		t.Run("Peek", func(t *testing.T) {
+			store.Flush()
+			q, err := store.GetQueue("default")
+			assert.NoError(t, err)
+			pq := q.(PriorityQueue)
+
+			assert.NoError(t, q.Push([]byte("first")))
+			assert.NoError(t, q.Push([]byte("second")))
+			assert.NoError(t, pq.PushPriority(9, []byte("urgent")))
+			assert.NoError(t, pq.PushPriority(1, []byte("later")))
+
+			peeked, err := q.Peek(3)
+			assert.NoError(t, err)
+			assert.Equal(t, [][]byte{[]byte("urgent"), []byte("first"), []byte("second")}, peeked)
+
+			peeked, err = q.Peek(10)
+			assert.NoError(t, err)
+			assert.Len(t, peeked, 4)
+			assert.EqualValues(t, 4, q.Size())
+		})
+
+		t.Run("Flush", func(t *testing.T) {
+			store.Flush()
+			q, err := store.GetQueue("default")
+			assert.NoError(t, err)
+			pq := q.(PriorityQueue)
+
+			assert.NoError(t, q.Push([]byte("first")))
+			assert.NoError(t, pq.PushPriority(9, []byte("urgent")))
+			assert.NoError(t, q.Pause())
+
+			count, err := q.Flush()
+			assert.NoError(t, err)
+			assert.EqualValues(t, 2, count)
+			assert.EqualValues(t, 0, q.Size())
+			assert.True(t, q.IsPaused())
+
+			count, err = q.Flush()
+			assert.NoError(t, err)
+			assert.EqualValues(t, 0, count)
+		})
+
+		t.Run("Transfer", func(t *testing.T) {
+			store.Flush()
+			src, err := store.GetQueue("thumbnails")
+			assert.NoError(t, err)
+			dst, err := store.GetQueue("thumbnails-retry")
+			assert.NoError(t, err)
+
+			job, err := src.(Transferable).TransferTo(dst)
+			assert.NoError(t, err)
+			assert.Nil(t, job)
+
+			pushed := client.NewJob("Resize", 1)
+			pushed.Queue = "thumbnails"
+			pushed.Priority = 9
+			assert.NoError(t, src.Add(pushed))
+
+			job, err = src.(Transferable).TransferTo(dst)
+			assert.NoError(t, err)
+			assert.Equal(t, pushed.Jid, job.Jid)
+			assert.Equal(t, "thumbnails-retry", job.Queue)
+			assert.EqualValues(t, 0, src.Size())
+			assert.EqualValues(t, 1, dst.Size())
+
+			data, err := dst.Pop()
+			assert.NoError(t, err)
+			assert.Contains(t, string(data), `"queue":"thumbnails-retry"`)
+			assert.Contains(t, string(data), `"priority":9`)
+		})
+
 		t.Run("heavy", func(t *testing.T) {
 			store.Flush()
 			q, err := store.GetQueue("default")
@@ -178,3 +289,89 @@ func fakeJob() (string, []byte) {
 	nows := util.Nows()
 	return jid, []byte(fmt.Sprintf(`{"jid":"%s","created_at":"%s","queue":"default","args":[1,2,3],"class":"SomeWorker"}`, jid, nows))
 }
+
+func TestDeclareQueue(t *testing.T) {
+	withRedis(t, "declare", func(t *testing.T, store Store) {
+		store.Flush()
+		configs, err := store.QueueConfigs()
+		assert.NoError(t, err)
+		assert.Empty(t, configs)
+
+		cfg := QueueConfig{MaxSize: 1000, Policy: "drop_oldest", Rate: 2.5, PriorityMode: "fifo"}
+		assert.NoError(t, store.DeclareQueue("thumbnails", cfg))
+		assert.Error(t, store.DeclareQueue("bad name", cfg))
+
+		configs, err = store.QueueConfigs()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]QueueConfig{"thumbnails": cfg}, configs)
+
+		found := false
+		store.EachQueue(func(q Queue) {
+			found = found || q.Name() == "thumbnails"
+		})
+		assert.True(t, found)
+	})
+}
+
+func TestRenameQueue(t *testing.T) {
+	withRedis(t, "rename", func(t *testing.T, store Store) {
+		store.Flush()
+		rs := store.(Renamable)
+
+		q, err := store.GetQueue("images")
+		assert.NoError(t, err)
+		for idx, priority := range []int{5, 9, 5} {
+			job := client.NewJob("Resize", idx)
+			job.Queue = "images"
+			job.Priority = priority
+			assert.NoError(t, q.Add(job))
+		}
+		assert.NoError(t, q.Pause())
+		assert.NoError(t, store.DeclareQueue("images", QueueConfig{Rate: 5}))
+
+		count, err := rs.RenameQueue("images", "thumbnails")
+		assert.NoError(t, err)
+		assert.EqualValues(t, 3, count)
+
+		_, err = rs.RenameQueue("images", "thumbnails")
+		assert.NoError(t, err)
+		_, err = rs.RenameQueue("images", "previews")
+		assert.True(t, errors.Is(err, ErrNoSuchQueue))
+		renames, err := rs.QueueRenames()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"images": "thumbnails"}, renames)
+
+		renamed, err := store.GetQueue("thumbnails")
+		assert.NoError(t, err)
+		assert.EqualValues(t, 3, renamed.Size())
+		assert.True(t, renamed.IsPaused())
+		configs, err := store.QueueConfigs()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]QueueConfig{"thumbnails": {Rate: 5}}, configs)
+
+		var args []interface{}
+		err = renamed.Each(func(_ int, data []byte) error {
+			var job client.Job
+			assert.NoError(t, json.Unmarshal(data, &job))
+			assert.Equal(t, "thumbnails", job.Queue)
+			args = append(args, job.Args[0])
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{1.0, 2.0, 0.0}, args)
+
+		_, err = store.GetQueue("other")
+		assert.NoError(t, err)
+		_, err = rs.RenameQueue("other", "thumbnails")
+		assert.True(t, errors.Is(err, ErrQueueNotEmpty))
+	})
+}
+
+func TestPriorityKeys(t *testing.T) {
+	keys := PriorityKeys("default")
+	assert.Equal(t, 9, len(keys))
+	assert.Equal(t, "default:p9", keys[0])
+	assert.Equal(t, "default", keys[4])
+	assert.Equal(t, "default:p1", keys[8])
+	assert.Equal(t, "default", priorityKey("default", 0))
+}
@@ -29,16 +29,22 @@ type redisStore struct {
 	retries   *redisSorted
 	dead      *redisSorted
 	working   *redisSorted
+	completed *redisSorted
+	waiting   *redisSorted
 
 	rclient *redis.Client
+	cipher  *PayloadCipher
+	// see retryWrite
+	writeRetries int
 }
 
 func NewRedisStore(name string, rclient *redis.Client) (Store, error) {
 	rs := &redisStore{
-		Name:     name,
-		mu:       sync.Mutex{},
-		queueSet: map[string]*redisQueue{},
-		rclient:  rclient,
+		Name:         name,
+		mu:           sync.Mutex{},
+		queueSet:     map[string]*redisQueue{},
+		rclient:      rclient,
+		writeRetries: DefaultWriteRetries,
 	}
 	rs.initSorted()
 
@@ -90,6 +96,11 @@ func bootRedis(path string, sock string) (func(), error) {
 	if err != nil {
 		//util.Debugf("Redis not alive, booting... -- %s", err)
 
+		err = restoreBackup(path)
+		if err != nil {
+			return nil, err
+		}
+
 		conffilename := "/tmp/redis.conf"
 		if _, err := os.Stat(conffilename); err != nil {
 			if err != nil && os.IsNotExist(err) {
@@ -110,7 +121,7 @@ func bootRedis(path string, sock string) (func(), error) {
 
 		logfile := fmt.Sprintf("%s/redis.log", path)
 		loglevel := "warning"
-		if util.LogDebug {
+		if util.DebugEnabled() {
 			loglevel = "notice"
 		}
 		arguments := []string{
@@ -229,6 +240,14 @@ func openRedis(sock string, poolSize int) (Store, error) {
 	return NewRedisStore(sock, rclient)
 }
 
+func (store *redisStore) SetCipher(pc *PayloadCipher) {
+	store.cipher = pc
+}
+
+func (store *redisStore) Cipher() *PayloadCipher {
+	return store.cipher
+}
+
 func (store *redisStore) Stats() map[string]string {
 	return map[string]string{
 		"stats": store.rclient.Info().String(),
@@ -353,6 +372,14 @@ func (store *redisStore) Dead() SortedSet {
 	return store.dead
 }
 
+func (store *redisStore) Completed() SortedSet {
+	return store.completed
+}
+
+func (store *redisStore) Waiting() SortedSet {
+	return store.waiting
+}
+
 func (store *redisStore) EnqueueAll(sset SortedSet) error {
 	return sset.Each(func(_ int, entry SortedEntry) error {
 		j, err := entry.Job()
@@ -419,6 +446,10 @@ var (
 	Stop = stopRedis
 )
 
+func init() {
+	Register("redis", openRedis)
+}
+
 const (
 	redisconf = `
 # DO NOT EDIT
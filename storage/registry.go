@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A Factory opens a Store.  For the Redis backend +path+ is the Unix
+// socket of an already booted Redis, other backends may treat it as a
+// file or directory.
+type Factory func(path string, poolSize int) (Store, error)
+
+var (
+	backendsMutex sync.RWMutex
+	backends      = map[string]Factory{}
+)
+
+// Register makes a storage backend available by name.  Backends
+// should call it from init() so importing the package is enough to
+// enable them.  Registering the same name twice panics.
+func Register(name string, factory Factory) {
+	backendsMutex.Lock()
+	defer backendsMutex.Unlock()
+
+	if factory == nil {
+		panic("storage: Register factory is nil")
+	}
+	if _, ok := backends[name]; ok {
+		panic("storage: Register called twice for backend " + name)
+	}
+	backends[name] = factory
+}
+
+// Backends returns the sorted names of the registered backends.
+func Backends() []string {
+	backendsMutex.RLock()
+	defer backendsMutex.RUnlock()
+
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OpenBackend opens a Store using the backend registered as +name+.
+func OpenBackend(name string, path string, poolSize int) (Store, error) {
+	backendsMutex.RLock()
+	factory, ok := backends[name]
+	backendsMutex.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown storage backend %q, available: %s", name, strings.Join(Backends(), ", "))
+	}
+	return factory(path, poolSize)
+}
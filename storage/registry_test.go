@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	assert.Contains(t, Backends(), "redis")
+
+	var opened string
+	Register("fake", func(path string, poolSize int) (Store, error) {
+		opened = path
+		return nil, nil
+	})
+	defer func() {
+		backendsMutex.Lock()
+		delete(backends, "fake")
+		backendsMutex.Unlock()
+	}()
+
+	_, err := OpenBackend("fake", "/tmp/fake.db", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, "/tmp/fake.db", opened)
+
+	assert.Panics(t, func() {
+		Register("fake", func(string, int) (Store, error) { return nil, nil })
+	})
+
+	_, err = OpenBackend("rocksdb", "/tmp/fake.db", 10)
+	assert.EqualError(t, err, `unknown storage backend "rocksdb", available: fake, redis`)
+}
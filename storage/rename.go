@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/go-redis/redis"
+)
+
+var (
+	ErrNoSuchQueue   = errors.New("no such queue")
+	ErrQueueNotEmpty = errors.New("queue is not empty")
+	// Some of the jobs were moved, renaming again finishes the move.
+	ErrRenameIncomplete = errors.New("rename incomplete")
+)
+
+// Stores which can rename a queue: its paused state and declared config
+// move to the new name in one transaction, then its jobs are moved in
+// chunks.  The old name is recorded so jobs which still name it, e.g. in
+// the retry set, can be sent to the new queue.
+type Renamable interface {
+	// Returns the number of jobs moved.  The new queue must be empty.
+	RenameQueue(from, to string) (uint64, error)
+	// Old queue name -> new name, for every queue which has been renamed.
+	QueueRenames() (map[string]string, error)
+}
+
+const (
+	queueRenamesKey = "queue-renames"
+	renameChunkSize = 500
+)
+
+func (store *redisStore) QueueRenames() (map[string]string, error) {
+	return store.rclient.HGetAll(queueRenamesKey).Result()
+}
+
+func (store *redisStore) RenameQueue(from, to string) (uint64, error) {
+	if from == to {
+		return 0, fmt.Errorf("queue is already named %s", to)
+	}
+	if !ValidQueueName.MatchString(to) {
+		return 0, fmt.Errorf("queue names must match %v", ValidQueueName)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	src, ok := store.queueSet[from]
+	if ok {
+		err := store.renameSettings(src, to)
+		if err != nil {
+			return 0, err
+		}
+		delete(store.queueSet, from)
+		store.queueSet[to] = store.NewQueue(to)
+	} else {
+		// finish an incomplete rename
+		current, err := store.rclient.HGet(queueRenamesKey, from).Result()
+		if err != nil && err != redis.Nil {
+			return 0, err
+		}
+		if current != to {
+			return 0, fmt.Errorf("%w %s", ErrNoSuchQueue, from)
+		}
+		src = store.NewQueue(from)
+	}
+
+	count := uint64(0)
+	for p := MinPriority; p <= MaxPriority; p++ {
+		for {
+			moved, err := src.moveChunk(priorityKey(from, p), priorityKey(to, p), to)
+			if err != nil {
+				return count, fmt.Errorf("%w, %d jobs moved: %v", ErrRenameIncomplete, count, err)
+			}
+			if moved == 0 {
+				break
+			}
+			count += moved
+		}
+	}
+	return count, nil
+}
+
+// Check the new queue is empty and move the old queue's paused state
+// and declared config, recording the rename.
+func (store *redisStore) renameSettings(src *redisQueue, to string) error {
+	keys := append(src.keys(), PriorityKeys(to)...)
+	for i := 0; i < maxTransferAttempts; i++ {
+		err := store.rclient.Watch(func(tx *redis.Tx) error {
+			for _, key := range PriorityKeys(to) {
+				size, err := tx.LLen(key).Result()
+				if err != nil {
+					return err
+				}
+				if size > 0 {
+					return fmt.Errorf("%w: %s", ErrQueueNotEmpty, to)
+				}
+			}
+
+			paused, err := tx.SIsMember("paused", src.name).Result()
+			if err != nil {
+				return err
+			}
+			cfg, err := tx.HGet(queueConfigsKey, src.name).Result()
+			if err != nil && err != redis.Nil {
+				return err
+			}
+			declared := err == nil
+			renames, err := tx.HGetAll(queueRenamesKey).Result()
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.TxPipelined(func(pipe redis.Pipeliner) error {
+				pipe.SRem("queues", src.name)
+				pipe.SAdd("queues", to)
+				if paused {
+					pipe.SRem("paused", src.name)
+					pipe.SAdd("paused", to)
+				}
+				if declared {
+					pipe.HDel(queueConfigsKey, src.name)
+					pipe.HSet(queueConfigsKey, to, cfg)
+				}
+				// the new name is in use again
+				pipe.HDel(queueRenamesKey, to)
+				for old, current := range renames {
+					// renamed more than once, point straight to the latest name
+					if current == src.name {
+						pipe.HSet(queueRenamesKey, old, to)
+					}
+				}
+				pipe.HSet(queueRenamesKey, src.name, to)
+				return nil
+			})
+			return err
+		}, append(keys, "paused", queueConfigsKey, queueRenamesKey)...)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		return err
+	}
+	return fmt.Errorf("Unable to rename %s, the queue is too busy", src.name)
+}
+
+// Move up to renameChunkSize jobs from the head of +srcKey+ to the tail
+// of +dstKey+, so the oldest jobs stay at the tail once every chunk has
+// moved.  Each job's payload names its queue so they're rewritten rather
+// than moved with RENAME.
+func (q *redisQueue) moveChunk(srcKey, dstKey, to string) (uint64, error) {
+	for i := 0; i < maxTransferAttempts; i++ {
+		var count uint64
+		err := q.store.rclient.Watch(func(tx *redis.Tx) error {
+			vals, err := tx.LRange(srcKey, 0, renameChunkSize-1).Result()
+			if err != nil {
+				return err
+			}
+			if len(vals) == 0 {
+				return nil
+			}
+			moved := make([]interface{}, len(vals))
+			for idx, val := range vals {
+				data, err := q.renamePayload([]byte(val), to)
+				if err != nil {
+					return err
+				}
+				moved[idx] = data
+			}
+
+			_, err = tx.TxPipelined(func(pipe redis.Pipeliner) error {
+				pipe.LTrim(srcKey, int64(len(vals)), -1)
+				// LRANGE returns head to tail, RPUSH keeps that order
+				pipe.RPush(dstKey, moved...)
+				return nil
+			})
+			count = uint64(len(vals))
+			return err
+		}, srcKey)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		return count, err
+	}
+	return 0, fmt.Errorf("Unable to rename %s, the queue is too busy", q.name)
+}
+
+func (q *redisQueue) renamePayload(payload []byte, to string) ([]byte, error) {
+	data, err := q.open(payload)
+	if err != nil {
+		return nil, err
+	}
+	var job client.Job
+	err = json.Unmarshal(data, &job)
+	if err != nil {
+		return nil, err
+	}
+	job.Queue = to
+	data, err = json.Marshal(&job)
+	if err != nil {
+		return nil, err
+	}
+	return q.seal(data)
+}
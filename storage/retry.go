@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// The number of times a failed write is retried unless the server's
+// storage_write_retries option says otherwise.
+const DefaultWriteRetries = 3
+
+// The delay before the first retry of a failed write, doubled for each
+// retry after that.
+const writeRetryDelay = 10 * time.Millisecond
+
+// Stores which retry writes that fail transiently, see IsRetryable.
+type WriteRetrier interface {
+	SetWriteRetries(retries int)
+}
+
+// Replies Redis sends while it can't serve a write for now, e.g. while
+// loading its dataset after a restart or running a slow script.
+var retryableReplies = []string{"LOADING", "BUSY", "TRYAGAIN", "MASTERDOWN", "CLUSTERDOWN"}
+
+// IsRetryable is true if the error is likely to go away by itself: a
+// network error or Redis being temporarily unable to serve requests.
+// Errors such as a full disk or invalid data are not retryable.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var ne net.Error
+	if errors.As(err, &ne) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	msg := err.Error()
+	for _, reply := range retryableReplies {
+		if strings.HasPrefix(msg, reply+" ") || msg == reply {
+			return true
+		}
+	}
+	return false
+}
+
+func (store *redisStore) SetWriteRetries(retries int) {
+	store.writeRetries = retries
+}
+
+// Call the write, retrying transient errors up to writeRetries times
+// 10, 20, 40ms... apart.  A write whose reply was lost may have been
+// applied so a retried push can enqueue a job twice, which Faktory's
+// at-least-once delivery allows for anyway.
+func (store *redisStore) retryWrite(write func() error) error {
+	err := write()
+	delay := writeRetryDelay
+	for attempt := 0; attempt < store.writeRetries && IsRetryable(err); attempt++ {
+		time.Sleep(delay)
+		delay *= 2
+		err = write()
+	}
+	return err
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRetryable(t *testing.T) {
+	t.Parallel()
+
+	assert.False(t, IsRetryable(nil))
+	assert.True(t, IsRetryable(&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}))
+	assert.True(t, IsRetryable(io.EOF))
+	assert.True(t, IsRetryable(fmt.Errorf("push failed: %w", io.ErrUnexpectedEOF)))
+	assert.True(t, IsRetryable(errors.New("LOADING Redis is loading the dataset in memory")))
+	assert.True(t, IsRetryable(errors.New("BUSY Redis is busy running a script")))
+
+	assert.False(t, IsRetryable(errors.New("OOM command not allowed when used memory > 'maxmemory'")))
+	assert.False(t, IsRetryable(errors.New("MISCONF Redis is configured to save RDB snapshots")))
+	assert.False(t, IsRetryable(errors.New("BUSYKEY Target key name already exists")))
+}
+
+func TestRetryWrite(t *testing.T) {
+	t.Parallel()
+
+	store := &redisStore{writeRetries: 3}
+	attempts := 0
+	start := time.Now()
+	err := store.retryWrite(func() error {
+		attempts++
+		if attempts < 3 {
+			return io.EOF
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+	// 10 + 20ms
+	assert.True(t, time.Since(start) >= 30*time.Millisecond)
+
+	attempts = 0
+	err = store.retryWrite(func() error {
+		attempts++
+		return io.EOF
+	})
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 4, attempts)
+
+	attempts = 0
+	err = store.retryWrite(func() error {
+		attempts++
+		return errors.New("OOM command not allowed")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+
+	store.SetWriteRetries(0)
+	attempts = 0
+	_ = store.retryWrite(func() error {
+		attempts++
+		return io.EOF
+	})
+	assert.Equal(t, 1, attempts)
+}
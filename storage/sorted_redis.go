@@ -23,6 +23,8 @@ func (rs *redisStore) initSorted() {
 	rs.retries = &redisSorted{name: "retries", store: rs}
 	rs.dead = &redisSorted{name: "dead", store: rs}
 	rs.working = &redisSorted{name: "working", store: rs}
+	rs.completed = &redisSorted{name: "completed", store: rs}
+	rs.waiting = &redisSorted{name: "waiting", store: rs}
 }
 
 func (rs *redisSorted) Name() string {
@@ -37,6 +39,19 @@ func (rs *redisSorted) Clear() error {
 	return rs.store.rclient.Unlink(rs.name).Err()
 }
 
+func (rs *redisSorted) Flush() (uint64, error) {
+	var size *redis.IntCmd
+	_, err := rs.store.rclient.TxPipelined(func(pipe redis.Pipeliner) error {
+		size = pipe.ZCard(rs.name)
+		pipe.Unlink(rs.name)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return uint64(size.Val()), nil
+}
+
 func (rs *redisSorted) Add(job *client.Job) error {
 	if job.At == "" {
 		return errors.New("Job does not have an At timestamp")
@@ -50,7 +65,42 @@ func (rs *redisSorted) Add(job *client.Job) error {
 }
 
 func (rs *redisSorted) RemoveEntry(ent SortedEntry) error {
-	return rs.store.rclient.ZRem(rs.name, ent.Value()).Err()
+	member := ent.Value()
+	if se, ok := ent.(*setEntry); ok {
+		member = se.member
+	}
+	return rs.store.rclient.ZRem(rs.name, member).Err()
+}
+
+// Elements are sealed like queued jobs when the store has a cipher.
+func (rs *redisSorted) seal(jid string, payload []byte) ([]byte, error) {
+	if rs.store.cipher == nil {
+		return payload, nil
+	}
+	return rs.store.cipher.SealFor(jid, payload)
+}
+
+// Elements added before encryption was enabled are returned as-is.
+func (rs *redisSorted) open(member []byte) ([]byte, error) {
+	if rs.store.cipher == nil {
+		return member, nil
+	}
+	data, err := rs.store.cipher.Open(member)
+	if err == ErrUnencrypted {
+		return member, nil
+	}
+	return data, err
+}
+
+// An entry for the stored element, its Value is the opened payload.
+func (rs *redisSorted) entry(score float64, member string) (*setEntry, error) {
+	data, err := rs.open([]byte(member))
+	if err != nil {
+		return nil, err
+	}
+	ent := NewEntry(score, data)
+	ent.member = []byte(member)
+	return ent, nil
 }
 
 func (rs *redisSorted) AddElement(timestamp string, jid string, payload []byte) error {
@@ -58,9 +108,14 @@ func (rs *redisSorted) AddElement(timestamp string, jid string, payload []byte)
 	if err != nil {
 		return err
 	}
+	payload, err = rs.seal(jid, payload)
+	if err != nil {
+		return err
+	}
 	time_f := float64(tim.Unix()) + (float64(tim.Nanosecond()) / 1000000000)
-	_, err = rs.store.rclient.ZAdd(rs.name, redis.Z{Score: time_f, Member: payload}).Result()
-	return err
+	return rs.store.retryWrite(func() error {
+		return rs.store.rclient.ZAdd(rs.name, redis.Z{Score: time_f, Member: payload}).Err()
+	})
 }
 
 func decompose(key []byte) (float64, string, error) {
@@ -99,14 +154,8 @@ func (rs *redisSorted) Get(key []byte) (SortedEntry, error) {
 	if len(elms) == 0 {
 		return nil, nil
 	}
-	if len(elms) == 1 {
-		return NewEntry(time_f, []byte(elms[0])), nil
-	}
-
-	for idx := range elms {
-		if strings.Index(elms[idx], jid) > 0 {
-			return NewEntry(time_f, []byte(elms[idx])), nil
-		}
+	if elm := matching(elms, jid); elm != "" {
+		return rs.entry(time_f, elm)
 	}
 	return nil, nil
 }
@@ -114,6 +163,8 @@ func (rs *redisSorted) Get(key []byte) (SortedEntry, error) {
 type setEntry struct {
 	value []byte
 	score float64
+	// as stored, value may have been opened from it
+	member []byte
 	// these two are lazy-loaded
 	job *client.Job
 	key []byte
@@ -121,8 +172,9 @@ type setEntry struct {
 
 func NewEntry(score float64, value []byte) *setEntry {
 	return &setEntry{
-		value: value,
-		score: score,
+		value:  value,
+		score:  score,
+		member: value,
 	}
 }
 
@@ -175,7 +227,11 @@ func (rs *redisSorted) Find(match string, fn func(index int, e SortedEntry) erro
 		if err != nil {
 			return err
 		}
-		if err := fn(idx, NewEntry(sf, []byte(job))); err != nil {
+		ent, err := rs.entry(sf, job)
+		if err != nil {
+			return err
+		}
+		if err := fn(idx, ent); err != nil {
 			return err
 		}
 		idx += 1
@@ -193,7 +249,11 @@ func (rs *redisSorted) Page(start int, count int, fn func(index int, e SortedEnt
 	}
 
 	for idx := range zs {
-		err = fn(idx, NewEntry(zs[idx].Score, []byte(zs[idx].Member.(string))))
+		ent, err := rs.entry(zs[idx].Score, zs[idx].Member.(string))
+		if err != nil {
+			return idx, err
+		}
+		err = fn(idx, ent)
 		if err != nil {
 			return idx, err
 		}
@@ -224,21 +284,25 @@ func (rs *redisSorted) rem(time_f float64, jid string) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	if len(elms) == 0 {
+	elm := matching(elms, jid)
+	if elm == "" {
 		return false, nil
 	}
+	count, err := rs.store.rclient.ZRem(rs.name, elm).Result()
+	return count == 1, err
+}
+
+// Several elements may share a timestamp, pick the one for jid.
+func matching(elms []string, jid string) string {
 	if len(elms) == 1 {
-		count, err := rs.store.rclient.ZRem(rs.name, elms[0]).Result()
-		return count == 1, err
+		return elms[0]
 	}
-
 	for idx := range elms {
 		if strings.Index(elms[idx], jid) > 0 {
-			count, err := rs.store.rclient.ZRem(rs.name, elms[idx]).Result()
-			return count == 1, err
+			return elms[idx]
 		}
 	}
-	return false, nil
+	return ""
 }
 
 // bool = was it removed?
@@ -285,7 +349,11 @@ func (rs *redisSorted) RemoveBefore(timestamp string, maxCount int64, fn func(da
 			return count, err
 		}
 		if cnt == 1 {
-			err = fn([]byte(j))
+			var data []byte
+			data, err = rs.open([]byte(j))
+			if err == nil {
+				err = fn(data)
+			}
 			if err != nil {
 				util.Warnf("Unable to process timed job: %v", err)
 				continue
@@ -297,19 +365,105 @@ func (rs *redisSorted) RemoveBefore(timestamp string, maxCount int64, fn func(da
 }
 
 func (rs *redisSorted) MoveTo(sset SortedSet, entry SortedEntry, newtime time.Time) error {
-	job, err := entry.Job()
+	key, err := entry.Key()
 	if err != nil {
 		return err
 	}
-
-	cnt, err := rs.store.rclient.ZRem(rs.name, string(entry.Value())).Result()
+	time_f, jid, err := decompose(key)
 	if err != nil {
 		return err
 	}
-	if cnt == 0 {
-		// race condition, element was removed or moved elsewhere
-		return nil
+	newtime_f := float64(newtime.Unix()) + (float64(newtime.Nanosecond()) / 1000000000)
+	// if the element was already removed or moved elsewhere, there's
+	// nothing to do
+	_, err = rs.move(sset, time_f, jid, newtime_f)
+	return err
+}
+
+func (rs *redisSorted) MoveIfPresent(timestamp string, jid string, dst SortedSet) (bool, error) {
+	tim, err := util.ParseTime(timestamp)
+	if err != nil {
+		return false, err
 	}
+	time_f := float64(tim.Unix()) + (float64(tim.Nanosecond()) / 1000000000)
+	return rs.move(dst, time_f, jid, time_f)
+}
 
-	return sset.AddElement(util.Thens(newtime), job.Jid, entry.Value())
+func (rs *redisSorted) ReplaceElement(timestamp string, jid string, payload []byte) (bool, error) {
+	tim, err := util.ParseTime(timestamp)
+	if err != nil {
+		return false, err
+	}
+	payload, err = rs.seal(jid, payload)
+	if err != nil {
+		return false, err
+	}
+	time_f := float64(tim.Unix()) + (float64(tim.Nanosecond()) / 1000000000)
+	strf := strconv.FormatFloat(time_f, 'f', -1, 64)
+
+	for i := 0; i < maxTransferAttempts; i++ {
+		replaced := false
+		err := rs.store.rclient.Watch(func(tx *redis.Tx) error {
+			elms, err := tx.ZRangeByScore(rs.name, redis.ZRangeBy{Min: strf, Max: strf}).Result()
+			if err != nil {
+				return err
+			}
+			elm := matching(elms, jid)
+			if elm == "" {
+				return nil
+			}
+			if elm == string(payload) {
+				replaced = true
+				return nil
+			}
+			_, err = tx.TxPipelined(func(pipe redis.Pipeliner) error {
+				pipe.ZAdd(rs.name, redis.Z{Score: time_f, Member: payload})
+				pipe.ZRem(rs.name, elm)
+				return nil
+			})
+			replaced = err == nil
+			return err
+		}, rs.name)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		return replaced, err
+	}
+	return false, fmt.Errorf("Unable to replace %s in %s, the set is too busy", jid, rs.name)
+}
+
+// Remove the element from this set and add it to dst in a MULTI,
+// retrying if another client changes this set while we're looking
+// at it.
+func (rs *redisSorted) move(dst SortedSet, time_f float64, jid string, newtime_f float64) (bool, error) {
+	if _, ok := dst.(*redisSorted); !ok {
+		return false, fmt.Errorf("Unable to move to %s, not a Redis sorted set", dst.Name())
+	}
+	strf := strconv.FormatFloat(time_f, 'f', -1, 64)
+
+	for i := 0; i < maxTransferAttempts; i++ {
+		moved := false
+		err := rs.store.rclient.Watch(func(tx *redis.Tx) error {
+			elms, err := tx.ZRangeByScore(rs.name, redis.ZRangeBy{Min: strf, Max: strf}).Result()
+			if err != nil {
+				return err
+			}
+			elm := matching(elms, jid)
+			if elm == "" {
+				return nil
+			}
+			_, err = tx.TxPipelined(func(pipe redis.Pipeliner) error {
+				pipe.ZRem(rs.name, elm)
+				pipe.ZAdd(dst.Name(), redis.Z{Score: newtime_f, Member: elm})
+				return nil
+			})
+			moved = err == nil
+			return err
+		}, rs.name)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		return moved, err
+	}
+	return false, fmt.Errorf("Unable to move %s from %s, the set is too busy", jid, rs.name)
 }
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"bytes"
 	"fmt"
 	"testing"
 	"time"
@@ -51,6 +52,33 @@ func TestBasicSortedOps(t *testing.T) {
 			})
 			assert.NoError(t, err)
 			assert.EqualValues(t, 6, spcount)
+
+			job := client.NewJob("FindMe", 1)
+			job.At = util.Nows()
+			err = sset.Add(job)
+			assert.NoError(t, err)
+
+			entry, err := FindByJid(sset, job.Jid)
+			assert.NoError(t, err)
+			assert.NotNil(t, entry)
+			j, err := entry.Job()
+			assert.NoError(t, err)
+			assert.Equal(t, "FindMe", j.Type)
+
+			entry, err = FindByJid(sset, "nosuchjid*")
+			assert.NoError(t, err)
+			assert.Nil(t, entry)
+
+			jobs, err := FindByType(sset, "SpecialType", 100)
+			assert.NoError(t, err)
+			assert.Len(t, jobs, 6)
+			jobs, err = FindByType(sset, "SpecialType", 2)
+			assert.NoError(t, err)
+			assert.Len(t, jobs, 2)
+			jobs, err = FindByType(sset, "Special", 100)
+			assert.NoError(t, err)
+			assert.Len(t, jobs, 0)
+
 			err = sset.Clear()
 			assert.NoError(t, err)
 		})
@@ -186,5 +214,83 @@ func TestBasicSortedOps(t *testing.T) {
 			assert.EqualValues(t, 1, store.Dead().Size())
 
 		})
+
+		t.Run("MoveIfPresent", func(t *testing.T) {
+			store.Flush()
+			dead := store.Dead()
+			retries := store.Retries()
+
+			job := client.NewJob("Report")
+			at := util.Thens(time.Now())
+			err := dead.AddElement(at, job.Jid, []byte(`{"jid":"`+job.Jid+`"}`))
+			assert.NoError(t, err)
+
+			moved, err := dead.MoveIfPresent(at, job.Jid, retries)
+			assert.NoError(t, err)
+			assert.True(t, moved)
+			assert.EqualValues(t, 0, dead.Size())
+			assert.EqualValues(t, 1, retries.Size())
+
+			// someone else got there first
+			moved, err = dead.MoveIfPresent(at, job.Jid, retries)
+			assert.NoError(t, err)
+			assert.False(t, moved)
+			assert.EqualValues(t, 1, retries.Size())
+		})
+
+		t.Run("Flush", func(t *testing.T) {
+			store.Flush()
+			retries := store.Retries()
+			for i := 0; i < 2; i++ {
+				job := client.NewJob("Report")
+				job.At = util.Thens(time.Now())
+				assert.NoError(t, retries.Add(job))
+			}
+
+			count, err := retries.Flush()
+			assert.NoError(t, err)
+			assert.EqualValues(t, 2, count)
+			assert.EqualValues(t, 0, retries.Size())
+		})
+	})
+}
+
+func TestEncryptedSets(t *testing.T) {
+	withRedis(t, "encrypted", func(t *testing.T, store Store) {
+		store.Flush()
+		pc, err := NewPayloadCipher(bytes.Repeat([]byte{7}, 32))
+		assert.NoError(t, err)
+		store.(Encryptable).SetCipher(pc)
+
+		job := client.NewJob("ChargeCard", "4111-1111-1111-1111")
+		job.At = util.Nows()
+		sset := store.Retries()
+		assert.NoError(t, sset.Add(job))
+
+		raw, err := store.Redis().ZRange("retries", 0, -1).Result()
+		assert.NoError(t, err)
+		assert.Len(t, raw, 1)
+		assert.NotContains(t, raw[0], "4111")
+
+		found, err := FindByJid(sset, job.Jid)
+		assert.NoError(t, err)
+		assert.NotNil(t, found)
+		opened, err := found.Job()
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{"4111-1111-1111-1111"}, opened.Args)
+		assert.NoError(t, sset.RemoveEntry(found))
+		assert.EqualValues(t, 0, sset.Size())
+
+		// found by the value a listing returns
+		q, err := store.GetQueue("default")
+		assert.NoError(t, err)
+		assert.NoError(t, q.Add(job))
+		var listed []byte
+		assert.NoError(t, q.Each(func(_ int, data []byte) error {
+			listed = data
+			return nil
+		}))
+		assert.NoError(t, q.Delete([][]byte{listed}))
+		assert.EqualValues(t, 0, q.Size())
 	})
 }
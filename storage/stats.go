@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ParsedStats picks the key metrics out of Redis's INFO, which Stats
+// returns as several kilobytes of raw text.
+func (store *redisStore) ParsedStats() (map[string]interface{}, error) {
+	info, err := store.rclient.Info().Result()
+	if err != nil {
+		return nil, err
+	}
+	return parseInfo(info), nil
+}
+
+func parseInfo(info string) map[string]interface{} {
+	fields := infoFields(info)
+
+	integer := func(name string) int64 {
+		val, _ := strconv.ParseInt(fields[name], 10, 64)
+		return val
+	}
+	float := func(name string) float64 {
+		val, _ := strconv.ParseFloat(fields[name], 64)
+		return val
+	}
+
+	hits, misses := integer("keyspace_hits"), integer("keyspace_misses")
+	hitRate := 0.0
+	if hits+misses > 0 {
+		hitRate = float64(hits) / float64(hits+misses)
+	}
+
+	// "db0:keys=12,expires=0,avg_ttl=0"
+	keys := int64(0)
+	for name, val := range fields {
+		if !strings.HasPrefix(name, "db") {
+			continue
+		}
+		for _, pair := range strings.Split(val, ",") {
+			if strings.HasPrefix(pair, "keys=") {
+				count, _ := strconv.ParseInt(pair[len("keys="):], 10, 64)
+				keys += count
+			}
+		}
+	}
+
+	return map[string]interface{}{
+		"redis_version":           fields["redis_version"],
+		"used_memory_bytes":       integer("used_memory"),
+		"used_memory_peak_bytes":  integer("used_memory_peak"),
+		"mem_fragmentation_ratio": float("mem_fragmentation_ratio"),
+		"keyspace_hit_rate":       hitRate,
+		"evicted_keys":            integer("evicted_keys"),
+		"keys":                    keys,
+		"connected_clients":       integer("connected_clients"),
+		"ops_per_sec":             integer("instantaneous_ops_per_sec"),
+	}
+}
@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseInfo(t *testing.T) {
+	t.Parallel()
+
+	info := "# Server\r\nredis_version:6.2.6\r\n\r\n# Clients\r\nconnected_clients:12\r\n" +
+		"# Memory\r\nused_memory:1048576\r\nused_memory_peak:2097152\r\nmem_fragmentation_ratio:1.25\r\n" +
+		"# Stats\r\ninstantaneous_ops_per_sec:340\r\nkeyspace_hits:75\r\nkeyspace_misses:25\r\nevicted_keys:0\r\n" +
+		"# Keyspace\r\ndb0:keys=10,expires=1,avg_ttl=0\r\ndb1:keys=5,expires=0,avg_ttl=0\r\n"
+
+	stats := parseInfo(info)
+	assert.Equal(t, "6.2.6", stats["redis_version"])
+	assert.EqualValues(t, 12, stats["connected_clients"])
+	assert.EqualValues(t, 1048576, stats["used_memory_bytes"])
+	assert.EqualValues(t, 2097152, stats["used_memory_peak_bytes"])
+	assert.Equal(t, 1.25, stats["mem_fragmentation_ratio"])
+	assert.EqualValues(t, 340, stats["ops_per_sec"])
+	assert.Equal(t, 0.75, stats["keyspace_hit_rate"])
+	assert.EqualValues(t, 15, stats["keys"])
+
+	// a fresh server has had no lookups
+	stats = parseInfo("# Stats\r\nkeyspace_hits:0\r\nkeyspace_misses:0\r\n")
+	assert.Equal(t, 0.0, stats["keyspace_hit_rate"])
+	assert.EqualValues(t, 0, stats["keys"])
+}
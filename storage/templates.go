@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"encoding/json"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/go-redis/redis"
+)
+
+const templatesKey = "templates"
+
+// PushTemplate saves a job for other jobs to inherit from by naming
+// its JID as their "base_jid", replacing any template with that JID.
+// Templates are kept until the store is flushed.
+func (store *redisStore) PushTemplate(job *client.Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	if store.cipher != nil {
+		data, err = store.cipher.Seal(data)
+		if err != nil {
+			return err
+		}
+	}
+	return store.rclient.HSet(templatesKey, job.Jid, data).Err()
+}
+
+// Template returns the template with the given JID or nil if there is
+// no such template.
+func (store *redisStore) Template(jid string) (*client.Job, error) {
+	data, err := store.rclient.HGet(templatesKey, jid).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if store.cipher != nil {
+		opened, err := store.cipher.Open(data)
+		if err == nil {
+			data = opened
+		} else if err != ErrUnencrypted {
+			return nil, err
+		}
+	}
+
+	var job client.Job
+	err = json.Unmarshal(data, &job)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
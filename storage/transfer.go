@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/util"
+	"github.com/go-redis/redis"
+)
+
+// Queues which can move a job to another queue atomically.
+type Transferable interface {
+	// Pop the next job and push it onto dst with its queue updated,
+	// in a single transaction.  Returns nil if the queue is empty.
+	TransferTo(dst Queue) (*client.Job, error)
+}
+
+// Retry the transaction a few times if another client changes the
+// source queue while we're looking at it.
+const maxTransferAttempts = 10
+
+func (q *redisQueue) TransferTo(dst Queue) (*client.Job, error) {
+	keys := q.keys()
+	for i := 0; i < maxTransferAttempts; i++ {
+		var job *client.Job
+		err := q.store.rclient.Watch(func(tx *redis.Tx) error {
+			var err error
+			job, err = q.transfer(tx, keys, dst)
+			return err
+		}, keys...)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		return job, err
+	}
+	return nil, fmt.Errorf("Unable to transfer from %s, the queue is too busy", q.name)
+}
+
+func (q *redisQueue) transfer(tx *redis.Tx, keys []string, dst Queue) (*client.Job, error) {
+	for _, key := range keys {
+		// the tail is the next element RPOP returns
+		val, err := tx.LIndex(key, -1).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := q.open([]byte(val))
+		if err != nil {
+			return nil, err
+		}
+		var job client.Job
+		err = json.Unmarshal(data, &job)
+		if err != nil {
+			return nil, err
+		}
+		job.Queue = dst.Name()
+		job.EnqueuedAt = util.Nows()
+		data, err = json.Marshal(&job)
+		if err != nil {
+			return nil, err
+		}
+		data, err = q.seal(data)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.TxPipelined(func(pipe redis.Pipeliner) error {
+			pipe.RPop(key)
+			pipe.LPush(priorityKey(dst.Name(), job.Priority), data)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &job, nil
+	}
+	return nil, nil
+}
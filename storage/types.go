@@ -9,10 +9,20 @@ import (
 )
 
 type BackupInfo struct {
-	Id        int64
-	FileCount int32
-	Size      int64
-	Timestamp int64
+	// the time of the backup in milliseconds since the epoch
+	Id        int64  `json:"id"`
+	FileCount int32  `json:"file_count"`
+	Size      int64  `json:"size"`
+	Timestamp int64  `json:"timestamp"`
+	Path      string `json:"path"`
+}
+
+// Stores which can back up their data while running, see backup.go.
+type Backupable interface {
+	Backup(dest string) (*BackupInfo, error)
+	Backups() ([]*BackupInfo, error)
+	// Restore the backup when the store next boots.
+	Restore(id int64) error
 }
 
 type Store interface {
@@ -21,18 +31,32 @@ type Store interface {
 	Scheduled() SortedSet
 	Working() SortedSet
 	Dead() SortedSet
+	// Recently acknowledged jobs, scored by completion time.
+	Completed() SortedSet
+	// Jobs waiting for their depends_on, scored by when they give up.
+	Waiting() SortedSet
 	GetQueue(string) (Queue, error)
 	EachQueue(func(Queue))
 	Stats() map[string]string
+	ParsedStats() (map[string]interface{}, error)
 	EnqueueAll(SortedSet) error
 	EnqueueFrom(SortedSet, []byte) error
 	PausedQueues() ([]string, error)
+	DeclareQueue(name string, cfg QueueConfig) error
+	QueueConfigs() (map[string]QueueConfig, error)
+	PushTemplate(job *client.Job) error
+	Template(jid string) (*client.Job, error)
+	Lock(name, holder string, ttl time.Duration) (bool, error)
+	Unlock(name, holder string) (bool, error)
 
 	History(days int, fn func(day string, procCnt uint64, failCnt uint64)) error
 	Success() error
 	Failure() error
 	TotalProcessed() uint64
 	TotalFailures() uint64
+	// Zero the totals, returning the processed and failure counts
+	// from before.
+	ResetStats() (uint64, uint64, error)
 
 	// Clear the database of all job data.
 	// Equivalent to Redis's FLUSHDB
@@ -46,6 +70,14 @@ type Redis interface {
 	Redis() *redis.Client
 }
 
+// Stores which can encrypt enqueued job payloads at rest.  Once a
+// cipher is set, payloads are sealed when pushed and opened when read
+// through the Queue interface.
+type Encryptable interface {
+	SetCipher(pc *PayloadCipher)
+	Cipher() *PayloadCipher
+}
+
 type Queue interface {
 	Name() string
 	Size() uint64
@@ -60,13 +92,42 @@ type Queue interface {
 	Pop() ([]byte, error)
 	BPop(context.Context) ([]byte, error)
 	Clear() (uint64, error)
+	// Remove every job in a single transaction, keeping the queue and
+	// its paused state.  Returns the number of jobs removed.
+	Flush() (uint64, error)
 
 	Each(func(index int, data []byte) error) error
 	Page(start int64, count int64, fn func(index int, data []byte) error) error
+	// The next n payloads in the order they'll be fetched, without
+	// removing them.
+	Peek(n int) ([][]byte, error)
 
 	Delete(keys [][]byte) error
 }
 
+// A PriorityQueue allows jobs to be pushed with a priority from
+// MinPriority to MaxPriority.  Higher priority jobs are fetched first,
+// lower priority jobs are fetched when nothing of higher priority is waiting.
+type PriorityQueue interface {
+	Queue
+
+	PushPriority(priority int, data []byte) error
+	// Push onto the tail of the queue so it's the next job fetched
+	// at that priority.
+	PushBack(priority int, data []byte) error
+	// Remove and return the first of the next +limit+ jobs, in the
+	// order they'd be fetched, which +match+ accepts so a job no worker
+	// can take doesn't hold up the jobs behind it.  +match+ is given
+	// the opened payload, the stored payload is returned as a fetch
+	// would.  Nil if none match.
+	TakeMatching(limit int, match func(data []byte) bool) ([]byte, error)
+	// Push unless the queue already holds +limit+ jobs, checked in the
+	// same transaction.  If it's full and +dropNext+ is set, the next
+	// job to be fetched is removed to make room and returned opened,
+	// otherwise it fails with ErrQueueFull.
+	PushBounded(priority int, data []byte, limit uint64, dropNext bool) ([]byte, error)
+}
+
 type SortedEntry interface {
 	Value() []byte
 	Key() ([]byte, error)
@@ -77,6 +138,9 @@ type SortedSet interface {
 	Name() string
 	Size() uint64
 	Clear() error
+	// Remove every element in a single transaction.  Returns the
+	// number of elements removed.
+	Flush() (uint64, error)
 
 	Add(job *client.Job) error
 	AddElement(timestamp string, jid string, payload []byte) error
@@ -94,9 +158,18 @@ type SortedSet interface {
 	RemoveElement(timestamp string, jid string) (bool, error)
 	RemoveBefore(timestamp string, maxCount int64, fn func(data []byte) error) (int64, error)
 	RemoveEntry(ent SortedEntry) error
+	// Replace the payload of the element with the given timestamp and
+	// jid in a single transaction.  Returns false if the element isn't
+	// in this SortedSet.
+	ReplaceElement(timestamp string, jid string, payload []byte) (bool, error)
 
 	// Move the given key from this SortedSet to the given
 	// SortedSet atomically.  The given func may mutate the payload and
 	// return a new tstamp.
 	MoveTo(sset SortedSet, entry SortedEntry, newtime time.Time) error
+
+	// Move the element with the given timestamp and jid to dst, keeping
+	// its timestamp, in a single transaction.  Returns false if the
+	// element isn't in this SortedSet, e.g. another client moved it first.
+	MoveIfPresent(timestamp string, jid string, dst SortedSet) (bool, error)
 }
@@ -3,6 +3,7 @@ package util
 import (
 	"fmt"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -44,6 +45,7 @@ var lvlPrefix = [...]string{
 var (
 	LogInfo  = false
 	LogDebug = false
+	levelMu  sync.RWMutex
 	logg     = os.Stdout
 	colorize = isTTY(logg.Fd())
 )
@@ -68,15 +70,25 @@ func llog(lvl Level, msg string) {
 // Logging functions
 //
 
+// May be called again to change the level, e.g. on reload.
 func InitLogger(level string) {
-	if level == "info" {
-		LogInfo = true
-	}
+	levelMu.Lock()
+	defer levelMu.Unlock()
+	LogInfo = level == "info" || level == "debug"
+	LogDebug = level == "debug"
+}
 
-	if level == "debug" {
-		LogInfo = true
-		LogDebug = true
-	}
+// InfoEnabled and DebugEnabled may be called while InitLogger changes the level.
+func InfoEnabled() bool {
+	levelMu.RLock()
+	defer levelMu.RUnlock()
+	return LogInfo
+}
+
+func DebugEnabled() bool {
+	levelMu.RLock()
+	defer levelMu.RUnlock()
+	return LogDebug
 }
 
 func Error(msg string, err error) {
@@ -94,14 +106,14 @@ func Warnf(msg string, args ...interface{}) {
 
 // Typical logging output, the default level
 func Info(arg string) {
-	if LogInfo {
+	if InfoEnabled() {
 		llog(InfoLevel, arg)
 	}
 }
 
 // Typical logging output, the default level
 func Infof(msg string, args ...interface{}) {
-	if LogInfo {
+	if InfoEnabled() {
 		llog(InfoLevel, fmt.Sprintf(msg, args...))
 	}
 }
@@ -109,7 +121,7 @@ func Infof(msg string, args ...interface{}) {
 // Verbosity level helps track down production issues:
 //  -l debug
 func Debug(arg string) {
-	if LogDebug {
+	if DebugEnabled() {
 		llog(DebugLevel, arg)
 	}
 }
@@ -117,7 +129,7 @@ func Debug(arg string) {
 // Verbosity level helps track down production issues:
 //  -l debug
 func Debugf(msg string, args ...interface{}) {
-	if LogDebug {
+	if DebugEnabled() {
 		llog(DebugLevel, fmt.Sprintf(msg, args...))
 	}
 }
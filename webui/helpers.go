@@ -229,14 +229,39 @@ func actOn(req *http.Request, set storage.SortedSet, action string, keys []strin
 	switch action {
 	case "delete":
 		if len(keys) == 1 && keys[0] == "all" {
-			return set.Clear()
+			mgr := ctx(req).Server().Manager()
+			jobs, err := mgr.SetJobs(set)
+			if err != nil {
+				return err
+			}
+			err = set.Clear()
+			if err != nil {
+				return err
+			}
+			for _, job := range jobs {
+				mgr.Removed(job)
+			}
+			return nil
 		} else {
 			for idx := range keys {
-				_, err := set.Remove([]byte(keys[idx]))
-				// ok doesn't really matter
+				entry, err := set.Get([]byte(keys[idx]))
+				if err != nil {
+					return err
+				}
+				if entry == nil {
+					continue
+				}
+				job, err := entry.Job()
+				if err != nil {
+					return err
+				}
+				ok, err := set.Remove([]byte(keys[idx]))
 				if err != nil {
 					return err
 				}
+				if ok {
+					ctx(req).Server().Manager().Removed(job)
+				}
 			}
 			return nil
 		}
@@ -265,10 +290,15 @@ func actOn(req *http.Request, set storage.SortedSet, action string, keys []strin
 					return err
 				}
 				if entry != nil {
+					job, err := entry.Job()
+					if err != nil {
+						return err
+					}
 					err = set.MoveTo(ctx(req).Store().Dead(), entry, expiry)
 					if err != nil {
 						return err
 					}
+					ctx(req).Server().Manager().Removed(job)
 				}
 			}
 			return nil
@@ -9,6 +9,7 @@ import (
 	"regexp"
 	"strconv"
 
+	"github.com/contribsys/faktory/client"
 	"github.com/contribsys/faktory/server"
 )
 
@@ -65,6 +66,7 @@ func queueHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		mgr := ctx(r).Server().Manager()
 		keys := r.Form["bkey"]
 		if len(keys) > 0 {
 			// delete specific entries
@@ -82,15 +84,29 @@ func queueHandler(w http.ResponseWriter, r *http.Request) {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
+			for idx := range bkeys {
+				var job client.Job
+				if json.Unmarshal(bkeys[idx], &job) == nil {
+					mgr.Removed(&job)
+				}
+			}
 		} else {
 			action := r.FormValue("action")
 			if action == "delete" {
 				// clear entire queue
-				_, err := q.Clear()
+				jobs, err := mgr.QueueJobs(q)
 				if err != nil {
 					http.Error(w, err.Error(), http.StatusInternalServerError)
 					return
 				}
+				_, err = q.Clear()
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				for _, job := range jobs {
+					mgr.Removed(job)
+				}
 			} else if action == "pause" {
 				err := ctx(r).webui.Server.Manager().Pause(q.Name())
 				if err != nil {
@@ -0,0 +1,216 @@
+// Package worker runs jobs fetched from a Faktory server.
+//
+// A Pool runs a number of goroutines which each fetch a job, pass it
+// to the handler and ACK or FAIL it depending on the result.  The pool
+// sends BEAT every 15 seconds and follows the lifecycle the server asks
+// for: once quiet it stops fetching, once told to terminate (or on
+// SIGTERM or SIGINT) it finishes the jobs in progress and returns.
+//
+//	pool := worker.NewPool(10, []string{"critical", "default"}, func(job *client.Job) error {
+//		...
+//	})
+//	err := pool.Run()
+//
+// The server's address and password are read from FAKTORY_URL, see
+// client.Open.
+package worker
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/contribsys/faktory/util"
+)
+
+const (
+	beatInterval = 15 * time.Second
+	// how long a fetcher waits before opening its connection again
+	reopenInterval = 1 * time.Second
+)
+
+type Pool struct {
+	concurrency int
+	queues      []string
+	handler     func(*client.Job) error
+	// identifies this process to the server, client.RandomProcessWid
+	// if it's set
+	wid string
+
+	// opens each goroutine's connection as +wid+, openShared by default
+	open func(wid string) (*client.SharedClient, error)
+
+	quietOnce sync.Once
+	quiet     chan struct{}
+	stopOnce  sync.Once
+	done      chan struct{}
+}
+
+func NewPool(concurrency int, queues []string, handler func(*client.Job) error) *Pool {
+	if len(queues) == 0 {
+		queues = []string{"default"}
+	}
+	// without a wid the server treats us as a producer
+	wid := client.RandomProcessWid
+	if wid == "" {
+		wid = client.RandomJid()
+	}
+	return &Pool{
+		concurrency: concurrency,
+		queues:      queues,
+		handler:     handler,
+		wid:         wid,
+		open:        openShared,
+		quiet:       make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Connect following the conventions of client.Open.
+func openShared(wid string) (*client.SharedClient, error) {
+	srv := client.DefaultServer()
+	if err := srv.ReadFromEnv(); err != nil {
+		return nil, fmt.Errorf("cannot read configuration from env: %w", err)
+	}
+	srv.Wid = wid
+	return srv.OpenShared()
+}
+
+// Run fetches and runs jobs until the pool is stopped, then waits for
+// the jobs in progress to finish.
+func (p *Pool) Run() error {
+	if p.concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1, not %d", p.concurrency)
+	}
+
+	beater, err := p.open(p.wid)
+	if err != nil {
+		return err
+	}
+	defer beater.Close()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+
+	var wg sync.WaitGroup
+	for idx := 0; idx < p.concurrency; idx++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.fetchLoop()
+		}()
+	}
+
+	ticker := time.NewTicker(beatInterval)
+	defer ticker.Stop()
+loop:
+	for {
+		select {
+		case <-signals:
+			p.Stop()
+		case <-ticker.C:
+			p.beat(beater)
+		case <-p.done:
+			break loop
+		}
+	}
+
+	wg.Wait()
+	return nil
+}
+
+// Quiet stops fetching new jobs, the jobs in progress still finish.
+func (p *Pool) Quiet() {
+	p.quietOnce.Do(func() { close(p.quiet) })
+}
+
+// Stop stops fetching new jobs and makes Run return once the jobs in
+// progress finish.
+func (p *Pool) Stop() {
+	p.Quiet()
+	p.stopOnce.Do(func() { close(p.done) })
+}
+
+func (p *Pool) beat(beater *client.SharedClient) {
+	state, err := beater.Heartbeat()
+	if err != nil {
+		util.Warnf("Unable to send heartbeat: %v", err)
+		return
+	}
+	switch state {
+	case "quiet":
+		p.Quiet()
+	case "terminate":
+		p.Stop()
+	}
+}
+
+func (p *Pool) stopping() bool {
+	select {
+	case <-p.quiet:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Pool) fetchLoop() {
+	var cl *client.SharedClient
+	defer func() {
+		if cl != nil {
+			cl.Close()
+		}
+	}()
+
+	for !p.stopping() {
+		if cl == nil {
+			var err error
+			cl, err = p.open(p.wid)
+			if err != nil {
+				util.Warnf("Unable to connect: %v", err)
+				time.Sleep(reopenInterval)
+				continue
+			}
+		}
+
+		job, err := cl.Pop(p.queues...)
+		if err != nil {
+			util.Warnf("Unable to fetch: %v", err)
+			time.Sleep(reopenInterval)
+			continue
+		}
+		if job == nil {
+			continue
+		}
+		p.perform(cl, job)
+	}
+}
+
+// Run the handler, a panic fails the job rather than the process.
+func (p *Pool) perform(cl *client.SharedClient, job *client.Job) {
+	var backtrace []byte
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+				backtrace = debug.Stack()
+			}
+		}()
+		return p.handler(job)
+	}()
+
+	if err == nil {
+		err = cl.Ack(job.Jid)
+	} else {
+		err = cl.Fail(job.Jid, err, backtrace)
+	}
+	if err != nil {
+		util.Warnf("Unable to report job %s: %v", job.Jid, err)
+	}
+}
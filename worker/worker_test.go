@@ -0,0 +1,189 @@
+package worker
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/contribsys/faktory/client"
+	"github.com/stretchr/testify/assert"
+)
+
+// A server which hands out +jobs+ and records the commands it receives.
+type fakeServer struct {
+	net.Listener
+
+	mu       sync.Mutex
+	jobs     []*client.Job
+	commands []string
+	wids     []string
+	beat     string
+}
+
+func newFakeServer(t *testing.T, jobs ...*client.Job) *fakeServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	fs := &fakeServer{Listener: l, jobs: jobs, beat: "OK"}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go fs.serve(conn)
+		}
+	}()
+	return fs
+}
+
+func (fs *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	rdr := bufio.NewReader(conn)
+	_, _ = conn.Write([]byte("+HI {\"v\":2}\r\n"))
+
+	for {
+		line, err := rdr.ReadString('\n')
+		if err != nil {
+			return
+		}
+		verb := strings.Fields(line)[0]
+
+		fs.mu.Lock()
+		fs.commands = append(fs.commands, verb)
+		if verb == "HELLO" || verb == "BEAT" {
+			var hash map[string]interface{}
+			_ = json.Unmarshal([]byte(line[len(verb):]), &hash)
+			wid, _ := hash["wid"].(string)
+			fs.wids = append(fs.wids, wid)
+		}
+		var reply string
+		switch verb {
+		case "FETCH":
+			if len(fs.jobs) == 0 {
+				fs.mu.Unlock()
+				time.Sleep(10 * time.Millisecond)
+				fs.mu.Lock()
+				reply = "$-1\r\n"
+				break
+			}
+			data, _ := json.Marshal(fs.jobs[0])
+			fs.jobs = fs.jobs[1:]
+			reply = fmt.Sprintf("$%d\r\n%s\r\n", len(data), data)
+		case "BEAT":
+			if fs.beat == "OK" {
+				reply = "+OK\r\n"
+			} else {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(fs.beat), fs.beat)
+			}
+		default:
+			reply = "+OK\r\n"
+		}
+		fs.mu.Unlock()
+		_, _ = conn.Write([]byte(reply))
+	}
+}
+
+func (fs *fakeServer) count(verb string) int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	count := 0
+	for _, cmd := range fs.commands {
+		if cmd == verb {
+			count++
+		}
+	}
+	return count
+}
+
+func TestPoolRunsJobs(t *testing.T) {
+	fs := newFakeServer(t, client.NewJob("Good", 1), client.NewJob("Bad", 2))
+	defer fs.Close()
+
+	var mu sync.Mutex
+	ran := []string{}
+	pool := NewPool(2, nil, func(job *client.Job) error {
+		mu.Lock()
+		ran = append(ran, job.Type)
+		mu.Unlock()
+		if job.Type == "Bad" {
+			panic("oops")
+		}
+		return nil
+	})
+	pool.open = func(wid string) (*client.SharedClient, error) {
+		srv := client.DefaultServer()
+		srv.Address = fs.Addr().String()
+		srv.Wid = wid
+		return srv.OpenShared()
+	}
+	assert.Equal(t, []string{"default"}, pool.queues)
+
+	errs := make(chan error, 1)
+	go func() { errs <- pool.Run() }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for fs.count("ACK") < 1 || fs.count("FAIL") < 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("jobs were not reported")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	pool.Stop()
+	select {
+	case err := <-errs:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after Stop")
+	}
+	assert.ElementsMatch(t, []string{"Good", "Bad"}, ran)
+
+	// every connection identifies as the pool, the global is untouched
+	assert.Empty(t, client.RandomProcessWid)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	assert.NotEmpty(t, fs.wids)
+	for _, wid := range fs.wids {
+		assert.Equal(t, pool.wid, wid)
+	}
+}
+
+func TestPoolFollowsHeartbeat(t *testing.T) {
+	fs := newFakeServer(t)
+	defer fs.Close()
+
+	pool := NewPool(1, []string{"critical"}, func(*client.Job) error { return nil })
+	beater, err := client.DialShared(fs.Addr().String(), "")
+	assert.NoError(t, err)
+	defer beater.Close()
+
+	pool.beat(beater)
+	assert.False(t, pool.stopping())
+
+	fs.mu.Lock()
+	fs.beat = `{"state":"quiet"}`
+	fs.mu.Unlock()
+	pool.beat(beater)
+	assert.True(t, pool.stopping())
+	select {
+	case <-pool.done:
+		t.Fatal("quiet should not stop the pool")
+	default:
+	}
+
+	fs.mu.Lock()
+	fs.beat = `{"state":"terminate"}`
+	fs.mu.Unlock()
+	pool.beat(beater)
+	<-pool.done
+}
+
+func TestPoolRequiresConcurrency(t *testing.T) {
+	pool := NewPool(0, nil, func(*client.Job) error { return nil })
+	assert.Error(t, pool.Run())
+}